@@ -0,0 +1,356 @@
+// Package client is a Go client for the cache server's HTTP API.
+package client
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ErrNotFound is returned, wrapped in an *APIError, when a key is missing
+// or expired. Use errors.Is to test for it.
+var ErrNotFound = errors.New("key not found")
+
+// APIError is a request the server answered with an error status.
+type APIError struct {
+    StatusCode int
+    Message    string
+}
+
+func (e *APIError) Error() string {
+    return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Is makes errors.Is(err, ErrNotFound) true for 404 responses.
+func (e *APIError) Is(target error) bool {
+    return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// TransportError is a request that got no response from the server, such
+// as one whose connection was refused or timed out. Err is the underlying
+// error.
+type TransportError struct {
+    Method string
+    URL    string
+    Err    error
+}
+
+// Error returns Err's message, which for errors from net/http already
+// names the method and URL.
+func (e *TransportError) Error() string {
+    return e.Err.Error()
+}
+
+func (e *TransportError) Unwrap() error {
+    return e.Err
+}
+
+// Client sends requests to a cache server. Its fields must not be changed
+// while requests are in flight.
+//
+// Idempotent requests (Get, Delete, Stats and State) are retried after a
+// transport error or a 429, 502, 503 or 504 response, up to MaxRetries
+// times, waiting RetryDelay before the first retry and twice as long
+// before each following one. Set is never retried.
+type Client struct {
+    // BaseURL is the server's address, such as http://localhost:3000.
+    BaseURL string
+    // APIKey, if set, is sent in the X-API-Key header.
+    APIKey string
+    // HTTPClient is used to send requests; http.DefaultClient if nil.
+    HTTPClient *http.Client
+    // MaxRetries is how many times an idempotent request is retried.
+    MaxRetries int
+    // RetryDelay is the wait before the first retry.
+    RetryDelay time.Duration
+}
+
+// New returns a client for the server at baseURL, authenticating with
+// apiKey unless it is empty. Each attempt at a request is bounded by
+// timeout, if positive, besides the context passed to the methods. Failed
+// idempotent requests are retried twice, after 100ms and 200ms.
+func New(baseURL, apiKey string, timeout time.Duration) *Client {
+    return &Client{
+        BaseURL:    strings.TrimRight(baseURL, "/"),
+        APIKey:     apiKey,
+        HTTPClient: &http.Client{Timeout: timeout},
+        MaxRetries: 2,
+        RetryDelay: 100 * time.Millisecond,
+    }
+}
+
+// Entry is a live cache entry as listed by State. Value is the JSON the
+// server holds for it. Expiration is the zero time for entries that never
+// expire.
+type Entry struct {
+    Key        string          `json:"key"`
+    Value      json.RawMessage `json:"value"`
+    Expiration time.Time       `json:"expiration"`
+}
+
+// StateOptions selects a page of State. Entries are listed in key order,
+// starting after the key After, and at most Limit of them, or all the
+// remaining ones if Limit is not positive. Only keys starting with Prefix
+// are listed.
+type StateOptions struct {
+    Prefix string
+    After  string
+    Limit  int
+}
+
+// Stats are the cache counters reported by the server.
+type Stats struct {
+    Hits        uint64  `json:"hits"`
+    Misses      uint64  `json:"misses"`
+    HitRatio    float64 `json:"hit_ratio"`
+    Inserts     uint64  `json:"inserts"`
+    Updates     uint64  `json:"updates"`
+    Deletes     uint64  `json:"deletes"`
+    Evictions   uint64  `json:"evictions"`
+    Expirations uint64  `json:"expirations"`
+    Clears      uint64  `json:"clears"`
+    Size        int     `json:"size"`
+    Capacity    int     `json:"capacity"`
+    BytesUsed   int64   `json:"bytes_used"`
+    MaxBytes    int64   `json:"max_bytes"`
+}
+
+// Get returns the JSON value stored for key. found is false, with a nil
+// error, if the key is missing or expired.
+func (c *Client) Get(ctx context.Context, key string) (value json.RawMessage, found bool, err error) {
+    var body struct {
+        Value json.RawMessage `json:"value"`
+    }
+    err = c.do(ctx, http.MethodGet, keyPath(key), nil, &body)
+    if errors.Is(err, ErrNotFound) {
+        return nil, false, nil
+    }
+    if err != nil {
+        return nil, false, err
+    }
+    return body.Value, true, nil
+}
+
+// Set stores value, which must encode to JSON, for key. The server counts
+// expirations in whole seconds, so a positive ttl is rounded up to the
+// next second; zero stores the entry without a TTL.
+func (c *Client) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+    if ttl < 0 {
+        return fmt.Errorf("negative ttl %s", ttl)
+    }
+    return c.do(ctx, http.MethodPost, keyPath(key), setBody(value, ttl), nil)
+}
+
+// Item is an entry written by SetMany. TTL is rounded up to whole seconds
+// as by Set; zero stores the entry without a TTL.
+type Item struct {
+    Key   string
+    Value interface{}
+    TTL   time.Duration
+}
+
+// GetMany returns the JSON values stored for keys, leaving out those that
+// are missing or expired. The server has no batch read, so the keys are
+// read one at a time; the first error ends the reads and is returned with
+// the values read until then.
+func (c *Client) GetMany(ctx context.Context, keys []string) (map[string]json.RawMessage, error) {
+    values := make(map[string]json.RawMessage, len(keys))
+    for _, key := range keys {
+        value, found, err := c.Get(ctx, key)
+        if err != nil {
+            return values, err
+        }
+        if found {
+            values[key] = value
+        }
+    }
+    return values, nil
+}
+
+// SetMany stores items in one request, which succeeds or fails as a whole.
+// Like Set it is never retried.
+func (c *Client) SetMany(ctx context.Context, items []Item) error {
+    body := make([]map[string]interface{}, len(items))
+    for i, item := range items {
+        if item.TTL < 0 {
+            return fmt.Errorf("negative ttl %s for %q", item.TTL, item.Key)
+        }
+        body[i] = setBody(item.Value, item.TTL)
+        body[i]["key"] = item.Key
+    }
+    return c.do(ctx, http.MethodPost, "/cache-views/batch", body, nil)
+}
+
+// Delete removes key. It fails with ErrNotFound if no live entry existed,
+// which includes a retry finding the key already deleted by an attempt
+// whose response was lost.
+func (c *Client) Delete(ctx context.Context, key string) error {
+    return c.do(ctx, http.MethodDelete, keyPath(key), nil, nil)
+}
+
+// Stats returns the server's cache counters.
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+    var body struct {
+        Cache Stats `json:"cache"`
+    }
+    err := c.do(ctx, http.MethodGet, "/stats", nil, &body)
+    return body.Cache, err
+}
+
+// State lists a page of the live entries, as selected by opts. next is
+// the After to request the following page with, or empty after the last
+// page.
+func (c *Client) State(ctx context.Context, opts StateOptions) (entries []Entry, next string, err error) {
+    query := url.Values{}
+    if opts.Prefix != "" {
+        query.Set("prefix", opts.Prefix)
+    }
+    if opts.After != "" {
+        query.Set("after", opts.After)
+    }
+    if opts.Limit > 0 {
+        query.Set("limit", strconv.Itoa(opts.Limit))
+    }
+    if err := c.do(ctx, http.MethodGet, "/cache-state?"+query.Encode(), nil, &entries); err != nil {
+        return nil, "", err
+    }
+    // The server only sorts the entries when asked for a page.
+    if opts.After == "" && opts.Limit <= 0 {
+        sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+    }
+    if opts.Limit > 0 && len(entries) == opts.Limit {
+        next = entries[len(entries)-1].Key
+    }
+    return entries, next, nil
+}
+
+// setBody returns the body of a write of value with ttl. The server
+// expires an entry written with a zero expiration at once unless it is
+// asked to persist it.
+func setBody(value interface{}, ttl time.Duration) map[string]interface{} {
+    if ttl == 0 {
+        return map[string]interface{}{"value": value, "persist": true}
+    }
+    return map[string]interface{}{"value": value, "expiration": int64((ttl + time.Second - 1) / time.Second)}
+}
+
+func keyPath(key string) string {
+    return "/cache/" + url.PathEscape(key)
+}
+
+// do sends a request with in, if not nil, as its JSON body, and decodes a
+// successful response into out, if not nil. Error statuses are returned
+// as an *APIError carrying the server's error message, and requests that
+// got no response as a *TransportError. GET and DELETE requests are
+// retried as described on Client.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+    var data []byte
+    if in != nil {
+        var err error
+        if data, err = json.Marshal(in); err != nil {
+            return err
+        }
+    }
+    idempotent := method == http.MethodGet || method == http.MethodDelete
+
+    delay := c.RetryDelay
+    for attempt := 0; ; attempt++ {
+        err := c.send(ctx, method, path, data, out)
+        if !idempotent || attempt >= c.MaxRetries || ctx.Err() != nil || !retryable(err) {
+            return err
+        }
+        timer := time.NewTimer(delay)
+        select {
+        case <-timer.C:
+        case <-ctx.Done():
+            timer.Stop()
+            return err
+        }
+        delay *= 2
+    }
+}
+
+// send makes one attempt at a request for do. data is the JSON body, if
+// not nil.
+func (c *Client) send(ctx context.Context, method, path string, data []byte, out interface{}) error {
+    var body io.Reader
+    if data != nil {
+        body = bytes.NewReader(data)
+    }
+    req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Accept", "application/json")
+    if data != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    if c.APIKey != "" {
+        req.Header.Set("X-API-Key", c.APIKey)
+    }
+
+    httpClient := c.HTTPClient
+    if httpClient == nil {
+        httpClient = http.DefaultClient
+    }
+    resp, err := httpClient.Do(req)
+    if err != nil {
+        return &TransportError{Method: method, URL: req.URL.String(), Err: err}
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        return responseError(resp)
+    }
+    if out == nil {
+        return nil
+    }
+    if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+        return fmt.Errorf("decode response: %w", err)
+    }
+    return nil
+}
+
+// retryable reports whether a request that failed with err may succeed if
+// sent again: it got no response, or the server reported being overloaded
+// or unavailable.
+func retryable(err error) bool {
+    var transportErr *TransportError
+    if errors.As(err, &transportErr) {
+        return true
+    }
+    var apiErr *APIError
+    if errors.As(err, &apiErr) {
+        switch apiErr.StatusCode {
+        case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+            return true
+        }
+    }
+    return false
+}
+
+// responseError returns the *APIError for an error response, taking the
+// message from its "error" field when there is one.
+func responseError(resp *http.Response) error {
+    data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+    var body struct {
+        Error string `json:"error"`
+    }
+    message := strings.TrimSpace(string(data))
+    if json.Unmarshal(data, &body) == nil && body.Error != "" {
+        message = body.Error
+    }
+    if message == "" {
+        message = http.StatusText(resp.StatusCode)
+    }
+    return &APIError{StatusCode: resp.StatusCode, Message: message}
+}
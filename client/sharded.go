@@ -0,0 +1,309 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "hash/fnv"
+    "net/http"
+    "sort"
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// DefaultVirtualNodes is the number of points each node gets on the hash
+// ring of a ShardedClient unless configured otherwise.
+const DefaultVirtualNodes = 160
+
+// ShardedClient spreads keys across several cache servers, each holding
+// its own share of the keys, without a proxy. Every key is owned by one
+// node, chosen with a consistent hash ring: each node is placed on the
+// ring at virtual points, and a key belongs to the node of the first point
+// at or after the key's hash. Adding or removing a node therefore only
+// moves about 1/N of the keys, those of the points it gains or loses.
+//
+// A node that fails MaxFailures requests in a row without a response, or
+// with a 502, 503 or 504, is ejected for EjectFor: its keys go to the next
+// node on the ring, where they miss until written again, and it rejoins
+// once EjectFor has passed or a health check, see StartHealthChecks,
+// succeeds. If every node is ejected, keys go to their owners anyway.
+// The fields must not be changed while requests are in flight.
+type ShardedClient struct {
+    // MaxFailures is the number of consecutive failures that eject a
+    // node. Zero never ejects.
+    MaxFailures int
+    // EjectFor is how long an ejected node is left out.
+    EjectFor time.Duration
+
+    nodes []*shardNode
+    ring  []ringPoint
+}
+
+// shardNode is a node of a ShardedClient.
+type shardNode struct {
+    client *Client
+    // failures counts consecutive failed requests and ejectedUntil is
+    // the time, in Unix nanoseconds, before which the node is left out.
+    failures     atomic.Int64
+    ejectedUntil atomic.Int64
+}
+
+// ringPoint is a virtual node: the point hash on the ring belongs to the
+// node at index node.
+type ringPoint struct {
+    hash uint64
+    node int
+}
+
+// NodeStatus describes a node of a ShardedClient.
+type NodeStatus struct {
+    URL      string
+    Ejected  bool
+    Failures int
+}
+
+// NewSharded returns a client spreading keys across the servers at
+// baseURLs, each reached through a Client configured as by New with
+// apiKey and timeout. Each node is placed at virtualNodes points on the
+// ring, DefaultVirtualNodes if it is not positive; more points spread keys
+// more evenly. Nodes are identified on the ring by their URL, so the same
+// URLs map keys the same way in every process, whatever their order. Nodes
+// are ejected after 3 consecutive failures, for 30 seconds. baseURLs must
+// not be empty.
+func NewSharded(baseURLs []string, apiKey string, timeout time.Duration, virtualNodes int) *ShardedClient {
+    if virtualNodes <= 0 {
+        virtualNodes = DefaultVirtualNodes
+    }
+    s := &ShardedClient{MaxFailures: 3, EjectFor: 30 * time.Second}
+    for i, baseURL := range baseURLs {
+        node := &shardNode{client: New(baseURL, apiKey, timeout)}
+        s.nodes = append(s.nodes, node)
+        for v := 0; v < virtualNodes; v++ {
+            s.ring = append(s.ring, ringPoint{hash: ringHash(node.client.BaseURL + "#" + strconv.Itoa(v)), node: i})
+        }
+    }
+    sort.Slice(s.ring, func(i, j int) bool {
+        if s.ring[i].hash == s.ring[j].hash {
+            return s.nodes[s.ring[i].node].client.BaseURL < s.nodes[s.ring[j].node].client.BaseURL
+        }
+        return s.ring[i].hash < s.ring[j].hash
+    })
+    return s
+}
+
+// ringHash hashes s onto the ring. FNV-1a is finished with the MurmurHash3
+// mixer so similar strings, such as the virtual node names, land far
+// apart.
+func ringHash(s string) uint64 {
+    h := fnv.New64a()
+    h.Write([]byte(s))
+    x := h.Sum64()
+    x ^= x >> 33
+    x *= 0xff51afd7ed558ccd
+    x ^= x >> 33
+    x *= 0xc4ceb9fe1a85ec53
+    x ^= x >> 33
+    return x
+}
+
+// Node returns the URL of the node key is currently sent to.
+func (s *ShardedClient) Node(key string) string {
+    return s.nodeFor(key, time.Now()).client.BaseURL
+}
+
+// Nodes returns the status of every node.
+func (s *ShardedClient) Nodes() []NodeStatus {
+    now := time.Now()
+    statuses := make([]NodeStatus, len(s.nodes))
+    for i, node := range s.nodes {
+        statuses[i] = NodeStatus{URL: node.client.BaseURL, Ejected: node.ejected(now), Failures: int(node.failures.Load())}
+    }
+    return statuses
+}
+
+// nodeFor returns the node key is sent to at now: the owner of the first
+// point at or after its hash, skipping ejected nodes.
+func (s *ShardedClient) nodeFor(key string, now time.Time) *shardNode {
+    hash := ringHash(key)
+    start := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= hash })
+    for i := 0; i < len(s.ring); i++ {
+        node := s.nodes[s.ring[(start+i)%len(s.ring)].node]
+        if !node.ejected(now) {
+            return node
+        }
+    }
+    return s.nodes[s.ring[start%len(s.ring)].node]
+}
+
+func (n *shardNode) ejected(now time.Time) bool {
+    return now.UnixNano() < n.ejectedUntil.Load()
+}
+
+// record counts the outcome of a request to n, ejecting it once it has
+// failed s.MaxFailures times in a row. Only failures suggesting the node
+// is down count: errors the server answered with, such as ErrNotFound,
+// show it is up.
+func (s *ShardedClient) record(n *shardNode, err error) {
+    if !nodeDown(err) {
+        n.failures.Store(0)
+        return
+    }
+    if failures := n.failures.Add(1); s.MaxFailures > 0 && failures >= int64(s.MaxFailures) {
+        n.ejectedUntil.Store(time.Now().Add(s.EjectFor).UnixNano())
+        n.failures.Store(0)
+    }
+}
+
+// nodeDown reports whether a request failing with err suggests the node
+// is down: it got no response, or a 502, 503 or 504.
+func nodeDown(err error) bool {
+    return retryable(err) && !isStatus(err, http.StatusTooManyRequests)
+}
+
+// isStatus reports whether err is an *APIError with the given status.
+func isStatus(err error, status int) bool {
+    var apiErr *APIError
+    return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// Get is Client.Get on the node owning key.
+func (s *ShardedClient) Get(ctx context.Context, key string) (value json.RawMessage, found bool, err error) {
+    node := s.nodeFor(key, time.Now())
+    value, found, err = node.client.Get(ctx, key)
+    s.record(node, err)
+    return value, found, err
+}
+
+// Set is Client.Set on the node owning key.
+func (s *ShardedClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+    node := s.nodeFor(key, time.Now())
+    err := node.client.Set(ctx, key, value, ttl)
+    s.record(node, err)
+    return err
+}
+
+// Delete is Client.Delete on the node owning key.
+func (s *ShardedClient) Delete(ctx context.Context, key string) error {
+    node := s.nodeFor(key, time.Now())
+    err := node.client.Delete(ctx, key)
+    s.record(node, err)
+    return err
+}
+
+// GetMany is Client.GetMany across the nodes: the keys are split by node,
+// each node's share is fetched concurrently, and the values found are
+// merged. If any node fails, the values found on the others are returned
+// with the first error.
+func (s *ShardedClient) GetMany(ctx context.Context, keys []string) (map[string]json.RawMessage, error) {
+    byNode := make(map[*shardNode][]string)
+    now := time.Now()
+    for _, key := range keys {
+        node := s.nodeFor(key, now)
+        byNode[node] = append(byNode[node], key)
+    }
+
+    values := make(map[string]json.RawMessage, len(keys))
+    var mutex sync.Mutex
+    var firstErr error
+    var wg sync.WaitGroup
+    for node, nodeKeys := range byNode {
+        wg.Add(1)
+        go func(node *shardNode, nodeKeys []string) {
+            defer wg.Done()
+            found, err := node.client.GetMany(ctx, nodeKeys)
+            s.record(node, err)
+
+            mutex.Lock()
+            defer mutex.Unlock()
+            for key, value := range found {
+                values[key] = value
+            }
+            if err != nil && firstErr == nil {
+                firstErr = err
+            }
+        }(node, nodeKeys)
+    }
+    wg.Wait()
+    return values, firstErr
+}
+
+// SetMany is Client.SetMany across the nodes: the items are split by
+// node and each node's share is written concurrently in one batch. Each
+// batch succeeds or fails as a whole; the first error is returned.
+func (s *ShardedClient) SetMany(ctx context.Context, items []Item) error {
+    byNode := make(map[*shardNode][]Item)
+    now := time.Now()
+    for _, item := range items {
+        node := s.nodeFor(item.Key, now)
+        byNode[node] = append(byNode[node], item)
+    }
+
+    var mutex sync.Mutex
+    var firstErr error
+    var wg sync.WaitGroup
+    for node, nodeItems := range byNode {
+        wg.Add(1)
+        go func(node *shardNode, nodeItems []Item) {
+            defer wg.Done()
+            err := node.client.SetMany(ctx, nodeItems)
+            s.record(node, err)
+
+            mutex.Lock()
+            defer mutex.Unlock()
+            if err != nil && firstErr == nil {
+                firstErr = err
+            }
+        }(node, nodeItems)
+    }
+    wg.Wait()
+    return firstErr
+}
+
+// StartHealthChecks checks every node with a Stats request each interval
+// until the returned stop function is called. A node failing a check
+// counts a failure, and an ejected node passing one rejoins at once.
+func (s *ShardedClient) StartHealthChecks(interval time.Duration) (stop func()) {
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ticker.C:
+                s.checkNodes(ctx)
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+    return func() {
+        cancel()
+        <-done
+    }
+}
+
+// checkNodes checks every node concurrently, without retries.
+func (s *ShardedClient) checkNodes(ctx context.Context) {
+    var wg sync.WaitGroup
+    for _, node := range s.nodes {
+        wg.Add(1)
+        go func(node *shardNode) {
+            defer wg.Done()
+            probe := *node.client
+            probe.MaxRetries = 0
+            _, err := probe.Stats(ctx)
+            if ctx.Err() != nil {
+                return
+            }
+            if err == nil {
+                node.ejectedUntil.Store(0)
+            }
+            s.record(node, err)
+        }(node)
+    }
+    wg.Wait()
+}
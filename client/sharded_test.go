@@ -0,0 +1,286 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// fakeNode is an httptest server answering the requests a ShardedClient
+// makes from an in-memory map, and recording the keys each request names.
+// While down is set it answers everything with 503.
+type fakeNode struct {
+    *httptest.Server
+    down atomic.Bool
+
+    mutex  sync.Mutex
+    values map[string]json.RawMessage
+    // requests holds the keys of every request, in the order received;
+    // a batch request is one entry.
+    requests [][]string
+}
+
+func startFakeNode(t *testing.T) *fakeNode {
+    n := &fakeNode{values: make(map[string]json.RawMessage)}
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /cache/{key}", func(w http.ResponseWriter, r *http.Request) {
+        key := r.PathValue("key")
+        n.mutex.Lock()
+        defer n.mutex.Unlock()
+        n.requests = append(n.requests, []string{key})
+        value, ok := n.values[key]
+        if !ok {
+            writeFakeJSON(w, http.StatusNotFound, map[string]string{"error": "key not found"})
+            return
+        }
+        writeFakeJSON(w, http.StatusOK, map[string]json.RawMessage{"value": value})
+    })
+    mux.HandleFunc("POST /cache-views/batch", func(w http.ResponseWriter, r *http.Request) {
+        var body []struct {
+            Key   string          `json:"key"`
+            Value json.RawMessage `json:"value"`
+        }
+        json.NewDecoder(r.Body).Decode(&body)
+        n.mutex.Lock()
+        defer n.mutex.Unlock()
+        var keys []string
+        for _, item := range body {
+            keys = append(keys, item.Key)
+            n.values[item.Key] = item.Value
+        }
+        n.requests = append(n.requests, keys)
+        writeFakeJSON(w, http.StatusOK, map[string]int{"count": len(body)})
+    })
+    mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+        writeFakeJSON(w, http.StatusOK, map[string]interface{}{"cache": map[string]interface{}{}})
+    })
+    n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if n.down.Load() {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            return
+        }
+        mux.ServeHTTP(w, r)
+    }))
+    t.Cleanup(n.Close)
+    return n
+}
+
+func writeFakeJSON(w http.ResponseWriter, code int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(body)
+}
+
+// keysReceived returns the sorted keys of every request n received and
+// forgets them.
+func (n *fakeNode) keysReceived() []string {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+    var keys []string
+    for _, request := range n.requests {
+        keys = append(keys, request...)
+    }
+    n.requests = nil
+    sort.Strings(keys)
+    return keys
+}
+
+// owners maps every key to the URL of the node s sends it to.
+func owners(s *ShardedClient, keys []string) map[string]string {
+    m := make(map[string]string, len(keys))
+    for _, key := range keys {
+        m[key] = s.Node(key)
+    }
+    return m
+}
+
+func testKeys(n int) []string {
+    keys := make([]string, n)
+    for i := range keys {
+        keys[i] = fmt.Sprintf("user:%d", i)
+    }
+    return keys
+}
+
+func TestShardedRemapsFewKeys(t *testing.T) {
+    keys := testKeys(20000)
+    urls := []string{"http://a:3000", "http://b:3000", "http://c:3000", "http://d:3000"}
+    before := owners(NewSharded(urls, "", 0, 0), keys)
+
+    // Keys spread evenly enough across the nodes.
+    counts := map[string]int{}
+    for _, url := range before {
+        counts[url]++
+    }
+    for _, url := range urls {
+        if share := float64(counts[url]) / float64(len(keys)); share < 0.15 || share > 0.35 {
+            t.Errorf("%s owns %.2f of the keys, want about 0.25", url, share)
+        }
+    }
+
+    // The order of the URLs does not matter.
+    reversed := []string{urls[3], urls[2], urls[1], urls[0]}
+    for key, url := range owners(NewSharded(reversed, "", 0, 0), keys) {
+        if before[key] != url {
+            t.Fatalf("%s maps to %s with the URLs reversed, %s otherwise", key, url, before[key])
+        }
+    }
+
+    // Adding a node moves about a fifth of the keys, all to it.
+    moved := 0
+    for key, url := range owners(NewSharded(append(urls, "http://e:3000"), "", 0, 0), keys) {
+        if url != before[key] {
+            moved++
+            if url != "http://e:3000" {
+                t.Fatalf("%s moved from %s to %s, not to the new node", key, before[key], url)
+            }
+        }
+    }
+    if fraction := float64(moved) / float64(len(keys)); fraction < 0.12 || fraction > 0.28 {
+        t.Errorf("adding a fifth node moved %.2f of the keys, want about 0.2", fraction)
+    }
+
+    // Removing a node only moves its own keys.
+    moved = 0
+    for key, url := range owners(NewSharded(urls[:3], "", 0, 0), keys) {
+        if url != before[key] {
+            moved++
+            if before[key] != urls[3] {
+                t.Fatalf("%s moved from %s, which was not removed", key, before[key])
+            }
+        }
+    }
+    if moved != counts[urls[3]] {
+        t.Errorf("removing a node moved %d keys, want its %d", moved, counts[urls[3]])
+    }
+}
+
+func TestShardedBatchesSplitByNode(t *testing.T) {
+    nodes := []*fakeNode{startFakeNode(t), startFakeNode(t), startFakeNode(t)}
+    byURL := map[string]*fakeNode{}
+    var urls []string
+    for _, node := range nodes {
+        urls = append(urls, node.URL)
+        byURL[node.URL] = node
+    }
+    s := NewSharded(urls, "", 5*time.Second, 0)
+    ctx := context.Background()
+
+    keys := testKeys(60)
+    items := make([]Item, len(keys))
+    want := map[string][]string{}
+    for i, key := range keys {
+        items[i] = Item{Key: key, Value: i}
+        want[s.Node(key)] = append(want[s.Node(key)], key)
+    }
+    if err := s.SetMany(ctx, items); err != nil {
+        t.Fatal(err)
+    }
+    // Each node received its own keys, in one batch.
+    for url, node := range byURL {
+        sort.Strings(want[url])
+        if len(want[url]) == 0 {
+            t.Fatalf("no keys map to %s", url)
+        }
+        node.mutex.Lock()
+        batches := len(node.requests)
+        node.mutex.Unlock()
+        if got := node.keysReceived(); batches != 1 || fmt.Sprint(got) != fmt.Sprint(want[url]) {
+            t.Fatalf("%s received %v in %d requests, want %v in one", url, got, batches, want[url])
+        }
+    }
+
+    values, err := s.GetMany(ctx, append(keys, "missing"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(values) != len(keys) {
+        t.Fatalf("GetMany returned %d values, want %d", len(values), len(keys))
+    }
+    for i, key := range keys {
+        if string(values[key]) != fmt.Sprint(i) {
+            t.Fatalf("GetMany[%s] = %s, want %d", key, values[key], i)
+        }
+    }
+    for url, node := range byURL {
+        got := node.keysReceived()
+        if s.Node("missing") == url {
+            want[url] = append(want[url], "missing")
+            sort.Strings(want[url])
+        }
+        if fmt.Sprint(got) != fmt.Sprint(want[url]) {
+            t.Fatalf("GetMany asked %s for %v, want %v", url, got, want[url])
+        }
+    }
+
+    // A node failing does not lose the values found on the others.
+    nodes[0].down.Store(true)
+    for _, node := range s.nodes {
+        node.client.MaxRetries = 0
+    }
+    values, err = s.GetMany(ctx, keys)
+    if err == nil {
+        t.Fatal("GetMany succeeded with a node down")
+    }
+    for _, key := range keys {
+        if _, ok := values[key]; ok == (s.Node(key) == nodes[0].URL) {
+            t.Fatalf("with %s down GetMany found %s: %v", nodes[0].URL, key, ok)
+        }
+    }
+}
+
+func TestShardedEjectsAndRejoinsNodes(t *testing.T) {
+    down, up := startFakeNode(t), startFakeNode(t)
+    s := NewSharded([]string{down.URL, up.URL}, "", 5*time.Second, 0)
+    s.MaxFailures, s.EjectFor = 2, time.Hour
+    for _, node := range s.nodes {
+        node.client.MaxRetries = 0
+    }
+    ctx := context.Background()
+    var key string
+    for _, k := range testKeys(100) {
+        if s.Node(k) == down.URL {
+            key = k
+            break
+        }
+    }
+
+    down.down.Store(true)
+    for i := 0; i < 2; i++ {
+        if _, _, err := s.Get(ctx, key); err == nil {
+            t.Fatalf("Get %d from a node that is down succeeded", i)
+        }
+    }
+    if !s.Nodes()[0].Ejected {
+        t.Fatalf("node not ejected after 2 failures: %+v", s.Nodes())
+    }
+    // The key now goes to the other node, where it misses.
+    if url := s.Node(key); url != up.URL {
+        t.Fatalf("Node(%s) = %s with its owner ejected, want %s", key, url, up.URL)
+    }
+    if _, found, err := s.Get(ctx, key); err != nil || found {
+        t.Fatalf("Get with the owner ejected = %v, %v; want a miss", found, err)
+    }
+
+    // A passing health check rejoins the node long before EjectFor.
+    down.down.Store(false)
+    stop := s.StartHealthChecks(5 * time.Millisecond)
+    defer stop()
+    deadline := time.Now().Add(5 * time.Second)
+    for s.Nodes()[0].Ejected {
+        if time.Now().After(deadline) {
+            t.Fatal("the node did not rejoin after a health check")
+        }
+        time.Sleep(time.Millisecond)
+    }
+    if url := s.Node(key); url != down.URL {
+        t.Fatalf("Node(%s) = %s after the owner rejoined", key, url)
+    }
+}
@@ -0,0 +1,301 @@
+// Command cachectl reads and writes a cache server through its HTTP API.
+//
+//    cachectl [flags] get KEY
+//    cachectl [flags] set KEY VALUE [--ttl 5m] [--string]
+//    cachectl [flags] del KEY
+//    cachectl [flags] stats
+//    cachectl [flags] state [--limit 50]
+//
+// The server address and API key come from --addr and --api-key, or the
+// CACHECTL_ADDR and CACHECTL_API_KEY environment variables. Output is meant
+// for people unless --json is given. The exit status is 1 when the key is
+// not found, 2 for usage errors and 3 for any other failure.
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "text/tabwriter"
+    "time"
+
+    "github.com/yashikajain0312/LRUCacheAssignment/client"
+)
+
+const (
+    exitOK = iota
+    exitNotFound
+    exitUsage
+    exitError
+)
+
+// errUsage reports a command line that could not be parsed. The message
+// has already been printed.
+var errUsage = errors.New("usage")
+
+func main() {
+    os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+    global := flag.NewFlagSet("cachectl", flag.ContinueOnError)
+    global.SetOutput(stderr)
+    addr := global.String("addr", envOr("CACHECTL_ADDR", "http://localhost:3000"), "server address (env CACHECTL_ADDR)")
+    apiKey := global.String("api-key", os.Getenv("CACHECTL_API_KEY"), "API key sent in X-API-Key (env CACHECTL_API_KEY)")
+    asJSON := global.Bool("json", false, "print JSON instead of human-readable output")
+    timeout := global.Duration("timeout", 10*time.Second, "request timeout")
+    global.Usage = func() {
+        fmt.Fprintln(stderr, "usage: cachectl [flags] get KEY | set KEY VALUE [--ttl D] [--string] | del KEY | stats | state [--limit N]")
+        global.PrintDefaults()
+    }
+    if err := global.Parse(args); err != nil {
+        return exitUsage
+    }
+    if global.NArg() == 0 {
+        global.Usage()
+        return exitUsage
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+    defer cancel()
+    cmd := &command{
+        client: client.New(*addr, *apiKey, *timeout),
+        json:   *asJSON,
+        stdout: stdout,
+        stderr: stderr,
+    }
+
+    var err error
+    switch name, rest := global.Arg(0), global.Args()[1:]; name {
+    case "get":
+        err = cmd.get(ctx, rest)
+    case "set":
+        err = cmd.set(ctx, rest)
+    case "del", "delete":
+        err = cmd.del(ctx, rest)
+    case "stats":
+        err = cmd.stats(ctx, rest)
+    case "state":
+        err = cmd.state(ctx, rest)
+    default:
+        fmt.Fprintf(stderr, "cachectl: unknown command %q\n", name)
+        global.Usage()
+        return exitUsage
+    }
+
+    switch {
+    case err == nil:
+        return exitOK
+    case errors.Is(err, errUsage):
+        return exitUsage
+    case errors.Is(err, client.ErrNotFound):
+        fmt.Fprintln(stderr, "cachectl: key not found")
+        return exitNotFound
+    }
+    fmt.Fprintln(stderr, "cachectl:", err)
+    return exitError
+}
+
+// command holds what the subcommands share.
+type command struct {
+    client *client.Client
+    json   bool
+    stdout io.Writer
+    stderr io.Writer
+}
+
+// parse parses the subcommand's flags, which may come before, between or
+// after its want positional arguments, and returns the positional ones.
+func (c *command) parse(fs *flag.FlagSet, args []string, want int, usage string) ([]string, error) {
+    fs.SetOutput(c.stderr)
+    fs.Usage = func() {
+        fmt.Fprintln(c.stderr, "usage: cachectl "+usage)
+        fs.PrintDefaults()
+    }
+    var positional []string
+    for {
+        if err := fs.Parse(args); err != nil {
+            return nil, errUsage
+        }
+        if fs.NArg() == 0 {
+            break
+        }
+        positional = append(positional, fs.Arg(0))
+        args = fs.Args()[1:]
+    }
+    if len(positional) != want {
+        fs.Usage()
+        return nil, errUsage
+    }
+    return positional, nil
+}
+
+func (c *command) get(ctx context.Context, args []string) error {
+    fs := flag.NewFlagSet("get", flag.ContinueOnError)
+    positional, err := c.parse(fs, args, 1, "get KEY")
+    if err != nil {
+        return err
+    }
+    value, found, err := c.client.Get(ctx, positional[0])
+    if err != nil {
+        return err
+    }
+    if !found {
+        return client.ErrNotFound
+    }
+    var s string
+    if !c.json && json.Unmarshal(value, &s) == nil {
+        fmt.Fprintln(c.stdout, s)
+        return nil
+    }
+    return c.printJSON(value)
+}
+
+func (c *command) set(ctx context.Context, args []string) error {
+    fs := flag.NewFlagSet("set", flag.ContinueOnError)
+    ttl := fs.Duration("ttl", 0, "time to live, such as 30s or 5m; 0 never expires")
+    asString := fs.Bool("string", false, "store VALUE as a string even if it is valid JSON")
+    positional, err := c.parse(fs, args, 2, "set KEY VALUE [--ttl D] [--string]")
+    if err != nil {
+        return err
+    }
+    key := positional[0]
+    value := parseValue(positional[1], *asString)
+    if err := c.client.Set(ctx, key, value, *ttl); err != nil {
+        return err
+    }
+    if c.json {
+        return c.printJSON(map[string]interface{}{"key": key, "stored": true})
+    }
+    fmt.Fprintf(c.stdout, "stored %s\n", key)
+    return nil
+}
+
+func (c *command) del(ctx context.Context, args []string) error {
+    fs := flag.NewFlagSet("del", flag.ContinueOnError)
+    positional, err := c.parse(fs, args, 1, "del KEY")
+    if err != nil {
+        return err
+    }
+    key := positional[0]
+    if err := c.client.Delete(ctx, key); err != nil {
+        return err
+    }
+    if c.json {
+        return c.printJSON(map[string]interface{}{"key": key, "deleted": true})
+    }
+    fmt.Fprintf(c.stdout, "deleted %s\n", key)
+    return nil
+}
+
+func (c *command) stats(ctx context.Context, args []string) error {
+    fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+    if _, err := c.parse(fs, args, 0, "stats"); err != nil {
+        return err
+    }
+    stats, err := c.client.Stats(ctx)
+    if err != nil {
+        return err
+    }
+    if c.json {
+        return c.printJSON(stats)
+    }
+
+    w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintf(w, "size\t%d / %d\n", stats.Size, stats.Capacity)
+    if stats.MaxBytes > 0 {
+        fmt.Fprintf(w, "bytes\t%d / %d\n", stats.BytesUsed, stats.MaxBytes)
+    } else {
+        fmt.Fprintf(w, "bytes\t%d\n", stats.BytesUsed)
+    }
+    fmt.Fprintf(w, "hits\t%d\n", stats.Hits)
+    fmt.Fprintf(w, "misses\t%d\n", stats.Misses)
+    fmt.Fprintf(w, "hit ratio\t%.1f%%\n", stats.HitRatio*100)
+    fmt.Fprintf(w, "inserts\t%d\n", stats.Inserts)
+    fmt.Fprintf(w, "updates\t%d\n", stats.Updates)
+    fmt.Fprintf(w, "deletes\t%d\n", stats.Deletes)
+    fmt.Fprintf(w, "evictions\t%d\n", stats.Evictions)
+    fmt.Fprintf(w, "expirations\t%d\n", stats.Expirations)
+    fmt.Fprintf(w, "clears\t%d\n", stats.Clears)
+    return w.Flush()
+}
+
+func (c *command) state(ctx context.Context, args []string) error {
+    fs := flag.NewFlagSet("state", flag.ContinueOnError)
+    limit := fs.Int("limit", 50, "maximum number of entries to show; 0 shows all")
+    if _, err := c.parse(fs, args, 0, "state [--limit N]"); err != nil {
+        return err
+    }
+    entries, next, err := c.client.State(ctx, client.StateOptions{Limit: *limit})
+    if err != nil {
+        return err
+    }
+    if c.json {
+        return c.printJSON(entries)
+    }
+
+    w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "KEY\tEXPIRES IN\tVALUE")
+    now := time.Now()
+    for _, entry := range entries {
+        expires := "never"
+        if !entry.Expiration.IsZero() {
+            expires = entry.Expiration.Sub(now).Round(time.Second).String()
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Key, expires, displayValue(entry.Value))
+    }
+    if err := w.Flush(); err != nil {
+        return err
+    }
+    if next != "" {
+        fmt.Fprintf(c.stdout, "(first %d entries shown; use --limit 0 to show all)\n", len(entries))
+    }
+    return nil
+}
+
+func (c *command) printJSON(v interface{}) error {
+    enc := json.NewEncoder(c.stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(v)
+}
+
+// parseValue returns s decoded as JSON, so numbers, booleans, arrays and
+// objects keep their type, or as a plain string if it is not valid JSON or
+// asString is set.
+func parseValue(s string, asString bool) interface{} {
+    if asString {
+        return s
+    }
+    var value interface{}
+    if err := json.Unmarshal([]byte(s), &value); err != nil {
+        return s
+    }
+    return value
+}
+
+// displayValue formats a JSON value on one line, strings without their
+// quotes, shortening long ones.
+func displayValue(value json.RawMessage) string {
+    var s string
+    if json.Unmarshal(value, &s) != nil {
+        s = string(value)
+    }
+    s = strings.Join(strings.Fields(s), " ")
+    if len(s) > 60 {
+        s = s[:57] + "..."
+    }
+    return s
+}
+
+func envOr(name, fallback string) string {
+    if v := os.Getenv(name); v != "" {
+        return v
+    }
+    return fallback
+}
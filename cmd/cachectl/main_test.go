@@ -0,0 +1,219 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "sort"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// fakeServer is an httptest server answering the requests cachectl makes
+// from an in-memory map, requiring the API key "secret".
+type fakeServer struct {
+    *httptest.Server
+
+    mutex  sync.Mutex
+    values map[string]json.RawMessage
+    // lastWrite is the body of the last write received.
+    lastWrite string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+    s := &fakeServer{values: make(map[string]json.RawMessage)}
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /cache/{key}", func(w http.ResponseWriter, r *http.Request) {
+        s.mutex.Lock()
+        value, ok := s.values[r.PathValue("key")]
+        s.mutex.Unlock()
+        if !ok {
+            writeJSON(w, http.StatusNotFound, map[string]string{"error": "key not found"})
+            return
+        }
+        writeJSON(w, http.StatusOK, map[string]json.RawMessage{"value": value})
+    })
+    mux.HandleFunc("POST /cache/{key}", func(w http.ResponseWriter, r *http.Request) {
+        var body struct {
+            Value json.RawMessage `json:"value"`
+        }
+        var raw bytes.Buffer
+        if err := json.NewDecoder(io.TeeReader(r.Body, &raw)).Decode(&body); err != nil {
+            writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+            return
+        }
+        s.mutex.Lock()
+        s.values[r.PathValue("key")] = body.Value
+        s.lastWrite = strings.TrimSpace(raw.String())
+        s.mutex.Unlock()
+        writeJSON(w, http.StatusOK, map[string]string{"message": "stored"})
+    })
+    mux.HandleFunc("DELETE /cache/{key}", func(w http.ResponseWriter, r *http.Request) {
+        s.mutex.Lock()
+        _, ok := s.values[r.PathValue("key")]
+        delete(s.values, r.PathValue("key"))
+        s.mutex.Unlock()
+        if !ok {
+            writeJSON(w, http.StatusNotFound, map[string]string{"error": "key not found"})
+            return
+        }
+        writeJSON(w, http.StatusOK, map[string]string{"message": "deleted"})
+    })
+    mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+        s.mutex.Lock()
+        size := len(s.values)
+        s.mutex.Unlock()
+        writeJSON(w, http.StatusOK, map[string]interface{}{"cache": map[string]interface{}{
+            "hits": 3, "misses": 1, "hit_ratio": 0.75, "size": size, "capacity": 100,
+        }})
+    })
+    mux.HandleFunc("GET /cache-state", func(w http.ResponseWriter, r *http.Request) {
+        s.mutex.Lock()
+        var entries []map[string]interface{}
+        for key, value := range s.values {
+            entries = append(entries, map[string]interface{}{"key": key, "value": value, "expiration": "0001-01-01T00:00:00Z"})
+        }
+        s.mutex.Unlock()
+        sort.Slice(entries, func(i, j int) bool { return entries[i]["key"].(string) < entries[j]["key"].(string) })
+        if limit := r.URL.Query().Get("limit"); limit == "2" && len(entries) > 2 {
+            entries = entries[:2]
+        }
+        writeJSON(w, http.StatusOK, entries)
+    })
+
+    s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("X-API-Key") != "secret" {
+            writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid API key"})
+            return
+        }
+        mux.ServeHTTP(w, r)
+    }))
+    t.Cleanup(s.Close)
+    return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+// cachectl runs the command line args against s and returns the exit
+// status and output.
+func (s *fakeServer) cachectl(args ...string) (code int, stdout, stderr string) {
+    var out, errOut bytes.Buffer
+    code = run(append([]string{"--addr", s.URL, "--api-key", "secret"}, args...), &out, &errOut)
+    return code, out.String(), errOut.String()
+}
+
+func TestSetGetDel(t *testing.T) {
+    s := newFakeServer(t)
+
+    for _, tc := range []struct {
+        args      []string
+        code      int
+        stdout    string
+        stderr    string
+        wantWrite string
+    }{
+        {[]string{"set", "greeting", "hello", "--ttl", "5m"}, exitOK, "stored greeting\n", "", `{"expiration":300,"value":"hello"}`},
+        {[]string{"get", "greeting"}, exitOK, "hello\n", "", ""},
+        {[]string{"--json", "get", "greeting"}, exitOK, "\"hello\"\n", "", ""},
+        {[]string{"set", "--ttl", "1500ms", "n", "42"}, exitOK, "stored n\n", "", `{"expiration":2,"value":42}`},
+        {[]string{"get", "n"}, exitOK, "42\n", "", ""},
+        {[]string{"set", "s", "42", "--string"}, exitOK, "stored s\n", "", `{"persist":true,"value":"42"}`},
+        {[]string{"set", "obj", `{"a": [1, 2]}`}, exitOK, "stored obj\n", "", `{"persist":true,"value":{"a":[1,2]}}`},
+        {[]string{"get", "obj"}, exitOK, "{\n  \"a\": [\n    1,\n    2\n  ]\n}\n", "", ""},
+        {[]string{"--json", "set", "k", "v"}, exitOK, "{\n  \"key\": \"k\",\n  \"stored\": true\n}\n", "", ""},
+        {[]string{"del", "greeting"}, exitOK, "deleted greeting\n", "", ""},
+        {[]string{"get", "greeting"}, exitNotFound, "", "cachectl: key not found\n", ""},
+        {[]string{"delete", "greeting"}, exitNotFound, "", "cachectl: key not found\n", ""},
+    } {
+        code, stdout, stderr := s.cachectl(tc.args...)
+        if code != tc.code || stdout != tc.stdout || stderr != tc.stderr {
+            t.Errorf("cachectl %q = %d, stdout %q, stderr %q; want %d, %q, %q", tc.args, code, stdout, stderr, tc.code, tc.stdout, tc.stderr)
+        }
+        s.mutex.Lock()
+        lastWrite := s.lastWrite
+        s.mutex.Unlock()
+        if tc.wantWrite != "" && lastWrite != tc.wantWrite {
+            t.Errorf("cachectl %q sent %s, want %s", tc.args, lastWrite, tc.wantWrite)
+        }
+    }
+}
+
+func TestStatsAndState(t *testing.T) {
+    s := newFakeServer(t)
+    for _, key := range []string{"c", "a", "b"} {
+        if code, _, stderr := s.cachectl("set", key, `"value of `+key+`"`); code != exitOK {
+            t.Fatalf("set %s failed: %s", key, stderr)
+        }
+    }
+
+    code, stdout, _ := s.cachectl("stats")
+    if code != exitOK || !strings.Contains(stdout, "size         3 / 100\n") || !strings.Contains(stdout, "hit ratio    75.0%\n") {
+        t.Fatalf("stats = %d:\n%s", code, stdout)
+    }
+    code, stdout, _ = s.cachectl("--json", "stats")
+    var stats map[string]interface{}
+    if code != exitOK || json.Unmarshal([]byte(stdout), &stats) != nil || stats["size"] != float64(3) || stats["hits"] != float64(3) {
+        t.Fatalf("stats --json = %d:\n%s", code, stdout)
+    }
+
+    code, stdout, _ = s.cachectl("state", "--limit", "2")
+    want := "KEY  EXPIRES IN  VALUE\na    never       value of a\nb    never       value of b\n(first 2 entries shown; use --limit 0 to show all)\n"
+    if code != exitOK || stdout != want {
+        t.Fatalf("state --limit 2 = %d:\n%s\nwant:\n%s", code, stdout, want)
+    }
+    code, stdout, _ = s.cachectl("--json", "state", "--limit", "0")
+    var entries []struct{ Key string }
+    if code != exitOK || json.Unmarshal([]byte(stdout), &entries) != nil || len(entries) != 3 {
+        t.Fatalf("state --json = %d:\n%s", code, stdout)
+    }
+}
+
+func TestAddressAndKeyFromEnvironment(t *testing.T) {
+    s := newFakeServer(t)
+    t.Setenv("CACHECTL_ADDR", s.URL)
+    t.Setenv("CACHECTL_API_KEY", "secret")
+    var stdout, stderr bytes.Buffer
+    if code := run([]string{"set", "k", "v"}, &stdout, &stderr); code != exitOK {
+        t.Fatalf("set with the environment = %d: %s", code, stderr.String())
+    }
+
+    // Flags override the environment.
+    stderr.Reset()
+    if code := run([]string{"--api-key", "wrong", "get", "k"}, &stdout, &stderr); code != exitError || !strings.Contains(stderr.String(), "invalid API key") {
+        t.Fatalf("get with a wrong key = %d: %s", code, stderr.String())
+    }
+}
+
+func TestErrors(t *testing.T) {
+    s := newFakeServer(t)
+    for _, tc := range []struct {
+        args []string
+        code int
+    }{
+        {nil, exitUsage},
+        {[]string{"frobnicate"}, exitUsage},
+        {[]string{"get"}, exitUsage},
+        {[]string{"get", "a", "b"}, exitUsage},
+        {[]string{"set", "k"}, exitUsage},
+        {[]string{"set", "k", "v", "--ttl", "soon"}, exitUsage},
+        {[]string{"stats", "extra"}, exitUsage},
+        {[]string{"--bogus", "stats"}, exitUsage},
+        {[]string{"set", "k", "v", "--ttl", "-1s"}, exitError},
+    } {
+        if code, _, _ := s.cachectl(tc.args...); code != tc.code {
+            t.Errorf("cachectl %q = %d, want %d", tc.args, code, tc.code)
+        }
+    }
+
+    s.Close()
+    if code, _, stderr := s.cachectl("--timeout", "1s", "stats"); code != exitError || stderr == "" {
+        t.Fatalf("stats with the server down = %d, %q", code, stderr)
+    }
+}
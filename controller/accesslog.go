@@ -0,0 +1,54 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// defaultAccessLogSize is the number of operations kept when
+// WithAccessLogSize is not used.
+const defaultAccessLogSize = 1000
+
+// AccessRecord describes one Get, Set or Delete. Hit is set for lookups and
+// deletes, and reports whether the key was found.
+type AccessRecord struct {
+    Time time.Time `json:"time"`
+    Op   string    `json:"op"`
+    Key  string    `json:"key"`
+    Hit  *bool     `json:"hit,omitempty"`
+}
+
+// recordAccess adds an operation to the access log. It must be called
+// without the cache lock held.
+func (c *LRUCache) recordAccess(op, key string, hit *bool) {
+    if c.accessLog == nil {
+        return
+    }
+    c.accessLog.add(AccessRecord{Time: time.Now(), Op: op, Key: key, Hit: hit})
+}
+
+// RecentAccesses returns up to n of the most recent operations, newest
+// first.
+func (c *LRUCache) RecentAccesses(n int) []AccessRecord {
+    return c.accessLog.recent(n, nil)
+}
+
+// recentHandler serves GET /debug/recent and GET /admin/audit. The n
+// parameter caps the number of operations returned (default 100).
+func recentHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        n := 100
+        if raw := c.Query("n"); raw != "" {
+            parsed, err := strconv.Atoi(raw)
+            if err != nil || parsed < 1 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "n must be a positive integer"})
+                return
+            }
+            n = parsed
+        }
+        respond(c, http.StatusOK, gin.H{"operations": cache.RecentAccesses(n)})
+    }
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "sync"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+// describeAccesses formats records as op:key:hit strings, for comparison.
+func describeAccesses(records []AccessRecord) []string {
+    out := []string{}
+    for _, r := range records {
+        hit := "-"
+        if r.Hit != nil {
+            hit = fmt.Sprint(*r.Hit)
+        }
+        out = append(out, r.Op+":"+r.Key+":"+hit)
+    }
+    return out
+}
+
+func TestRecentAccessesKeepsLastN(t *testing.T) {
+    cache := NewLRUCache(10, WithAccessLogSize(4))
+    cache.Set("a", 1, 0)
+    cache.Get("a")
+    cache.Get("b")
+    cache.Set("b", 2, 0)
+    cache.Delete("a")
+    cache.Delete("a")
+
+    want := []string{"delete:a:false", "delete:a:true", "set:b:-", "get:b:false"}
+    if got := describeAccesses(cache.RecentAccesses(10)); !reflect.DeepEqual(got, want) {
+        t.Fatalf("RecentAccesses(10) = %q, want %q", got, want)
+    }
+    if got := describeAccesses(cache.RecentAccesses(2)); !reflect.DeepEqual(got, want[:2]) {
+        t.Fatalf("RecentAccesses(2) = %q, want %q", got, want[:2])
+    }
+    records := cache.RecentAccesses(10)
+    for i := 1; i < len(records); i++ {
+        if records[i].Time.After(records[i-1].Time) {
+            t.Fatalf("records are not newest first: %v", records)
+        }
+    }
+}
+
+func TestRecentAccessesBoundedUnderConcurrency(t *testing.T) {
+    cache := NewLRUCache(10, WithAccessLogSize(16))
+    var wg sync.WaitGroup
+    for g := 0; g < 8; g++ {
+        wg.Add(1)
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < 500; i++ {
+                cache.Set(fmt.Sprint(g), i, 0)
+                cache.Get(fmt.Sprint(g))
+            }
+        }(g)
+    }
+    wg.Wait()
+
+    if n := len(cache.RecentAccesses(1000)); n != 16 {
+        t.Fatalf("RecentAccesses returned %d records, want the 16 kept", n)
+    }
+    if n := len(NewLRUCache(10, WithAccessLogSize(0)).RecentAccesses(10)); n != 0 {
+        t.Fatalf("a disabled access log returned %d records", n)
+    }
+}
+
+func TestRecentHandler(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(10)
+    cache.Set("a", 1, 0)
+    cache.Get("a")
+    router := gin.New()
+    router.GET("/debug/recent", recentHandler(cache))
+
+    for path, want := range map[string]int{
+        "/debug/recent":     http.StatusOK,
+        "/debug/recent?n=1": http.StatusOK,
+        "/debug/recent?n=0": http.StatusBadRequest,
+        "/debug/recent?n=x": http.StatusBadRequest,
+    } {
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+        if rec.Code != want {
+            t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+        }
+    }
+
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/recent?n=1", nil))
+    var body struct {
+        Operations []AccessRecord `json:"operations"`
+    }
+    decodeBody(t, rec.Body.String(), &body)
+    if got := describeAccesses(body.Operations); !reflect.DeepEqual(got, []string{"get:a:true"}) {
+        t.Fatalf("operations = %q", got)
+    }
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "container/list"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+)
+
+// FsyncPolicy says when the append-only log is synced to disk.
+type FsyncPolicy int
+
+const (
+    // FsyncEverySecond syncs once a second, losing at most about a second
+    // of writes on a crash.
+    FsyncEverySecond FsyncPolicy = iota
+    // FsyncAlways syncs after every write operation, before the call that
+    // made it returns. The sync runs once the cache lock is released, so
+    // other operations do not wait for the disk, and concurrent writes may
+    // share one sync.
+    FsyncAlways
+    // FsyncNever leaves syncing to the operating system. The log is still
+    // flushed to the file every second.
+    FsyncNever
+)
+
+// ParseFsyncPolicy parses "always", "everysec" or "never".
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+    switch s {
+    case "always":
+        return FsyncAlways, nil
+    case "everysec":
+        return FsyncEverySecond, nil
+    case "never":
+        return FsyncNever, nil
+    }
+    return 0, fmt.Errorf("unknown fsync policy %q", s)
+}
+
+// aofRecord is one line of the append-only log. Op is "set", "expire"
+// (only the expiration changed), "delete" or "clear". Expiration is
+// absolute and omitted for entries that never expire.
+type aofRecord struct {
+    Op         string          `json:"op"`
+    Key        string          `json:"key,omitempty"`
+    Value      json.RawMessage `json:"value,omitempty"`
+    Expiration *time.Time      `json:"expiration,omitempty"`
+}
+
+// appendLog is an append-only log of the cache's write operations, one
+// JSON record per line. Records are appended to a buffer while the cache
+// lock is held, so they are in the order the operations were applied, and
+// written out according to the fsync policy.
+type appendLog struct {
+    mutex  sync.Mutex
+    path   string
+    policy FsyncPolicy
+    file   *os.File
+    buf    *bufio.Writer
+    size   int64
+    dirty  bool
+
+    // baseSize is the size of the log after the last rewrite. A rewrite is
+    // only due once the log has doubled since, so a log whose live entries
+    // alone exceed the rewrite size is not rewritten continuously.
+    baseSize int64
+}
+
+// logOp appends r to the log if one is attached, and to the replication
+// log if enabled. The caller must hold the cache lock.
+func (c *LRUCache) logOp(r aofRecord) {
+    c.replication.append(r)
+    if c.aof == nil {
+        return
+    }
+    if err := c.aof.append(r); err != nil {
+        slog.Error("append-only log write failed", "error", err)
+    }
+}
+
+// logSet appends a set record for key and queues the write for
+// write-behind. Every path storing a value calls it. The caller must hold
+// the cache lock.
+func (c *LRUCache) logSet(key string, value interface{}, expiration time.Time) {
+    c.queueWrite(writeOp{key: key, value: value, expiration: expiration})
+    if c.aof == nil && c.replication == nil {
+        return
+    }
+    data, err := json.Marshal(value)
+    if err != nil {
+        slog.Error("append-only log cannot encode value", "key", key, "error", err)
+        return
+    }
+    c.logOp(aofRecord{Op: "set", Key: key, Value: data, Expiration: expirationPtr(expiration)})
+}
+
+// expirationPtr returns nil for the zero time and a pointer to a copy of t
+// otherwise.
+func expirationPtr(t time.Time) *time.Time {
+    if t.IsZero() {
+        return nil
+    }
+    return &t
+}
+
+func (l *appendLog) append(r aofRecord) error {
+    data, err := json.Marshal(r)
+    if err != nil {
+        return err
+    }
+    data = append(data, '\n')
+
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    n, err := l.buf.Write(data)
+    l.size += int64(n)
+    l.dirty = true
+    return err
+}
+
+// commit syncs the log if the policy is FsyncAlways. It is called by
+// unlock after every write operation, once the cache lock is released.
+func (l *appendLog) commit() {
+    if l.policy == FsyncAlways {
+        if err := l.sync(true); err != nil {
+            slog.Error("append-only log sync failed", "error", err)
+        }
+    }
+}
+
+// sync flushes buffered records to the file and, if fsync is set, to disk.
+func (l *appendLog) sync(fsync bool) error {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    if !l.dirty {
+        return nil
+    }
+    if err := l.buf.Flush(); err != nil {
+        return err
+    }
+    l.dirty = false
+    if fsync {
+        return l.file.Sync()
+    }
+    return nil
+}
+
+// StartAOF replays the append-only log at path into the cache, normally
+// after a snapshot has been loaded, then appends every later write
+// operation to it. Once the log grows past rewriteSize bytes, and has at
+// least doubled since it was last rewritten, it is rewritten to hold only
+// the current entries; zero disables rewriting.
+// A truncated final record, left by a crash mid-write, is discarded. The
+// returned stop function flushes, syncs and closes the log.
+func (c *LRUCache) StartAOF(path string, policy FsyncPolicy, rewriteSize int64) (stop func(), err error) {
+    if err := c.replayAOF(path); err != nil {
+        return nil, err
+    }
+
+    file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+    if err != nil {
+        return nil, err
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, err
+    }
+    l := &appendLog{
+        path:   path,
+        policy: policy,
+        file:   file,
+        buf:    bufio.NewWriter(file),
+        size:   info.Size(),
+    }
+
+    c.mutex.Lock()
+    c.aof = l
+    c.unlock()
+
+    ticker := time.NewTicker(time.Second)
+    done := make(chan struct{})
+    exited := make(chan struct{})
+    go func() {
+        defer close(exited)
+        for {
+            select {
+            case <-ticker.C:
+                if err := l.sync(policy != FsyncNever); err != nil {
+                    slog.Error("append-only log sync failed", "error", err)
+                }
+                if rewriteSize > 0 && l.rewriteDue(rewriteSize) {
+                    if err := c.rewriteAOF(); err != nil {
+                        slog.Error("append-only log rewrite failed", "error", err)
+                    }
+                }
+            case <-done:
+                ticker.Stop()
+                return
+            }
+        }
+    }()
+
+    return func() {
+        close(done)
+        <-exited
+        c.mutex.Lock()
+        c.aof = nil
+        c.unlock()
+        if err := l.sync(true); err != nil {
+            slog.Error("append-only log sync failed", "error", err)
+        }
+        l.file.Close()
+    }, nil
+}
+
+// rewriteDue reports whether the log should be rewritten.
+func (l *appendLog) rewriteDue(rewriteSize int64) bool {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    return l.size > rewriteSize && l.size > 2*l.baseSize
+}
+
+// replayAOF applies the records of the log at path to the cache. A missing
+// file is not an error. A final line that does not decode is treated as a
+// record cut short by a crash and truncated away; a bad line followed by
+// more data means the log is corrupt and is reported.
+func (c *LRUCache) replayAOF(path string) error {
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    var records []aofRecord
+    var values []interface{}
+    offset := 0
+    for offset < len(data) {
+        end := bytes.IndexByte(data[offset:], '\n')
+        if end < 0 {
+            // No newline: the last write never completed.
+            break
+        }
+        line := data[offset : offset+end]
+        var r aofRecord
+        var value interface{}
+        err := json.Unmarshal(line, &r)
+        if err == nil && r.Op == "set" {
+            err = json.Unmarshal(r.Value, &value)
+        }
+        if err != nil {
+            if offset+end+1 < len(data) {
+                return fmt.Errorf("append-only log %s: corrupt record at offset %d: %w", path, offset, err)
+            }
+            break
+        }
+        records = append(records, r)
+        values = append(values, value)
+        offset += end + 1
+    }
+    if offset < len(data) {
+        slog.Warn("append-only log ends with a partial record, truncating", "path", path, "bytes", len(data)-offset)
+        if err := os.Truncate(path, int64(offset)); err != nil {
+            return err
+        }
+    }
+
+    c.mutex.Lock()
+    defer c.unlock()
+
+    now := c.now()
+    for i, r := range records {
+        c.applyRecord(r, values[i], now)
+    }
+    slog.Info("append-only log replayed", "path", path, "records", len(records), "entries", len(c.cache))
+    return nil
+}
+
+// applyRecord applies r, whose decoded value is value, as of now. A set
+// whose entry has expired by now removes the entry instead. The caller
+// must hold the write lock.
+func (c *LRUCache) applyRecord(r aofRecord, value interface{}, now time.Time) {
+    var expiration time.Time
+    if r.Expiration != nil {
+        expiration = *r.Expiration
+    }
+    switch r.Op {
+    case "set":
+        if expiration.IsZero() || now.Before(expiration) {
+            c.set(r.Key, value, expiration)
+        } else if element, ok := c.cache[r.Key]; ok {
+            c.removeElement(element, removedExpired, "")
+        }
+    case "expire":
+        if element, ok := c.cache[r.Key]; ok {
+            element.Value.(*cacheEntry).expiration = expiration
+        }
+    case "delete":
+        if element, ok := c.cache[r.Key]; ok {
+            c.removeElement(element, removedDeleted, "")
+        }
+    case "clear":
+        c.clear()
+    }
+}
+
+// rewriteAOF replaces the log with one set record per live entry, least
+// recently used first so replaying it restores the recency order. Writers
+// are blocked while the new log is written.
+func (c *LRUCache) rewriteAOF() error {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    l := c.aof
+    if l == nil {
+        return nil
+    }
+
+    tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".rewrite*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+
+    w := bufio.NewWriter(tmp)
+    size, err := writeAOFEntries(w, c.list.Back(), c.now())
+    if err == nil {
+        err = w.Flush()
+    }
+    if err == nil {
+        err = tmp.Sync()
+    }
+    if closeErr := tmp.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return err
+    }
+
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    if err := os.Rename(tmp.Name(), l.path); err != nil {
+        return err
+    }
+    file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0o600)
+    if err != nil {
+        return err
+    }
+    // Records buffered for the old file are already covered by the
+    // rewritten one, since they were appended before the read lock was
+    // taken.
+    l.file.Close()
+    l.file, l.size, l.baseSize, l.dirty = file, size, size, false
+    l.buf.Reset(file)
+    return nil
+}
+
+// writeAOFEntries writes a set record for every live entry from element
+// towards the front of the list, returning the number of bytes written.
+func writeAOFEntries(w io.Writer, element *list.Element, now time.Time) (int64, error) {
+    var size int64
+    for ; element != nil; element = element.Prev() {
+        entry := element.Value.(*cacheEntry)
+        if entry.expired(now) {
+            continue
+        }
+        value, err := json.Marshal(entry.value)
+        if err != nil {
+            return 0, fmt.Errorf("encode %q: %w", entry.key, err)
+        }
+        data, err := json.Marshal(aofRecord{Op: "set", Key: entry.key, Value: value, Expiration: expirationPtr(entry.expiration)})
+        if err != nil {
+            return 0, err
+        }
+        n, err := w.Write(append(data, '\n'))
+        size += int64(n)
+        if err != nil {
+            return 0, err
+        }
+    }
+    return size, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// cacheContents describes the live entries of cache, most recently used
+// first, for comparison.
+func cacheContents(cache *LRUCache) string {
+    var entries []string
+    cache.Range(func(key string, value interface{}, expiration time.Time) bool {
+        entries = append(entries, fmt.Sprintf("%s=%v@%v", key, value, expiration.UTC()))
+        return true
+    })
+    return strings.Join(entries, " ")
+}
+
+// startAOF starts the append-only log at path for cache, failing the test
+// on error. The returned stop function may be called more than once; the
+// log is stopped when the test ends in any case.
+func startAOF(t *testing.T, cache *LRUCache, path string, policy FsyncPolicy) func() {
+    t.Helper()
+    stop, err := cache.StartAOF(path, policy, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var once sync.Once
+    stopOnce := func() { once.Do(stop) }
+    t.Cleanup(stopOnce)
+    return stopOnce
+}
+
+func TestAOFRecoversAfterKill(t *testing.T) {
+    clock := newFakeClock()
+    path := filepath.Join(t.TempDir(), "cache.aof")
+    cache := NewLRUCache(3, WithClock(clock.Now))
+    startAOF(t, cache, path, FsyncAlways)
+
+    cache.Set("gone", 0, 0)
+    cache.ClearCache()
+    cache.Set("a", 1, 0)
+    cache.Set("b", "two", time.Hour)
+    cache.Set("c", map[string]interface{}{"n": 3.0}, 0)
+    cache.Set("a", 10, 0)
+    cache.Set("d", 4, 0)
+    cache.Delete("c")
+    cache.Set("e", 5, time.Minute)
+    if _, err := cache.TouchMany([]string{"b"}, 2*time.Hour); err != nil {
+        t.Fatal(err)
+    }
+    cache.Set("short", 6, time.Second)
+    clock.Advance(2 * time.Second)
+    want := cacheContents(cache)
+
+    // The first cache is killed: its log is neither flushed nor closed,
+    // and with FsyncAlways every completed write is already on disk.
+    restarted := NewLRUCache(3, WithClock(clock.Now))
+    startAOF(t, restarted, path, FsyncAlways)
+
+    if got := cacheContents(restarted); got != want {
+        t.Fatalf("recovered %s\nwant      %s", got, want)
+    }
+
+    // The restarted cache keeps logging to the same file.
+    restarted.Set("f", 6, 0)
+    want = cacheContents(restarted)
+    again := NewLRUCache(3, WithClock(clock.Now))
+    startAOF(t, again, path, FsyncAlways)
+    if got := cacheContents(again); got != want {
+        t.Fatalf("recovered %s after a second restart\nwant      %s", got, want)
+    }
+}
+
+func TestAOFTruncatesPartialFinalRecord(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "cache.aof")
+    cache := NewLRUCache(10)
+    stop := startAOF(t, cache, path, FsyncEverySecond)
+    cache.Set("a", 1, 0)
+    cache.Set("b", 2, 0)
+    stop()
+    want := cacheContents(cache)
+
+    info, err := os.Stat(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f.WriteString(`{"op":"set","key":"c","val`)
+    f.Close()
+
+    restarted := NewLRUCache(10)
+    startAOF(t, restarted, path, FsyncEverySecond)
+    if got := cacheContents(restarted); got != want {
+        t.Fatalf("recovered %s, want %s", got, want)
+    }
+    truncated, err := os.Stat(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if truncated.Size() != info.Size() {
+        t.Fatalf("log is %d bytes after replay, want the partial record cut back to %d", truncated.Size(), info.Size())
+    }
+}
+
+func TestAOFRejectsCorruptRecord(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "cache.aof")
+    data := `{"op":"set","key":"a","value":1}` + "\n" + `{"op":` + "\n" + `{"op":"set","key":"b","value":2}` + "\n"
+    if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+        t.Fatal(err)
+    }
+
+    cache := NewLRUCache(10)
+    if _, err := cache.StartAOF(path, FsyncNever, 0); err == nil || !strings.Contains(err.Error(), "corrupt record") {
+        t.Fatalf("StartAOF error = %v, want a corrupt record", err)
+    }
+    if cache.Len() != 0 {
+        t.Fatal("a corrupt log was partly replayed")
+    }
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "io"
+    "log/slog"
+    "os"
+    "sync/atomic"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// AuditRecord describes one mutating request. Values are never recorded,
+// only the size of the request body.
+type AuditRecord struct {
+    Time      time.Time `json:"time"`
+    Actor     string    `json:"actor"`
+    ClientIP  string    `json:"client_ip"`
+    Method    string    `json:"method"`
+    Route     string    `json:"route"`
+    Key       string    `json:"key,omitempty"`
+    ValueSize int64     `json:"value_size"`
+    Status    int       `json:"status"`
+}
+
+// auditLog writes AuditRecords as JSON lines from a background goroutine.
+// Records are handed over through a bounded channel; when it is full the
+// record is dropped and counted rather than blocking the request.
+type auditLog struct {
+    records chan AuditRecord
+    dropped atomic.Uint64
+    done    chan struct{}
+}
+
+// newAuditLog starts writing records to w, buffering up to queueSize of
+// them. Output is flushed whenever the queue runs empty and on Close.
+func newAuditLog(w io.Writer, queueSize int) *auditLog {
+    l := &auditLog{
+        records: make(chan AuditRecord, queueSize),
+        done:    make(chan struct{}),
+    }
+    go l.run(w)
+    return l
+}
+
+func (l *auditLog) run(w io.Writer) {
+    defer close(l.done)
+
+    buf := bufio.NewWriter(w)
+    enc := json.NewEncoder(buf)
+    for record := range l.records {
+        if err := enc.Encode(record); err != nil {
+            slog.Error("audit log write failed", "error", err)
+        }
+        if len(l.records) == 0 {
+            buf.Flush()
+        }
+    }
+    buf.Flush()
+    if closer, ok := w.(io.Closer); ok {
+        closer.Close()
+    }
+}
+
+// record queues r, dropping it if the writer has fallen behind.
+func (l *auditLog) record(r AuditRecord) {
+    select {
+    case l.records <- r:
+    default:
+        l.dropped.Add(1)
+    }
+}
+
+// Dropped returns the number of records discarded because the queue was
+// full.
+func (l *auditLog) Dropped() uint64 {
+    return l.dropped.Load()
+}
+
+// Close writes the queued records, flushes and closes the writer if it is
+// an io.Closer. No records may be queued after Close.
+func (l *auditLog) Close() {
+    close(l.records)
+    <-l.done
+}
+
+// middleware records every POST, PUT, PATCH and DELETE request once it has
+// been handled. Actor is "admin" or "user" depending on the key presented,
+// and empty when authentication is disabled.
+func (l *auditLog) middleware(auth authConfig) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        switch c.Request.Method {
+        case "POST", "PUT", "PATCH", "DELETE":
+        default:
+            return
+        }
+
+        c.Next()
+
+        route := c.FullPath()
+        if route == "" {
+            route = "unmatched"
+        }
+        l.record(AuditRecord{
+            Time:      time.Now(),
+            Actor:     auth.role(c),
+            ClientIP:  c.ClientIP(),
+            Method:    c.Request.Method,
+            Route:     route,
+            Key:       c.Param("key"),
+            ValueSize: max(c.Request.ContentLength, 0),
+            Status:    c.Writer.Status(),
+        })
+    }
+}
+
+// rotatingFile is an io.WriteCloser appending to path. Once the file has
+// reached maxSize bytes it is renamed to path.1, replacing any previous
+// one, and a new file is started. Rotation only happens at line boundaries
+// so no record is split across files.
+type rotatingFile struct {
+    path      string
+    maxSize   int64
+    file      *os.File
+    size      int64
+    lineStart bool
+}
+
+func openRotatingFile(path string, maxSize int64) (*rotatingFile, error) {
+    f := &rotatingFile{path: path, maxSize: maxSize}
+    if err := f.open(); err != nil {
+        return nil, err
+    }
+    return f, nil
+}
+
+func (f *rotatingFile) open() error {
+    file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+    if err != nil {
+        return err
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return err
+    }
+    f.file, f.size, f.lineStart = file, info.Size(), true
+    return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+    if f.maxSize > 0 && f.size >= f.maxSize && f.lineStart {
+        if err := f.rotate(); err != nil {
+            return 0, err
+        }
+    }
+    n, err := f.file.Write(p)
+    f.size += int64(n)
+    f.lineStart = n > 0 && p[n-1] == '\n'
+    return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+    if err := f.file.Close(); err != nil {
+        return err
+    }
+    if err := os.Rename(f.path, f.path+".1"); err != nil {
+        return err
+    }
+    return f.open()
+}
+
+func (f *rotatingFile) Close() error {
+    return f.file.Close()
+}
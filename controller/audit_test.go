@@ -0,0 +1,120 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestAuditLogLines(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    var out bytes.Buffer
+    audit := newAuditLog(&out, 16)
+    auth := authConfig{apiKey: "user-key", adminKey: "admin-key"}
+    router := gin.New()
+    router.Use(audit.middleware(auth))
+    ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+    router.GET("/cache/:key", ok)
+    router.POST("/cache/:key", ok)
+    router.DELETE("/cache/:key", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+    router.PUT("/admin/config", ok)
+
+    for _, req := range []struct {
+        method, path, key, body string
+    }{
+        {http.MethodPost, "/cache/a", "user-key", `{"value":"secret"}`},
+        {http.MethodGet, "/cache/a", "user-key", ""},
+        {http.MethodDelete, "/cache/b", "", ""},
+        {http.MethodPut, "/admin/config", "admin-key", `{}`},
+    } {
+        r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+        r.RemoteAddr = "192.0.2.1:1234"
+        if req.key != "" {
+            r.Header.Set("X-API-Key", req.key)
+        }
+        router.ServeHTTP(httptest.NewRecorder(), r)
+    }
+    audit.Close()
+
+    if strings.Contains(out.String(), "secret") {
+        t.Fatal("the audit log records a value")
+    }
+    var records []AuditRecord
+    scanner := bufio.NewScanner(&out)
+    for scanner.Scan() {
+        var record AuditRecord
+        if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+            t.Fatalf("line %q: %v", scanner.Text(), err)
+        }
+        if record.Time.IsZero() || record.ClientIP != "192.0.2.1" {
+            t.Errorf("record %+v lacks its time or client IP", record)
+        }
+        record.Time, record.ClientIP = time.Time{}, ""
+        records = append(records, record)
+    }
+    want := []AuditRecord{
+        {Actor: "user", Method: "POST", Route: "/cache/:key", Key: "a", ValueSize: 18, Status: 200},
+        {Actor: "", Method: "DELETE", Route: "/cache/:key", Key: "b", Status: 404},
+        {Actor: "admin", Method: "PUT", Route: "/admin/config", ValueSize: 2, Status: 200},
+    }
+    if len(records) != len(want) {
+        t.Fatalf("%d audit lines, want %d:\n%v", len(records), len(want), records)
+    }
+    for i := range want {
+        if records[i] != want[i] {
+            t.Errorf("line %d = %+v, want %+v", i, records[i], want[i])
+        }
+    }
+}
+
+// blockedWriter blocks every Write until release is closed.
+type blockedWriter struct {
+    release chan struct{}
+}
+
+func (w blockedWriter) Write(p []byte) (int, error) {
+    <-w.release
+    return len(p), nil
+}
+
+func TestAuditLogDropsWhenBehind(t *testing.T) {
+    w := blockedWriter{release: make(chan struct{})}
+    audit := newAuditLog(w, 2)
+    // The first record may be taken by the writer goroutine, the next two
+    // fill the queue and the rest are dropped.
+    for i := 0; i < 10; i++ {
+        audit.record(AuditRecord{Method: "POST"})
+    }
+    if dropped := audit.Dropped(); dropped < 7 {
+        t.Fatalf("dropped %d records, want at least 7", dropped)
+    }
+    close(w.release)
+    audit.Close()
+}
+
+func TestRotatingFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    f, err := openRotatingFile(path, 10)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f.Write([]byte("first line\n"))
+    f.Write([]byte("second "))
+    f.Write([]byte("line\n"))
+    f.Close()
+
+    rotated, _ := os.ReadFile(path + ".1")
+    current, _ := os.ReadFile(path)
+    if string(rotated) != "first line\n" || string(current) != "second line\n" {
+        t.Fatalf("rotated %q, current %q", rotated, current)
+    }
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+    "crypto/subtle"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+)
+
+// authConfig holds the keys accepted in the X-API-Key header. The admin key
+// also grants everything the regular API key does. An empty key disables the
+// corresponding check.
+type authConfig struct {
+    apiKey   string
+    adminKey string
+}
+
+// requireUser rejects requests that carry neither the API key nor the admin
+// key. It is a no-op when no API key is configured.
+func (a authConfig) requireUser() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if a.apiKey == "" {
+            return
+        }
+        if !keyMatches(c, a.apiKey) && !keyMatches(c, a.adminKey) {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing API key"})
+        }
+    }
+}
+
+// requireAdmin rejects requests that do not carry the admin key. It is a
+// no-op when no admin key is configured.
+func (a authConfig) requireAdmin() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if a.adminKey == "" {
+            return
+        }
+        if !keyMatches(c, a.adminKey) {
+            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin API key required"})
+        }
+    }
+}
+
+// role returns "admin" or "user" depending on the key the request carries,
+// or an empty string if it carries neither.
+func (a authConfig) role(c *gin.Context) string {
+    switch {
+    case keyMatches(c, a.adminKey):
+        return "admin"
+    case keyMatches(c, a.apiKey):
+        return "user"
+    }
+    return ""
+}
+
+// keyMatches reports whether the request's X-API-Key header equals key.
+func keyMatches(c *gin.Context, key string) bool {
+    return key != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader("X-API-Key")), []byte(key)) == 1
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+    "log/slog"
+    "time"
+)
+
+// SnapshotStatus describes the last snapshot written by the cache.
+type SnapshotStatus struct {
+    At              time.Time `json:"at"`
+    DurationSeconds float64   `json:"duration_seconds"`
+    Entries         int       `json:"entries"`
+}
+
+// LastSnapshot returns the status of the last snapshot written by
+// SaveSnapshotTo or SaveSnapshotFile, or nil if none has been written.
+func (c *LRUCache) LastSnapshot() *SnapshotStatus {
+    return c.lastSnapshot.Load()
+}
+
+// StartAutoSnapshot saves a snapshot to the store configured with
+// WithAutoSnapshot or WithAutoSnapshotStore at every interval in a
+// background goroutine. A run is skipped if the previous one is still
+// writing. The returned stop function stops the goroutine and writes a
+// final snapshot, so it should be called on shutdown. Without either
+// option it does nothing.
+func (c *LRUCache) StartAutoSnapshot() (stop func()) {
+    if c.autoSnapshotStore == nil || c.autoSnapshotInterval <= 0 {
+        return func() {}
+    }
+
+    ticker := time.NewTicker(c.autoSnapshotInterval)
+    done := make(chan struct{})
+    exited := make(chan struct{})
+    go func() {
+        defer close(exited)
+        c.runAutoSnapshot(ticker.C, done)
+        ticker.Stop()
+    }()
+    return func() {
+        close(done)
+        <-exited
+        c.snapshotMutex.Lock()
+        defer c.snapshotMutex.Unlock()
+        c.autoSnapshot()
+    }
+}
+
+// runAutoSnapshot starts a snapshot on every tick until done is closed.
+// Snapshots run in their own goroutine so a slow one makes the following
+// ticks skip rather than queue up.
+func (c *LRUCache) runAutoSnapshot(ticks <-chan time.Time, done <-chan struct{}) {
+    for {
+        select {
+        case <-ticks:
+            if c.snapshotMutex.TryLock() {
+                go func() {
+                    defer c.snapshotMutex.Unlock()
+                    c.autoSnapshot()
+                }()
+            }
+        case <-done:
+            return
+        }
+    }
+}
+
+// autoSnapshot writes the configured snapshot, logging failures.
+func (c *LRUCache) autoSnapshot() {
+    if err := c.SaveSnapshotTo(c.autoSnapshotStore, c.autoSnapshotName); err != nil {
+        slog.Error("automatic snapshot failed", "name", c.autoSnapshotName, "error", err)
+    }
+}
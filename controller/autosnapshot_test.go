@@ -0,0 +1,114 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// waitForSnapshot waits until the cache has written a snapshot other than
+// previous and returns its status.
+func waitForSnapshot(t *testing.T, cache *LRUCache, previous *SnapshotStatus) *SnapshotStatus {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        if status := cache.LastSnapshot(); status != nil && status != previous {
+            return status
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("no snapshot was written")
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+func TestAutoSnapshotOnTick(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "cache.json")
+    cache := NewLRUCache(10, WithAutoSnapshot(path, time.Hour))
+    cache.Set("a", 1, 0)
+    cache.Set("b", 2, 0)
+
+    ticks := make(chan time.Time)
+    done := make(chan struct{})
+    exited := make(chan struct{})
+    go func() {
+        defer close(exited)
+        cache.runAutoSnapshot(ticks, done)
+    }()
+    defer func() {
+        close(done)
+        <-exited
+    }()
+
+    ticks <- time.Now()
+    status := waitForSnapshot(t, cache, nil)
+    if status.Entries != 2 {
+        t.Fatalf("snapshot holds %d entries, want 2", status.Entries)
+    }
+    restored := NewLRUCache(10)
+    if err := restored.LoadSnapshotFile(path); err != nil {
+        t.Fatal(err)
+    }
+    if restored.Get("a") != float64(1) || restored.Get("b") != float64(2) {
+        t.Fatalf("restored snapshot = %v", restored.Snapshot())
+    }
+    if tmp, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*")); len(tmp) != 0 {
+        t.Fatalf("temporary files left behind: %v", tmp)
+    }
+
+    // A tick while a snapshot is still being written is skipped.
+    cache.snapshotMutex.Lock()
+    cache.Set("c", 3, 0)
+    ticks <- time.Now()
+    ticks <- time.Now()
+    cache.snapshotMutex.Unlock()
+    if cache.LastSnapshot() != status {
+        t.Fatal("a snapshot ran while the previous one was in progress")
+    }
+
+    ticks <- time.Now()
+    if status := waitForSnapshot(t, cache, status); status.Entries != 3 {
+        t.Fatalf("snapshot holds %d entries, want 3", status.Entries)
+    }
+}
+
+func TestAutoSnapshotFinalOnStop(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    path := filepath.Join(t.TempDir(), "cache.json")
+    cache := NewLRUCache(10, WithAutoSnapshot(path, time.Hour))
+    stop := cache.StartAutoSnapshot()
+    cache.Set("a", 1, 0)
+    stop()
+
+    if _, err := os.Stat(path); err != nil {
+        t.Fatalf("no final snapshot: %v", err)
+    }
+    router := gin.New()
+    router.GET("/stats", statsHandler(cache))
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+    var body struct {
+        LastSnapshot *SnapshotStatus `json:"last_snapshot"`
+    }
+    if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    if body.LastSnapshot == nil || body.LastSnapshot.Entries != 1 || body.LastSnapshot.At.IsZero() {
+        t.Fatalf("last_snapshot = %+v", body.LastSnapshot)
+    }
+}
+
+func TestAutoSnapshotDisabled(t *testing.T) {
+    dir := t.TempDir()
+    cache := NewLRUCache(10, WithAutoSnapshot(filepath.Join(dir, "cache.json"), 0))
+    cache.StartAutoSnapshot()()
+    if files, _ := os.ReadDir(dir); len(files) != 0 || cache.LastSnapshot() != nil {
+        t.Fatalf("a disabled auto-snapshot wrote %d files", len(files))
+    }
+}
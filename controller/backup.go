@@ -0,0 +1,272 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    // backupFormat and backupVersion identify a backup file. A backup is
+    // a BackupHeader encoded as one line of JSON followed by its body, a
+    // JSON snapshot.
+    backupFormat  = "lrucache-backup"
+    backupVersion = 1
+    // Backup files are named after their creation time, formatted with
+    // backupTimeLayout between backupPrefix and backupSuffix.
+    backupPrefix     = "backup-"
+    backupSuffix     = ".bak"
+    backupTimeLayout = "20060102T150405.000000000Z"
+)
+
+// BackupHeader describes a backup: when it was created, the number of
+// entries in its body and the body's size and hex SHA-256.
+type BackupHeader struct {
+    Format    string    `json:"format"`
+    Version   int       `json:"version"`
+    CreatedAt time.Time `json:"created_at"`
+    Entries   int       `json:"entries"`
+    Size      int64     `json:"size"`
+    SHA256    string    `json:"sha256"`
+}
+
+// BackupInfo describes a backup listed by ListBackups.
+type BackupInfo struct {
+    Name string `json:"name"`
+    BackupHeader
+}
+
+// BackupVerifyError reports a backup whose body does not match its
+// header: Field names what differs, with the value the header records in
+// Expected and the one found in Actual.
+type BackupVerifyError struct {
+    Name     string `json:"name"`
+    Field    string `json:"field"`
+    Expected string `json:"expected"`
+    Actual   string `json:"actual"`
+}
+
+func (e *BackupVerifyError) Error() string {
+    return fmt.Sprintf("backup %s failed verification: %s is %s, header says %s", e.Name, e.Field, e.Actual, e.Expected)
+}
+
+// ErrBackupNotFound means no backup of the requested name exists.
+var ErrBackupNotFound = errors.New("backup not found")
+
+// SaveBackup writes a backup of the live entries to store, named after its
+// creation time, and returns its description.
+func (c *LRUCache) SaveBackup(store SnapshotStore) (BackupInfo, error) {
+    var body bytes.Buffer
+    entries, err := c.writeSnapshot(&body)
+    if err != nil {
+        return BackupInfo{}, err
+    }
+    sum := sha256.Sum256(body.Bytes())
+    header := BackupHeader{
+        Format:    backupFormat,
+        Version:   backupVersion,
+        CreatedAt: time.Now().UTC(),
+        Entries:   entries,
+        Size:      int64(body.Len()),
+        SHA256:    hex.EncodeToString(sum[:]),
+    }
+    name := backupPrefix + header.CreatedAt.Format(backupTimeLayout) + backupSuffix
+
+    line, err := json.Marshal(header)
+    if err != nil {
+        return BackupInfo{}, err
+    }
+    line = append(line, '\n')
+    if err := store.Put(name, io.MultiReader(bytes.NewReader(line), &body)); err != nil {
+        return BackupInfo{}, err
+    }
+    return BackupInfo{Name: name, BackupHeader: header}, nil
+}
+
+// ListBackups describes the backups in store, newest first. Backups whose
+// header cannot be read are left out.
+func ListBackups(store SnapshotStore) ([]BackupInfo, error) {
+    infos, err := store.List()
+    if err != nil {
+        return nil, err
+    }
+    backups := []BackupInfo{}
+    for _, info := range infos {
+        if !validBackupName(info.Name) {
+            continue
+        }
+        r, err := store.Get(info.Name)
+        if err != nil {
+            continue
+        }
+        header, err := readBackupHeader(bufio.NewReader(r))
+        r.Close()
+        if err == nil {
+            backups = append(backups, BackupInfo{Name: info.Name, BackupHeader: header})
+        }
+    }
+    sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+    return backups, nil
+}
+
+// PruneBackups deletes all but the keep newest backups in store and
+// returns the names deleted; see PruneSnapshots.
+func PruneBackups(store SnapshotStore, keep int) ([]string, error) {
+    return PruneSnapshots(store, backupPrefix, keep)
+}
+
+// RestoreBackup replaces the contents of the cache with the backup name in
+// store. The body is checked against the header's size, checksum and entry
+// count, and fully decoded, before the cache is touched, and then swapped
+// in under a single lock acquisition, so a backup failing verification,
+// reported as a *BackupVerifyError, leaves the cache unchanged. It returns
+// the number of entries restored and of expired entries skipped.
+func (c *LRUCache) RestoreBackup(store SnapshotStore, name string) (restored, skipped int, err error) {
+    if !validBackupName(name) {
+        return 0, 0, ErrBackupNotFound
+    }
+    r, err := store.Get(name)
+    if errors.Is(err, ErrSnapshotNotFound) {
+        return 0, 0, ErrBackupNotFound
+    }
+    if err != nil {
+        return 0, 0, err
+    }
+    defer r.Close()
+
+    items, err := readBackup(bufio.NewReader(r), name, c.codec)
+    if err != nil {
+        return 0, 0, err
+    }
+    restored, skipped = c.replaceEntries(items)
+    return restored, skipped, nil
+}
+
+// readBackup reads and verifies the backup name from r and returns its
+// entries.
+func readBackup(r *bufio.Reader, name string, codec Codec) ([]cacheEntry, error) {
+    header, err := readBackupHeader(r)
+    if err != nil {
+        return nil, &BackupVerifyError{Name: name, Field: "header", Expected: backupFormat + " version " + strconv.Itoa(backupVersion), Actual: err.Error()}
+    }
+    body, err := io.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+    if int64(len(body)) != header.Size {
+        return nil, &BackupVerifyError{Name: name, Field: "size", Expected: strconv.FormatInt(header.Size, 10), Actual: strconv.Itoa(len(body))}
+    }
+    if sum := sha256.Sum256(body); hex.EncodeToString(sum[:]) != header.SHA256 {
+        return nil, &BackupVerifyError{Name: name, Field: "sha256", Expected: header.SHA256, Actual: hex.EncodeToString(sum[:])}
+    }
+    items, err := decodeSnapshot(bytes.NewReader(body), codec)
+    if err != nil {
+        return nil, &BackupVerifyError{Name: name, Field: "body", Expected: "a snapshot", Actual: err.Error()}
+    }
+    if len(items) != header.Entries {
+        return nil, &BackupVerifyError{Name: name, Field: "entries", Expected: strconv.Itoa(header.Entries), Actual: strconv.Itoa(len(items))}
+    }
+    return items, nil
+}
+
+// readBackupHeader reads the header line of a backup.
+func readBackupHeader(r *bufio.Reader) (BackupHeader, error) {
+    line, err := r.ReadBytes('\n')
+    if err != nil {
+        return BackupHeader{}, fmt.Errorf("read header: %w", err)
+    }
+    var header BackupHeader
+    if err := json.Unmarshal(line, &header); err != nil {
+        return BackupHeader{}, fmt.Errorf("decode header: %w", err)
+    }
+    if header.Format != backupFormat || header.Version != backupVersion {
+        return BackupHeader{}, fmt.Errorf("unsupported format %q version %d", header.Format, header.Version)
+    }
+    return header, nil
+}
+
+// validBackupName reports whether name is the name of a backup, which also
+// keeps requests from naming other snapshots in the store.
+func validBackupName(name string) bool {
+    return filepath.Base(name) == name && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix)
+}
+
+// backupHandler serves POST /admin/backup, writing a backup to store and
+// then, if keep is positive, deleting all but the keep newest backups.
+func backupHandler(cache *LRUCache, store SnapshotStore, keep int) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if store == nil {
+            c.JSON(http.StatusConflict, gin.H{"error": "no backup store configured"})
+            return
+        }
+        backup, err := cache.SaveBackup(store)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        if _, err := PruneBackups(store, keep); err != nil {
+            slog.Error("backup pruning failed", "error", err)
+        }
+        c.JSON(http.StatusOK, backup)
+    }
+}
+
+// listBackupsHandler serves GET /admin/backups.
+func listBackupsHandler(store SnapshotStore) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if store == nil {
+            c.JSON(http.StatusConflict, gin.H{"error": "no backup store configured"})
+            return
+        }
+        backups, err := ListBackups(store)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, backups)
+    }
+}
+
+// restoreHandler serves POST /admin/restore, which takes {"name": ...}.
+// A backup failing verification is refused with 422 and the mismatch.
+func restoreHandler(cache *LRUCache, store SnapshotStore) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if store == nil {
+            c.JSON(http.StatusConflict, gin.H{"error": "no backup store configured"})
+            return
+        }
+        var data struct {
+            Name string `json:"name" binding:"required"`
+        }
+        if err := c.ShouldBindJSON(&data); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "name", Reason: "is required"}}})
+            return
+        }
+        restored, skipped, err := cache.RestoreBackup(store, data.Name)
+        var verifyErr *BackupVerifyError
+        switch {
+        case errors.As(err, &verifyErr):
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "backup failed verification", "mismatch": verifyErr})
+        case errors.Is(err, ErrBackupNotFound):
+            c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        case err != nil:
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        default:
+            c.JSON(http.StatusOK, gin.H{"restored": restored, "skipped_expired": skipped})
+        }
+    }
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// blobStore is a SnapshotStore standing in for an object store: a map of
+// keys to objects that records the key of every upload.
+type blobStore struct {
+    mutex   sync.Mutex
+    objects map[string][]byte
+    puts    []string
+}
+
+func newBlobStore() *blobStore {
+    return &blobStore{objects: make(map[string][]byte)}
+}
+
+func (s *blobStore) Put(name string, r io.Reader) error {
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return err
+    }
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    s.objects[name] = data
+    s.puts = append(s.puts, name)
+    return nil
+}
+
+func (s *blobStore) Get(name string) (io.ReadCloser, error) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    data, ok := s.objects[name]
+    if !ok {
+        return nil, ErrSnapshotNotFound
+    }
+    return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *blobStore) List() ([]SnapshotInfo, error) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    var infos []SnapshotInfo
+    for name, data := range s.objects {
+        infos = append(infos, SnapshotInfo{Name: name, Size: int64(len(data))})
+    }
+    return infos, nil
+}
+
+func (s *blobStore) Delete(name string) error {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    if _, ok := s.objects[name]; !ok {
+        return ErrSnapshotNotFound
+    }
+    delete(s.objects, name)
+    return nil
+}
+
+func TestBackupToBlobStore(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("a", "alpha", 0)
+    cache.Set("b", map[string]interface{}{"n": 2.0}, time.Hour)
+    store := newBlobStore()
+
+    before := time.Now().UTC()
+    backup, err := cache.SaveBackup(store)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(store.puts) != 1 || store.puts[0] != backup.Name {
+        t.Fatalf("uploaded %v, want only %s", store.puts, backup.Name)
+    }
+    if want := "backup-" + backup.CreatedAt.Format(backupTimeLayout) + ".bak"; backup.Name != want || backup.CreatedAt.Before(before) {
+        t.Fatalf("backup %s created at %v, want %s", backup.Name, backup.CreatedAt, want)
+    }
+    header, err := readBackupHeader(bufio.NewReader(bytes.NewReader(store.objects[backup.Name])))
+    if err != nil || header != backup.BackupHeader || header.Entries != 2 {
+        t.Fatalf("uploaded header %+v, %v; want %+v", header, err, backup.BackupHeader)
+    }
+
+    restored := NewLRUCache(10)
+    restored.Set("stale", 1, 0)
+    n, skipped, err := restored.RestoreBackup(store, backup.Name)
+    if err != nil || n != 2 || skipped != 0 {
+        t.Fatalf("RestoreBackup = %d, %d, %v", n, skipped, err)
+    }
+    if restored.Get("a") != "alpha" || restored.ContainsKey("stale") {
+        t.Fatalf("restored cache holds %+v", restored.Snapshot())
+    }
+    if ttl, ok := restored.TTL("b"); !ok || ttl <= 59*time.Minute {
+        t.Fatalf("TTL(b) = %v, %v after restoring", ttl, ok)
+    }
+
+    backups, err := ListBackups(store)
+    if err != nil || len(backups) != 1 || backups[0].Name != backup.Name {
+        t.Fatalf("ListBackups = %+v, %v", backups, err)
+    }
+}
+
+func TestRestoreRejectsTamperedBackup(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("a", "alpha", 0)
+    cache.Set("b", 2, time.Hour)
+    store := newBlobStore()
+    backup, err := cache.SaveBackup(store)
+    if err != nil {
+        t.Fatal(err)
+    }
+    original := store.objects[backup.Name]
+    bodyStart := bytes.IndexByte(original, '\n') + 1
+
+    // Flipping any one byte of the body is caught.
+    target := NewLRUCache(10)
+    target.Set("kept", 1, 0)
+    for i := bodyStart; i < len(original); i++ {
+        tampered := bytes.Clone(original)
+        tampered[i] ^= 0x01
+        store.objects[backup.Name] = tampered
+        _, _, err = target.RestoreBackup(store, backup.Name)
+        if verifyErr, ok := err.(*BackupVerifyError); !ok || verifyErr.Field != "sha256" {
+            t.Fatalf("RestoreBackup with byte %d flipped = %v, want a sha256 mismatch", i, err)
+        }
+        if !target.ContainsKey("kept") || target.Len() != 1 {
+            t.Fatalf("a failed restore with byte %d flipped changed the cache", i)
+        }
+    }
+
+    // Over HTTP the restore is refused with 422 and the mismatch.
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.POST("/admin/restore", restoreHandler(target, store))
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/restore", strings.NewReader(`{"name":"`+backup.Name+`"}`)))
+    var body struct {
+        Mismatch BackupVerifyError `json:"mismatch"`
+    }
+    if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusUnprocessableEntity || body.Mismatch.Field != "sha256" || body.Mismatch.Name != backup.Name {
+        t.Fatalf("POST /admin/restore = %d %s", rec.Code, rec.Body)
+    }
+    if !target.ContainsKey("kept") || target.Len() != 1 {
+        t.Fatal("a refused restore changed the cache")
+    }
+
+    // The untouched backup still restores.
+    store.objects[backup.Name] = original
+    if n, _, err := target.RestoreBackup(store, backup.Name); err != nil || n != 2 {
+        t.Fatalf("RestoreBackup of the original = %d, %v", n, err)
+    }
+}
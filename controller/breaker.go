@@ -0,0 +1,101 @@
+package main
+
+import (
+    "sync"
+    "time"
+)
+
+// Circuit breaker states.
+const (
+    circuitClosed = iota
+    circuitOpen
+    circuitHalfOpen
+)
+
+// WithCircuitBreaker stops calling the loader once threshold loads in a
+// row have failed. For openDuration afterwards, lookups that miss fail
+// immediately with ErrBackendUnavailable instead of waiting on a degraded
+// backend. Then a single load is let through as a probe: if it succeeds
+// the loader is used again, otherwise the circuit stays open for another
+// openDuration. A non-positive threshold disables the breaker.
+func WithCircuitBreaker(threshold int, openDuration time.Duration) Option {
+    return func(c *LRUCache) {
+        if threshold <= 0 {
+            c.breaker = nil
+            return
+        }
+        c.breaker = &circuitBreaker{threshold: threshold, openDuration: openDuration}
+    }
+}
+
+// circuitBreaker counts consecutive loader failures. A nil breaker allows
+// every call.
+type circuitBreaker struct {
+    threshold    int
+    openDuration time.Duration
+
+    mutex    sync.Mutex
+    state    int
+    failures int
+    openedAt time.Time
+    // probing is set while the half-open probe is running, so no other
+    // call is let through until it reports.
+    probing bool
+}
+
+// allow reports whether a loader call may be made. Every allowed call must
+// be followed by done or abandon.
+func (b *circuitBreaker) allow() bool {
+    if b == nil {
+        return true
+    }
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    switch b.state {
+    case circuitOpen:
+        if time.Since(b.openedAt) < b.openDuration {
+            return false
+        }
+        b.state = circuitHalfOpen
+        b.probing = true
+        return true
+    case circuitHalfOpen:
+        if b.probing {
+            return false
+        }
+        b.probing = true
+    }
+    return true
+}
+
+// done records the outcome of an allowed call.
+func (b *circuitBreaker) done(failed bool) {
+    if b == nil {
+        return
+    }
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    if !failed {
+        b.state, b.failures, b.probing = circuitClosed, 0, false
+        return
+    }
+    b.failures++
+    if b.state == circuitHalfOpen || b.failures >= b.threshold {
+        b.state, b.openedAt, b.probing = circuitOpen, time.Now(), false
+    }
+}
+
+// abandon releases an allowed call whose outcome says nothing about the
+// backend, such as one cancelled by its caller, letting another call probe
+// a half-open circuit.
+func (b *circuitBreaker) abandon() {
+    if b == nil {
+        return
+    }
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    b.probing = false
+}
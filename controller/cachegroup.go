@@ -0,0 +1,136 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "time"
+)
+
+// CacheGroup loads many keys at once through a batch loader, storing the
+// results in a cache with a default TTL.
+type CacheGroup struct {
+    cache *LRUCache
+    ttl   time.Duration
+
+    // inflight maps each key being loaded to the batch loading it, so
+    // concurrent GetMulti calls with overlapping keys share loads.
+    mutex    sync.Mutex
+    inflight map[string]*batchLoad
+}
+
+// batchLoad is one call to a GetMulti loader. values and err are set
+// before done is closed.
+type batchLoad struct {
+    done   chan struct{}
+    values map[string]interface{}
+    err    error
+}
+
+// NewCacheGroup returns a CacheGroup storing loaded values in cache for
+// ttl; a non-positive ttl stores them without expiration.
+func NewCacheGroup(cache *LRUCache, ttl time.Duration) *CacheGroup {
+    return &CacheGroup{cache: cache, ttl: max(ttl, 0), inflight: make(map[string]*batchLoad)}
+}
+
+// GetMulti returns the values of keys. Keys found in the cache are
+// returned directly and the rest are passed to loader in a single call,
+// except for keys another GetMulti call is already loading, whose result
+// is awaited instead. Loaded values are stored in the cache. Keys that are
+// neither cached nor returned by the loader are absent from the result.
+// A loader failure is reported as a *CacheError wrapping ErrBackend, and a
+// failure to store the loaded values, such as in read-only mode, as
+// SetMany reports it; ctx only bounds the wait for loads started by other
+// calls.
+func (g *CacheGroup) GetMulti(ctx context.Context, keys []string, loader func([]string) (map[string]interface{}, error)) (map[string]interface{}, error) {
+    result := make(map[string]interface{}, len(keys))
+    seen := make(map[string]bool, len(keys))
+    var misses []string
+    for _, key := range keys {
+        if seen[key] {
+            continue
+        }
+        seen[key] = true
+        if entry, _, err := g.cache.get(context.Background(), key); err == nil {
+            result[key] = entry.value
+        } else {
+            misses = append(misses, key)
+        }
+    }
+    if len(misses) == 0 {
+        return result, nil
+    }
+
+    // Claim the misses nobody is loading yet; wait for the others.
+    waits := make(map[string]*batchLoad)
+    var own *batchLoad
+    var toLoad []string
+    g.mutex.Lock()
+    for _, key := range misses {
+        if call, ok := g.inflight[key]; ok {
+            waits[key] = call
+            continue
+        }
+        if own == nil {
+            own = &batchLoad{done: make(chan struct{})}
+        }
+        g.inflight[key] = own
+        toLoad = append(toLoad, key)
+    }
+    g.mutex.Unlock()
+
+    if own != nil {
+        g.load(own, toLoad, loader)
+        if own.err != nil {
+            return nil, own.err
+        }
+        for _, key := range toLoad {
+            if value, ok := own.values[key]; ok {
+                result[key] = value
+            }
+        }
+    }
+
+    for key, call := range waits {
+        select {
+        case <-call.done:
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        }
+        if call.err != nil {
+            return nil, call.err
+        }
+        if value, ok := call.values[key]; ok {
+            result[key] = value
+        }
+    }
+    return result, nil
+}
+
+// load runs loader for keys on behalf of call, stores the values it
+// returns and releases the keys.
+func (g *CacheGroup) load(call *batchLoad, keys []string, loader func([]string) (map[string]interface{}, error)) {
+    values, err := loader(keys)
+    if err != nil {
+        call.err = &CacheError{Op: "get_multi", Err: fmt.Errorf("%w: %w", ErrBackend, err)}
+    } else {
+        entries := make([]BatchEntry, 0, len(values))
+        for _, key := range keys {
+            if value, ok := values[key]; ok {
+                entries = append(entries, BatchEntry{Key: key, Value: value, TTL: g.ttl})
+            }
+        }
+        if err := g.cache.SetMany(entries); err != nil {
+            call.err = err
+        } else {
+            call.values = values
+        }
+    }
+
+    g.mutex.Lock()
+    for _, key := range keys {
+        delete(g.inflight, key)
+    }
+    g.mutex.Unlock()
+    close(call.done)
+}
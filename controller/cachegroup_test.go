@@ -0,0 +1,160 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "reflect"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// echoLoader returns a batch loader that maps each key to "v:" + key,
+// counting calls and recording the keys of each.
+func echoLoader(calls *atomic.Int32, mu *sync.Mutex, batches *[][]string, release <-chan struct{}) func([]string) (map[string]interface{}, error) {
+    return func(keys []string) (map[string]interface{}, error) {
+        calls.Add(1)
+        batch := append([]string(nil), keys...)
+        sort.Strings(batch)
+        mu.Lock()
+        *batches = append(*batches, batch)
+        mu.Unlock()
+        if release != nil {
+            <-release
+        }
+        values := make(map[string]interface{}, len(keys))
+        for _, key := range keys {
+            values[key] = "v:" + key
+        }
+        return values, nil
+    }
+}
+
+func TestGetMultiLoadsOnlyMisses(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    cache.Set("a", "cached", 0)
+    group := NewCacheGroup(cache, time.Minute)
+    var (
+        calls   atomic.Int32
+        mu      sync.Mutex
+        batches [][]string
+    )
+
+    got, err := group.GetMulti(context.Background(), []string{"a", "b", "c", "b"}, echoLoader(&calls, &mu, &batches, nil))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]interface{}{"a": "cached", "b": "v:b", "c": "v:c"}
+    if !reflect.DeepEqual(got, want) {
+        t.Fatalf("GetMulti = %v, want %v", got, want)
+    }
+    if !reflect.DeepEqual(batches, [][]string{{"b", "c"}}) {
+        t.Fatalf("loader batches = %v, want one batch of b and c", batches)
+    }
+    if ttl, ok := cache.TTL("b"); !ok || ttl != time.Minute {
+        t.Fatalf("TTL(b) = %v, %v; want the group TTL", ttl, ok)
+    }
+
+    if _, err := group.GetMulti(context.Background(), []string{"a", "b", "c"}, echoLoader(&calls, &mu, &batches, nil)); err != nil || calls.Load() != 1 {
+        t.Fatalf("GetMulti of cached keys = %v after %d loader calls, want no new call", err, calls.Load())
+    }
+}
+
+func TestGetMultiConcurrentCallsLoadOnce(t *testing.T) {
+    cache := NewLRUCache(100)
+    group := NewCacheGroup(cache, 0)
+    var (
+        calls   atomic.Int32
+        mu      sync.Mutex
+        batches [][]string
+    )
+    release := make(chan struct{})
+    loader := echoLoader(&calls, &mu, &batches, release)
+    keys := []string{"x", "y", "z"}
+
+    const callers = 10
+    var wg sync.WaitGroup
+    start := make(chan struct{})
+    results := make([]map[string]interface{}, callers)
+    errs := make([]error, callers)
+    for i := 0; i < callers; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            <-start
+            results[i], errs[i] = group.GetMulti(context.Background(), keys, loader)
+        }(i)
+    }
+    close(start)
+    // Give every caller time to find the keys in flight.
+    time.Sleep(50 * time.Millisecond)
+    close(release)
+    wg.Wait()
+
+    if n := calls.Load(); n != 1 {
+        t.Fatalf("loader called %d times, want 1: %v", n, batches)
+    }
+    want := map[string]interface{}{"x": "v:x", "y": "v:y", "z": "v:z"}
+    for i := range results {
+        if errs[i] != nil || !reflect.DeepEqual(results[i], want) {
+            t.Fatalf("caller %d got %v, %v", i, results[i], errs[i])
+        }
+    }
+}
+
+func TestGetMultiOverlappingKeys(t *testing.T) {
+    cache := NewLRUCache(100)
+    group := NewCacheGroup(cache, 0)
+    var (
+        calls   atomic.Int32
+        mu      sync.Mutex
+        batches [][]string
+    )
+    release := make(chan struct{})
+    first := make(chan map[string]interface{})
+    go func() {
+        values, _ := group.GetMulti(context.Background(), []string{"a", "b"}, echoLoader(&calls, &mu, &batches, release))
+        first <- values
+    }()
+    for calls.Load() == 0 {
+        time.Sleep(time.Millisecond)
+    }
+
+    // b is being loaded by the first call, so only c is loaded here.
+    second := make(chan map[string]interface{})
+    go func() {
+        values, _ := group.GetMulti(context.Background(), []string{"b", "c"}, echoLoader(&calls, &mu, &batches, nil))
+        second <- values
+    }()
+    for calls.Load() == 1 {
+        time.Sleep(time.Millisecond)
+    }
+    close(release)
+
+    if got := <-first; len(got) != 2 {
+        t.Fatalf("first call = %v", got)
+    }
+    if got := <-second; !reflect.DeepEqual(got, map[string]interface{}{"b": "v:b", "c": "v:c"}) {
+        t.Fatalf("second call = %v", got)
+    }
+    if fmt.Sprint(batches) != "[[a b] [c]]" {
+        t.Fatalf("loader batches = %v, want [a b] then [c]", batches)
+    }
+}
+
+func TestGetMultiLoaderError(t *testing.T) {
+    group := NewCacheGroup(NewLRUCache(10), 0)
+    _, err := group.GetMulti(context.Background(), []string{"a"}, func([]string) (map[string]interface{}, error) {
+        return nil, errors.New("database down")
+    })
+    if !errors.Is(err, ErrBackend) {
+        t.Fatalf("GetMulti error = %v, want ErrBackend", err)
+    }
+    if len(group.inflight) != 0 {
+        t.Fatalf("keys left in flight after a failure: %v", group.inflight)
+    }
+}
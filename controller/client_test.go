@@ -0,0 +1,123 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/yashikajain0312/LRUCacheAssignment/client"
+)
+
+// newClientServer serves cache's API on an httptest server, with the
+// /cache routes served by ServeHTTP, and returns a client for it.
+func newClientServer(t *testing.T, cache *LRUCache) *client.Client {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.GET("/stats", statsHandler(cache))
+    router.GET("/cache-state", cacheStateHandler(cache))
+    router.POST("/cache-views/batch", batchHandler(cache, noLimits))
+    router.Any("/cache/*path", gin.WrapH(http.StripPrefix("/cache", cache)))
+    server := httptest.NewServer(router)
+    t.Cleanup(server.Close)
+
+    c := client.New(server.URL, "", 5*time.Second)
+    c.RetryDelay = time.Millisecond
+    return c
+}
+
+func TestClientAgainstHandlers(t *testing.T) {
+    cache := NewLRUCache(10)
+    c := newClientServer(t, cache)
+    ctx := context.Background()
+
+    if err := c.Set(ctx, "user:1", map[string]interface{}{"name": "Alice"}, time.Hour); err != nil {
+        t.Fatal(err)
+    }
+    value, found, err := c.Get(ctx, "user:1")
+    if err != nil || !found || string(value) != `{"name":"Alice"}` {
+        t.Fatalf("Get = %s, %v, %v", value, found, err)
+    }
+    if ttl, ok := cache.TTL("user:1"); !ok || ttl <= 0 || ttl > time.Hour {
+        t.Fatalf("TTL = %v, %v; want at most an hour", ttl, ok)
+    }
+
+    if _, found, err := c.Get(ctx, "missing"); err != nil || found {
+        t.Fatalf("Get(missing) = %v, %v; want a soft miss", found, err)
+    }
+    if err := c.Delete(ctx, "missing"); !errors.Is(err, client.ErrNotFound) {
+        t.Fatalf("Delete(missing) = %v, want ErrNotFound", err)
+    }
+
+    items := []client.Item{{Key: "user:2", Value: 2}, {Key: "user:3", Value: 3}, {Key: "other", Value: "x"}}
+    if err := c.SetMany(ctx, items); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.Delete(ctx, "user:1"); err != nil {
+        t.Fatal(err)
+    }
+
+    stats, err := c.Stats(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if stats.Size != 3 || stats.Capacity != 10 || stats.Inserts != 4 || stats.Deletes != 1 {
+        t.Fatalf("Stats = %+v", stats)
+    }
+
+    var keys []string
+    opts := client.StateOptions{Prefix: "user:", Limit: 1}
+    for {
+        entries, next, err := c.State(ctx, opts)
+        if err != nil {
+            t.Fatal(err)
+        }
+        for _, entry := range entries {
+            keys = append(keys, entry.Key)
+        }
+        if next == "" {
+            break
+        }
+        opts.After = next
+    }
+    if len(keys) != 2 || keys[0] != "user:2" || keys[1] != "user:3" {
+        t.Fatalf("State pages listed %v", keys)
+    }
+}
+
+func TestClientReportsValidationErrors(t *testing.T) {
+    c := newClientServer(t, NewLRUCache(10))
+
+    err := c.Set(context.Background(), "bad key", 1, 0)
+    var apiErr *client.APIError
+    if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+        t.Fatalf("Set(bad key) = %v, want a 400 APIError", err)
+    }
+}
+
+func TestClientRetriesUnavailableReads(t *testing.T) {
+    attempts := 0
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        attempts++
+        if attempts < 3 {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{"value": 1})
+    }))
+    defer server.Close()
+
+    c := client.New(server.URL, "", time.Second)
+    c.RetryDelay = time.Millisecond
+    if value, found, err := c.Get(context.Background(), "k"); err != nil || !found || string(value) != "1" {
+        t.Fatalf("Get = %s, %v, %v after %d attempts", value, found, err, attempts)
+    }
+    if attempts != 3 {
+        t.Fatalf("%d attempts, want 3", attempts)
+    }
+}
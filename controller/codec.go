@@ -0,0 +1,74 @@
+package main
+
+import (
+    "bytes"
+    "encoding/gob"
+    "encoding/json"
+)
+
+// Codec encodes values for storage outside the process and decodes them
+// back.
+type Codec interface {
+    Marshal(v interface{}) ([]byte, error)
+    Unmarshal(data []byte) (interface{}, error)
+}
+
+// WithCodec sets the codec binary snapshots encode values with, except
+// strings, numbers, booleans, nil, and the slices and maps of them that
+// encoding/json produces, which the format stores directly. A snapshot
+// must be loaded by a cache using the codec it was saved with. The
+// default is JSONCodec. JSON snapshots and the append-only log always use
+// JSON.
+func WithCodec(codec Codec) Option {
+    return func(c *LRUCache) {
+        c.codec = codec
+    }
+}
+
+// JSONCodec encodes values as JSON. Any value encoding/json accepts can be
+// encoded, and is decoded as the types encoding/json decodes into an
+// interface{}: structs come back as map[string]interface{} and numbers as
+// float64.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+    return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte) (interface{}, error) {
+    var v interface{}
+    if err := json.Unmarshal(data, &v); err != nil {
+        return nil, err
+    }
+    return v, nil
+}
+
+// GobCodec encodes values with encoding/gob, so they are decoded with
+// their original Go types. Values are encoded as interfaces, so every
+// concrete type stored, other than the predeclared types and slices and
+// maps of them, must be registered with gob.Register in both the process
+// encoding and the one decoding, or Marshal and Unmarshal fail. Only Go
+// programs can read the result.
+type GobCodec struct{}
+
+// gobValue wraps a value so gob records its concrete type and accepts
+// nil.
+type gobValue struct {
+    V interface{}
+}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+    var buf bytes.Buffer
+    if err := gob.NewEncoder(&buf).Encode(gobValue{V: v}); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte) (interface{}, error) {
+    var value gobValue
+    if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value); err != nil {
+        return nil, err
+    }
+    return value.V, nil
+}
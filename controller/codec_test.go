@@ -0,0 +1,128 @@
+package main
+
+import (
+    "bytes"
+    "encoding/gob"
+    "reflect"
+    "testing"
+)
+
+type codecAddress struct {
+    City string
+    Zip  int
+}
+
+type codecUser struct {
+    Name    string
+    Tags    []string
+    Address *codecAddress
+    Scores  map[string]float64
+    Friends []codecUser
+}
+
+func init() {
+    gob.Register(codecUser{})
+}
+
+// nestedUser returns a value with nested structs, pointers, slices and
+// maps.
+func nestedUser() codecUser {
+    return codecUser{
+        Name:    "ada",
+        Tags:    []string{"admin", "ops"},
+        Address: &codecAddress{City: "London", Zip: 1815},
+        Scores:  map[string]float64{"math": 9.5},
+        Friends: []codecUser{{Name: "charles", Address: &codecAddress{City: "Teignmouth"}}},
+    }
+}
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+    for _, tc := range []struct {
+        name  string
+        value interface{}
+        want  interface{}
+    }{
+        {"nil", nil, nil},
+        {"string", "hello", "hello"},
+        {"number", 42, float64(42)},
+        {"nested struct", nestedUser(), map[string]interface{}{
+            "Name":    "ada",
+            "Tags":    []interface{}{"admin", "ops"},
+            "Address": map[string]interface{}{"City": "London", "Zip": float64(1815)},
+            "Scores":  map[string]interface{}{"math": 9.5},
+            "Friends": []interface{}{map[string]interface{}{
+                "Name": "charles", "Tags": nil, "Scores": nil, "Friends": nil,
+                "Address": map[string]interface{}{"City": "Teignmouth", "Zip": float64(0)},
+            }},
+        }},
+    } {
+        data, err := JSONCodec{}.Marshal(tc.value)
+        if err != nil {
+            t.Fatalf("%s: Marshal: %v", tc.name, err)
+        }
+        got, err := JSONCodec{}.Unmarshal(data)
+        if err != nil {
+            t.Fatalf("%s: Unmarshal: %v", tc.name, err)
+        }
+        if !reflect.DeepEqual(got, tc.want) {
+            t.Errorf("%s: round trip = %#v, want %#v", tc.name, got, tc.want)
+        }
+    }
+    if _, err := (JSONCodec{}).Marshal(make(chan int)); err == nil {
+        t.Error("JSONCodec encoded a channel")
+    }
+}
+
+func TestGobCodecRoundTrip(t *testing.T) {
+    for _, tc := range []struct {
+        name  string
+        value interface{}
+    }{
+        {"nil", nil},
+        {"string", "hello"},
+        {"int", 42},
+        {"slice", []string{"a", "b"}},
+        {"nested struct", nestedUser()},
+    } {
+        data, err := GobCodec{}.Marshal(tc.value)
+        if err != nil {
+            t.Fatalf("%s: Marshal: %v", tc.name, err)
+        }
+        got, err := GobCodec{}.Unmarshal(data)
+        if err != nil {
+            t.Fatalf("%s: Unmarshal: %v", tc.name, err)
+        }
+        if !reflect.DeepEqual(got, tc.value) {
+            t.Errorf("%s: round trip = %#v, want %#v", tc.name, got, tc.value)
+        }
+    }
+
+    // Types that were not registered cannot be encoded.
+    if _, err := (GobCodec{}).Marshal(codecAddress{City: "Paris"}); err == nil {
+        t.Error("GobCodec encoded an unregistered type")
+    }
+    if _, err := (GobCodec{}).Unmarshal([]byte("not gob")); err == nil {
+        t.Error("GobCodec decoded garbage")
+    }
+}
+
+func TestBinarySnapshotUsesCodec(t *testing.T) {
+    cache := NewLRUCache(10, WithCodec(GobCodec{}))
+    cache.Set("user", nestedUser(), 0)
+    cache.Set("nil", nil, 0)
+    var buf bytes.Buffer
+    if err := cache.SaveSnapshotBinary(&buf); err != nil {
+        t.Fatal(err)
+    }
+
+    restored := NewLRUCache(10, WithCodec(GobCodec{}))
+    if err := restored.LoadSnapshot(&buf); err != nil {
+        t.Fatal(err)
+    }
+    if got := restored.Get("user"); !reflect.DeepEqual(got, nestedUser()) {
+        t.Fatalf("restored user = %#v", got)
+    }
+    if !restored.ContainsKey("nil") || restored.Get("nil") != nil {
+        t.Fatal("the nil value was not restored")
+    }
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// notModified sets the Last-Modified header from modifiedAt and, if the
+// request's If-Modified-Since is at or after it, responds with 304 Not
+// Modified and reports true. HTTP dates have one second resolution, so
+// modifiedAt is truncated before comparing.
+func notModified(c *gin.Context, modifiedAt time.Time) bool {
+    if modifiedAt.IsZero() {
+        return false
+    }
+    modifiedAt = modifiedAt.Truncate(time.Second)
+    c.Header("Last-Modified", modifiedAt.UTC().Format(http.TimeFormat))
+
+    since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+    if err != nil || modifiedAt.After(since) {
+        return false
+    }
+    c.Status(http.StatusNotModified)
+    return true
+}
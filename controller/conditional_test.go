@@ -0,0 +1,56 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestGetHandlerIfModifiedSince(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    router := gin.New()
+    router.GET("/cache/:key", getHandler(cache, 0, false))
+    get := func(ifModifiedSince string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodGet, "/cache/k", nil)
+        if ifModifiedSince != "" {
+            req.Header.Set("If-Modified-Since", ifModifiedSince)
+        }
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, req)
+        return rec
+    }
+
+    clock.Advance(500 * time.Millisecond)
+    cache.Set("k", "v1", 0)
+    rec := get("")
+    lastModified := rec.Header().Get("Last-Modified")
+    if rec.Code != http.StatusOK || lastModified != clock.Now().UTC().Format(http.TimeFormat) {
+        t.Fatalf("first GET = %d, Last-Modified %q", rec.Code, lastModified)
+    }
+
+    // The sub-second part of the write time is dropped, as in the header.
+    if rec := get(lastModified); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+        t.Fatalf("GET since Last-Modified = %d %s, want 304", rec.Code, rec.Body)
+    }
+    if rec := get(clock.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); rec.Code != http.StatusNotModified {
+        t.Fatalf("GET since a later time = %d, want 304", rec.Code)
+    }
+    if rec := get("not a date"); rec.Code != http.StatusOK {
+        t.Fatalf("GET with an invalid date = %d, want 200", rec.Code)
+    }
+
+    clock.Advance(2 * time.Second)
+    cache.Set("k", "v2", 0)
+    rec = get(lastModified)
+    if rec.Code != http.StatusOK || rec.Body.String() != `{"value":"v2"}` {
+        t.Fatalf("GET after an update = %d %s, want 200 with v2", rec.Code, rec.Body)
+    }
+    if got := rec.Header().Get("Last-Modified"); got != clock.Now().UTC().Format(http.TimeFormat) {
+        t.Fatalf("Last-Modified after an update = %q", got)
+    }
+}
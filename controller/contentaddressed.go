@@ -0,0 +1,145 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "io"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ContentAddressedCache is a view over an LRUCache storing immutable
+// blobs under the hex SHA-256 of their content, so identical blobs are
+// stored once:
+//
+//   blobs := NewContentAddressedCache(cache)
+//   hash, err := blobs.SetCA(rendered, time.Hour)
+//   ...
+//   if rendered, ok := blobs.GetCA(hash); ok {
+//       w.Write(rendered)
+//   }
+//
+// Hashes share the cache's key space with every other key.
+type ContentAddressedCache struct {
+    cache *LRUCache
+}
+
+// NewContentAddressedCache returns a content-addressed view over cache.
+func NewContentAddressedCache(cache *LRUCache) *ContentAddressedCache {
+    return &ContentAddressedCache{cache: cache}
+}
+
+// ContentHash returns the key value is stored under: the lowercase hex
+// SHA-256 of value.
+func ContentHash(value []byte) string {
+    sum := sha256.Sum256(value)
+    return hex.EncodeToString(sum[:])
+}
+
+// SetCA stores value under its ContentHash for ttl, or without a TTL if it
+// is not positive, and returns the hash. Storing a blob already present
+// only resets its TTL. It fails like LRUCache.Set.
+func (ca *ContentAddressedCache) SetCA(value []byte, ttl time.Duration) (string, error) {
+    hash := ContentHash(value)
+    if err := ca.cache.Set(hash, value, ttl); err != nil {
+        return "", err
+    }
+    return hash, nil
+}
+
+// GetCA returns the blob stored under hash and whether it was found. The
+// blob is checked against its hash, so anything else stored under the key
+// is reported as a miss.
+func (ca *ContentAddressedCache) GetCA(hash string) ([]byte, bool) {
+    var value []byte
+    switch v := ca.cache.Get(hash).(type) {
+    case []byte:
+        value = v
+    case string:
+        // A JSON snapshot restores byte slices as base64 strings.
+        decoded, err := base64.StdEncoding.DecodeString(v)
+        if err != nil {
+            return nil, false
+        }
+        value = decoded
+    default:
+        return nil, false
+    }
+    if ContentHash(value) != hash {
+        return nil, false
+    }
+    return value, true
+}
+
+// validContentHash reports whether hash is a lowercase hex SHA-256.
+func validContentHash(hash string) bool {
+    if len(hash) != 2*sha256.Size {
+        return false
+    }
+    for _, r := range hash {
+        if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+            return false
+        }
+    }
+    return true
+}
+
+// contentAddressedSetHandler serves POST /cache-views/content-addressed,
+// which stores the raw request body and responds with its hash. The
+// optional expiration query parameter is the TTL in seconds.
+func contentAddressedSetHandler(ca *ContentAddressedCache, limits writeLimits) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var expiration int64
+        if raw := c.Query("expiration"); raw != "" {
+            var err error
+            if expiration, err = strconv.ParseInt(raw, 10, 64); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "expiration", Reason: "must be an integer"}}})
+                return
+            }
+        }
+        if errs := limits.validateExpiration(expiration); len(errs) > 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": errs})
+            return
+        }
+        value, err := io.ReadAll(c.Request.Body)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        hash, err := ca.SetCA(value, time.Duration(expiration)*time.Second)
+        if err != nil {
+            c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"hash": hash})
+    }
+}
+
+// contentAddressedGetHandler serves GET
+// /cache-views/content-addressed/:hash, responding with the raw blob. The
+// content never changes, so the hash doubles as its ETag.
+func contentAddressedGetHandler(ca *ContentAddressedCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        hash := c.Param("hash")
+        if !validContentHash(hash) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "hash", Reason: "must be a lowercase hex SHA-256"}}})
+            return
+        }
+        value, ok := ca.GetCA(hash)
+        if !ok {
+            c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+            return
+        }
+        etag := `"` + hash + `"`
+        c.Header("ETag", etag)
+        if c.GetHeader("If-None-Match") == etag {
+            c.Status(http.StatusNotModified)
+            return
+        }
+        c.Data(http.StatusOK, "application/octet-stream", value)
+    }
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+    "slices"
+    "time"
+)
+
+// SetWithDeps is like Set but records that the value was computed from the
+// entries for deps. When any of them is updated or leaves the cache, for
+// whatever reason, key is invalidated too, and so on transitively.
+// Dependencies on keys not currently cached are kept, and a key cannot
+// depend on itself. Cycles are broken at the first key found already
+// removed, so each entry is invalidated at most once. Overwriting key
+// with Set drops its dependencies. It fails when Set would.
+func (c *LRUCache) SetWithDeps(key string, value interface{}, ttl time.Duration, deps []string) error {
+    if err := c.checkWritable("set", key); err != nil {
+        return err
+    }
+
+    c.mutex.Lock()
+    defer c.unlock()
+
+    c.set(key, value, c.expirationTime(ttl))
+    element, ok := c.cache[key]
+    if !ok {
+        // Evicted straight away by the byte budget.
+        return nil
+    }
+    entry := element.Value.(*cacheEntry)
+    for _, dep := range deps {
+        if dep == key || slices.Contains(entry.deps, dep) {
+            continue
+        }
+        entry.deps = append(entry.deps, dep)
+        if c.dependants == nil {
+            c.dependants = make(map[string][]string)
+        }
+        c.dependants[dep] = append(c.dependants[dep], key)
+    }
+    return nil
+}
+
+// dropDeps removes the dependency edges recorded for entry. The caller
+// must hold the lock.
+func (c *LRUCache) dropDeps(entry *cacheEntry) {
+    for _, dep := range entry.deps {
+        dependants := slices.DeleteFunc(c.dependants[dep], func(k string) bool { return k == entry.key })
+        if len(dependants) == 0 {
+            delete(c.dependants, dep)
+        } else {
+            c.dependants[dep] = dependants
+        }
+    }
+    entry.deps = nil
+}
+
+// invalidateDependants removes every entry that depends on key. Removing
+// them invalidates their own dependants in turn. The caller must hold the
+// lock.
+func (c *LRUCache) invalidateDependants(key string) {
+    dependants, ok := c.dependants[key]
+    if !ok {
+        return
+    }
+    delete(c.dependants, key)
+    for _, dependant := range dependants {
+        if element, ok := c.cache[dependant]; ok {
+            c.removeElement(element, removedInvalidated, "")
+        }
+    }
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+    "reflect"
+    "sort"
+    "testing"
+)
+
+// removals returns the keys removed from cache with reason, sorted.
+func removals(cache *LRUCache, reason removalReason) []string {
+    keys := []string{}
+    for _, event := range cache.RemovalEvents("", 100) {
+        if event.Reason == reason.String() {
+            keys = append(keys, event.Key)
+        }
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// chainedCache returns a cache holding the chain price <- total <- summary,
+// where each entry depends on the one before, and an unrelated entry.
+func chainedCache(t *testing.T, capacity int) *LRUCache {
+    t.Helper()
+    cache := NewLRUCache(capacity)
+    cache.Set("price", 10, 0)
+    if err := cache.SetWithDeps("total", 20, 0, []string{"price"}); err != nil {
+        t.Fatal(err)
+    }
+    if err := cache.SetWithDeps("summary", "total 20", 0, []string{"total"}); err != nil {
+        t.Fatal(err)
+    }
+    cache.Set("unrelated", 1, 0)
+    return cache
+}
+
+func TestDepsChainInvalidation(t *testing.T) {
+    for name, change := range map[string]func(cache *LRUCache){
+        "delete": func(cache *LRUCache) { cache.Delete("price") },
+        "update": func(cache *LRUCache) { cache.Set("price", 11, 0) },
+        "evict": func(cache *LRUCache) {
+            cache.Get("total")
+            cache.Get("summary")
+            cache.Get("unrelated")
+            cache.Set("new", 1, 0)
+        },
+    } {
+        cache := chainedCache(t, 4)
+        change(cache)
+        if cache.ContainsKey("total") || cache.ContainsKey("summary") {
+            t.Errorf("%s: dependants survived: %v", name, viewKeys(cache.Snapshot()))
+        }
+        if !cache.ContainsKey("unrelated") {
+            t.Errorf("%s: an unrelated entry was invalidated", name)
+        }
+        if got := removals(cache, removedInvalidated); !reflect.DeepEqual(got, []string{"summary", "total"}) {
+            t.Errorf("%s: invalidated %v, want summary and total", name, got)
+        }
+        if len(cache.dependants) != 0 {
+            t.Errorf("%s: dependency edges left: %v", name, cache.dependants)
+        }
+        checkConsistent(t, cache)
+    }
+}
+
+func TestDepsMiddleOfChain(t *testing.T) {
+    cache := chainedCache(t, 10)
+    cache.Delete("total")
+    if !cache.ContainsKey("price") || cache.ContainsKey("summary") {
+        t.Fatalf("entries after deleting total = %v, want price kept and summary gone", viewKeys(cache.Snapshot()))
+    }
+}
+
+func TestDepsCycle(t *testing.T) {
+    cache := NewLRUCache(10)
+    // a depends on b before b exists, then b depends on a.
+    if err := cache.SetWithDeps("a", 1, 0, []string{"b", "a"}); err != nil {
+        t.Fatal(err)
+    }
+    if err := cache.SetWithDeps("b", 2, 0, []string{"a"}); err != nil {
+        t.Fatal(err)
+    }
+    cache.Set("c", 3, 0)
+
+    cache.Delete("a")
+    if cache.ContainsKey("b") || !cache.ContainsKey("c") {
+        t.Fatalf("entries after deleting a = %v, want only c", viewKeys(cache.Snapshot()))
+    }
+    if got := removals(cache, removedInvalidated); !reflect.DeepEqual(got, []string{"b"}) {
+        t.Fatalf("invalidated %v, want b once", got)
+    }
+    checkConsistent(t, cache)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+)
+
+// Errors returned by cache operations, always wrapped in a *CacheError.
+// Use errors.Is to test for them.
+var (
+    // ErrNotFound means the key is not in the cache.
+    ErrNotFound = errors.New("key not found")
+    // ErrExpired means the key was present but its TTL had elapsed. The
+    // entry is removed by the lookup that reports it.
+    ErrExpired = errors.New("key expired")
+    // ErrVersionMismatch means a compare-and-swap found the entry changed
+    // since the version it was given was read.
+    ErrVersionMismatch = errors.New("version mismatch")
+    // ErrBackend means a source the cache reads from, such as a warm-up
+    // URL, failed.
+    ErrBackend = errors.New("backend failure")
+    // ErrBackendUnavailable means the loader was not called because it
+    // has been failing; see WithCircuitBreaker.
+    ErrBackendUnavailable = errors.New("backend unavailable")
+    // ErrLoaderBusy means the loader was not called because as many loads
+    // as allowed were already running; see WithLoaderConcurrency.
+    ErrLoaderBusy = errors.New("too many concurrent loads")
+    // ErrNoLoader means the operation needs a loader and none is
+    // configured.
+    ErrNoLoader = errors.New("no loader configured")
+    // ErrReadOnly means a write was attempted while the cache is in
+    // read-only mode.
+    ErrReadOnly = errors.New("cache is read-only")
+    // ErrReplica means a write was attempted on a replica, which only
+    // applies the writes of its primary; see StartReplica.
+    ErrReplica = errors.New("cache is a read-only replica")
+    // ErrBusy means an operation gave up waiting for the cache lock; see
+    // TryGet and TrySet.
+    ErrBusy = errors.New("cache busy")
+    // ErrWriteBehindFull means a write was refused because the
+    // write-behind queue was full; see StartWriteBehind.
+    ErrWriteBehindFull = errors.New("write-behind queue full")
+    // ErrLeaseExpired means a Lease was used after it timed out or was
+    // released.
+    ErrLeaseExpired = errors.New("lease expired")
+)
+
+// CacheError describes a failed cache operation. Err is one of the Err*
+// values above, possibly wrapping the underlying cause.
+type CacheError struct {
+    Op  string
+    Key string
+    Err error
+}
+
+func (e *CacheError) Error() string {
+    if e.Key == "" {
+        return "cache " + e.Op + ": " + e.Err.Error()
+    }
+    return "cache " + e.Op + " " + strconv.Quote(e.Key) + ": " + e.Err.Error()
+}
+
+func (e *CacheError) Unwrap() error {
+    return e.Err
+}
+
+// errorStatus maps an error returned by a cache operation to the HTTP
+// status the API reports for it.
+func errorStatus(err error) int {
+    switch {
+    case errors.Is(err, ErrNotFound), errors.Is(err, ErrExpired):
+        return http.StatusNotFound
+    case errors.Is(err, ErrVersionMismatch):
+        return http.StatusConflict
+    case errors.Is(err, ErrLoaderBusy), errors.Is(err, ErrWriteBehindFull), errors.Is(err, ErrBusy):
+        return http.StatusServiceUnavailable
+    case errors.Is(err, ErrBackend):
+        return http.StatusBadGateway
+    case errors.Is(err, ErrBackendUnavailable):
+        return http.StatusServiceUnavailable
+    case errors.Is(err, ErrNoLoader):
+        return http.StatusNotImplemented
+    case errors.Is(err, ErrReadOnly):
+        return http.StatusServiceUnavailable
+    case errors.Is(err, ErrReplica):
+        return http.StatusForbidden
+    }
+    return http.StatusInternalServerError
+}
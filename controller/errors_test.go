@@ -0,0 +1,59 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestCacheErrorsMatchSentinels(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("expiring", 1, 10*time.Millisecond)
+    cache.Set("versioned", 1, 0)
+    time.Sleep(20 * time.Millisecond)
+
+    cache.mutex.RLock()
+    version := cache.cache["versioned"].Value.(*cacheEntry).version
+    cache.mutex.RUnlock()
+    cache.Set("versioned", 2, 0)
+
+    failing := NewLRUCache(10, WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        return nil, 0, errors.New("database down")
+    })))
+    replica := NewLRUCache(10)
+    replica.SetReadOnly(true)
+
+    cases := []struct {
+        name   string
+        err    error
+        want   error
+        status int
+    }{
+        {"missing", errorOf(cache.GetCtx(context.Background(), "missing")), ErrNotFound, http.StatusNotFound},
+        {"expired", errorOf(cache.GetCtx(context.Background(), "expiring")), ErrExpired, http.StatusNotFound},
+        {"cas changed", cache.compareAndSwap("versioned", 3, 0, false, version), ErrVersionMismatch, http.StatusConflict},
+        {"cas missing", cache.compareAndSwap("missing", 3, 0, false, version), ErrNotFound, http.StatusNotFound},
+        {"loader", errorOf(failing.GetCtx(context.Background(), "k")), ErrBackend, http.StatusBadGateway},
+        {"read-only", replica.Set("k", 1, 0), ErrReadOnly, http.StatusServiceUnavailable},
+    }
+    for _, tc := range cases {
+        var cacheErr *CacheError
+        if !errors.Is(tc.err, tc.want) || !errors.As(tc.err, &cacheErr) {
+            t.Errorf("%s: err = %v, want a *CacheError wrapping %v", tc.name, tc.err, tc.want)
+            continue
+        }
+        if status := errorStatus(tc.err); status != tc.status {
+            t.Errorf("%s: errorStatus = %d, want %d", tc.name, status, tc.status)
+        }
+    }
+    if value := cache.Get("versioned"); value != 2 {
+        t.Fatalf("a mismatched cas stored %v", value)
+    }
+}
+
+// errorOf returns the error of a two-value call.
+func errorOf(_ interface{}, err error) error {
+    return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// defaultEventLogSize is the number of removal events kept when
+// WithEventLogSize is not used.
+const defaultEventLogSize = 1000
+
+// RemovalEvent records why an entry left the cache. DisplacedBy is the key
+// whose insertion caused a capacity eviction, and is empty for every other
+// reason or when the eviction was caused by Resize or Merge.
+type RemovalEvent struct {
+    Key         string    `json:"key"`
+    Reason      string    `json:"reason"`
+    Time        time.Time `json:"time"`
+    DisplacedBy string    `json:"displaced_by,omitempty"`
+}
+
+// String returns the name reported for reason in RemovalEvent.
+func (r removalReason) String() string {
+    switch r {
+    case removedCapacity:
+        return "capacity"
+    case removedExpired:
+        return "expired"
+    case removedDeleted:
+        return "deleted"
+    case removedCleared:
+        return "cleared"
+    case removedInvalidated:
+        return "invalidated"
+    }
+    return "unknown"
+}
+
+// queueEvent queues a removal event to be recorded once the write lock is
+// released. The caller must hold the lock.
+func (c *LRUCache) queueEvent(key string, reason removalReason, displacedBy string) {
+    if c.events == nil {
+        return
+    }
+    if displacedBy == key {
+        // An entry too large for the byte budget evicts itself.
+        displacedBy = ""
+    }
+    c.pendingEvents = append(c.pendingEvents, RemovalEvent{
+        Key:         key,
+        Reason:      reason.String(),
+        Time:        c.now(),
+        DisplacedBy: displacedBy,
+    })
+}
+
+// RemovalEvents returns up to limit of the most recent removal events,
+// newest first. When key is not empty only events for that key are
+// returned.
+func (c *LRUCache) RemovalEvents(key string, limit int) []RemovalEvent {
+    return c.events.recent(limit, func(event RemovalEvent) bool {
+        return key == "" || event.Key == key
+    })
+}
+
+// eventsHandler serves GET /admin/events. The optional key parameter
+// filters by key and limit caps the number of events returned (default
+// 100).
+func eventsHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        limit := 100
+        if raw := c.Query("limit"); raw != "" {
+            n, err := strconv.Atoi(raw)
+            if err != nil || n < 1 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+                return
+            }
+            limit = n
+        }
+        respond(c, http.StatusOK, gin.H{"events": cache.RemovalEvents(c.Query("key"), limit)})
+    }
+}
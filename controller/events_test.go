@@ -0,0 +1,84 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestRemovalEventReasons(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(3, WithClock(clock.Now))
+    cache.Set("evicted", 1, 0)
+    cache.Set("expired", 2, time.Second)
+    cache.Set("deleted", 3, 0)
+    cache.Set("displacer", 4, 0)
+    clock.Advance(time.Minute)
+    cache.Get("expired")
+    cache.Delete("deleted")
+    cache.Set("parent", 5, 0)
+    cache.SetWithDeps("child", 6, 0, []string{"parent"})
+    cache.Set("parent", 7, 0)
+    cache.ClearCache()
+
+    for _, want := range []RemovalEvent{
+        {Key: "evicted", Reason: "capacity", DisplacedBy: "displacer", Time: clock.Now().Add(-time.Minute)},
+        {Key: "expired", Reason: "expired", Time: clock.Now()},
+        {Key: "deleted", Reason: "deleted", Time: clock.Now()},
+        {Key: "child", Reason: "invalidated", Time: clock.Now()},
+        {Key: "parent", Reason: "cleared", Time: clock.Now()},
+    } {
+        events := cache.RemovalEvents(want.Key, 10)
+        if len(events) != 1 || events[0] != want {
+            t.Errorf("events for %s = %+v, want %+v", want.Key, events, want)
+        }
+    }
+    if events := cache.RemovalEvents("", 2); len(events) != 2 || events[0].Reason != "cleared" {
+        t.Fatalf("RemovalEvents(\"\", 2) = %+v, want the newest two", events)
+    }
+}
+
+func TestEventLogIsBounded(t *testing.T) {
+    cache := NewLRUCache(10, WithEventLogSize(3))
+    for _, key := range []string{"a", "b", "c", "d"} {
+        cache.Set(key, 1, 0)
+        cache.Delete(key)
+    }
+    events := cache.RemovalEvents("", 10)
+    if len(events) != 3 || events[0].Key != "d" || events[2].Key != "b" {
+        t.Fatalf("events = %+v, want the newest three", events)
+    }
+}
+
+func TestEventsHandler(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(10)
+    for _, key := range []string{"a", "b", "a"} {
+        cache.Set(key, 1, 0)
+        cache.Delete(key)
+    }
+    router := gin.New()
+    router.GET("/admin/events", eventsHandler(cache))
+
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/events?key=a&limit=100", nil))
+    var body struct {
+        Events []RemovalEvent `json:"events"`
+    }
+    if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &body) != nil {
+        t.Fatalf("GET /admin/events = %d %s", rec.Code, rec.Body)
+    }
+    if len(body.Events) != 2 || body.Events[0].Key != "a" || body.Events[1].Key != "a" {
+        t.Fatalf("events = %+v, want a's two deletions", body.Events)
+    }
+
+    rec = httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/events?limit=0", nil))
+    if rec.Code != http.StatusBadRequest {
+        t.Fatalf("limit=0 = %d, want 400", rec.Code)
+    }
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+type User struct {
+    Name  string
+    Email string
+}
+
+type UserSession struct {
+    UserID int64
+    Roles  []string
+}
+
+type Token struct {
+    Subject   string
+    ExpiresAt time.Time
+}
+
+func ExampleTypedLRUCache() {
+    users := NewTypedLRUCache[User](NewLRUCache(100))
+    users.Set("alice", User{Name: "Alice", Email: "alice@example.com"}, time.Hour)
+
+    if u, ok := users.Get("alice"); ok {
+        fmt.Println(u.Name, u.Email)
+    }
+    if _, ok := users.Get("bob"); !ok {
+        fmt.Println("bob not cached")
+    }
+    // Output:
+    // Alice alice@example.com
+    // bob not cached
+}
+
+func ExampleTypedLRUCache_sharedCache() {
+    cache := NewLRUCache(100)
+    users := NewTypedLRUCache[User](cache)
+    counts := NewTypedLRUCache[int](cache)
+
+    users.Set("user:alice", User{Name: "Alice"}, 0)
+    counts.Set("count:alice", 3, 0)
+
+    // A value of another type is reported as a miss.
+    _, ok := counts.Get("user:alice")
+    n, _ := counts.Get("count:alice")
+    fmt.Println(ok, n)
+    // Output: false 3
+}
+
+func ExampleMapCache() {
+    sessions := NewMapCache[int64, UserSession](1000, HasherFunc[int64](func(id int64) string {
+        return strconv.FormatInt(id, 10)
+    }))
+    sessions.Set(42, UserSession{UserID: 42, Roles: []string{"admin"}}, 30*time.Minute)
+
+    if s, ok := sessions.Get(42); ok {
+        fmt.Println(s.UserID, s.Roles)
+    }
+    _, ok := sessions.Get(7)
+    fmt.Println(ok)
+    // Output:
+    // 42 [admin]
+    // false
+}
+
+func ExampleMapCache_uuid() {
+    // Without a Hasher, keys are formatted with %v, which for a UUID is
+    // its canonical string form.
+    tokens := NewMapCache[uuid.UUID, Token](1000, nil)
+    id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+    tokens.Set(id, Token{Subject: "alice"}, time.Hour)
+
+    t, ok := tokens.Get(id)
+    fmt.Println(t.Subject, ok)
+    tokens.Delete(id)
+    _, ok = tokens.Get(id)
+    fmt.Println(ok)
+    // Output:
+    // alice true
+    // false
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+    "io"
+    "log/slog"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+)
+
+// importPolicies maps the policy query parameter of POST /admin/import to
+// the ConflictPolicy applied to keys already in the cache.
+var importPolicies = map[string]ConflictPolicy{
+    "skip-existing": KeepExisting,
+    "overwrite":     KeepIncoming,
+    "prefer-newer":  KeepNewer,
+}
+
+// ImportSnapshot reads a snapshot in either format from r and merges it
+// into the cache, resolving keys present in both with conflictPolicy as
+// Merge does. It returns the number of entries read. Like LoadSnapshot, it
+// decodes the whole snapshot before touching the cache.
+func (c *LRUCache) ImportSnapshot(r io.Reader, conflictPolicy ConflictPolicy) (int, error) {
+    items, err := decodeSnapshot(r, c.codec)
+    if err != nil {
+        return 0, err
+    }
+    c.mergeEntries(items, conflictPolicy)
+    return len(items), nil
+}
+
+// exportHandler serves GET /admin/export, streaming a snapshot of the cache
+// as JSON, or in the binary format with ?format=binary. The entries are
+// copied first, so the cache is not locked while the response is written.
+// The response has no length and is sent with chunked encoding.
+func exportHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        write, contentType := cache.writeSnapshot, "application/json"
+        switch c.DefaultQuery("format", "json") {
+        case "json":
+        case "binary":
+            write, contentType = cache.writeBinarySnapshot, "application/octet-stream"
+        default:
+            c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or binary"})
+            return
+        }
+
+        c.Header("Content-Type", contentType)
+        c.Status(http.StatusOK)
+        if _, err := write(c.Writer); err != nil {
+            // The status has been sent, so the client can only notice the
+            // failure from the truncated body.
+            slog.Error("export failed", "error", err)
+        }
+    }
+}
+
+// importHandler serves POST /admin/import, merging a snapshot read from the
+// request body into the cache. The policy query parameter decides what
+// happens to keys already in the cache: skip-existing, overwrite, or
+// prefer-newer (the default), which keeps whichever value was written last.
+func importHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        policy, ok := importPolicies[c.DefaultQuery("policy", "prefer-newer")]
+        if !ok {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "policy must be skip-existing, overwrite or prefer-newer"})
+            return
+        }
+        imported, err := cache.ImportSnapshot(c.Request.Body, policy)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"imported": imported})
+    }
+}
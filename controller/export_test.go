@@ -0,0 +1,119 @@
+package main
+
+import (
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// adminRouter serves the export and import endpoints of cache behind the
+// admin key "secret".
+func adminRouter(cache *LRUCache) *gin.Engine {
+    gin.SetMode(gin.TestMode)
+    auth := authConfig{adminKey: "secret"}
+    router := gin.New()
+    router.GET("/admin/export", auth.requireAdmin(), exportHandler(cache))
+    router.POST("/admin/import", auth.requireAdmin(), rejectWhenReadOnly(cache), importHandler(cache))
+    return router
+}
+
+// adminRequest sends an admin-authenticated request to url.
+func adminRequest(t *testing.T, method, url string, body io.Reader) *http.Response {
+    t.Helper()
+    req, err := http.NewRequest(method, url, body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    req.Header.Set("X-API-Key", "secret")
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return resp
+}
+
+func TestExportImportBetweenCaches(t *testing.T) {
+    for _, format := range []string{"json", "binary"} {
+        source := syntheticCache(500)
+        source.Get("key:3")
+        target := NewLRUCache(500)
+        oldServer := httptest.NewServer(adminRouter(source))
+        newServer := httptest.NewServer(adminRouter(target))
+
+        export := adminRequest(t, http.MethodGet, oldServer.URL+"/admin/export?format="+format, nil)
+        if export.StatusCode != http.StatusOK || export.ContentLength != -1 || len(export.TransferEncoding) == 0 || export.TransferEncoding[0] != "chunked" {
+            t.Fatalf("%s: export = %d, length %d, encoding %v; want a chunked 200", format, export.StatusCode, export.ContentLength, export.TransferEncoding)
+        }
+        imported := adminRequest(t, http.MethodPost, newServer.URL+"/admin/import", export.Body)
+        export.Body.Close()
+        var body struct {
+            Imported int `json:"imported"`
+        }
+        if err := json.NewDecoder(imported.Body).Decode(&body); err != nil || imported.StatusCode != http.StatusOK || body.Imported != 500 {
+            t.Fatalf("%s: import = %d, %+v, %v", format, imported.StatusCode, body, err)
+        }
+        imported.Body.Close()
+        oldServer.Close()
+        newServer.Close()
+
+        if got := cacheContents(target); got != cacheContents(source) {
+            t.Fatalf("%s: imported\n%s\nwant\n%s", format, got, cacheContents(source))
+        }
+    }
+}
+
+func TestImportPolicies(t *testing.T) {
+    clock := newFakeClock()
+    source := NewLRUCache(10, WithClock(clock.Now))
+    // The target writes both keys between the source's two writes.
+    source.Set("old", "incoming", 0)
+    clock.Advance(time.Minute)
+    source.Set("new", "incoming", 0)
+    var snapshot strings.Builder
+    if err := source.SaveSnapshot(&snapshot); err != nil {
+        t.Fatal(err)
+    }
+
+    for policy, want := range map[string]string{
+        "skip-existing": "existing existing",
+        "overwrite":     "incoming incoming",
+        "prefer-newer":  "existing incoming",
+    } {
+        target := NewLRUCache(10, WithClock(clock.Now))
+        clock.Advance(-30 * time.Second)
+        target.Set("old", "existing", 0)
+        target.Set("new", "existing", 0)
+        clock.Advance(30 * time.Second)
+
+        rec := httptest.NewRecorder()
+        req := httptest.NewRequest(http.MethodPost, "/admin/import?policy="+policy, strings.NewReader(snapshot.String()))
+        req.Header.Set("X-API-Key", "secret")
+        adminRouter(target).ServeHTTP(rec, req)
+        if rec.Code != http.StatusOK {
+            t.Fatalf("%s: import = %d %s", policy, rec.Code, rec.Body)
+        }
+        if got := target.Get("old").(string) + " " + target.Get("new").(string); got != want {
+            t.Errorf("%s: old and new = %s, want %s", policy, got, want)
+        }
+    }
+}
+
+func TestExportImportRequireAdmin(t *testing.T) {
+    router := adminRouter(NewLRUCache(10))
+    for _, req := range []*http.Request{
+        httptest.NewRequest(http.MethodGet, "/admin/export", nil),
+        httptest.NewRequest(http.MethodPost, "/admin/import", strings.NewReader(`{"entries":[]}`)),
+    } {
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, req)
+        if rec.Code != http.StatusForbidden {
+            t.Errorf("%s %s without the admin key = %d, want 403", req.Method, req.URL, rec.Code)
+        }
+    }
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+    "expvar"
+    "time"
+)
+
+// publishExpvar publishes the cache counters and configuration as the
+// expvar map "lrucache". The values are computed from Stats on every read so
+// they always agree with /stats. It must be called at most once per process.
+func publishExpvar(cache *LRUCache) {
+    m := expvar.NewMap("lrucache")
+    m.Set("hits", expvar.Func(func() any { return cache.Stats().Hits }))
+    m.Set("misses", expvar.Func(func() any { return cache.Stats().Misses }))
+    m.Set("evictions", expvar.Func(func() any { return cache.Stats().Evictions }))
+    m.Set("expirations", expvar.Func(func() any { return cache.Stats().Expirations }))
+    m.Set("size", expvar.Func(func() any { return cache.Stats().Size }))
+    m.Set("capacity", expvar.Func(func() any { return cache.Stats().Capacity }))
+    m.Set("janitor_last_run", expvar.Func(func() any {
+        last := cache.JanitorLastRun()
+        if last.IsZero() {
+            return nil
+        }
+        return last.Format(time.RFC3339Nano)
+    }))
+}
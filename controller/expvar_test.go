@@ -0,0 +1,66 @@
+package main
+
+import (
+    "encoding/json"
+    "expvar"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+// expvarCache is the cache published by TestExpvarTracksStats. expvar
+// names can be published only once per process, so it outlives the test.
+var (
+    expvarCache   = NewLRUCache(5)
+    expvarPublish sync.Once
+)
+
+func TestExpvarTracksStats(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := expvarCache
+    expvarPublish.Do(func() { publishExpvar(cache) })
+    cache.ClearCache()
+    auth := authConfig{adminKey: "admin"}
+    router := gin.New()
+    router.GET("/debug/vars", auth.requireAdmin(), gin.WrapH(expvar.Handler()))
+
+    fetch := func() map[string]interface{} {
+        t.Helper()
+        req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+        req.Header.Set("X-API-Key", "admin")
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, req)
+        var vars struct {
+            LRUCache map[string]interface{} `json:"lrucache"`
+        }
+        if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &vars) != nil {
+            t.Fatalf("GET /debug/vars = %d %s", rec.Code, rec.Body)
+        }
+        return vars.LRUCache
+    }
+
+    before := fetch()
+    if before["size"] != 0.0 || before["capacity"] != 5.0 || before["janitor_last_run"] != nil {
+        t.Fatalf("lrucache = %v before any operation", before)
+    }
+    cache.Get("missing")
+    cache.Set("k", 1, 0)
+    cache.Get("k")
+    after := fetch()
+    stats := cache.Stats()
+    if after["misses"] != float64(stats.Misses) || after["hits"] != float64(stats.Hits) || after["size"] != float64(stats.Size) {
+        t.Fatalf("lrucache = %v, /stats has %+v", after, stats)
+    }
+    if after["misses"] != before["misses"].(float64)+1 || after["hits"] != before["hits"].(float64)+1 || after["size"] != 1.0 {
+        t.Fatalf("lrucache = %v after a miss, a Set and a hit", after)
+    }
+
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+    if rec.Code != http.StatusForbidden {
+        t.Fatalf("GET /debug/vars without the admin key = %d", rec.Code)
+    }
+}
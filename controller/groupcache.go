@@ -0,0 +1,150 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sync"
+    "time"
+)
+
+// GroupCache shares a total capacity between named groups so that one busy
+// group cannot push out everyone else's entries. Each group is an LRUCache
+// sized to its fraction of the total and only ever evicts from its own LRU
+// list. Capacity not reserved by any group forms an overflow pool: entries
+// evicted from a group move there, and GroupCache.Get moves them back into
+// their group on a hit. The pool evicts in LRU order across all groups.
+type GroupCache struct {
+    mutex    sync.RWMutex
+    capacity int
+    reserved int
+    groups   map[string]*LRUCache
+    overflow *LRUCache
+}
+
+// NewGroupCache returns a GroupCache holding at most capacity entries in
+// total, with no groups yet.
+func NewGroupCache(capacity int) *GroupCache {
+    return &GroupCache{
+        capacity: capacity,
+        groups:   make(map[string]*LRUCache),
+        overflow: NewLRUCache(capacity),
+    }
+}
+
+// AddGroup creates the group name, reserving maxFraction of the total
+// capacity for it, at least one entry. The reservation is taken from the
+// overflow pool, whose oldest entries are evicted if it no longer fits.
+// It fails if the group exists, the name is empty or the fractions of all
+// groups would exceed 1.
+func (g *GroupCache) AddGroup(name string, maxFraction float64) error {
+    if name == "" {
+        return errors.New("group name must not be empty")
+    }
+    if maxFraction <= 0 || maxFraction > 1 {
+        return fmt.Errorf("group %q: fraction %v must be in (0, 1]", name, maxFraction)
+    }
+
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+
+    if _, ok := g.groups[name]; ok {
+        return fmt.Errorf("group %q already exists", name)
+    }
+    capacity := max(int(maxFraction*float64(g.capacity)), 1)
+    if g.reserved+capacity > g.capacity {
+        return fmt.Errorf("group %q: only %d of %d entries left to reserve", name, g.capacity-g.reserved, g.capacity)
+    }
+
+    group := NewLRUCache(capacity)
+    group.onEvict = func(key string, value interface{}, expiration time.Time) {
+        g.spill(name, key, value, expiration)
+    }
+    g.groups[name] = group
+    g.reserved += capacity
+    return g.overflow.Resize(g.capacity - g.reserved)
+}
+
+// Group returns the cache for the named group, or nil if there is none.
+// Lookups made directly on it do not consult the overflow pool; use
+// GroupCache.Get for that.
+func (g *GroupCache) Group(name string) *LRUCache {
+    g.mutex.RLock()
+    defer g.mutex.RUnlock()
+
+    return g.groups[name]
+}
+
+// Get returns the value for key in the named group. If the group no longer
+// holds it but the overflow pool does, the entry is moved back into the
+// group, keeping its expiration.
+func (g *GroupCache) Get(name, key string) (interface{}, bool) {
+    group := g.Group(name)
+    if group == nil {
+        return nil, false
+    }
+    if value, err := group.GetCtx(context.Background(), key); err == nil {
+        return value, true
+    }
+
+    value, expiration, ok := g.overflow.take(overflowKey(name, key))
+    if !ok {
+        return nil, false
+    }
+    group.mutex.Lock()
+    group.set(key, value, expiration)
+    group.unlock()
+    return value, true
+}
+
+// GroupStats returns the stats of every group, and of the overflow pool
+// under the empty name.
+func (g *GroupCache) GroupStats() map[string]CacheStats {
+    g.mutex.RLock()
+    defer g.mutex.RUnlock()
+
+    stats := make(map[string]CacheStats, len(g.groups)+1)
+    for name, group := range g.groups {
+        stats[name] = group.Stats()
+    }
+    stats[""] = g.overflow.Stats()
+    return stats
+}
+
+// spill stores an entry evicted from the named group in the overflow pool,
+// unless it has expired.
+func (g *GroupCache) spill(name, key string, value interface{}, expiration time.Time) {
+    if !expiration.IsZero() && !time.Now().Before(expiration) {
+        return
+    }
+    g.overflow.mutex.Lock()
+    defer g.overflow.unlock()
+
+    if g.overflow.capacity > 0 {
+        g.overflow.set(overflowKey(name, key), value, expiration)
+    }
+}
+
+// overflowKey namespaces key by group in the overflow pool.
+func overflowKey(name, key string) string {
+    return name + "\x00" + key
+}
+
+// take removes key from the cache and returns its value and expiration, if
+// it is present and live.
+func (c *LRUCache) take(key string) (value interface{}, expiration time.Time, ok bool) {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    element, ok := c.cache[key]
+    if !ok {
+        return nil, time.Time{}, false
+    }
+    entry := element.Value.(*cacheEntry)
+    if entry.expired(c.now()) {
+        c.removeElement(element, removedExpired, "")
+        return nil, time.Time{}, false
+    }
+    c.removeElement(element, removedDeleted, "")
+    return entry.value, entry.expiration, true
+}
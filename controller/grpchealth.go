@@ -0,0 +1,81 @@
+package main
+
+import (
+    "context"
+    "time"
+
+    "github.com/yashikajain0312/LRUCacheAssignment/controller/cachepb"
+    "google.golang.org/grpc/codes"
+    healthpb "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/status"
+)
+
+const (
+    // defaultHealthThreshold is the fill ratio above which the gRPC health
+    // service reports NOT_SERVING unless configured otherwise.
+    defaultHealthThreshold = 0.95
+    // healthWatchInterval is how often Watch streams recheck the status.
+    healthWatchInterval = time.Second
+)
+
+// WithHealthThreshold makes the gRPC health service report NOT_SERVING
+// while the cache holds more than ratio of its capacity in entries. The
+// default is 0.95; a ratio of 1 or more never reports it.
+func WithHealthThreshold(ratio float64) Option {
+    return func(c *LRUCache) {
+        c.healthThreshold = ratio
+    }
+}
+
+// healthServer implements the grpc.health.v1 Health service for the
+// overall server, named "", and for the CacheService.
+type healthServer struct {
+    healthpb.UnimplementedHealthServer
+    cache *LRUCache
+}
+
+// status returns the health of service, or an error if it is unknown.
+func (s *healthServer) status(service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+    if service != "" && service != cachepb.CacheService_ServiceDesc.ServiceName {
+        return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, status.Errorf(codes.NotFound, "unknown service %q", service)
+    }
+    s.cache.mutex.RLock()
+    size, capacity, threshold := len(s.cache.cache), s.cache.capacity, s.cache.healthThreshold
+    s.cache.mutex.RUnlock()
+    if capacity > 0 && float64(size) > threshold*float64(capacity) {
+        return healthpb.HealthCheckResponse_NOT_SERVING, nil
+    }
+    return healthpb.HealthCheckResponse_SERVING, nil
+}
+
+func (s *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+    serving, err := s.status(req.Service)
+    if err != nil {
+        return nil, err
+    }
+    return &healthpb.HealthCheckResponse{Status: serving}, nil
+}
+
+// Watch sends the current status, then every change, checking every
+// healthWatchInterval. Unknown services are reported as SERVICE_UNKNOWN
+// rather than failing, as the protocol requires.
+func (s *healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+    ticker := time.NewTicker(healthWatchInterval)
+    defer ticker.Stop()
+
+    last := healthpb.HealthCheckResponse_ServingStatus(-1)
+    for {
+        serving, _ := s.status(req.Service)
+        if serving != last {
+            if err := stream.Send(&healthpb.HealthCheckResponse{Status: serving}); err != nil {
+                return err
+            }
+            last = serving
+        }
+        select {
+        case <-ticker.C:
+        case <-stream.Context().Done():
+            return status.FromContextError(stream.Context().Err()).Err()
+        }
+    }
+}
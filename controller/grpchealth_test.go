@@ -0,0 +1,98 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "testing"
+    "time"
+
+    "github.com/yashikajain0312/LRUCacheAssignment/controller/cachepb"
+    "google.golang.org/grpc/codes"
+    healthpb "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/status"
+)
+
+// fill writes n entries to cache.
+func fill(cache *LRUCache, n int) {
+    for i := 0; i < n; i++ {
+        cache.Set(fmt.Sprint(i), i, 0)
+    }
+}
+
+func TestGRPCHealthCheck(t *testing.T) {
+    for _, tc := range []struct {
+        name    string
+        options []Option
+        entries int
+        want    healthpb.HealthCheckResponse_ServingStatus
+    }{
+        {"empty", nil, 0, healthpb.HealthCheckResponse_SERVING},
+        {"at the default threshold", nil, 19, healthpb.HealthCheckResponse_SERVING},
+        {"above the default threshold", nil, 20, healthpb.HealthCheckResponse_NOT_SERVING},
+        {"at a custom threshold", []Option{WithHealthThreshold(0.5)}, 10, healthpb.HealthCheckResponse_SERVING},
+        {"above a custom threshold", []Option{WithHealthThreshold(0.5)}, 11, healthpb.HealthCheckResponse_NOT_SERVING},
+    } {
+        cache := NewLRUCache(20, tc.options...)
+        fill(cache, tc.entries)
+        client := healthpb.NewHealthClient(dialGRPC(t, cache, writeLimits{}))
+
+        for _, service := range []string{"", cachepb.CacheService_ServiceDesc.ServiceName} {
+            resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+            if err != nil {
+                t.Fatalf("%s: Check(%q): %v", tc.name, service, err)
+            }
+            if resp.Status != tc.want {
+                t.Fatalf("%s: Check(%q) = %v, want %v", tc.name, service, resp.Status, tc.want)
+            }
+        }
+    }
+}
+
+func TestGRPCHealthCheckUnknownService(t *testing.T) {
+    client := healthpb.NewHealthClient(dialGRPC(t, NewLRUCache(10), writeLimits{}))
+    _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "other.Service"})
+    if code := status.Code(err); code != codes.NotFound {
+        t.Fatalf("Check of an unknown service = %v, want NotFound", err)
+    }
+
+    stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{Service: "other.Service"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp, err := stream.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_SERVICE_UNKNOWN {
+        t.Fatalf("Watch of an unknown service = %v, %v; want SERVICE_UNKNOWN", resp, err)
+    }
+}
+
+func TestGRPCHealthWatch(t *testing.T) {
+    cache := NewLRUCache(10)
+    client := healthpb.NewHealthClient(dialGRPC(t, cache, writeLimits{}))
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The current status comes first, then each change.
+    for _, step := range []struct {
+        entries int
+        want    healthpb.HealthCheckResponse_ServingStatus
+    }{
+        {0, healthpb.HealthCheckResponse_SERVING},
+        {10, healthpb.HealthCheckResponse_NOT_SERVING},
+        {0, healthpb.HealthCheckResponse_SERVING},
+    } {
+        if err := cache.ClearCache(); err != nil {
+            t.Fatal(err)
+        }
+        fill(cache, step.entries)
+        resp, err := stream.Recv()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if resp.Status != step.want {
+            t.Fatalf("with %d entries Watch sent %v, want %v", step.entries, resp.Status, step.want)
+        }
+    }
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "log/slog"
+    "mime"
+    "net"
+    "strings"
+    "time"
+
+    "github.com/yashikajain0312/LRUCacheAssignment/controller/cachepb"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    healthpb "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/status"
+)
+
+// BlobValue is how a value written over gRPC with a content type other
+// than JSON or plain text is stored, so the bytes and their type can be
+// returned as they were given.
+type BlobValue struct {
+    ContentType string `json:"content_type"`
+    Data        []byte `json:"data"`
+}
+
+// grpcServer implements cachepb.CacheServiceServer over the cache. Keys
+// and expirations are checked against the same limits as the HTTP API.
+type grpcServer struct {
+    cachepb.UnimplementedCacheServiceServer
+    cache  *LRUCache
+    limits writeLimits
+}
+
+// StartGRPC serves the CacheService gRPC API from the cache on addr. The
+// returned stop function stops accepting calls, ends Watch streams and
+// waits for the calls in progress to finish.
+func (c *LRUCache) StartGRPC(addr string, limits writeLimits) (stop func(), err error) {
+    listener, err := net.Listen("tcp", addr)
+    if err != nil {
+        return nil, err
+    }
+    server := newGRPCServer(c, limits)
+    go func() {
+        if err := server.Serve(listener); err != nil {
+            slog.Error("gRPC server failed", "error", err)
+        }
+    }()
+    slog.Info("gRPC listener started", "addr", listener.Addr().String())
+
+    done := make(chan struct{})
+    return func() {
+        // Watch streams only end when cancelled, so give up on a graceful
+        // stop once the unary calls have had a moment to finish.
+        go func() {
+            server.GracefulStop()
+            close(done)
+        }()
+        select {
+        case <-done:
+        case <-time.After(time.Second):
+            server.Stop()
+            <-done
+        }
+    }, nil
+}
+
+// newGRPCServer returns a gRPC server with the CacheService and the
+// standard Health service registered.
+func newGRPCServer(c *LRUCache, limits writeLimits) *grpc.Server {
+    server := grpc.NewServer()
+    cachepb.RegisterCacheServiceServer(server, &grpcServer{cache: c, limits: limits})
+    healthpb.RegisterHealthServer(server, &healthServer{cache: c})
+    return server
+}
+
+func (s *grpcServer) Get(ctx context.Context, req *cachepb.GetRequest) (*cachepb.GetResponse, error) {
+    if err := s.checkKey(req.Key); err != nil {
+        return nil, err
+    }
+    value, err := s.cache.GetCtx(ctx, req.Key)
+    if err != nil {
+        return nil, grpcError(ctx, err)
+    }
+    encoded, err := encodeGRPCValue(value)
+    if err != nil {
+        return nil, status.Error(codes.Internal, err.Error())
+    }
+    return &cachepb.GetResponse{Value: encoded}, nil
+}
+
+func (s *grpcServer) Set(ctx context.Context, req *cachepb.SetRequest) (*cachepb.SetResponse, error) {
+    entry, err := s.batchEntry(req)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.cache.SetCtx(ctx, entry.Key, entry.Value, entry.TTL); err != nil {
+        return nil, grpcError(ctx, err)
+    }
+    return &cachepb.SetResponse{}, nil
+}
+
+func (s *grpcServer) Delete(ctx context.Context, req *cachepb.DeleteRequest) (*cachepb.DeleteResponse, error) {
+    if err := s.checkKey(req.Key); err != nil {
+        return nil, err
+    }
+    deleted, err := s.cache.Delete(req.Key)
+    if err != nil {
+        return nil, grpcError(ctx, err)
+    }
+    return &cachepb.DeleteResponse{Deleted: deleted}, nil
+}
+
+func (s *grpcServer) Clear(ctx context.Context, req *cachepb.ClearRequest) (*cachepb.ClearResponse, error) {
+    if err := s.cache.ClearCache(); err != nil {
+        return nil, grpcError(ctx, err)
+    }
+    return &cachepb.ClearResponse{}, nil
+}
+
+func (s *grpcServer) BatchGet(ctx context.Context, req *cachepb.BatchGetRequest) (*cachepb.BatchGetResponse, error) {
+    resp := &cachepb.BatchGetResponse{Values: make(map[string]*cachepb.Value)}
+    for _, key := range req.Keys {
+        if err := s.checkKey(key); err != nil {
+            return nil, err
+        }
+    }
+    for _, key := range req.Keys {
+        found, _, err := s.cache.get(ctx, key)
+        if err != nil {
+            resp.Missing = append(resp.Missing, key)
+            continue
+        }
+        encoded, err := encodeGRPCValue(found.value)
+        if err != nil {
+            return nil, status.Errorf(codes.Internal, "key %q: %v", key, err)
+        }
+        resp.Values[key] = encoded
+    }
+    return resp, nil
+}
+
+func (s *grpcServer) BatchSet(ctx context.Context, req *cachepb.BatchSetRequest) (*cachepb.BatchSetResponse, error) {
+    entries := make([]BatchEntry, 0, len(req.Entries))
+    for i, r := range req.Entries {
+        entry, err := s.batchEntry(r)
+        if err != nil {
+            return nil, status.Errorf(status.Code(err), "entries[%d]: %s", i, status.Convert(err).Message())
+        }
+        entries = append(entries, entry)
+    }
+    if err := s.cache.SetMany(entries); err != nil {
+        return nil, grpcError(ctx, err)
+    }
+    return &cachepb.BatchSetResponse{}, nil
+}
+
+func (s *grpcServer) Stats(ctx context.Context, req *cachepb.StatsRequest) (*cachepb.StatsResponse, error) {
+    stats := s.cache.Stats()
+    return &cachepb.StatsResponse{
+        Hits:        stats.Hits,
+        Misses:      stats.Misses,
+        HitRatio:    stats.HitRatio,
+        Inserts:     stats.Inserts,
+        Updates:     stats.Updates,
+        Deletes:     stats.Deletes,
+        Evictions:   stats.Evictions,
+        Expirations: stats.Expirations,
+        Clears:      stats.Clears,
+        Size:        int64(stats.Size),
+        Capacity:    int64(stats.Capacity),
+        BytesUsed:   stats.BytesUsed,
+        MaxBytes:    stats.MaxBytes,
+    }, nil
+}
+
+func (s *grpcServer) Watch(req *cachepb.WatchRequest, stream grpc.ServerStreamingServer[cachepb.WatchEvent]) error {
+    for event := range s.cache.Watch(stream.Context(), req.Prefix) {
+        err := stream.Send(&cachepb.WatchEvent{
+            Key:          event.Key,
+            Type:         event.Type,
+            TimeUnixNano: event.Time.UnixNano(),
+        })
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// checkKey validates key, reporting problems as InvalidArgument.
+func (s *grpcServer) checkKey(key string) error {
+    return fieldErrorsStatus(s.limits.validateKey(key))
+}
+
+// batchEntry validates a write request and decodes its value. Values that
+// could never fit in the cache's byte budget are ResourceExhausted.
+func (s *grpcServer) batchEntry(req *cachepb.SetRequest) (BatchEntry, error) {
+    errs := s.limits.validateKey(req.Key)
+    if req.TtlMs < 0 {
+        errs = append(errs, FieldError{Field: "ttl_ms", Reason: "must not be negative"})
+    } else if s.limits.maxExpiration > 0 && time.Duration(req.TtlMs)*time.Millisecond > s.limits.maxExpiration {
+        errs = append(errs, FieldError{Field: "ttl_ms", Reason: "must be at most " + s.limits.maxExpiration.String()})
+    }
+    if req.Value == nil {
+        errs = append(errs, FieldError{Field: "value", Reason: "is required"})
+    }
+    if err := fieldErrorsStatus(errs); err != nil {
+        return BatchEntry{}, err
+    }
+
+    value, err := decodeGRPCValue(req.Value)
+    if err != nil {
+        return BatchEntry{}, status.Errorf(codes.InvalidArgument, "value: %v", err)
+    }
+    // maxBytes is only set when the cache is created, so it can be read
+    // without the lock.
+    if maxBytes := s.cache.maxBytes; maxBytes > 0 && s.cache.entrySize(req.Key, value) > maxBytes {
+        return BatchEntry{}, status.Errorf(codes.ResourceExhausted, "entry for %q is larger than the cache's %d byte budget", req.Key, maxBytes)
+    }
+    return BatchEntry{Key: req.Key, Value: value, TTL: time.Duration(req.TtlMs) * time.Millisecond}, nil
+}
+
+// fieldErrorsStatus returns an InvalidArgument status describing errs, or
+// nil if there are none.
+func fieldErrorsStatus(errs []FieldError) error {
+    if len(errs) == 0 {
+        return nil
+    }
+    reasons := make([]string, len(errs))
+    for i, e := range errs {
+        reasons[i] = e.Field + " " + e.Reason
+    }
+    return status.Error(codes.InvalidArgument, strings.Join(reasons, "; "))
+}
+
+// grpcError maps an error returned by a cache operation to a gRPC status,
+// as errorStatus does for HTTP.
+func grpcError(ctx context.Context, err error) error {
+    code := codes.Internal
+    switch {
+    case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+        code = codes.DeadlineExceeded
+    case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+        code = codes.Canceled
+    case errors.Is(err, ErrNotFound), errors.Is(err, ErrExpired):
+        code = codes.NotFound
+    case errors.Is(err, ErrVersionMismatch):
+        code = codes.Aborted
+    case errors.Is(err, ErrLoaderBusy), errors.Is(err, ErrWriteBehindFull), errors.Is(err, ErrBusy):
+        code = codes.ResourceExhausted
+    case errors.Is(err, ErrBackend), errors.Is(err, ErrBackendUnavailable):
+        code = codes.Unavailable
+    case errors.Is(err, ErrNoLoader):
+        code = codes.Unimplemented
+    case errors.Is(err, ErrReadOnly), errors.Is(err, ErrReplica):
+        code = codes.FailedPrecondition
+    }
+    return status.Error(code, err.Error())
+}
+
+// decodeGRPCValue converts a Value to what is stored in the cache.
+func decodeGRPCValue(v *cachepb.Value) (interface{}, error) {
+    mediaType := "text/plain"
+    if v.ContentType != "" {
+        parsed, _, err := mime.ParseMediaType(v.ContentType)
+        if err != nil {
+            return nil, err
+        }
+        mediaType = parsed
+    }
+    switch mediaType {
+    case "application/json":
+        var value interface{}
+        if err := json.Unmarshal(v.Data, &value); err != nil {
+            return nil, err
+        }
+        return value, nil
+    case "text/plain":
+        return string(v.Data), nil
+    }
+    return BlobValue{ContentType: v.ContentType, Data: v.Data}, nil
+}
+
+// encodeGRPCValue converts a cached value to a Value: strings as plain
+// text, blobs as they were stored and anything else as JSON.
+func encodeGRPCValue(value interface{}) (*cachepb.Value, error) {
+    switch v := value.(type) {
+    case string:
+        return &cachepb.Value{Data: []byte(v), ContentType: "text/plain"}, nil
+    case BlobValue:
+        return &cachepb.Value{Data: v.Data, ContentType: v.ContentType}, nil
+    }
+    data, err := json.Marshal(value)
+    if err != nil {
+        return nil, err
+    }
+    return &cachepb.Value{Data: data, ContentType: "application/json"}, nil
+}
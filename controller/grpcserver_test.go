@@ -0,0 +1,229 @@
+package main
+
+import (
+    "context"
+    "net"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/yashikajain0312/LRUCacheAssignment/controller/cachepb"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials/insecure"
+    "google.golang.org/grpc/status"
+    "google.golang.org/grpc/test/bufconn"
+)
+
+// dialGRPC serves the gRPC API for cache over an in-memory listener and
+// returns a connection to it. Both are shut down when the test ends.
+func dialGRPC(t *testing.T, cache *LRUCache, limits writeLimits) *grpc.ClientConn {
+    t.Helper()
+    listener := bufconn.Listen(1 << 20)
+    server := newGRPCServer(cache, limits)
+    go server.Serve(listener)
+    t.Cleanup(server.Stop)
+
+    conn, err := grpc.NewClient("passthrough:///bufconn",
+        grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+            return listener.DialContext(ctx)
+        }),
+        grpc.WithTransportCredentials(insecure.NewCredentials()))
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    return conn
+}
+
+func TestGRPCRoundTrip(t *testing.T) {
+    cache := NewLRUCache(10)
+    client := cachepb.NewCacheServiceClient(dialGRPC(t, cache, writeLimits{}))
+    ctx := context.Background()
+
+    for _, req := range []*cachepb.SetRequest{
+        {Key: "text", Value: &cachepb.Value{Data: []byte("hello")}},
+        {Key: "json", Value: &cachepb.Value{Data: []byte(`{"n":1}`), ContentType: "application/json"}},
+        {Key: "blob", Value: &cachepb.Value{Data: []byte{0, 1, 2}, ContentType: "image/png"}, TtlMs: 60000},
+    } {
+        if _, err := client.Set(ctx, req); err != nil {
+            t.Fatalf("Set %s: %v", req.Key, err)
+        }
+    }
+    if value, ok := cache.Get("json").(map[string]interface{}); !ok || value["n"] != float64(1) {
+        t.Fatalf("json was stored as %#v", cache.Get("json"))
+    }
+    if ttl, ok := cache.TTL("blob"); !ok || ttl <= 0 || ttl > time.Minute {
+        t.Fatalf("blob TTL = %v, %v; want up to a minute", ttl, ok)
+    }
+
+    for key, want := range map[string]string{"text": "text/plain hello", "json": `application/json {"n":1}`, "blob": "image/png \x00\x01\x02"} {
+        resp, err := client.Get(ctx, &cachepb.GetRequest{Key: key})
+        if err != nil {
+            t.Fatalf("Get %s: %v", key, err)
+        }
+        if got := resp.Value.ContentType + " " + string(resp.Value.Data); got != want {
+            t.Errorf("Get %s = %q, want %q", key, got, want)
+        }
+    }
+
+    if _, err := client.BatchSet(ctx, &cachepb.BatchSetRequest{Entries: []*cachepb.SetRequest{
+        {Key: "a", Value: &cachepb.Value{Data: []byte("1")}},
+        {Key: "b", Value: &cachepb.Value{Data: []byte("2")}},
+    }}); err != nil {
+        t.Fatal(err)
+    }
+    batch, err := client.BatchGet(ctx, &cachepb.BatchGetRequest{Keys: []string{"a", "missing", "b"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(batch.Values) != 2 || string(batch.Values["a"].Data) != "1" || string(batch.Values["b"].Data) != "2" || strings.Join(batch.Missing, " ") != "missing" {
+        t.Fatalf("BatchGet = %v", batch)
+    }
+
+    for _, want := range []bool{true, false} {
+        resp, err := client.Delete(ctx, &cachepb.DeleteRequest{Key: "a"})
+        if err != nil || resp.Deleted != want {
+            t.Fatalf("Delete = %v, %v; want deleted %v", resp, err, want)
+        }
+    }
+    stats, err := client.Stats(ctx, &cachepb.StatsRequest{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if stats.Size != 4 || stats.Capacity != 10 || stats.Inserts != 5 || stats.Deletes != 1 || stats.Hits != 6 || stats.Misses != 1 {
+        t.Fatalf("Stats = %v", stats)
+    }
+    if _, err := client.Clear(ctx, &cachepb.ClearRequest{}); err != nil || cache.Len() != 0 {
+        t.Fatalf("Clear = %v with %d entries left", err, cache.Len())
+    }
+}
+
+func TestGRPCErrorCodes(t *testing.T) {
+    cache := NewLRUCache(10, WithMaxBytes(1024))
+    client := cachepb.NewCacheServiceClient(dialGRPC(t, cache, writeLimits{maxKeyLength: 8, maxExpiration: time.Minute}))
+    ctx := context.Background()
+    text := &cachepb.Value{Data: []byte("v")}
+
+    for _, tc := range []struct {
+        name string
+        call func() error
+        want codes.Code
+    }{
+        {"missing key", func() error {
+            _, err := client.Get(ctx, &cachepb.GetRequest{Key: "missing"})
+            return err
+        }, codes.NotFound},
+        {"long key", func() error {
+            _, err := client.Get(ctx, &cachepb.GetRequest{Key: "much too long"})
+            return err
+        }, codes.InvalidArgument},
+        {"negative ttl", func() error {
+            _, err := client.Set(ctx, &cachepb.SetRequest{Key: "k", Value: text, TtlMs: -1})
+            return err
+        }, codes.InvalidArgument},
+        {"ttl over the limit", func() error {
+            _, err := client.Set(ctx, &cachepb.SetRequest{Key: "k", Value: text, TtlMs: time.Hour.Milliseconds()})
+            return err
+        }, codes.InvalidArgument},
+        {"no value", func() error {
+            _, err := client.Set(ctx, &cachepb.SetRequest{Key: "k"})
+            return err
+        }, codes.InvalidArgument},
+        {"bad json", func() error {
+            _, err := client.Set(ctx, &cachepb.SetRequest{Key: "k", Value: &cachepb.Value{Data: []byte("{"), ContentType: "application/json"}})
+            return err
+        }, codes.InvalidArgument},
+        {"too large", func() error {
+            _, err := client.Set(ctx, &cachepb.SetRequest{Key: "k", Value: &cachepb.Value{Data: make([]byte, 2048), ContentType: "application/octet-stream"}})
+            return err
+        }, codes.ResourceExhausted},
+        {"bad batch entry", func() error {
+            _, err := client.BatchSet(ctx, &cachepb.BatchSetRequest{Entries: []*cachepb.SetRequest{{Key: "ok", Value: text}, {Key: "", Value: text}}})
+            if err != nil && !strings.HasPrefix(status.Convert(err).Message(), "entries[1]: ") {
+                t.Errorf("BatchSet error %q does not name the entry", status.Convert(err).Message())
+            }
+            return err
+        }, codes.InvalidArgument},
+    } {
+        if code := status.Code(tc.call()); code != tc.want {
+            t.Errorf("%s: code %v, want %v", tc.name, code, tc.want)
+        }
+    }
+    if cache.Len() != 0 {
+        t.Fatalf("rejected writes stored %v", viewKeys(cache.Snapshot()))
+    }
+
+    cache.SetReadOnly(true)
+    if _, err := client.Set(ctx, &cachepb.SetRequest{Key: "k", Value: text}); status.Code(err) != codes.FailedPrecondition {
+        t.Fatalf("Set on a read-only cache = %v, want FailedPrecondition", err)
+    }
+}
+
+func TestGRPCGetRespectsDeadline(t *testing.T) {
+    cache := NewLRUCache(10, WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        <-ctx.Done()
+        return nil, 0, ctx.Err()
+    })))
+    client := cachepb.NewCacheServiceClient(dialGRPC(t, cache, writeLimits{}))
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    if _, err := client.Get(ctx, &cachepb.GetRequest{Key: "slow"}); status.Code(err) != codes.DeadlineExceeded {
+        t.Fatalf("Get = %v, want DeadlineExceeded", err)
+    }
+    if elapsed := time.Since(start); elapsed > 2*time.Second {
+        t.Fatalf("Get returned after %v, long past its deadline", elapsed)
+    }
+}
+
+func TestGRPCWatch(t *testing.T) {
+    cache := NewLRUCache(10)
+    client := cachepb.NewCacheServiceClient(dialGRPC(t, cache, writeLimits{}))
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    stream, err := client.Watch(ctx, &cachepb.WatchRequest{Prefix: "user:"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    // The stream has no reply until the first event, so wait for the
+    // server to subscribe before writing.
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        cache.mutex.RLock()
+        subscribed := len(cache.subscribers) > 0
+        cache.mutex.RUnlock()
+        if subscribed {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("the Watch call did not subscribe")
+        }
+        time.Sleep(time.Millisecond)
+    }
+
+    cache.Set("user:1", "a", 0)
+    cache.Set("other", "b", 0)
+    cache.Delete("user:1")
+    var got []string
+    for i := 0; i < 2; i++ {
+        event, err := stream.Recv()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if event.TimeUnixNano == 0 {
+            t.Errorf("event %v has no time", event)
+        }
+        got = append(got, event.Type+" "+event.Key)
+    }
+    if want := "set user:1, " + removedDeleted.String() + " user:1"; strings.Join(got, ", ") != want {
+        t.Fatalf("events = %q, want %s", got, want)
+    }
+
+    cancel()
+    if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+        t.Fatalf("Recv after cancel = %v, want Canceled", err)
+    }
+}
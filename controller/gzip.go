@@ -0,0 +1,132 @@
+package main
+
+import (
+    "bytes"
+    "compress/gzip"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// compressedTypes lists content type prefixes that are already compressed
+// and gain nothing from gzip.
+var compressedTypes = []string{
+    "image/",
+    "video/",
+    "audio/",
+    "application/gzip",
+    "application/x-gzip",
+    "application/zip",
+    "application/zstd",
+    "application/msgpack",
+    "application/x-msgpack",
+}
+
+// gzipWriter buffers a response so the middleware can decide whether to
+// compress it once the handler has finished. Flushing switches it to pass
+// the response through untouched, which keeps streaming responses working.
+type gzipWriter struct {
+    gin.ResponseWriter
+    buf         bytes.Buffer
+    status      int
+    passthrough bool
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+    if w.passthrough {
+        w.ResponseWriter.WriteHeader(code)
+        return
+    }
+    w.status = code
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+    if w.passthrough {
+        return w.ResponseWriter.Write(data)
+    }
+    return w.buf.Write(data)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+    return w.Write([]byte(s))
+}
+
+func (w *gzipWriter) Status() int {
+    if w.passthrough {
+        return w.ResponseWriter.Status()
+    }
+    return w.status
+}
+
+func (w *gzipWriter) Size() int {
+    if w.passthrough {
+        return w.ResponseWriter.Size()
+    }
+    return w.buf.Len()
+}
+
+func (w *gzipWriter) Written() bool {
+    return w.passthrough || w.buf.Len() > 0
+}
+
+func (w *gzipWriter) Flush() {
+    if !w.passthrough {
+        w.passthrough = true
+        w.ResponseWriter.WriteHeader(w.status)
+        w.ResponseWriter.Write(w.buf.Bytes())
+        w.buf.Reset()
+    }
+    w.ResponseWriter.Flush()
+}
+
+// gzipMiddleware compresses responses of at least minSize bytes for clients
+// that send Accept-Encoding: gzip. Responses that already carry a
+// Content-Encoding or an already-compressed content type are sent as is.
+func gzipMiddleware(minSize int) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+            return
+        }
+
+        original := c.Writer
+        w := &gzipWriter{ResponseWriter: original, status: http.StatusOK}
+        c.Writer = w
+        c.Next()
+        c.Writer = original
+
+        if w.passthrough {
+            return
+        }
+
+        header := original.Header()
+        header.Add("Vary", "Accept-Encoding")
+        body := w.buf.Bytes()
+        if len(body) < minSize || header.Get("Content-Encoding") != "" || isCompressedType(header.Get("Content-Type")) {
+            original.WriteHeader(w.status)
+            original.Write(body)
+            return
+        }
+
+        var compressed bytes.Buffer
+        gz := gzip.NewWriter(&compressed)
+        gz.Write(body)
+        gz.Close()
+
+        header.Set("Content-Encoding", "gzip")
+        header.Set("Content-Length", strconv.Itoa(compressed.Len()))
+        original.WriteHeader(w.status)
+        original.Write(compressed.Bytes())
+    }
+}
+
+// isCompressedType reports whether contentType is already compressed.
+func isCompressedType(contentType string) bool {
+    for _, prefix := range compressedTypes {
+        if strings.HasPrefix(contentType, prefix) {
+            return true
+        }
+    }
+    return false
+}
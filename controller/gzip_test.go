@@ -0,0 +1,73 @@
+package main
+
+import (
+    "compress/gzip"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+// gzipRouter serves body with contentType at / behind gzipMiddleware with a
+// 100 byte threshold.
+func gzipRouter(contentType, body string) *gin.Engine {
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.Use(gzipMiddleware(100))
+    router.GET("/", func(c *gin.Context) {
+        c.Data(http.StatusOK, contentType, []byte(body))
+    })
+    return router
+}
+
+// getWithEncoding requests / from router with the Accept-Encoding header
+// set to acceptEncoding, if not empty.
+func getWithEncoding(router http.Handler, acceptEncoding string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(http.MethodGet, "/", nil)
+    if acceptEncoding != "" {
+        req.Header.Set("Accept-Encoding", acceptEncoding)
+    }
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, req)
+    return rec
+}
+
+func TestGzipLargeResponse(t *testing.T) {
+    body := strings.Repeat(`{"key":"value"},`, 100)
+    rec := getWithEncoding(gzipRouter("application/json", body), "gzip, deflate")
+
+    if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "gzip" {
+        t.Fatalf("status %d, Content-Encoding %q", rec.Code, rec.Header().Get("Content-Encoding"))
+    }
+    if rec.Body.Len() >= len(body) {
+        t.Fatalf("compressed body is %d bytes, plain %d", rec.Body.Len(), len(body))
+    }
+    gz, err := gzip.NewReader(rec.Body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    plain, err := io.ReadAll(gz)
+    if err != nil || string(plain) != body {
+        t.Fatalf("decompressed body differs: %v", err)
+    }
+}
+
+func TestGzipSendsPlain(t *testing.T) {
+    large := strings.Repeat("x", 1000)
+    for _, tc := range []struct {
+        name, acceptEncoding, contentType, body string
+    }{
+        {"not advertised", "", "application/json", large},
+        {"other encoding", "br", "application/json", large},
+        {"below threshold", "gzip", "application/json", "small"},
+        {"already compressed", "gzip", "application/msgpack", large},
+    } {
+        rec := getWithEncoding(gzipRouter(tc.contentType, tc.body), tc.acceptEncoding)
+        if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != tc.body {
+            t.Errorf("%s: Content-Encoding %q, body of %d bytes", tc.name, rec.Header().Get("Content-Encoding"), rec.Body.Len())
+        }
+    }
+}
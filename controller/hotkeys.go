@@ -0,0 +1,100 @@
+package main
+
+import (
+    "container/heap"
+    "encoding/json"
+    "net/http"
+    "sort"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// KeyStats describes the access history of a single entry. ApproxSize is
+// the length of the value's JSON encoding.
+type KeyStats struct {
+    Key        string    `json:"key"`
+    Hits       uint64    `json:"hits"`
+    LastAccess time.Time `json:"last_access"`
+    ApproxSize int       `json:"approx_size"`
+
+    value interface{}
+}
+
+// keyStatsHeap is a min-heap on Hits, used to keep the n hottest keys.
+type keyStatsHeap []KeyStats
+
+func (h keyStatsHeap) Len() int            { return len(h) }
+func (h keyStatsHeap) Less(i, j int) bool  { return h[i].Hits < h[j].Hits }
+func (h keyStatsHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keyStatsHeap) Push(x interface{}) { *h = append(*h, x.(KeyStats)) }
+func (h *keyStatsHeap) Pop() interface{} {
+    old := *h
+    x := old[len(old)-1]
+    *h = old[:len(old)-1]
+    return x
+}
+
+// TopKeys returns up to n live entries with the most hits since they were
+// inserted or since the last ResetHitCounts, hottest first. Selection uses
+// a bounded heap, so the cost is O(size * log n) rather than a full sort.
+func (c *LRUCache) TopKeys(n int) []KeyStats {
+    if n <= 0 {
+        return []KeyStats{}
+    }
+
+    h := make(keyStatsHeap, 0, n)
+    c.mutex.RLock()
+    now := c.now()
+    for element := c.list.Front(); element != nil; element = element.Next() {
+        entry := element.Value.(*cacheEntry)
+        if entry.expired(now) {
+            continue
+        }
+        if len(h) == n && entry.hits <= h[0].Hits {
+            continue
+        }
+        stats := KeyStats{Key: entry.key, Hits: entry.hits, LastAccess: entry.lastAccess, value: entry.value}
+        if len(h) < n {
+            heap.Push(&h, stats)
+        } else {
+            h[0] = stats
+            heap.Fix(&h, 0)
+        }
+    }
+    c.mutex.RUnlock()
+
+    // Sizes are only computed for the selected entries, outside the lock.
+    top := []KeyStats(h)
+    for i := range top {
+        if data, err := json.Marshal(top[i].value); err == nil {
+            top[i].ApproxSize = len(data)
+        }
+    }
+    sort.SliceStable(top, func(i, j int) bool { return top[i].Hits > top[j].Hits })
+    return top
+}
+
+// ResetHitCounts zeroes the per-entry hit counters without removing any
+// entries, so TopKeys reflects only accesses made after the reset.
+func (c *LRUCache) ResetHitCounts() {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    for element := c.list.Front(); element != nil; element = element.Next() {
+        element.Value.(*cacheEntry).hits = 0
+    }
+}
+
+// hotKeysHandler serves GET /stats/hot-keys.
+func hotKeysHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+        if err != nil || limit < 1 || limit > 1000 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be an integer between 1 and 1000"})
+            return
+        }
+        respond(c, http.StatusOK, cache.TopKeys(limit))
+    }
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+// hotCache returns a cache where key i, for i from 0 to 9, was read i times.
+func hotCache() *LRUCache {
+    cache := NewLRUCache(20)
+    for i := 0; i < 10; i++ {
+        key := "k" + strconv.Itoa(i)
+        cache.Set(key, i, 0)
+        for j := 0; j < i; j++ {
+            cache.Get(key)
+        }
+    }
+    return cache
+}
+
+func TestTopKeysRanking(t *testing.T) {
+    cache := hotCache()
+
+    top := cache.TopKeys(3)
+    if len(top) != 3 {
+        t.Fatalf("TopKeys(3) returned %d entries", len(top))
+    }
+    for i, want := range []string{"k9", "k8", "k7"} {
+        if top[i].Key != want || top[i].Hits != uint64(9-i) {
+            t.Fatalf("TopKeys(3)[%d] = %+v, want %s with %d hits", i, top[i], want, 9-i)
+        }
+    }
+    if top[0].ApproxSize != 1 || top[0].LastAccess.IsZero() {
+        t.Fatalf("TopKeys(3)[0] = %+v, want its size and last access", top[0])
+    }
+    if all := cache.TopKeys(100); len(all) != 10 || all[9].Key != "k0" {
+        t.Fatalf("TopKeys(100) = %+v", all)
+    }
+}
+
+func TestResetHitCounts(t *testing.T) {
+    cache := hotCache()
+    cache.ResetHitCounts()
+    cache.Get("k1")
+    cache.Get("k1")
+    cache.Get("k4")
+
+    top := cache.TopKeys(2)
+    if len(top) != 2 || top[0].Key != "k1" || top[0].Hits != 2 || top[1].Key != "k4" || top[1].Hits != 1 {
+        t.Fatalf("TopKeys(2) after a reset = %+v", top)
+    }
+    if cache.Len() != 10 {
+        t.Fatalf("Len = %d after resetting hit counts", cache.Len())
+    }
+}
+
+func TestHotKeysHandler(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.GET("/stats/hot-keys", hotKeysHandler(hotCache()))
+
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/hot-keys?limit=2", nil))
+    var top []KeyStats
+    if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &top) != nil {
+        t.Fatalf("GET /stats/hot-keys = %d %s", rec.Code, rec.Body)
+    }
+    if len(top) != 2 || top[0].Key != "k9" || top[1].Key != "k8" {
+        t.Fatalf("hot keys = %+v", top)
+    }
+
+    rec = httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/hot-keys?limit=0", nil))
+    if rec.Code != http.StatusBadRequest {
+        t.Fatalf("limit=0 = %d, want 400", rec.Code)
+    }
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "log/slog"
+    "sync"
+    "time"
+)
+
+// Invalidation is the message published for every key deleted or expired,
+// and for ClearCache, and applied by every other replica receiving it. Op
+// is "delete", "expire" or "clear", which has no Key. Origin identifies
+// the publishing cache, which ignores its own messages.
+type Invalidation struct {
+    Op        string    `json:"op"`
+    Key       string    `json:"key,omitempty"`
+    Origin    string    `json:"origin,omitempty"`
+    Timestamp time.Time `json:"timestamp"`
+}
+
+// InvalidationBroker carries invalidations between the replicas of a
+// cache. Publish sends an invalidation to every subscriber, possibly
+// including the publisher. Subscribe calls apply for every invalidation
+// received until stop is called; it is called at most once per broker.
+type InvalidationBroker interface {
+    Publish(message Invalidation) error
+    Subscribe(apply func(Invalidation)) (stop func(), err error)
+}
+
+// WithInvalidationBroker makes StartInvalidation share invalidations with
+// other replicas through b. Writes are not propagated, so replicas never
+// overwrite each other.
+func WithInvalidationBroker(b InvalidationBroker) Option {
+    return func(c *LRUCache) {
+        c.broker = b
+    }
+}
+
+// StartInvalidation subscribes to the broker configured with
+// WithInvalidationBroker or WithNATSInvalidation and, until the returned
+// stop function is called, publishes this cache's deletions, expirations
+// and clears to it and applies those of other replicas. Without a broker
+// it does nothing.
+func (c *LRUCache) StartInvalidation() (stop func(), err error) {
+    if c.broker == nil {
+        return func() {}, nil
+    }
+    c.mutex.Lock()
+    c.nodeID = newNodeID()
+    c.unlock()
+
+    unsubscribe, err := c.broker.Subscribe(c.applyInvalidation)
+    if err != nil {
+        return nil, err
+    }
+    c.mutex.Lock()
+    c.invalidating = true
+    c.unlock()
+
+    return func() {
+        c.mutex.Lock()
+        c.invalidating = false
+        c.unlock()
+        unsubscribe()
+    }, nil
+}
+
+// newNodeID returns a random identifier for the messages of one cache.
+func newNodeID() string {
+    var b [8]byte
+    rand.Read(b[:])
+    return hex.EncodeToString(b[:])
+}
+
+// queueInvalidation queues the publication of the removal of key if
+// invalidation is running and reason is one that peers must apply;
+// removedCleared stands for ClearCache. The caller must hold the write
+// lock; the message is sent once it is released.
+func (c *LRUCache) queueInvalidation(key string, reason removalReason) {
+    if !c.invalidating {
+        return
+    }
+    var op string
+    switch reason {
+    case removedDeleted:
+        op = "delete"
+    case removedExpired:
+        op = "expire"
+    case removedCleared:
+        op = "clear"
+    default:
+        return
+    }
+    message := Invalidation{Op: op, Key: key, Origin: c.nodeID, Timestamp: time.Now()}
+    broker := c.broker
+    c.pending = append(c.pending, func() {
+        if err := broker.Publish(message); err != nil {
+            slog.Warn("invalidation not published", "op", op, "key", key, "error", err)
+        }
+    })
+}
+
+// applyInvalidation applies a peer's invalidation. It is applied even in
+// read-only mode, since it keeps the replicas consistent rather than
+// writing new data, and is not published again.
+func (c *LRUCache) applyInvalidation(message Invalidation) {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    if message.Origin != "" && message.Origin == c.nodeID {
+        return
+    }
+    if message.Op == "clear" {
+        c.clear()
+        return
+    }
+    if element, ok := c.cache[message.Key]; ok {
+        c.removeElement(element, removedInvalidated, "")
+    }
+}
+
+// MemoryBroker is an InvalidationBroker connecting caches in the same
+// process, delivering every invalidation synchronously to every
+// subscriber.
+type MemoryBroker struct {
+    mutex       sync.Mutex
+    subscribers map[*func(Invalidation)]struct{}
+}
+
+// NewMemoryBroker returns a broker with no subscribers.
+func NewMemoryBroker() *MemoryBroker {
+    return &MemoryBroker{subscribers: make(map[*func(Invalidation)]struct{})}
+}
+
+func (b *MemoryBroker) Publish(message Invalidation) error {
+    b.mutex.Lock()
+    subscribers := make([]func(Invalidation), 0, len(b.subscribers))
+    for apply := range b.subscribers {
+        subscribers = append(subscribers, *apply)
+    }
+    b.mutex.Unlock()
+
+    for _, apply := range subscribers {
+        apply(message)
+    }
+    return nil
+}
+
+func (b *MemoryBroker) Subscribe(apply func(Invalidation)) (stop func(), err error) {
+    key := &apply
+    b.mutex.Lock()
+    b.subscribers[key] = struct{}{}
+    b.mutex.Unlock()
+
+    return func() {
+        b.mutex.Lock()
+        delete(b.subscribers, key)
+        b.mutex.Unlock()
+    }, nil
+}
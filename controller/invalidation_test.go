@@ -0,0 +1,124 @@
+package main
+
+import (
+    "strings"
+    "sync"
+    "testing"
+)
+
+// brokerReplicas returns n caches sharing invalidations through one
+// MemoryBroker, with invalidation stopped when the test ends.
+func brokerReplicas(t *testing.T, n int) []*LRUCache {
+    t.Helper()
+    broker := NewMemoryBroker()
+    caches := make([]*LRUCache, n)
+    for i := range caches {
+        caches[i] = NewLRUCache(10, WithInvalidationBroker(broker))
+        stop, err := caches[i].StartInvalidation()
+        if err != nil {
+            t.Fatal(err)
+        }
+        t.Cleanup(stop)
+    }
+    return caches
+}
+
+func TestDeleteInvalidatesPeers(t *testing.T) {
+    caches := brokerReplicas(t, 3)
+    for _, cache := range caches {
+        cache.Set("k", 1, 0)
+        cache.Set("other", 1, 0)
+    }
+
+    if deleted, err := caches[0].Delete("k"); !deleted || err != nil {
+        t.Fatalf("Delete = %v, %v", deleted, err)
+    }
+    for i, cache := range caches {
+        if cache.ContainsKey("k") || !cache.ContainsKey("other") {
+            t.Fatalf("replica %d holds %v after the delete", i, viewKeys(cache.Snapshot()))
+        }
+    }
+    // Peers record the removal as an invalidation, not a delete.
+    if events := caches[1].RemovalEvents("k", 1); len(events) != 1 || events[0].Reason != removedInvalidated.String() {
+        t.Fatalf("peer removal events = %+v", events)
+    }
+    if stats := caches[1].Stats(); stats.Deletes != 0 {
+        t.Fatalf("peer counted %d deletes", stats.Deletes)
+    }
+}
+
+func TestClearInvalidatesPeers(t *testing.T) {
+    caches := brokerReplicas(t, 2)
+    caches[1].Set("a", 1, 0)
+    caches[1].Set("b", 2, 0)
+    caches[0].ClearCache()
+    if n := caches[1].Len(); n != 0 {
+        t.Fatalf("peer holds %d entries after a clear", n)
+    }
+}
+
+func TestWritesAreNotPropagated(t *testing.T) {
+    caches := brokerReplicas(t, 2)
+    caches[0].Set("k", 1, 0)
+    caches[1].Set("k", 2, 0)
+    caches[0].Set("k", 3, 0)
+    if caches[1].Get("k") != 2 {
+        t.Fatalf("peer value = %v, want its own write", caches[1].Get("k"))
+    }
+}
+
+func TestOwnInvalidationsAreIgnored(t *testing.T) {
+    // The MemoryBroker echoes every message back to its publisher, which
+    // must not apply it: a write racing with its own delete's echo would
+    // otherwise be lost.
+    broker := NewMemoryBroker()
+    var (
+        mutex    sync.Mutex
+        received []string
+    )
+    stopSpy, _ := broker.Subscribe(func(message Invalidation) {
+        mutex.Lock()
+        received = append(received, message.Op+" "+message.Key)
+        mutex.Unlock()
+    })
+    defer stopSpy()
+    cache := NewLRUCache(10, WithInvalidationBroker(broker))
+    stop, err := cache.StartInvalidation()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer stop()
+
+    cache.Set("k", 1, 0)
+    cache.Set("kept", 1, 0)
+    cache.Delete("k")
+    broker.Publish(Invalidation{Op: "delete", Key: "kept", Origin: cache.nodeID})
+    if !cache.ContainsKey("kept") {
+        t.Fatal("the cache applied its own invalidation")
+    }
+    if got := strings.Join(received, ", "); got != "delete k, delete kept" {
+        t.Fatalf("broker carried %s", got)
+    }
+}
+
+func TestStoppedReplicaNoLongerShares(t *testing.T) {
+    broker := NewMemoryBroker()
+    a := NewLRUCache(10, WithInvalidationBroker(broker))
+    b := NewLRUCache(10, WithInvalidationBroker(broker))
+    stopA, _ := a.StartInvalidation()
+    stopB, _ := b.StartInvalidation()
+    defer stopB()
+    a.Set("k", 1, 0)
+    b.Set("k", 1, 0)
+
+    stopA()
+    a.Delete("k")
+    if !b.ContainsKey("k") {
+        t.Fatal("a stopped replica still published")
+    }
+    a.Set("k", 1, 0)
+    b.Delete("k")
+    if !a.ContainsKey("k") {
+        t.Fatal("a stopped replica still applied invalidations")
+    }
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+    "container/list"
+    "time"
+)
+
+// maxTrackedMisses bounds the number of distinct keys whose misses are
+// remembered, so scans over random keys cannot grow the tracker.
+const maxTrackedMisses = 1024
+
+// missTracker counts misses per key for a bounded set of recently missed
+// keys, evicting the least recently missed key when full. It is guarded by
+// the owning cache's lock.
+type missTracker struct {
+    capacity int
+    counts   map[string]*list.Element
+    order    *list.List
+}
+
+type missCount struct {
+    key   string
+    count uint64
+}
+
+func newMissTracker(capacity int) *missTracker {
+    return &missTracker{capacity: capacity, counts: make(map[string]*list.Element), order: list.New()}
+}
+
+// record counts a miss for key. The caller must hold the write lock.
+func (t *missTracker) record(key string) {
+    if element, ok := t.counts[key]; ok {
+        element.Value.(*missCount).count++
+        t.order.MoveToFront(element)
+        return
+    }
+    t.counts[key] = t.order.PushFront(&missCount{key: key, count: 1})
+    if t.order.Len() > t.capacity {
+        oldest := t.order.Back()
+        delete(t.counts, oldest.Value.(*missCount).key)
+        t.order.Remove(oldest)
+    }
+}
+
+// count returns the recorded misses for key. The caller must hold the lock.
+func (t *missTracker) count(key string) uint64 {
+    if element, ok := t.counts[key]; ok {
+        return element.Value.(*missCount).count
+    }
+    return 0
+}
+
+// KeyAccessStats describes one key. Misses are only remembered for the most
+// recently missed keys. TTLRemaining is -1 for entries without a TTL, and
+// Rank is the entry's position in LRU order, 0 being most recently used.
+// The entry fields are zero when Present is false.
+type KeyAccessStats struct {
+    Key          string    `json:"key"`
+    Present      bool      `json:"present"`
+    Hits         uint64    `json:"hits"`
+    Misses       uint64    `json:"misses"`
+    CreatedAt    time.Time `json:"created_at"`
+    UpdatedAt    time.Time `json:"updated_at"`
+    TTLRemaining float64   `json:"ttl_remaining_seconds"`
+    Rank         int       `json:"lru_rank"`
+}
+
+// StatsFor returns the access statistics for key without counting as an
+// access. Computing the rank walks the LRU list, so it is O(n).
+func (c *LRUCache) StatsFor(key string) KeyAccessStats {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    stats := KeyAccessStats{Key: key, Misses: c.misses.count(key), Rank: -1}
+    element, ok := c.cache[key]
+    now := c.now()
+    if !ok || element.Value.(*cacheEntry).expired(now) {
+        return stats
+    }
+
+    entry := element.Value.(*cacheEntry)
+    stats.Present = true
+    stats.Hits = entry.hits
+    stats.CreatedAt = entry.createdAt
+    stats.UpdatedAt = entry.modifiedAt
+    stats.TTLRemaining = -1
+    if !entry.expiration.IsZero() {
+        stats.TTLRemaining = entry.expiration.Sub(now).Seconds()
+    }
+    rank := 0
+    for e := c.list.Front(); e != element; e = e.Next() {
+        rank++
+    }
+    stats.Rank = rank
+    return stats
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+    "strconv"
+    "testing"
+    "time"
+)
+
+func TestStatsForHitsAndMisses(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    created := clock.Now()
+
+    // Misses recorded before the key exists count towards it too.
+    cache.Get("k")
+    cache.Get("k")
+    cache.Set("k", 1, time.Minute)
+    clock.Advance(10 * time.Second)
+    cache.Set("k", 2, time.Minute)
+    cache.Get("k")
+    cache.Get("k")
+    cache.Get("k")
+    cache.Set("newer", 3, 0)
+
+    stats := cache.StatsFor("k")
+    want := KeyAccessStats{
+        Key:          "k",
+        Present:      true,
+        Hits:         3,
+        Misses:       2,
+        CreatedAt:    created,
+        UpdatedAt:    created.Add(10 * time.Second),
+        TTLRemaining: 60,
+        Rank:         1,
+    }
+    if stats != want {
+        t.Fatalf("StatsFor(k) = %+v, want %+v", stats, want)
+    }
+    if hits := cache.StatsFor("k").Hits; hits != 3 {
+        t.Fatalf("StatsFor counted as an access: %d hits", hits)
+    }
+
+    clock.Advance(time.Minute)
+    cache.Get("k")
+    stats = cache.StatsFor("k")
+    if stats.Present || stats.Misses != 3 || stats.Rank != -1 {
+        t.Fatalf("StatsFor(k) = %+v after expiry", stats)
+    }
+}
+
+func TestMissTrackerIsBounded(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Get("first")
+    for i := 0; i < maxTrackedMisses; i++ {
+        cache.Get("scan-" + strconv.Itoa(i))
+    }
+    if n := len(cache.misses.counts); n != maxTrackedMisses {
+        t.Fatalf("tracking %d keys, want %d", n, maxTrackedMisses)
+    }
+    if misses := cache.StatsFor("first").Misses; misses != 0 {
+        t.Fatalf("least recently missed key still has %d misses", misses)
+    }
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "sync/atomic"
+    "time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the operation latency
+// histogram buckets, from one microsecond to 50 milliseconds.
+var latencyBuckets = [...]float64{.000001, .0000025, .000005, .00001, .000025, .00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05}
+
+// latencyHistogram is a histogram updated with atomics only, so timing an
+// operation never waits on anything but the operation itself. Bucket
+// counts are stored per bucket and made cumulative when read.
+type latencyHistogram struct {
+    counts [len(latencyBuckets) + 1]atomic.Uint64 // the last one is +Inf
+    sumNs  atomic.Uint64
+    maxNs  atomic.Uint64
+}
+
+// observeSince records and returns the time elapsed since start.
+func (h *latencyHistogram) observeSince(start time.Time) time.Duration {
+    d := time.Since(start)
+    seconds := d.Seconds()
+    i := 0
+    for i < len(latencyBuckets) && seconds > latencyBuckets[i] {
+        i++
+    }
+    h.counts[i].Add(1)
+    ns := uint64(d)
+    h.sumNs.Add(ns)
+    for {
+        max := h.maxNs.Load()
+        if ns <= max || h.maxNs.CompareAndSwap(max, ns) {
+            break
+        }
+    }
+    return d
+}
+
+// reset zeroes the histogram. Observations racing with it may be lost.
+func (h *latencyHistogram) reset() {
+    for i := range h.counts {
+        h.counts[i].Store(0)
+    }
+    h.sumNs.Store(0)
+    h.maxNs.Store(0)
+}
+
+// histogram returns a cumulative copy suitable for the /metrics output.
+func (h *latencyHistogram) histogram() *histogram {
+    out := newHistogram(latencyBuckets[:])
+    var cumulative uint64
+    for i := range latencyBuckets {
+        cumulative += h.counts[i].Load()
+        out.counts[i] = cumulative
+    }
+    out.count = cumulative + h.counts[len(latencyBuckets)].Load()
+    out.sum = time.Duration(h.sumNs.Load()).Seconds()
+    return out
+}
+
+// LatencyStats summarizes the latency of one cache operation. Percentiles
+// are the upper bounds of the histogram buckets they fall in.
+type LatencyStats struct {
+    Count       uint64  `json:"count"`
+    MeanSeconds float64 `json:"mean_seconds"`
+    MaxSeconds  float64 `json:"max_seconds"`
+    P50Seconds  float64 `json:"p50_seconds"`
+    P99Seconds  float64 `json:"p99_seconds"`
+}
+
+func (h *latencyHistogram) stats() LatencyStats {
+    snapshot := h.histogram()
+    stats := LatencyStats{
+        Count:      snapshot.count,
+        MaxSeconds: time.Duration(h.maxNs.Load()).Seconds(),
+    }
+    if snapshot.count > 0 {
+        stats.MeanSeconds = snapshot.sum / float64(snapshot.count)
+        stats.P50Seconds = snapshot.quantile(0.5)
+        stats.P99Seconds = snapshot.quantile(0.99)
+    }
+    return stats
+}
+
+// quantile returns the upper bound of the bucket holding the q-th
+// quantile. JSON cannot encode +Inf, so the largest bucket bound is
+// reported instead when the quantile falls beyond it.
+func (h *histogram) quantile(q float64) float64 {
+    rank := uint64(math.Ceil(q * float64(h.count)))
+    for i, upper := range h.buckets {
+        if h.counts[i] >= rank {
+            return upper
+        }
+    }
+    return h.buckets[len(h.buckets)-1]
+}
+
+// opLatencies holds one latency histogram per timed cache operation. Each
+// covers waiting for the lock as well as the work done under it.
+type opLatencies struct {
+    get        latencyHistogram
+    set        latencyHistogram
+    delete     latencyHistogram
+    cacheState latencyHistogram
+}
+
+// each calls fn with the name and histogram of every operation, in a
+// stable order.
+func (l *opLatencies) each(fn func(op string, h *latencyHistogram)) {
+    fn("get", &l.get)
+    fn("set", &l.set)
+    fn("delete", &l.delete)
+    fn("cache_state", &l.cacheState)
+}
+
+func (l *opLatencies) reset() {
+    l.each(func(_ string, h *latencyHistogram) { h.reset() })
+}
+
+// OperationLatencies returns latency statistics for Get, Set, Delete and
+// GetCacheState, keyed by "get", "set", "delete" and "cache_state".
+func (c *LRUCache) OperationLatencies() map[string]LatencyStats {
+    result := make(map[string]LatencyStats, 4)
+    c.latency.each(func(op string, h *latencyHistogram) {
+        result[op] = h.stats()
+    })
+    return result
+}
+
+// writeLatencyMetrics emits the operation latency histograms.
+func writeLatencyMetrics(w io.Writer, c *LRUCache) {
+    fmt.Fprintln(w, "# HELP cache_operation_duration_seconds Cache operation latency, including lock acquisition.")
+    fmt.Fprintln(w, "# TYPE cache_operation_duration_seconds histogram")
+    c.latency.each(func(op string, h *latencyHistogram) {
+        h.histogram().write(w, "cache_operation_duration_seconds", fmt.Sprintf("op=%q", op))
+    })
+}
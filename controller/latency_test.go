@@ -0,0 +1,58 @@
+package main
+
+import (
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+)
+
+func TestLatencyUnderContention(t *testing.T) {
+    cache := NewLRUCache(20_000)
+    for i := 0; i < 20_000; i++ {
+        cache.Set(strconv.Itoa(i), strings.Repeat("v", 32), 0)
+    }
+    cache.ResetStats()
+
+    // Gets contend with full-cache scans for the lock; each scan copies
+    // every entry, so it should take far longer than any single Get.
+    var wg sync.WaitGroup
+    for w := 0; w < 2; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := 0; i < 5; i++ {
+                cache.GetCacheState()
+            }
+        }()
+    }
+    for w := 0; w < 4; w++ {
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            for i := 0; i < 2000; i++ {
+                cache.Get(strconv.Itoa(i * (w + 1)))
+            }
+        }(w)
+    }
+    wg.Wait()
+
+    latencies := cache.OperationLatencies()
+    get, state := latencies["get"], latencies["cache_state"]
+    if get.Count != 8000 || state.Count != 10 {
+        t.Fatalf("counted %d gets and %d scans, want 8000 and 10", get.Count, state.Count)
+    }
+    if state.MeanSeconds <= get.MeanSeconds || state.P50Seconds < get.P50Seconds {
+        t.Fatalf("GetCacheState %+v is not slower than Get %+v", state, get)
+    }
+    if state.MaxSeconds <= 0 || state.MaxSeconds < state.MeanSeconds {
+        t.Fatalf("GetCacheState max %v, mean %v", state.MaxSeconds, state.MeanSeconds)
+    }
+
+    var b strings.Builder
+    writeLatencyMetrics(&b, cache)
+    series, _ := parseMetrics(t, b.String())
+    if series[`cache_operation_duration_seconds_count{op="cache_state"}`] != 10 || series[`cache_operation_duration_seconds_count{op="get"}`] != 8000 {
+        t.Fatalf("latency metrics:\n%s", b.String())
+    }
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+    "context"
+    "time"
+)
+
+// defaultLeaseTimeout is how long a Lease lasts unless configured with
+// WithLeaseTimeout.
+const defaultLeaseTimeout = 10 * time.Second
+
+// WithLeaseTimeout sets how long a Lease returned by GetLease lasts before
+// it is released on its own, letting another caller populate the key if
+// the holder crashed or forgot to. The default is 10 seconds.
+func WithLeaseTimeout(d time.Duration) Option {
+    return func(c *LRUCache) {
+        c.leaseTimeout = d
+    }
+}
+
+// Lease is the exclusive right to populate a missing key, handed out by
+// GetLease. The holder must end it with Set or Release.
+type Lease struct {
+    cache *LRUCache
+    key   string
+    timer *time.Timer
+    // ended is closed when the lease ends. storing is set, under the
+    // cache's leaseMutex, while Set writes the value, which the lease
+    // timing out does not interrupt.
+    ended   chan struct{}
+    storing bool
+}
+
+// GetLease looks up key like Get, without calling the loader. On a hit it
+// returns the value with ok set. On a miss it returns a Lease, and until
+// the lease is ended every other GetLease call for key waits for it, then
+// returns the value it stored, or takes a lease itself if none was. This
+// way a miss is populated by a single caller instead of every caller
+// querying the backend at once. A lease not ended within the lease timeout
+// is released on its own.
+//
+// Callers only wait for leases on the same key, and no lock is held while
+// the cache is read or written, so callbacks run by the cache, such as
+// WithOnEvict, may take leases on other keys than the one being stored.
+func (c *LRUCache) GetLease(key string) (value interface{}, lease *Lease, ok bool) {
+    for {
+        c.leaseMutex.Lock()
+        if held := c.leases[key]; held != nil {
+            c.leaseMutex.Unlock()
+            <-held.ended
+            continue
+        }
+        ended := c.leasesEnded
+        c.leaseMutex.Unlock()
+
+        if entry, _, err := c.get(context.Background(), key); err == nil {
+            return entry.value, nil, true
+        }
+
+        c.leaseMutex.Lock()
+        // A lease taken meanwhile, or one that ended meanwhile and may
+        // have stored the value, means looking again rather than handing
+        // out a second lease for the same miss.
+        if c.leases[key] != nil || c.leasesEnded != ended {
+            c.leaseMutex.Unlock()
+            continue
+        }
+        lease = &Lease{cache: c, key: key, ended: make(chan struct{})}
+        lease.timer = time.AfterFunc(c.leaseTimeout, lease.Release)
+        c.leases[key] = lease
+        c.leaseMutex.Unlock()
+        return nil, lease, false
+    }
+}
+
+// Set stores value under the lease's key for ttl, as Set would, and ends
+// the lease, waking the callers waiting on it. It fails with
+// ErrLeaseExpired, without storing anything, if the lease has already
+// ended or is being ended by another call to Set.
+func (l *Lease) Set(value interface{}, ttl time.Duration) error {
+    c := l.cache
+    c.leaseMutex.Lock()
+    if c.leases[l.key] != l || l.storing {
+        c.leaseMutex.Unlock()
+        return &CacheError{Op: "lease set", Key: l.key, Err: ErrLeaseExpired}
+    }
+    l.storing = true
+    c.leaseMutex.Unlock()
+
+    // The lease stays held while the value is stored, so waiters find it
+    // once they wake.
+    err := c.Set(l.key, value, ttl)
+
+    c.leaseMutex.Lock()
+    defer c.leaseMutex.Unlock()
+    l.end()
+    return err
+}
+
+// Release ends the lease without storing anything, so the next caller
+// waiting on it takes a lease of its own. Releasing an ended lease, or one
+// whose Set is in progress, does nothing.
+func (l *Lease) Release() {
+    c := l.cache
+    c.leaseMutex.Lock()
+    defer c.leaseMutex.Unlock()
+
+    if c.leases[l.key] == l && !l.storing {
+        l.end()
+    }
+}
+
+// end removes the lease and wakes its waiters. The caller must hold
+// leaseMutex.
+func (l *Lease) end() {
+    l.timer.Stop()
+    delete(l.cache.leases, l.key)
+    l.cache.leasesEnded++
+    close(l.ended)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestGetLeaseSingleHolder(t *testing.T) {
+    cache := NewLRUCache(10)
+    _, lease, ok := cache.GetLease("k")
+    if ok || lease == nil {
+        t.Fatalf("GetLease on a miss = %v, %v; want a lease", lease, ok)
+    }
+
+    const waiters = 10
+    var (
+        wg     sync.WaitGroup
+        leases atomic.Int32
+        values = make([]interface{}, waiters)
+    )
+    for i := 0; i < waiters; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            value, lease, _ := cache.GetLease("k")
+            if lease != nil {
+                leases.Add(1)
+                lease.Release()
+            }
+            values[i] = value
+        }(i)
+    }
+    time.Sleep(20 * time.Millisecond)
+    if err := lease.Set("v", 0); err != nil {
+        t.Fatal(err)
+    }
+    wg.Wait()
+
+    if n := leases.Load(); n != 0 {
+        t.Fatalf("%d waiters took a lease after the value was stored", n)
+    }
+    for i, value := range values {
+        if value != "v" {
+            t.Fatalf("waiter %d got %v, want v", i, value)
+        }
+    }
+    if err := lease.Set("again", 0); err == nil {
+        t.Fatal("an ended lease stored a value")
+    }
+}
+
+func TestLeaseReleasePassesToWaiter(t *testing.T) {
+    cache := NewLRUCache(10)
+    _, first, _ := cache.GetLease("k")
+    got := make(chan *Lease)
+    go func() {
+        _, lease, _ := cache.GetLease("k")
+        got <- lease
+    }()
+
+    first.Release()
+    second := <-got
+    if second == nil {
+        t.Fatal("the waiter did not take a lease after the release")
+    }
+    second.Set("v", 0)
+    if value, lease, ok := cache.GetLease("k"); value != "v" || lease != nil || !ok {
+        t.Fatalf("GetLease after Set = %v, %v, %v", value, lease, ok)
+    }
+}
+
+func TestLeaseTimesOut(t *testing.T) {
+    cache := NewLRUCache(10, WithLeaseTimeout(10*time.Millisecond))
+    _, crashed, _ := cache.GetLease("k")
+
+    start := time.Now()
+    _, lease, _ := cache.GetLease("k")
+    if lease == nil || time.Since(start) < 10*time.Millisecond {
+        t.Fatalf("second GetLease = %v after %v, want a lease once the first timed out", lease, time.Since(start))
+    }
+    if err := crashed.Set("late", 0); err == nil || cache.ContainsKey("k") {
+        t.Fatalf("timed out lease Set = %v, want ErrLeaseExpired and nothing stored", err)
+    }
+    lease.Release()
+}
+
+func TestLeaseFromEvictionCallback(t *testing.T) {
+    // The eviction callback runs on the goroutine storing the leased
+    // value and takes a lease of its own on the evicted key.
+    var cache *LRUCache
+    var relet atomic.Bool
+    cache = NewLRUCache(1, WithOnEvict(func(key string, value interface{}, meta *RequestMeta) {
+        if _, lease, _ := cache.GetLease(key); lease != nil {
+            relet.Store(true)
+            lease.Release()
+        }
+    }))
+    cache.Set("old", 1, 0)
+
+    done := make(chan error, 1)
+    go func() {
+        _, lease, _ := cache.GetLease("new")
+        done <- lease.Set(2, 0)
+    }()
+    select {
+    case err := <-done:
+        if err != nil {
+            t.Fatal(err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("Lease.Set deadlocked with a callback taking a lease")
+    }
+    if !relet.Load() || cache.Get("new") != 2 {
+        t.Fatalf("callback took a lease: %v; new = %v", relet.Load(), cache.Get("new"))
+    }
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "time"
+)
+
+// Loader fetches the value for a key missing from the cache, along with
+// the TTL to store it with. A non-positive TTL stores the value without
+// expiration.
+type Loader interface {
+    Load(ctx context.Context, key string) (value interface{}, ttl time.Duration, err error)
+}
+
+// LoaderFunc adapts a function to the Loader interface.
+type LoaderFunc func(ctx context.Context, key string) (interface{}, time.Duration, error)
+
+func (f LoaderFunc) Load(ctx context.Context, key string) (interface{}, time.Duration, error) {
+    return f(ctx, key)
+}
+
+// load calls the loader for key and stores the result. Concurrent loads of
+// the same key are collapsed into one call, made with the context of the
+// first caller; the others wait for its result. Every caller stops waiting
+// once its own ctx is done, even if the loader ignores the context. Loader
+// failures, after any retries, and abandoned waits are reported as a
+// *CacheError wrapping ErrBackend, loads refused by an open circuit
+// breaker as one wrapping ErrBackendUnavailable, and loads refused by the
+// concurrency limit as one wrapping ErrLoaderBusy.
+func (c *LRUCache) load(ctx context.Context, key string) (interface{}, error) {
+    result := c.loads.DoChan(key, func() (interface{}, error) {
+        if err := c.failedLoads.get(key); err != nil {
+            return nil, err
+        }
+        if !c.breaker.allow() {
+            return nil, &CacheError{Op: "load", Key: key, Err: ErrBackendUnavailable}
+        }
+        value, ttl, err := c.callLoader(ctx, key)
+        if errors.Is(err, ErrLoaderBusy) {
+            c.breaker.abandon()
+            return nil, &CacheError{Op: "load", Key: key, Err: ErrLoaderBusy}
+        }
+        if err != nil && ctx.Err() != nil {
+            c.breaker.abandon()
+        } else {
+            c.breaker.done(err != nil)
+        }
+        if err != nil {
+            err = &CacheError{Op: "load", Key: key, Err: fmt.Errorf("%w: %w", ErrBackend, err)}
+            if c.retry.NegativeTTL > 0 {
+                c.failedLoads.put(key, err, c.retry.NegativeTTL)
+            }
+            return nil, err
+        }
+        // The caller still gets the value when it cannot be stored, for
+        // example because the cache is read-only.
+        if err := c.SetCtx(ctx, key, value, max(ttl, 0)); err != nil {
+            slog.Warn("loaded value not cached", "key", key, "error", err)
+        }
+        return value, nil
+    })
+    select {
+    case r := <-result:
+        return r.Val, r.Err
+    case <-ctx.Done():
+        return nil, &CacheError{Op: "load", Key: key, Err: fmt.Errorf("%w: %w", ErrBackend, ctx.Err())}
+    }
+}
+
+// RefreshAhead makes Get reload key through the loader in the background
+// once a hit finds less than threshold left before the entry expires. The
+// current value is returned meanwhile, so readers never wait for the
+// reload. A non-positive threshold cancels refresh-ahead for key. It has no
+// effect without a loader or on entries without a TTL.
+func (c *LRUCache) RefreshAhead(key string, threshold time.Duration) {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    if threshold <= 0 {
+        delete(c.refreshAhead, key)
+        return
+    }
+    if c.refreshAhead == nil {
+        c.refreshAhead = make(map[string]time.Duration)
+    }
+    c.refreshAhead[key] = threshold
+}
+
+// WatchForRefresh adds key to the watchlist of StartRefresher, which then
+// reloads it through the loader shortly before it expires, or as soon as
+// it is missing, so reads of it never miss. Delete removes the key from
+// the watchlist.
+func (c *LRUCache) WatchForRefresh(key string) {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    if c.refreshWatchlist == nil {
+        c.refreshWatchlist = make(map[string]struct{})
+    }
+    c.refreshWatchlist[key] = struct{}{}
+}
+
+// UnwatchForRefresh removes key from the watchlist of StartRefresher.
+func (c *LRUCache) UnwatchForRefresh(key string) {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    delete(c.refreshWatchlist, key)
+}
+
+// StartRefresher checks the keys registered with WatchForRefresh every
+// interval in a background goroutine, until the returned stop function is
+// called, and reloads those missing or expiring within window. The window
+// should be longer than interval plus the time a load takes, or entries
+// may expire before they are reloaded. Without a loader it does nothing.
+func (c *LRUCache) StartRefresher(interval, window time.Duration) (stop func()) {
+    ticker := time.NewTicker(interval)
+    done := make(chan struct{})
+    go func() {
+        for {
+            select {
+            case <-ticker.C:
+                for _, key := range c.refreshDue(c.now().Add(window)) {
+                    c.refresh(key)
+                }
+            case <-done:
+                ticker.Stop()
+                return
+            }
+        }
+    }()
+    return func() { close(done) }
+}
+
+// refreshDue returns the watched keys that are missing or expire before
+// deadline.
+func (c *LRUCache) refreshDue(deadline time.Time) []string {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    var due []string
+    for key := range c.refreshWatchlist {
+        element, ok := c.cache[key]
+        if !ok {
+            due = append(due, key)
+            continue
+        }
+        if expiration := element.Value.(*cacheEntry).expiration; !expiration.IsZero() && expiration.Before(deadline) {
+            due = append(due, key)
+        }
+    }
+    return due
+}
+
+// refresh starts a background reload of key unless one is already running.
+func (c *LRUCache) refresh(key string) {
+    if c.loader == nil {
+        return
+    }
+    if _, running := c.refreshing.LoadOrStore(key, struct{}{}); running {
+        return
+    }
+    c.setRefreshing(key, true)
+    go func() {
+        defer c.refreshing.Delete(key)
+        if _, err := c.load(context.Background(), key); err != nil {
+            c.setRefreshing(key, false)
+            slog.Warn("refresh failed", "key", key, "error", err)
+        }
+    }()
+}
+
+// setRefreshing marks the entry for key, if any, as being refreshed or
+// not. A successful reload clears the mark when it stores the new value.
+func (c *LRUCache) setRefreshing(key string, refreshing bool) {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    if element, ok := c.cache[key]; ok {
+        element.Value.(*cacheEntry).isRefreshing = refreshing
+    }
+}
+
+// StaleWhileRevalidate is like Get but, following RFC 5861, returns an
+// expired value instead of waiting while a background reload of key is in
+// progress. A lookup that finds an expired entry starts that reload itself
+// when a loader is configured. It reports false when no value, fresh or
+// stale, is available.
+func (c *LRUCache) StaleWhileRevalidate(key string) (interface{}, bool) {
+    c.mutex.Lock()
+    element, ok := c.cache[key]
+    if !ok {
+        c.countMiss(key)
+        c.unlock()
+        return nil, false
+    }
+    entry := element.Value.(*cacheEntry)
+    now := c.now()
+    if !entry.expired(now) {
+        c.promote(element)
+        entry.hits++
+        entry.lastAccess = now
+        c.stats.hits.Add(1)
+        c.recent.hit()
+        c.unlock()
+        return entry.value, true
+    }
+    if c.loader == nil {
+        c.removeElement(element, removedExpired, "")
+        c.countMiss(key)
+        c.unlock()
+        return nil, false
+    }
+    value := entry.value
+    c.unlock()
+
+    c.refresh(key)
+    return value, true
+}
+
+// WithLoaderConcurrency lets at most n loader calls run at once, across
+// all keys, to protect a fragile backend. Calls beyond the limit wait for
+// a slot, or for their context to be done, unless failFast is set, when
+// they fail at once with ErrLoaderBusy. Retries take a new slot for every
+// attempt. A non-positive n removes the limit.
+func WithLoaderConcurrency(n int, failFast bool) Option {
+    return func(c *LRUCache) {
+        c.loadSlots, c.loadFailFast = nil, failFast
+        if n > 0 {
+            c.loadSlots = make(chan struct{}, n)
+        }
+    }
+}
+
+// LoadsInFlight returns the number of loader calls running.
+func (c *LRUCache) LoadsInFlight() int64 {
+    return c.loadsInFlight.Load()
+}
+
+// LoaderConcurrency returns the limit set by WithLoaderConcurrency, or
+// zero if loads are unlimited.
+func (c *LRUCache) LoaderConcurrency() int {
+    return cap(c.loadSlots)
+}
+
+// acquireLoadSlot takes a slot for a loader call, waiting for one unless
+// the cache fails fast. Every successful call must be followed by
+// releaseLoadSlot.
+func (c *LRUCache) acquireLoadSlot(ctx context.Context) error {
+    if c.loadSlots == nil {
+        return nil
+    }
+    select {
+    case c.loadSlots <- struct{}{}:
+        return nil
+    default:
+    }
+    if c.loadFailFast {
+        return ErrLoaderBusy
+    }
+    select {
+    case c.loadSlots <- struct{}{}:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// releaseLoadSlot returns the slot taken by acquireLoadSlot.
+func (c *LRUCache) releaseLoadSlot() {
+    if c.loadSlots != nil {
+        <-c.loadSlots
+    }
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestGetCtxLoadsMissOnce(t *testing.T) {
+    var calls atomic.Int32
+    release := make(chan struct{})
+    cache := NewLRUCache(10, WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        calls.Add(1)
+        <-release
+        return "value of " + key, time.Hour, nil
+    })))
+
+    const readers = 10
+    var wg sync.WaitGroup
+    values := make([]interface{}, readers)
+    errs := make([]error, readers)
+    for i := 0; i < readers; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            values[i], errs[i] = cache.GetCtx(context.Background(), "k")
+        }(i)
+    }
+    // Let every reader join the load before it finishes.
+    for cache.LoadsInFlight() == 0 {
+        time.Sleep(time.Millisecond)
+    }
+    time.Sleep(20 * time.Millisecond)
+    close(release)
+    wg.Wait()
+
+    if n := calls.Load(); n != 1 {
+        t.Fatalf("loader called %d times, want 1", n)
+    }
+    for i := range values {
+        if values[i] != "value of k" || errs[i] != nil {
+            t.Fatalf("reader %d got %v, %v", i, values[i], errs[i])
+        }
+    }
+    if value, err := cache.GetCtx(context.Background(), "k"); value != "value of k" || err != nil || calls.Load() != 1 {
+        t.Fatalf("cached GetCtx = %v, %v after %d loads", value, err, calls.Load())
+    }
+}
+
+func TestLoadReturnsValueNotStored(t *testing.T) {
+    buf := captureLogs(t)
+    cache := NewLRUCache(10, WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        return 1, 0, nil
+    })))
+    cache.SetReadOnly(true)
+
+    if value, err := cache.GetCtx(context.Background(), "k"); value != 1 || err != nil {
+        t.Fatalf("GetCtx = %v, %v; want 1, nil", value, err)
+    }
+    if cache.ContainsKey("k") {
+        t.Fatal("a read-only cache stored the loaded value")
+    }
+    if !strings.Contains(buf.String(), "loaded value not cached") {
+        t.Fatalf("the failed store was not logged:\n%s", buf)
+    }
+}
+
+func TestRefreshAheadReloadsBeforeExpiry(t *testing.T) {
+    clock := newFakeClock()
+    var calls atomic.Int32
+    release := make(chan struct{})
+    cache := NewLRUCache(10, WithClock(clock.Now), WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        calls.Add(1)
+        <-release
+        return "new", 10 * time.Second, nil
+    })))
+    cache.Set("k", "old", 10*time.Second)
+    cache.RefreshAhead("k", 5*time.Second)
+
+    if value := cache.Get("k"); value != "old" || calls.Load() != 0 {
+        t.Fatalf("Get with 10s left = %v after %d loads, want old and no reload", value, calls.Load())
+    }
+
+    // With 4s left every hit returns the current value, and only the
+    // first starts a reload.
+    clock.Advance(6 * time.Second)
+    for i := 0; i < 5; i++ {
+        if value := cache.Get("k"); value != "old" {
+            t.Fatalf("Get during the reload = %v, want old", value)
+        }
+    }
+    close(release)
+    deadline := time.Now().Add(time.Second)
+    for cache.Get("k") != "new" {
+        if time.Now().After(deadline) {
+            t.Fatal("the entry was not reloaded")
+        }
+        time.Sleep(time.Millisecond)
+    }
+    if n := calls.Load(); n != 1 {
+        t.Fatalf("loader called %d times, want 1", n)
+    }
+
+    // The reloaded entry outlives the original expiration.
+    clock.Advance(5 * time.Second)
+    if value := cache.Get("k"); value != "new" {
+        t.Fatalf("Get past the original expiration = %v, want new", value)
+    }
+}
+
+func TestRefresherReloadsWatchedKeys(t *testing.T) {
+    clock := newFakeClock()
+    var mu sync.Mutex
+    loads := map[string]int{}
+    cache := NewLRUCache(10, WithClock(clock.Now), WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        mu.Lock()
+        defer mu.Unlock()
+        loads[key]++
+        return "new", 10 * time.Second, nil
+    })))
+    loadCount := func(key string) int {
+        mu.Lock()
+        defer mu.Unlock()
+        return loads[key]
+    }
+    cache.Set("watched", "old", 10*time.Second)
+    cache.Set("unwatched", "old", 10*time.Second)
+    cache.WatchForRefresh("watched")
+    stop := cache.StartRefresher(time.Millisecond, 5*time.Second)
+    defer stop()
+
+    // Nothing is due while the entry has more than the window left.
+    time.Sleep(20 * time.Millisecond)
+    if n := loadCount("watched"); n != 0 {
+        t.Fatalf("watched key reloaded %d times with 10s left", n)
+    }
+
+    // With 4s left the watched key is reloaded, before it expires.
+    clock.Advance(6 * time.Second)
+    deadline := time.Now().Add(time.Second)
+    for cache.Get("watched") != "new" {
+        if time.Now().After(deadline) {
+            t.Fatal("the watched key was not reloaded")
+        }
+        time.Sleep(time.Millisecond)
+    }
+
+    // Past the original expiration only the unwatched key is gone.
+    clock.Advance(5 * time.Second)
+    if value := cache.Get("watched"); value != "new" {
+        t.Fatalf("watched key past its original expiration = %v, want new", value)
+    }
+    if cache.ContainsKey("unwatched") {
+        t.Fatal("the unwatched key did not expire")
+    }
+    if n := loadCount("unwatched"); n != 0 {
+        t.Fatalf("unwatched key loaded %d times", n)
+    }
+
+    // Delete unwatches the key, so it is not loaded again.
+    if _, err := cache.Delete("watched"); err != nil {
+        t.Fatal(err)
+    }
+    before := loadCount("watched")
+    time.Sleep(20 * time.Millisecond)
+    if n := loadCount("watched"); n != before || cache.ContainsKey("watched") {
+        t.Fatalf("deleted key reloaded: %d loads, was %d", n, before)
+    }
+}
+
+func TestRefresherLoadsMissingWatchedKey(t *testing.T) {
+    cache := NewLRUCache(10, WithClock(newFakeClock().Now), WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        return "loaded", 0, nil
+    })))
+    cache.WatchForRefresh("k")
+    stop := cache.StartRefresher(time.Millisecond, time.Second)
+    defer stop()
+
+    deadline := time.Now().Add(time.Second)
+    for !cache.ContainsKey("k") {
+        if time.Now().After(deadline) {
+            t.Fatal("the missing watched key was not loaded")
+        }
+        time.Sleep(time.Millisecond)
+    }
+    if value := cache.Get("k"); value != "loaded" {
+        t.Fatalf("Get = %v, want loaded", value)
+    }
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+    clock := newFakeClock()
+    var calls atomic.Int32
+    release := make(chan struct{})
+    cache := NewLRUCache(10, WithClock(clock.Now), WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        calls.Add(1)
+        <-release
+        return "fresh", time.Minute, nil
+    })))
+    cache.Set("k", "stale", time.Second)
+    clock.Advance(2 * time.Second)
+
+    // Every lookup gets the stale value while a single reload runs.
+    for i := 0; i < 3; i++ {
+        if value, ok := cache.StaleWhileRevalidate("k"); value != "stale" || !ok {
+            t.Fatalf("lookup %d = %v, %v; want the stale value", i, value, ok)
+        }
+    }
+
+    close(release)
+    deadline := time.Now().Add(time.Second)
+    for {
+        value, ok := cache.StaleWhileRevalidate("k")
+        if value == "fresh" && ok {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("lookup after the reload = %v, %v; want the fresh value", value, ok)
+        }
+        time.Sleep(time.Millisecond)
+    }
+    if n := calls.Load(); n != 1 {
+        t.Fatalf("loader called %d times, want 1", n)
+    }
+}
+
+func TestStaleWhileRevalidateWithoutLoader(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    cache.Set("k", "stale", time.Second)
+    clock.Advance(2 * time.Second)
+
+    if value, ok := cache.StaleWhileRevalidate("k"); value != nil || ok {
+        t.Fatalf("lookup = %v, %v; want a miss", value, ok)
+    }
+    if value, ok := cache.StaleWhileRevalidate("missing"); value != nil || ok {
+        t.Fatalf("lookup of a missing key = %v, %v; want a miss", value, ok)
+    }
+}
+
+func TestLoaderConcurrencyLimit(t *testing.T) {
+    const limit, readers = 3, 30
+    var running, peak atomic.Int64
+    var cache *LRUCache
+    cache = NewLRUCache(readers, WithLoaderConcurrency(limit, false), WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        n := running.Add(1)
+        defer running.Add(-1)
+        for {
+            old := peak.Load()
+            if n <= old || peak.CompareAndSwap(old, n) {
+                break
+            }
+        }
+        if inFlight := cache.LoadsInFlight(); inFlight > limit {
+            t.Errorf("LoadsInFlight = %d above the limit of %d", inFlight, limit)
+        }
+        time.Sleep(5 * time.Millisecond)
+        return "value of " + key, 0, nil
+    })))
+
+    var wg sync.WaitGroup
+    errs := make([]error, readers)
+    for i := 0; i < readers; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            _, errs[i] = cache.GetCtx(context.Background(), fmt.Sprint(i))
+        }(i)
+    }
+    wg.Wait()
+
+    for i, err := range errs {
+        if err != nil {
+            t.Fatalf("reader %d: %v", i, err)
+        }
+    }
+    if n := peak.Load(); n > limit || n < 2 {
+        t.Fatalf("at most %d loads ran at once, want between 2 and %d", n, limit)
+    }
+    if n := cache.LoadsInFlight(); n != 0 {
+        t.Fatalf("LoadsInFlight = %d after every load finished", n)
+    }
+    if n := cache.Stats().Size; n != readers {
+        t.Fatalf("%d values cached, want %d", n, readers)
+    }
+}
+
+func TestLoaderConcurrencyFailFastAndContext(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    release := make(chan struct{})
+    loader := LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        <-release
+        return "value", 0, nil
+    })
+    failFast := NewLRUCache(10, WithLoaderConcurrency(1, true), WithLoader(loader))
+    waiting := NewLRUCache(10, WithLoaderConcurrency(1, false), WithLoader(loader))
+
+    var wg sync.WaitGroup
+    for _, cache := range []*LRUCache{failFast, waiting} {
+        wg.Add(1)
+        go func(cache *LRUCache) {
+            defer wg.Done()
+            cache.GetCtx(context.Background(), "held")
+        }(cache)
+        waitUntil(t, "the first load", func() bool { return cache.LoadsInFlight() == 1 })
+    }
+
+    // With fail-fast a load beyond the limit is refused at once.
+    if _, err := failFast.GetCtx(context.Background(), "other"); !errors.Is(err, ErrLoaderBusy) {
+        t.Fatalf("fail-fast GetCtx = %v, want ErrLoaderBusy", err)
+    }
+    // Otherwise it waits for a slot until its context is done.
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    if _, err := waiting.GetCtx(ctx, "other"); !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("waiting GetCtx = %v, want a deadline error", err)
+    }
+
+    // /stats reports the load holding the slot.
+    router := gin.New()
+    router.GET("/stats", statsHandler(waiting))
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+    var body struct {
+        Loader struct {
+            InFlight         int64 `json:"in_flight"`
+            ConcurrencyLimit int   `json:"concurrency_limit"`
+        } `json:"loader"`
+    }
+    if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    if body.Loader.InFlight != 1 || body.Loader.ConcurrencyLimit != 1 {
+        t.Fatalf("/stats loader = %+v, want 1 in flight with a limit of 1", body.Loader)
+    }
+
+    close(release)
+    wg.Wait()
+    if value, err := waiting.GetCtx(context.Background(), "other"); value != "value" || err != nil {
+        t.Fatalf("GetCtx once the slot is free = %v, %v", value, err)
+    }
+}
@@ -2,86 +2,900 @@ package main
 
 import (
     "container/list"
+    "context"
+    "encoding/json"
+    "errors"
+    "expvar"
+    "flag"
+    "log/slog"
     "net/http"
+    "os"
+    "os/signal"
+    "sort"
+    "strconv"
+    "strings"
     "sync"
+    "sync/atomic"
+    "syscall"
     "time"
 	"fmt"
 
     "github.com/gin-gonic/gin"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+    "golang.org/x/sync/singleflight"
 )
 
 // cacheEntry represents an entry in the LRU cache.
 type cacheEntry struct {
     key        string
     value      interface{}
+    sizeBytes  int64
     expiration time.Time
+    createdAt  time.Time
+    modifiedAt time.Time
+    lastAccess time.Time
+    hits       uint64
+    onExpire   func(key string, value interface{})
+
+    // seq is the insertion sequence number of the entry. It breaks ties
+    // between entries with equal timestamps, which are common with coarse
+    // clocks, so orderings by time are deterministic. version is taken
+    // from the same counter on every write of the value.
+    seq     uint64
+    version uint64
+
+    // deps are the keys the entry was declared to depend on by
+    // SetWithDeps.
+    deps []string
+
+    // priority is the entry's eviction priority and priorityElement its
+    // element in the eviction queue for that priority. Under LFU,
+    // lfuBucket is the queue's bucket holding priorityElement. uses counts
+    // the reads and overwrites of the entry, whatever the policy, and is
+    // the frequency LFU orders by. Unlike hits, it is never reset.
+    priority        int
+    priorityElement *list.Element
+    lfuBucket       *list.Element
+    uses            uint64
+
+    // isRefreshing is set while a background reload of an entry is in
+    // progress. Expired entries being refreshed are kept so
+    // StaleWhileRevalidate can serve them.
+    isRefreshing bool
+}
+
+// expired reports whether the entry has expired at now. A zero expiration
+// means the entry never expires.
+func (e *cacheEntry) expired(now time.Time) bool {
+    return !e.expiration.IsZero() && !e.expiration.After(now)
+}
+
+// view returns an exported copy of the entry.
+func (e *cacheEntry) view() CacheEntryView {
+    return CacheEntryView{Key: e.key, Value: e.value, Expiration: e.expiration, seq: e.seq}
+}
+
+// CacheEntryView is a read-only copy of a cache entry. A zero Expiration
+// means the entry never expires.
+type CacheEntryView struct {
+    Key        string      `json:"key"`
+    Value      interface{} `json:"value"`
+    Expiration time.Time   `json:"expiration"`
+
+    seq uint64
+}
+
+// expiredTTL is a TTL storing an entry already expired, so it is never
+// returned. The HTTP API uses it for a zero expiration without persist.
+const expiredTTL time.Duration = -1
+
+// expirationTime converts a TTL into an absolute expiration time on the
+// cache's clock. A zero TTL yields the zero time, meaning the entry never
+// expires, and a negative one a time already past.
+func (c *LRUCache) expirationTime(ttl time.Duration) time.Time {
+    if ttl == 0 {
+        return time.Time{}
+    }
+    return c.now().Add(ttl)
 }
 
 // LRUCache represents the LRU cache.
+//
+// capacity, cache and list are guarded by mutex and must only be read or
+// written while it is held; methods must not keep references to them past
+// unlocking. The stats counters are atomic and may be read without the lock.
 type LRUCache struct {
     capacity int
     cache    map[string]*list.Element
     list     *list.List
-    mutex    sync.Mutex
+    mutex    sync.RWMutex
+
+    // clock returns the current time against which entries expire; see
+    // WithClock.
+    clock func() time.Time
+
+    // nextSeq is the sequence number given to the next inserted or
+    // written entry.
+    nextSeq uint64
+
+    // dependants maps each key named in a SetWithDeps call to the keys
+    // depending on it.
+    dependants map[string][]string
+
+    // priorities holds an eviction queue per priority level, ordered by
+    // policy, used to choose eviction victims.
+    priorities [numPriorities]evictionQueue
+    policy     EvictionPolicy
+
+    // totalBytes is the sum of the estimated sizes of all entries. When
+    // maxBytes is positive it is bounded by it, in addition to the entry
+    // count.
+    maxBytes      int64
+    totalBytes    int64
+    sizeEstimator SizeEstimator
+
+    // evictionBatchSize limits how many entries Resize evicts per lock
+    // acquisition. Zero evicts everything at once.
+    evictionBatchSize int
+
+    stats     cacheCounters
+    // totalSets and totalGets count the calls to SetCtx and GetWithModTime,
+    // and through them Set, Get and GetCtx, over the cache's lifetime.
+    totalSets atomic.Uint64
+    totalGets atomic.Uint64
+    recent    rollingWindow
+    resetAt   atomic.Int64
+    latency   opLatencies
+    // valueSizes records the size of each value written, only when
+    // maxBytes is positive.
+    valueSizes valueSizeHistogram
+
+    // slowThreshold is the duration in nanoseconds above which operations
+    // are logged, zero when disabled. hashSlowKeys logs key hashes instead
+    // of keys.
+    slowThreshold atomic.Int64
+    hashSlowKeys  bool
+
+    // misses counts recent misses per key for StatsFor.
+    misses *missTracker
+
+    // pending holds callbacks queued while the write lock was held. They
+    // are run by unlock once the lock has been released.
+    pending []func()
+
+    // events is the removal event log, nil when disabled. pendingEvents
+    // holds events queued under the write lock until unlock records them.
+    events        *ringBuffer[RemovalEvent]
+    pendingEvents []RemovalEvent
+
+    // accessLog holds the most recent operations, nil when disabled. It is
+    // written without a lock so recording adds little to every operation.
+    accessLog *atomicRing[AccessRecord]
+
+    // loader populates missing keys, with loads collapses concurrent loads
+    // of the same key. loader is nil when not configured. retry configures
+    // retries of failed loads and failedLoads remembers keys that could not
+    // be loaded. breaker, nil when disabled, stops calling a failing
+    // loader. loadSlots, nil when unlimited, holds a token for every
+    // loader call running, with loadFailFast refusing calls once it is
+    // full instead of waiting; loadsInFlight counts the calls running.
+    loader        Loader
+    loads         singleflight.Group
+    retry         LoaderRetry
+    failedLoads   negativeCache
+    breaker       *circuitBreaker
+    loadSlots     chan struct{}
+    loadFailFast  bool
+    loadsInFlight atomic.Int64
+
+    // refreshAhead maps keys registered with RefreshAhead to their
+    // threshold, and refreshWatchlist holds the keys registered with
+    // WatchForRefresh. refreshing holds the keys being refreshed.
+    refreshAhead     map[string]time.Duration
+    refreshWatchlist map[string]struct{}
+    refreshing       sync.Map
+
+    // autoSnapshotStore, autoSnapshotName and autoSnapshotInterval
+    // configure StartAutoSnapshot. snapshotMutex is held while it writes a
+    // snapshot, and lastSnapshot describes the last snapshot written.
+    autoSnapshotStore    SnapshotStore
+    autoSnapshotName     string
+    autoSnapshotInterval time.Duration
+    snapshotMutex        sync.Mutex
+    lastSnapshot         atomic.Pointer[SnapshotStatus]
+
+    // codec encodes the values of binary snapshots that are not of the
+    // JSON types.
+    codec Codec
+
+    // aof is the append-only log write operations are recorded in, nil
+    // when disabled.
+    aof *appendLog
+
+    // onEvict, if set, is called outside the lock with every entry evicted
+    // for capacity. GroupCache uses it to move evicted entries to its
+    // overflow pool.
+    onEvict func(key string, value interface{}, expiration time.Time)
+
+    // evictCallback is the WithOnEvict callback. opMeta is the RequestMeta
+    // of the GetCtx or SetCtx holding the write lock, if any, and is passed
+    // to it for the entries that operation evicts.
+    evictCallback func(key string, value interface{}, meta *RequestMeta)
+    opMeta        *RequestMeta
+
+    // leases maps keys to the Lease held on them, and leaseTimeout is how
+    // long a lease lasts. leasesEnded counts the leases that have ended.
+    // leases and leasesEnded are guarded by leaseMutex, which is never
+    // held while the cache is read or written.
+    leases       map[string]*Lease
+    leasesEnded  uint64
+    leaseTimeout time.Duration
+    leaseMutex   sync.Mutex
+
+    // broker carries invalidations to and from other replicas once
+    // StartInvalidation has set invalidating. nodeID marks the messages
+    // this cache publishes.
+    broker       InvalidationBroker
+    invalidating bool
+    nodeID       string
+
+    // healthThreshold is the fill ratio above which the gRPC health
+    // service reports NOT_SERVING.
+    healthThreshold float64
+
+    // webhook is the publisher started by StartWebhook, if any.
+    webhook *webhookPublisher
+
+    // writeBehind queues writes for the backend of StartWriteBehind, nil
+    // when it is not running.
+    writeBehind atomic.Pointer[writeBehind]
+
+    // subscribers receive the events of Subscribe and Watch, and eventSeq
+    // is the Seq of the last event. Both are guarded by the write lock.
+    // droppedEvents counts the events subscribers missed.
+    subscribers   map[*subscriber]struct{}
+    eventSeq      uint64
+    droppedEvents atomic.Uint64
+
+    // readOnly is set while the cache rejects writes; see SetReadOnly.
+    readOnly atomic.Bool
+
+    // replica is set while the cache mirrors a primary; see StartReplica.
+    // replication is the log of writes served to replicas, nil when
+    // disabled.
+    replica     atomic.Pointer[replicaState]
+    replication *replicationLog
+
+    // janitorLastRun is the UnixNano time of the last janitor sweep.
+    janitorLastRun atomic.Int64
 }
 
-// Get retrieves the value associated with the given key from the cache.
+// NewLRUCache returns an empty cache holding at most capacity entries,
+// configured by opts.
+func NewLRUCache(capacity int, opts ...Option) *LRUCache {
+    c := &LRUCache{
+        capacity:        capacity,
+        cache:           make(map[string]*list.Element),
+        clock:           time.Now,
+        list:            list.New(),
+        misses:          newMissTracker(maxTrackedMisses),
+        events:          newRingBuffer[RemovalEvent](defaultEventLogSize),
+        accessLog:       newAtomicRing[AccessRecord](defaultAccessLogSize),
+        leases:          make(map[string]*Lease),
+        leaseTimeout:    defaultLeaseTimeout,
+        codec:           JSONCodec{},
+        healthThreshold: defaultHealthThreshold,
+    }
+    c.recent.now = c.now
+    for i := range c.priorities {
+        c.priorities[i] = newEvictionQueue(EvictLRU)
+    }
+    for _, opt := range opts {
+        opt(c)
+    }
+    return c
+}
+
+// now returns the current time on the cache's clock.
+func (c *LRUCache) now() time.Time {
+    return c.clock()
+}
+
+// unlock releases the write lock and then runs the callbacks queued while it
+// was held, so user code never runs under the lock. Write paths must use it
+// instead of c.mutex.Unlock.
+func (c *LRUCache) unlock() {
+    pending, events := c.pending, c.pendingEvents
+    c.pending, c.pendingEvents = nil, nil
+    aof := c.aof
+    c.mutex.Unlock()
+
+    if aof != nil {
+        aof.commit()
+    }
+    c.events.add(events...)
+    for _, fn := range pending {
+        fn()
+    }
+}
+
+// removalReason records why an entry left the cache.
+type removalReason int
+
+const (
+    removedCapacity removalReason = iota
+    removedExpired
+    removedDeleted
+    removedCleared
+    removedInvalidated
+)
+
+// removeElement unlinks element from the cache and counts the removal under
+// reason. displacedBy names the key whose insertion forced a capacity
+// eviction, if any. The caller must hold the lock.
+func (c *LRUCache) removeElement(element *list.Element, reason removalReason, displacedBy string) {
+    entry := element.Value.(*cacheEntry)
+    delete(c.cache, entry.key)
+    c.list.Remove(element)
+    c.priorities[entry.priority].remove(element)
+    c.totalBytes -= entry.sizeBytes
+    c.dropDeps(entry)
+    c.queueEvent(entry.key, reason, displacedBy)
+    c.notifyWatchers(entry.key, reason.String(), nil)
+    c.queueInvalidation(entry.key, reason)
+    if reason != removedExpired {
+        c.logOp(aofRecord{Op: "delete", Key: entry.key})
+    }
+    if reason == removedDeleted {
+        c.queueWrite(writeOp{key: entry.key, deleted: true})
+    }
+
+    switch reason {
+    case removedCapacity:
+        c.stats.evictions.Add(1)
+        c.recent.evict()
+        if onEvict := c.onEvict; onEvict != nil {
+            key, value, expiration := entry.key, entry.value, entry.expiration
+            c.pending = append(c.pending, func() { onEvict(key, value, expiration) })
+        }
+        if callback := c.evictCallback; callback != nil {
+            key, value, meta := entry.key, entry.value, c.opMeta
+            c.pending = append(c.pending, func() { callback(key, value, meta) })
+        }
+    case removedExpired:
+        c.stats.expirations.Add(1)
+        if onExpire := entry.onExpire; onExpire != nil {
+            entry.onExpire = nil
+            key, value := entry.key, entry.value
+            c.pending = append(c.pending, func() { onExpire(key, value) })
+        }
+    case removedDeleted:
+        c.stats.deletes.Add(1)
+    }
+    c.invalidateDependants(entry.key)
+}
+
+// Get retrieves the value associated with the given key from the cache,
+// calling the loader on a miss if one is configured.
 func (c *LRUCache) Get(key string) interface{} {
-    c.mutex.Lock()
-    defer c.mutex.Unlock()
+    value, _ := c.GetCtx(context.Background(), key)
+    return value
+}
+
+// GetOrDefault is like Get but returns defaultValue on a miss. A key
+// holding nil is a hit and returns nil.
+func (c *LRUCache) GetOrDefault(key string, defaultValue interface{}) interface{} {
+    value, err := c.GetCtx(context.Background(), key)
+    if err != nil {
+        return defaultValue
+    }
+    return value
+}
+
+// MustGet is like Get but panics if the key is missing, expired or holds
+// nil. It is meant for initialization code, where a missing key is a
+// programming error, and must not be used while handling requests.
+func (c *LRUCache) MustGet(key string) interface{} {
+    value := c.Get(key)
+    if value == nil {
+        panic(fmt.Sprintf("lru_cache: key %q not found", key))
+    }
+    return value
+}
+
+// GetCtx is like Get but reports a miss as a *CacheError wrapping
+// ErrNotFound or ErrExpired, and records a cache.get span under ctx when
+// tracing is enabled. With a loader configured, misses are loaded under ctx
+// instead and only loader failures are reported.
+func (c *LRUCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+    value, _, err := c.GetWithModTime(ctx, key)
+    return value, err
+}
+
+// GetWithModTime is like GetCtx but also returns when the value was last
+// written. A value just fetched by the loader reports the time it was
+// stored.
+func (c *LRUCache) GetWithModTime(ctx context.Context, key string) (interface{}, time.Time, error) {
+    var span trace.Span
+    if tracer != nil {
+        _, span = tracer.Start(ctx, "cache.get", trace.WithAttributes(attribute.String("cache.key_hash", keyHash(key))))
+        defer span.End()
+    }
+
+    c.totalGets.Add(1)
+    entry, refresh, err := c.get(ctx, key)
+    value, modifiedAt := entry.value, entry.modifiedAt
+    hit := err == nil
+    c.recordAccess("get", key, &hit)
+    if span != nil {
+        span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+    }
+    if refresh {
+        c.refresh(key)
+    }
+    if err != nil && c.loader != nil && !errors.Is(err, ErrBusy) {
+        modifiedAt = c.now()
+        value, err = c.load(ctx, key)
+    }
+    return value, modifiedAt, err
+}
+
+// get looks up key, promoting it on a hit and removing it if expired. On a
+// hit it returns a copy of the entry, and refresh reports whether the entry
+// is due for a refresh-ahead reload. The RequestMeta carried by ctx, if
+// any, is included in the slow-operation log.
+func (c *LRUCache) get(ctx context.Context, key string) (found cacheEntry, refresh bool, err error) {
+    defer c.finishOp(&c.latency.get, "get", key, time.Now(), 0, RequestMetaFrom(ctx))
+    if err := c.lockCtx(ctx); err != nil {
+        return cacheEntry{}, false, &CacheError{Op: "get", Key: key, Err: err}
+    }
+    defer c.unlock()
 
     if element, ok := c.cache[key]; ok {
         entry := element.Value.(*cacheEntry)
-        if entry.expiration.After(time.Now()) {
-            c.list.MoveToFront(element)
-            return entry.value
+        if now := c.now(); !entry.expired(now) {
+            c.promote(element)
+            entry.hits++
+            entry.lastAccess = now
+            c.stats.hits.Add(1)
+            c.recent.hit()
+            threshold, ok := c.refreshAhead[key]
+            refresh = ok && !entry.expiration.IsZero() && entry.expiration.Sub(now) < threshold
+            return *entry, refresh, nil
         }
         // If entry has expired, delete it from cache
-        delete(c.cache, key)
-        c.list.Remove(element)
+        if !entry.isRefreshing {
+            c.removeElement(element, removedExpired, "")
+        }
+        c.countMiss(key)
+        return cacheEntry{}, false, &CacheError{Op: "get", Key: key, Err: ErrExpired}
+    }
+    c.countMiss(key)
+    return cacheEntry{}, false, &CacheError{Op: "get", Key: key, Err: ErrNotFound}
+}
+
+// nextVersion returns the next value of the sequence counter, starting at
+// 1 so a zero version never names an entry. The caller must hold the lock.
+func (c *LRUCache) nextVersion() uint64 {
+    c.nextSeq++
+    return c.nextSeq
+}
+
+// countMiss records a miss for key. The caller must hold the lock.
+func (c *LRUCache) countMiss(key string) {
+    c.stats.misses.Add(1)
+    c.recent.miss()
+    c.misses.record(key)
+}
+
+// ContainsKey reports whether key is present and not expired. Unlike Get it
+// neither promotes the entry nor removes it when expired.
+func (c *LRUCache) ContainsKey(key string) bool {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    element, ok := c.cache[key]
+    return ok && !element.Value.(*cacheEntry).expired(c.now())
+}
+
+// Set inserts or updates a key-value pair in the cache. A zero expiration
+// stores the entry without a TTL, and a negative one stores it already
+// expired. It only fails in read-only
+// mode, on a replica, and with write-behind rejecting writes when its queue
+// is full.
+func (c *LRUCache) Set(key string, value interface{}, expiration time.Duration) error {
+    return c.SetCtx(context.Background(), key, value, expiration)
+}
+
+// SetCtx is like Set but records a cache.set span under ctx when tracing is
+// enabled, with a cache.evict child span if the write evicted entries. The
+// RequestMeta carried by ctx, if any, is passed to the WithOnEvict callback
+// for the entries evicted and included in the slow-operation log.
+func (c *LRUCache) SetCtx(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+    if err := c.checkWritable("set", key); err != nil {
+        return err
+    }
+
+    var span trace.Span
+    if tracer != nil {
+        ctx, span = tracer.Start(ctx, "cache.set", trace.WithAttributes(
+            attribute.String("cache.key_hash", keyHash(key)),
+            attribute.Int("cache.value_size", valueSize(value)),
+        ))
+        defer span.End()
+    }
+
+    c.totalSets.Add(1)
+    meta := RequestMetaFrom(ctx)
+    start := time.Now()
+    if err := c.lockCtx(ctx); err != nil {
+        return &CacheError{Op: "set", Key: key, Err: err}
+    }
+    c.opMeta = meta
+    evicted := c.set(key, value, c.expirationTime(expiration))
+    c.opMeta = nil
+    c.unlock()
+    c.finishOp(&c.latency.set, "set", key, start, evicted, meta)
+    c.recordAccess("set", key, nil)
+
+    if span != nil && evicted > 0 {
+        _, evictSpan := tracer.Start(ctx, "cache.evict", trace.WithAttributes(attribute.Int("cache.evicted", evicted)))
+        evictSpan.End()
     }
     return nil
 }
 
-// Set inserts or updates a key-value pair in the cache.
-func (c *LRUCache) Set(key string, value interface{}, expiration time.Duration) {
+// SetWithCallback is like Set but calls onExpire once if the entry expires,
+// whether it is noticed by a lookup or by the janitor. The callback runs
+// outside the cache lock. It is not called when the entry is overwritten,
+// deleted, evicted for capacity or cleared; overwriting the key with Set
+// drops the callback. It fails when Set would.
+func (c *LRUCache) SetWithCallback(key string, value interface{}, ttl time.Duration, onExpire func(key string, value interface{})) error {
+    if err := c.checkWritable("set", key); err != nil {
+        return err
+    }
+
     c.mutex.Lock()
-    defer c.mutex.Unlock()
+    defer c.unlock()
 
+    c.set(key, value, c.expirationTime(ttl))
+    if element, ok := c.cache[key]; ok {
+        element.Value.(*cacheEntry).onExpire = onExpire
+    }
+    return nil
+}
+
+// BatchEntry is a single key-value pair in a batch write.
+type BatchEntry struct {
+    Key   string
+    Value interface{}
+    TTL   time.Duration
+}
+
+// SetMany inserts or updates all entries under a single lock acquisition.
+// Entries are applied in order, so later duplicates win. It fails when Set
+// would, applying none of them.
+func (c *LRUCache) SetMany(entries []BatchEntry) error {
+    if err := c.checkWritable("set", ""); err != nil {
+        return err
+    }
+
+    c.mutex.Lock()
+    defer c.unlock()
+
+    for _, e := range entries {
+        c.set(e.Key, e.Value, c.expirationTime(e.TTL))
+    }
+    return nil
+}
+
+// set inserts or updates a key-value pair expiring at expiration, at
+// PriorityNormal, and returns the number of entries evicted to make room.
+// The caller must hold the lock.
+func (c *LRUCache) set(key string, value interface{}, expiration time.Time) (evicted int) {
+    return c.setPriority(key, value, expiration, PriorityNormal)
+}
+
+// setPriority is like set but stores the entry at priority.
+//
+// Overwriting a live entry is an update: the entry keeps its creation
+// time, hit count and insertion sequence. An entry that has expired but
+// not yet been removed is removed as expired first, running its expiry
+// callback, and the value is stored as a fresh insert with new metadata,
+// unless a background refresh is keeping it, in which case the refreshed
+// value updates it.
+func (c *LRUCache) setPriority(key string, value interface{}, expiration time.Time, priority int) (evicted int) {
+    size := c.entrySize(key, value)
+    if c.maxBytes > 0 {
+        // Reuse the entry size rather than estimating the value again.
+        c.valueSizes.observe(size - entryOverhead - int64(len(key)))
+    }
+    priority = clampPriority(priority)
+
+    if element, ok := c.cache[key]; ok && !element.Value.(*cacheEntry).isRefreshing && element.Value.(*cacheEntry).expired(c.now()) {
+        c.removeElement(element, removedExpired, "")
+    }
     if element, ok := c.cache[key]; ok {
         c.list.MoveToFront(element)
+        c.setEntryPriority(element, priority)
         entry := element.Value.(*cacheEntry)
+        c.dropDeps(entry)
+        c.invalidateDependants(key)
+        c.totalBytes += size - entry.sizeBytes
         entry.value = value
-        entry.expiration = time.Now().Add(expiration)
+        entry.sizeBytes = size
+        entry.expiration = expiration
+        entry.modifiedAt = c.now()
+        entry.version = c.nextVersion()
+        entry.onExpire = nil
+        entry.isRefreshing = false
+        c.stats.updates.Add(1)
     } else {
+        now := c.now()
         entry := &cacheEntry{
             key:        key,
             value:      value,
-            expiration: time.Now().Add(expiration),
+            sizeBytes:  size,
+            expiration: expiration,
+            createdAt:  now,
+            modifiedAt: now,
         }
+        entry.seq = c.nextVersion()
+        entry.version = entry.seq
         element := c.list.PushFront(entry)
+        c.setEntryPriority(element, priority)
         c.cache[key] = element
-        if len(c.cache) > c.capacity {
-            // Remove least recently used entry if capacity exceeded
-            delete(c.cache, c.list.Back().Value.(*cacheEntry).key)
-            c.list.Remove(c.list.Back())
+        c.totalBytes += size
+        c.stats.inserts.Add(1)
+    }
+    // Logged only now, so a removal of the expired entry comes first.
+    c.logSet(key, value, expiration)
+    c.notifyWatchers(key, "set", value)
+    return c.evictOverflow(0, key)
+}
+
+// overCapacity reports whether the cache exceeds its entry capacity or, if
+// set, its byte budget. The caller must hold the lock.
+func (c *LRUCache) overCapacity() bool {
+    return len(c.cache) > c.capacity || (c.maxBytes > 0 && c.totalBytes > c.maxBytes)
+}
+
+// evictOverflow removes entries chosen by the eviction policy, lowest
+// priority first, until the cache is no longer over capacity or limit
+// entries have been removed; a non-positive limit means no limit. The
+// entry for displacedBy is only evicted if no other entry of its priority
+// is left. A single entry larger than the byte budget is
+// evicted as well. displacedBy is recorded in the removal events. It returns
+// the number of entries evicted. The caller must hold the lock.
+func (c *LRUCache) evictOverflow(limit int, displacedBy string) (evicted int) {
+    if c.replica.Load() != nil {
+        // A replica removes entries when the primary's evictions arrive.
+        return 0
+    }
+    for c.list.Len() > 0 && c.overCapacity() && (limit <= 0 || evicted < limit) {
+        c.removeElement(c.evictionCandidate(c.cache[displacedBy]), removedCapacity, displacedBy)
+        evicted++
+    }
+    return evicted
+}
+
+// TouchMany resets the TTL of every live key in keys to ttl, read as by
+// Set, under a single lock acquisition and returns how many keys were
+// extended. Missing and
+// expired keys are skipped, and recency is not changed. It fails when Set
+// would, touching nothing.
+func (c *LRUCache) TouchMany(keys []string, ttl time.Duration) (int, error) {
+    if err := c.checkWritable("touch", ""); err != nil {
+        return 0, err
+    }
+
+    c.mutex.Lock()
+    defer c.unlock()
+
+    now := c.now()
+    touched := 0
+    for _, key := range keys {
+        element, ok := c.cache[key]
+        if !ok {
+            continue
         }
+        entry := element.Value.(*cacheEntry)
+        if entry.expired(now) {
+            continue
+        }
+        entry.expiration = c.expirationTime(ttl)
+        c.logOp(aofRecord{Op: "expire", Key: key, Expiration: expirationPtr(entry.expiration)})
+        c.queueWrite(writeOp{key: key, value: entry.value, expiration: entry.expiration})
+        touched++
+    }
+    return touched, nil
+}
+
+// Swap exchanges the values and expirations of keyA and keyB under a
+// single lock acquisition, so readers see either the old or the new
+// pairing. Recency is not changed. It returns false, changing nothing, if
+// either key is missing or expired, or if the cache is read-only or a
+// replica.
+func (c *LRUCache) Swap(keyA, keyB string) bool {
+    if c.checkWritable("swap", "") != nil {
+        return false
+    }
+
+    c.mutex.Lock()
+    defer c.unlock()
+
+    now := c.now()
+    elementA, okA := c.cache[keyA]
+    elementB, okB := c.cache[keyB]
+    if !okA || !okB {
+        return false
+    }
+    a, b := elementA.Value.(*cacheEntry), elementB.Value.(*cacheEntry)
+    if a.expired(now) || b.expired(now) {
+        return false
+    }
+    if a == b {
+        return true
+    }
+
+    a.value, b.value = b.value, a.value
+    a.expiration, b.expiration = b.expiration, a.expiration
+    a.onExpire, b.onExpire = b.onExpire, a.onExpire
+    sizeA, sizeB := c.entrySize(a.key, a.value), c.entrySize(b.key, b.value)
+    c.totalBytes += sizeA - a.sizeBytes + sizeB - b.sizeBytes
+    a.sizeBytes, b.sizeBytes = sizeA, sizeB
+    for _, entry := range []*cacheEntry{a, b} {
+        entry.modifiedAt = now
+        entry.version = c.nextVersion()
+        c.dropDeps(entry)
+        c.logSet(entry.key, entry.value, entry.expiration)
+        c.notifyWatchers(entry.key, "set", entry.value)
+    }
+    // With their own dependencies dropped, neither key can be invalidated
+    // through the other.
+    c.invalidateDependants(a.key)
+    c.invalidateDependants(b.key)
+    c.stats.updates.Add(2)
+    // Keys differ in length, so the byte budget may now be exceeded.
+    c.evictOverflow(0, "")
+    return true
+}
+
+// Delete removes key from the cache and reports whether a live entry was
+// removed. It only fails, with ErrReadOnly, in read-only mode.
+func (c *LRUCache) Delete(key string) (deleted bool, err error) {
+    if err := c.checkWritable("delete", key); err != nil {
+        return false, err
+    }
+
+    defer func() { c.recordAccess("delete", key, &deleted) }()
+    defer c.finishOp(&c.latency.delete, "delete", key, time.Now(), 0, nil)
+    c.mutex.Lock()
+    defer c.unlock()
+
+    delete(c.refreshWatchlist, key)
+    element, ok := c.cache[key]
+    if !ok {
+        // The backend may still hold a key the cache has evicted.
+        c.queueWrite(writeOp{key: key, deleted: true})
+        return false, nil
+    }
+    if element.Value.(*cacheEntry).expired(c.now()) {
+        c.removeElement(element, removedExpired, "")
+        c.queueWrite(writeOp{key: key, deleted: true})
+        return false, nil
+    }
+    c.removeElement(element, removedDeleted, "")
+    return true, nil
+}
+
+// Resize changes the capacity of the cache, evicting least recently used
+// entries if it now holds more than newCapacity. When an eviction batch
+// size is configured, a large shrink is carried out in batches, releasing
+// the lock in between so other operations are not stalled for the whole
+// shrink. A replica keeps its entries until its primary's evictions
+// arrive. Resize fails if newCapacity is negative.
+func (c *LRUCache) Resize(newCapacity int) error {
+    if newCapacity < 0 {
+        return fmt.Errorf("resize: negative capacity %d", newCapacity)
+    }
+
+    c.mutex.Lock()
+    c.capacity = newCapacity
+    evicted := c.evictOverflow(c.evictionBatchSize, "")
+    over := c.overCapacity()
+    c.unlock()
+
+    // A batch evicting nothing means nothing more can be evicted.
+    for over && evicted > 0 {
+        c.mutex.Lock()
+        evicted = c.evictOverflow(c.evictionBatchSize, "")
+        over = c.overCapacity()
+        c.unlock()
     }
+    return nil
 }
 
-// Function to clear the entire cache
-func (c *LRUCache) ClearCache() {
+// Function to clear the entire cache. It only fails, with ErrReadOnly, in
+// read-only mode.
+func (c *LRUCache) ClearCache() error {
+    if err := c.checkWritable("clear", ""); err != nil {
+        return err
+    }
+
     c.mutex.Lock()
-    defer c.mutex.Unlock()
+    defer c.unlock()
+
+    c.clear()
+    c.queueInvalidation("", removedCleared)
+    return nil
+}
+
+// Drain empties the cache and returns its live entries, most recently used
+// first, each with its remaining TTL. Entries that never expire get a zero
+// TTL. Drained entries are not reported as expired, so SetWithCallback
+// callbacks do not run for them. Like ClearCache, it fails, draining
+// nothing, in read-only mode and on a replica.
+func (c *LRUCache) Drain() ([]BatchEntry, error) {
+    if err := c.checkWritable("drain", ""); err != nil {
+        return nil, err
+    }
+
+    c.mutex.Lock()
+    defer c.unlock()
+
+    now := c.now()
+    drained := make([]BatchEntry, 0, len(c.cache))
+    for element := c.list.Front(); element != nil; element = element.Next() {
+        entry := element.Value.(*cacheEntry)
+        if entry.expired(now) {
+            continue
+        }
+        var ttl time.Duration
+        if !entry.expiration.IsZero() {
+            ttl = entry.expiration.Sub(now)
+        }
+        drained = append(drained, BatchEntry{Key: entry.key, Value: entry.value, TTL: ttl})
+    }
+    c.clear()
+    return drained, nil
+}
+
+// Len returns the number of entries in the cache, including expired
+// entries that have not been removed yet.
+func (c *LRUCache) Len() int {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    return len(c.cache)
+}
+
+// clear removes every entry. The caller must hold the lock.
+func (c *LRUCache) clear() {
+    for key := range c.cache {
+        c.queueEvent(key, removedCleared, "")
+        c.notifyWatchers(key, removedCleared.String(), nil)
+    }
 
-    c.cache = make(map[string]*list.Element)
+    // Clear in place rather than swapping in a new map, so the fields
+    // keep pointing at the same objects for the cache's whole lifetime.
+    clear(c.cache)
+    clear(c.dependants)
     c.list.Init()
+    for _, entries := range c.priorities {
+        entries.reset()
+    }
+    c.totalBytes = 0
+    c.stats.clears.Add(1)
+    c.logOp(aofRecord{Op: "clear"})
 }
 
 // Function to get cache state and remove expired entries
 func (c *LRUCache) GetCacheState() []cacheEntry {
+    defer c.finishOp(&c.latency.cacheState, "cache_state", "", time.Now(), 0, nil)
     c.mutex.Lock()
-    defer c.mutex.Unlock()
+    defer c.unlock()
 
     // Create a slice to store non-expired cache entries
     nonExpiredEntries := make([]cacheEntry, 0, len(c.cache))
@@ -91,86 +905,727 @@ func (c *LRUCache) GetCacheState() []cacheEntry {
         entry := element.Value.(*cacheEntry)
 
         // Check if entry has expired
-        if entry.expiration.After(time.Now()) {
+        if !entry.expired(c.now()) {
             // If not expired, include in cache state
             nonExpiredEntries = append(nonExpiredEntries, *entry)
-        } else {
-            delete(c.cache, entry.key)
-            c.list.Remove(element)
+        } else if !entry.isRefreshing {
+            c.removeElement(element, removedExpired, "")
         }
     }
 
-    fmt.Println("cacheState", nonExpiredEntries)
     return nonExpiredEntries
 }
 
+// DeleteExpired removes every expired entry and returns how many were
+// removed.
+func (c *LRUCache) DeleteExpired() int {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    now := c.now()
+    removed := 0
+    for element := c.list.Back(); element != nil; {
+        prev := element.Prev()
+        if entry := element.Value.(*cacheEntry); entry.expired(now) && !entry.isRefreshing {
+            c.removeElement(element, removedExpired, "")
+            removed++
+        }
+        element = prev
+    }
+    return removed
+}
+
+// StartJanitor runs DeleteExpired every interval in a background goroutine
+// until the returned stop function is called.
+func (c *LRUCache) StartJanitor(interval time.Duration) (stop func()) {
+    ticker := time.NewTicker(interval)
+    done := make(chan struct{})
+    go func() {
+        for {
+            select {
+            case <-ticker.C:
+                c.DeleteExpired()
+                c.janitorLastRun.Store(time.Now().UnixNano())
+            case <-done:
+                ticker.Stop()
+                return
+            }
+        }
+    }()
+    return func() { close(done) }
+}
+
+// JanitorLastRun returns when the janitor last swept the cache, or the zero
+// time if it has not run yet.
+func (c *LRUCache) JanitorLastRun() time.Time {
+    if last := c.janitorLastRun.Load(); last != 0 {
+        return time.Unix(0, last)
+    }
+    return time.Time{}
+}
+
+// Snapshot returns the live entries in LRU order, most recently used first.
+// Expired entries are skipped but not removed.
+func (c *LRUCache) Snapshot() []CacheEntryView {
+    entries := c.entries()
+    views := make([]CacheEntryView, len(entries))
+    for i := range entries {
+        views[i] = entries[i].view()
+    }
+    return views
+}
+
+// Range calls fn for each live entry, most recently used first, until fn
+// returns false. Expired entries are skipped and recency is not changed.
+//
+// Range holds the cache's read lock for the whole iteration, so fn must not
+// call back into the cache (writes would deadlock) and should return
+// quickly, as writers are blocked until Range returns.
+func (c *LRUCache) Range(fn func(key string, value interface{}, expiration time.Time) bool) {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    now := c.now()
+    for element := c.list.Front(); element != nil; element = element.Next() {
+        entry := element.Value.(*cacheEntry)
+        if entry.expired(now) {
+            continue
+        }
+        if !fn(entry.key, entry.value, entry.expiration) {
+            return
+        }
+    }
+}
+
+// entries returns copies of the live entries in LRU order, most recently
+// used first.
+func (c *LRUCache) entries() []cacheEntry {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    return c.liveEntries()
+}
+
+// liveEntries implements entries. The caller must hold the lock.
+func (c *LRUCache) liveEntries() []cacheEntry {
+    now := c.now()
+    entries := make([]cacheEntry, 0, c.list.Len())
+    for element := c.list.Front(); element != nil; element = element.Next() {
+        entry := element.Value.(*cacheEntry)
+        if !entry.expired(now) {
+            entries = append(entries, *entry)
+        }
+    }
+    return entries
+}
+
+// SnapshotPrefix is like Snapshot but only returns entries whose keys start
+// with prefix. An empty prefix returns every live entry.
+func (c *LRUCache) SnapshotPrefix(prefix string) []CacheEntryView {
+    views := []CacheEntryView{}
+    for _, entry := range c.entries() {
+        if strings.HasPrefix(entry.key, prefix) {
+            views = append(views, entry.view())
+        }
+    }
+    return views
+}
+
+// ExpiringWithin returns the live entries that expire within d of now,
+// including those expiring exactly at now+d, soonest first. Entries that
+// never expire are left out.
+func (c *LRUCache) ExpiringWithin(d time.Duration) []CacheEntryView {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    now := c.now()
+    deadline := now.Add(d)
+    views := []CacheEntryView{}
+    for element := c.list.Front(); element != nil; element = element.Next() {
+        entry := element.Value.(*cacheEntry)
+        if !entry.expiration.IsZero() && !entry.expired(now) && !entry.expiration.After(deadline) {
+            views = append(views, entry.view())
+        }
+    }
+    sortByExpiration(views)
+    return views
+}
+
+// SnapshotPage returns up to limit live entries whose keys start with
+// prefix and sort after after, in key order, for listing the cache a page
+// at a time: each page is requested with after set to the last key of the
+// previous one. A non-positive limit returns every remaining entry.
+func (c *LRUCache) SnapshotPage(prefix, after string, limit int) []CacheEntryView {
+    views := []CacheEntryView{}
+    for _, entry := range c.entries() {
+        if strings.HasPrefix(entry.key, prefix) && entry.key > after {
+            views = append(views, entry.view())
+        }
+    }
+    sort.Slice(views, func(i, j int) bool { return views[i].Key < views[j].Key })
+    if limit > 0 && len(views) > limit {
+        views = views[:limit]
+    }
+    return views
+}
+
+// GetPrefix returns the values of the live entries whose keys start with
+// prefix, in a single pass under one lock acquisition. With promote set,
+// each returned entry is marked as recently used, as Get would; otherwise
+// recency is left alone so that reads from dashboards and the like do not
+// keep entries alive. Expired entries are skipped but not removed, and
+// hits are not counted. It examines every entry, so it is O(n) in the size
+// of the cache and blocks writers meanwhile, regardless of how few keys
+// match.
+func (c *LRUCache) GetPrefix(prefix string, promote bool) map[string]interface{} {
+    if promote {
+        c.mutex.Lock()
+        defer c.unlock()
+    } else {
+        c.mutex.RLock()
+        defer c.mutex.RUnlock()
+    }
+
+    values := make(map[string]interface{})
+    var matched []*list.Element
+    now := c.now()
+    for element := c.list.Front(); element != nil; element = element.Next() {
+        entry := element.Value.(*cacheEntry)
+        if entry.expired(now) || !strings.HasPrefix(entry.key, prefix) {
+            continue
+        }
+        values[entry.key] = entry.value
+        matched = append(matched, element)
+    }
+    // Promote least recently used first, so the matched entries keep their
+    // relative order at the front of the list.
+    if promote {
+        for i := len(matched) - 1; i >= 0; i-- {
+            c.promote(matched[i])
+            matched[i].Value.(*cacheEntry).lastAccess = now
+        }
+    }
+    return values
+}
+
+// SnapshotByExpiration returns the live entries sorted by expiration time,
+// soonest first. Entries that never expire are placed last, and ties are
+// broken by insertion order.
+func (c *LRUCache) SnapshotByExpiration() []CacheEntryView {
+    entries := c.Snapshot()
+    sortByExpiration(entries)
+    return entries
+}
+
+// sortByExpiration sorts entries by expiration time, soonest first, with
+// entries that never expire last. Entries with equal expirations are
+// ordered by insertion, oldest first.
+func sortByExpiration(entries []CacheEntryView) {
+    sort.Slice(entries, func(i, j int) bool {
+        a, b := entries[i].Expiration, entries[j].Expiration
+        if a.Equal(b) {
+            return entries[i].seq < entries[j].seq
+        }
+        if a.IsZero() || b.IsZero() {
+            return !a.IsZero() && b.IsZero()
+        }
+        return a.Before(b)
+    })
+}
+
+
+// getHandler serves GET /cache/:key, answering 304 Not Modified when the
+// request's If-Modified-Since is not older than the entry. A positive
+// lockTimeout bounds the wait for the cache lock, and softMissDefault is
+// the soft-miss mode for requests that do not choose one.
+func getHandler(cache *LRUCache, lockTimeout time.Duration, softMissDefault bool) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        key := c.Param("key")
+        ctx := c.Request.Context()
+        if lockTimeout > 0 {
+            ctx = withLockWait(ctx, lockTimeout)
+        }
+        value, modifiedAt, err := cache.GetWithModTime(ctx, key)
+        if err != nil {
+            status, message := errorStatus(err), err.Error()
+            if status == http.StatusNotFound {
+                if softMiss(c, softMissDefault) {
+                    respond(c, http.StatusOK, gin.H{"found": false})
+                    return
+                }
+                message = "key not found"
+            }
+            respond(c, status, gin.H{"error": message})
+            return
+        }
+        if notModified(c, modifiedAt) {
+            return
+        }
+        respond(c, http.StatusOK, gin.H{"value": value})
+    }
+}
+
+// existsHandler serves GET /cache/:key/exists, reporting whether the key
+// holds a live entry without promoting it or removing it if expired.
+func existsHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.JSON(http.StatusOK, gin.H{"exists": cache.ContainsKey(c.Param("key"))})
+    }
+}
+
+// batchHandler serves POST /cache-views/batch, writing a JSON array of
+// entries, each validated as a POST /cache/:key body with its key, all or
+// none.
+func batchHandler(cache *LRUCache, limits writeLimits) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var body []map[string]json.RawMessage
+        if err := c.ShouldBindJSON(&body); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "body", Reason: "must be a JSON array of objects"}}})
+            return
+        }
+        reqs, errs := limits.validateBatch(body)
+        if len(errs) > 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": errs})
+            return
+        }
+        entries := make([]BatchEntry, len(reqs))
+        for i, req := range reqs {
+            entries[i] = BatchEntry{Key: req.Key, Value: req.Value, TTL: req.Expiration}
+        }
+        if err := cache.SetMany(entries); err != nil {
+            c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"count": len(entries)})
+    }
+}
+
+// batchTouchHandler serves POST /cache-views/batch/touch, giving the
+// listed keys a new expiration, or none with persist.
+func batchTouchHandler(cache *LRUCache, limits writeLimits) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var data struct {
+            Keys       []string `json:"keys"`
+            Expiration int64    `json:"expiration"`
+            Persist    bool     `json:"persist"`
+        }
+        if err := c.ShouldBindJSON(&data); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": decodeErrors(err)})
+            return
+        }
+        if errs := limits.validateTouch(data.Keys, data.Expiration, data.Persist); len(errs) > 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": errs})
+            return
+        }
+        touched, err := cache.TouchMany(data.Keys, requestTTL(data.Expiration, data.Persist))
+        if err != nil {
+            c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"touched": touched})
+    }
+}
+
+// cacheStateHandler serves GET /cache-state, listing the live entries.
+// With limit or after it serves one page in key order; prefix selects the
+// keys, sort=expiration orders by expiration and sizes=true adds each
+// entry's size.
+func cacheStateHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        prefix := c.Query("prefix")
+        if raw, after := c.Query("limit"), c.Query("after"); raw != "" || after != "" {
+            limit := 0
+            if raw != "" {
+                n, err := strconv.Atoi(raw)
+                if err != nil || n < 1 {
+                    c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+                    return
+                }
+                limit = n
+            }
+            respond(c, http.StatusOK, cache.SnapshotPage(prefix, after, limit))
+            return
+        }
+        if c.Query("sort") == "expiration" {
+            entries := cache.SnapshotPrefix(prefix)
+            sortByExpiration(entries)
+            respond(c, http.StatusOK, entries)
+            return
+        }
+        if prefix != "" && c.Query("sizes") != "true" {
+            respond(c, http.StatusOK, cache.SnapshotPrefix(prefix))
+            return
+        }
+
+        cacheState := cache.GetCacheState()
+        // Convert cache state into cache entry responses
+        if c.Query("sizes") == "true" {
+            type sizedEntry struct {
+                CacheEntryView
+                SizeBytes int64 `json:"size_bytes"`
+            }
+            sized := make([]sizedEntry, 0, len(cacheState))
+            for _, entry := range cacheState {
+                if strings.HasPrefix(entry.key, prefix) {
+                    sized = append(sized, sizedEntry{CacheEntryView: entry.view(), SizeBytes: entry.sizeBytes})
+                }
+            }
+            respond(c, http.StatusOK, sized)
+            return
+        }
+
+        var cacheStateResponse []CacheEntryView
+        for _, entry := range cacheState {
+            cacheStateResponse = append(cacheStateResponse, entry.view())
+        }
+
+        respond(c, http.StatusOK, cacheStateResponse)
+    }
+}
+
+// serveUntilDone runs serve until ctx is done, then shuts server down,
+// letting in-flight requests finish within timeout, and calls cleanup with
+// the context of the shutdown. It returns early with the error of serve if
+// serving fails first.
+func serveUntilDone(ctx context.Context, server *http.Server, serve func() error, timeout time.Duration, cleanup func(ctx context.Context)) error {
+    errc := make(chan error, 1)
+    go func() { errc <- serve() }()
+    select {
+    case err := <-errc:
+        return err
+    case <-ctx.Done():
+    }
+
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    if err := server.Shutdown(shutdownCtx); err != nil {
+        slog.Error("shutdown failed", "error", err)
+    }
+    cleanup(shutdownCtx)
+    return nil
+}
 
 func main() {
+    maxKeyLength := flag.Int("max-key-length", 250, "maximum key length in bytes")
+    maxExpiration := flag.Duration("max-expiration", 0, "maximum entry expiration accepted by the write endpoints (0 for no limit)")
+    sweepInterval := flag.Duration("sweep-interval", time.Minute, "interval between expired entry sweeps (0 to disable)")
+    apiKey := flag.String("api-key", "", "API key required in the X-API-Key header (empty disables authentication)")
+    adminKey := flag.String("admin-key", "", "API key required for admin endpoints (empty disables the admin check)")
+    lockTimeout := flag.Duration("lock-timeout", 0, "longest GET and POST /cache/:key wait for the cache lock before answering 503 (0 waits as long as it takes)")
+    softMissDefault := flag.Bool("soft-miss", false, "answer GET /cache/:key for a missing key with 200 and {\"found\":false} instead of 404 (requests can override it with the X-Soft-Miss header)")
+    metricsNoAuth := flag.Bool("metrics-no-auth", false, "serve /metrics without requiring the API key")
+    gzipMinSize := flag.Int("gzip-min-size", 0, "gzip responses of at least this many bytes when the client accepts it (0 disables compression)")
+    maxBytes := flag.Int64("max-bytes", 0, "maximum total estimated size of the cache entries in bytes (0 for no limit)")
+    auditPath := flag.String("audit-log", "", "file receiving a JSON line per mutating request (empty disables auditing)")
+    auditMaxSize := flag.Int64("audit-log-max-size", 100<<20, "size in bytes at which the audit log is rotated (0 disables rotation)")
+    slowThreshold := flag.Duration("slow-threshold", 0, "log cache operations and requests slower than this (0 disables, can be changed through /admin/config)")
+    slowHashKeys := flag.Bool("slow-log-hash-keys", false, "log key hashes instead of keys in slow operation warnings")
+    snapshotPath := flag.String("snapshot-file", "", "snapshot loaded at startup if present and written by /admin/snapshot/save; a .bin extension selects the binary format")
+    snapshotStoreURL := flag.String("snapshot-store", "", "store holding -snapshot-file, as file:///dir or memory://, making -snapshot-file a name within it (empty uses -snapshot-file as a path)")
+    aofPath := flag.String("aof-file", "", "append-only log of write operations, replayed at startup after the snapshot (empty disables it)")
+    aofFsync := flag.String("aof-fsync", "everysec", "when the append-only log is synced to disk: always, everysec or never")
+    aofRewriteSize := flag.Int64("aof-rewrite-size", 64<<20, "size in bytes past which the append-only log is compacted (0 disables compaction)")
+    backupDir := flag.String("backup-dir", "", "directory, or store as file:///dir or memory://, /admin/backup writes verified backups to and /admin/restore reads them from (empty disables them)")
+    backupKeep := flag.Int("backup-keep", 0, "number of newest backups kept, older ones being deleted after each backup (0 keeps all)")
+    snapshotInterval := flag.Duration("snapshot-interval", 0, "interval between automatic snapshots to -snapshot-file, with a final one on shutdown (0 disables)")
+    snapshotOnShutdown := flag.Bool("snapshot-on-shutdown", true, "save -snapshot-file on shutdown once requests have drained, and move it aside to .restored after loading it at startup")
+    ringSize := flag.Int("ring-size", 1000, "number of values kept by /ringcache")
+    accessLogSize := flag.Int("access-log-size", defaultAccessLogSize, "number of recent operations kept for /debug/recent (0 disables the log)")
+    respAddr := flag.String("resp-addr", "", "address of a Redis protocol (RESP) listener sharing the cache, such as :6379 (empty disables it)")
+    natsURL := flag.String("nats-url", "", "NATS server, such as nats://localhost:4222, to share deletions, expirations and clears with other replicas through (empty disables it)")
+    natsSubject := flag.String("nats-subject", "lrucache.invalidate", "NATS subject invalidations are published and received on")
+    grpcAddr := flag.String("grpc-addr", "", "address of the gRPC CacheService listener, such as :50051 (empty disables it)")
+    healthThreshold := flag.Float64("grpc-health-threshold", defaultHealthThreshold, "fill ratio above which the gRPC health service reports NOT_SERVING")
+    memcacheAddr := flag.String("memcache-addr", "", "address of a memcached text protocol listener sharing the cache, such as :11211 (empty disables it)")
+    eventLogSize := flag.Int("event-log-size", defaultEventLogSize, "number of removal events kept for /admin/events (0 disables the log)")
+    webhookURL := flag.String("webhook-url", "", "URL evictions and expirations are POSTed to in JSON batches (empty disables it)")
+    webhookPrefix := flag.String("webhook-prefix", "", "only send webhook events for keys starting with this prefix")
+    webhookSecret := flag.String("webhook-secret", "", "secret signing webhook batches with HMAC-SHA256 in the X-Cache-Signature header")
+    replicationLogSize := flag.Int("replication-log-size", 0, "number of recent writes kept for replicas to tail through /replication/stream (0 disables serving replicas)")
+    replicateFrom := flag.String("replicate-from", "", "URL of a primary cache server, such as http://primary:3000, to mirror as a read-only replica (empty disables it)")
+    replicateKey := flag.String("replicate-key", "", "API key sent to the primary's replication endpoints, its admin key if it has one")
+    writeBehindURL := flag.String("write-behind-url", "", "base URL writes and deletes are persisted to asynchronously, as PUT and DELETE of URL/key (empty disables it)")
+    writeBehindQueue := flag.Int("write-behind-queue", defaultWriteBehindQueueSize, "number of keys waiting to be persisted past which -write-behind-overflow applies")
+    writeBehindOverflow := flag.String("write-behind-overflow", "block", "what writes do when the write-behind queue is full: block, or reject with 503")
+    evictionPolicy := flag.String("eviction-policy", "lru", "entry evicted when the cache is full: lru, lfu or fifo (can be changed through /admin/policy)")
+    flag.Parse()
+
+    limits := writeLimits{maxKeyLength: *maxKeyLength, maxExpiration: *maxExpiration}
+    auth := authConfig{apiKey: *apiKey, adminKey: *adminKey}
+    policy, err := ParseEvictionPolicy(*evictionPolicy)
+    if err != nil {
+        panic(err)
+    }
+    var snapshotStore SnapshotStore
+    snapshotName := *snapshotPath
+    switch {
+    case *snapshotPath == "":
+    case *snapshotStoreURL != "":
+        if snapshotStore, err = OpenSnapshotStore(*snapshotStoreURL); err != nil {
+            panic(err)
+        }
+    default:
+        snapshotStore, snapshotName = fileSnapshotStoreFor(*snapshotPath)
+    }
+    var backupStore SnapshotStore
+    if *backupDir != "" {
+        if backupStore, err = OpenSnapshotStore(*backupDir); err != nil {
+            panic(err)
+        }
+    }
+
     // Initialize the LRU cache
-    cache := &LRUCache{
-        capacity: 1000, // adjust capacity as needed
-        cache:    make(map[string]*list.Element),
-        list:     list.New(),
+    cache := NewLRUCache(1000, // adjust capacity as needed
+        WithMaxBytes(*maxBytes),
+        WithEventLogSize(*eventLogSize),
+        WithAccessLogSize(*accessLogSize),
+        WithSlowThreshold(*slowThreshold, *slowHashKeys),
+        WithAutoSnapshotStore(snapshotStore, snapshotName, *snapshotInterval),
+        WithNATSInvalidation(*natsURL, *natsSubject),
+        WithEvictionPolicy(policy),
+        WithHealthThreshold(*healthThreshold),
+        WithReplicationLog(*replicationLogSize),
+    )
+    if snapshotStore != nil {
+        loadSnapshotAtStartup(cache, snapshotStore, snapshotName, *snapshotOnShutdown)
+    }
+    if *aofPath != "" {
+        policy, err := ParseFsyncPolicy(*aofFsync)
+        if err != nil {
+            panic(err)
+        }
+        stopAOF, err := cache.StartAOF(*aofPath, policy, *aofRewriteSize)
+        if err != nil {
+            panic(err)
+        }
+        defer stopAOF()
+    }
+    defer cache.StartAutoSnapshot()()
+    stopInvalidation, err := cache.StartInvalidation()
+    if err != nil {
+        panic(err)
+    }
+    defer stopInvalidation()
+    if *webhookURL != "" {
+        defer cache.StartWebhook(WebhookConfig{URL: *webhookURL, Prefix: *webhookPrefix, Secret: *webhookSecret})()
+    }
+    stopWriteBehind := func(context.Context) error { return nil }
+    if *writeBehindURL != "" {
+        overflow, err := ParseWriteBehindOverflow(*writeBehindOverflow)
+        if err != nil {
+            panic(err)
+        }
+        stopWriteBehind = cache.StartWriteBehind(NewHTTPBackend(*writeBehindURL), WriteBehindConfig{QueueSize: *writeBehindQueue, Overflow: overflow})
+    }
+    if *replicateFrom != "" {
+        defer cache.StartReplica(strings.TrimSuffix(*replicateFrom, "/"), *replicateKey)()
+    }
+    if *sweepInterval > 0 {
+        defer cache.StartJanitor(*sweepInterval)()
     }
 
     // Initialize Gin router
+    shutdownTracing, err := setupTracing(context.Background())
+    if err != nil {
+        panic(err)
+    }
+    defer shutdownTracing(context.Background())
+
     router := gin.Default()
+    router.Use(tracingMiddleware())
+    router.Use(requestMetaMiddleware(auth))
+    httpStats := newHTTPMetrics()
+    router.Use(httpStats.middleware())
+    router.Use(slowRequestMiddleware(cache))
+    if *gzipMinSize > 0 {
+        router.Use(gzipMiddleware(*gzipMinSize))
+    }
+
+    // /metrics is registered before the auth middleware so it can opt out
+    // of it; scrapers often cannot carry credentials.
+    if *metricsNoAuth {
+        router.GET("/metrics", metricsHandler(cache, httpStats))
+    } else {
+        router.GET("/metrics", auth.requireUser(), metricsHandler(cache, httpStats))
+    }
+    router.Use(auth.requireUser())
+    if *auditPath != "" {
+        file, err := openRotatingFile(*auditPath, *auditMaxSize)
+        if err != nil {
+            panic(err)
+        }
+        audit := newAuditLog(file, 1024)
+        defer audit.Close()
+        expvar.Publish("audit_dropped", expvar.Func(func() any { return audit.Dropped() }))
+        router.Use(audit.middleware(auth))
+    }
 
     // Define API endpoints
-    router.GET("/cache/:key", func(c *gin.Context) {
-        key := c.Param("key")
-        value := cache.Get(key)
-        if value != nil {
-            c.JSON(http.StatusOK, gin.H{"value": value})
-        } else {
-            c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+    router.GET("/cache/:key", getHandler(cache, *lockTimeout, *softMissDefault))
+
+    // Other views of the cache live outside /cache, where their paths
+    // would shadow keys.
+    blobs := NewContentAddressedCache(cache)
+    router.POST("/cache-views/content-addressed", contentAddressedSetHandler(blobs, limits))
+    router.GET("/cache-views/content-addressed/:hash", contentAddressedGetHandler(blobs))
+    router.GET("/cache-views/prefix/:prefix", func(c *gin.Context) {
+        respond(c, http.StatusOK, cache.GetPrefix(c.Param("prefix"), c.Query("promote") == "true"))
+    })
+    router.GET("/cache-views/expiring", func(c *gin.Context) {
+        within, err := time.ParseDuration(c.Query("within"))
+        if err != nil || within < 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "within", Reason: "must be a non-negative duration such as 30s"}}})
+            return
         }
+        respond(c, http.StatusOK, cache.ExpiringWithin(within))
+    })
+
+    router.POST("/cache-views/batch", batchHandler(cache, limits))
+    router.POST("/cache-views/batch/touch", rejectWhenReadOnly(cache), batchTouchHandler(cache, limits))
+    router.POST("/cache-views/warm", rejectWhenReadOnly(cache), warmHandler(cache))
+
+    router.GET("/cache/:key/exists", existsHandler(cache))
+
+    router.GET("/cache/:key/stats", func(c *gin.Context) {
+        respond(c, http.StatusOK, cache.StatsFor(c.Param("key")))
     })
 
     router.POST("/cache/:key", func(c *gin.Context) {
         key := c.Param("key")
-        var data struct {
-            Value      interface{} `json:"value"`
-            Expiration int         `json:"expiration"`
+        var body map[string]json.RawMessage
+        if err := c.ShouldBindJSON(&body); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "body", Reason: "must be a JSON object"}}})
+            return
+        }
+        data, errs := limits.validateSet(key, body)
+        if len(errs) > 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": errs})
+            return
+        }
+        ctx := c.Request.Context()
+        if *lockTimeout > 0 {
+            ctx = withLockWait(ctx, *lockTimeout)
         }
-        if err := c.BindJSON(&data); err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        if err := cache.SetCtx(ctx, key, data.Value, data.Expiration); err != nil {
+            c.JSON(errorStatus(err), gin.H{"error": err.Error()})
             return
         }
-        cache.Set(key, data.Value, time.Duration(data.Expiration)*time.Second)
         c.Status(http.StatusOK)
     })
 
+    ring := NewRingCache(*ringSize)
+    router.GET("/ringcache", ringHandler(ring))
+    router.POST("/ringcache", ringPushHandler(ring))
+
+    router.GET("/stats", statsHandler(cache))
+    router.POST("/stats/reset", auth.requireAdmin(), func(c *gin.Context) {
+        cache.ResetStats()
+        c.Status(http.StatusOK)
+    })
+    router.GET("/stats/hot-keys", hotKeysHandler(cache))
+    router.POST("/stats/hot-keys/reset", auth.requireAdmin(), func(c *gin.Context) {
+        cache.ResetHitCounts()
+        c.Status(http.StatusOK)
+    })
+
+    publishExpvar(cache)
+    router.GET("/debug/vars", auth.requireAdmin(), gin.WrapH(expvar.Handler()))
+    router.GET("/debug/recent", auth.requireAdmin(), recentHandler(cache))
+    router.GET("/admin/audit", auth.requireAdmin(), recentHandler(cache))
+    router.GET("/admin/events", auth.requireAdmin(), eventsHandler(cache))
+    router.GET("/admin/config", auth.requireAdmin(), configHandler(cache))
+    router.PUT("/admin/config", auth.requireAdmin(), updateConfigHandler(cache))
+    router.POST("/admin/snapshot/save", auth.requireAdmin(), snapshotHandler(snapshotStore, snapshotName, cache.SaveSnapshotTo))
+    router.POST("/admin/snapshot/load", auth.requireAdmin(), rejectWhenReadOnly(cache), snapshotHandler(snapshotStore, snapshotName, cache.LoadSnapshotFrom))
+    router.POST("/admin/backup", auth.requireAdmin(), backupHandler(cache, backupStore, *backupKeep))
+    router.GET("/admin/backups", auth.requireAdmin(), listBackupsHandler(backupStore))
+    router.POST("/admin/restore", auth.requireAdmin(), rejectWhenReadOnly(cache), restoreHandler(cache, backupStore))
+    router.GET("/admin/export", auth.requireAdmin(), exportHandler(cache))
+    router.POST("/admin/import", auth.requireAdmin(), rejectWhenReadOnly(cache), importHandler(cache))
+    router.GET("/admin/readonly", auth.requireAdmin(), readOnlyHandler(cache))
+    router.PUT("/admin/readonly", auth.requireAdmin(), updateReadOnlyHandler(cache))
+    router.GET("/admin/policy", auth.requireAdmin(), policyHandler(cache))
+    router.PUT("/admin/policy", auth.requireAdmin(), updatePolicyHandler(cache))
+
+    router.DELETE("/cache/:key", func(c *gin.Context) {
+        deleted, err := cache.Delete(c.Param("key"))
+        switch {
+        case err != nil:
+            c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+        case deleted:
+            c.Status(http.StatusOK)
+        default:
+            c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+        }
+    })
+
     // Define API endpoint for clearing the cache
     router.DELETE("/cache", func(c *gin.Context) {
-      	cache.ClearCache()
+      	if err := cache.ClearCache(); err != nil {
+      	    c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+      	    return
+      	}
       	c.Status(http.StatusOK)
     })
 
-	type CacheEntryResponse struct {
-		Key        string      `json:"key"`
-		Value      interface{} `json:"value"`
-		Expiration time.Time   `json:"expiration"`
-	}
+    router.GET("/cache-state", cacheStateHandler(cache))
+    stateStreams := newWSHub()
+    router.GET("/cache-state/ws", stateStreamHandler(cache, stateStreams))
+    // streamsDone ends the streaming responses, which never finish on
+    // their own, when the server shuts down.
+    streamsDone := make(chan struct{})
+    router.GET("/events", eventStreamHandler(cache, streamsDone))
+    router.GET("/replication/snapshot", auth.requireAdmin(), replicationSnapshotHandler(cache))
+    router.GET("/replication/stream", auth.requireAdmin(), replicationStreamHandler(cache, streamsDone))
 
-	router.GET("/cache-state", func(c *gin.Context) {
-        cacheState := cache.GetCacheState()
-		fmt.Println("cacheStateeee", cacheState)
-		// Convert cache state into cache entry responses
-		var cacheStateResponse []CacheEntryResponse
-		for _, entry := range cacheState {
-			cacheStateResponse = append(cacheStateResponse, CacheEntryResponse{
-				Key:        entry.key,
-				Value:      entry.value,
-				Expiration: entry.expiration,
-			})
-		}
-
-        c.JSON(http.StatusOK, cacheStateResponse)
-    })
+    // Run the server until interrupted, then let in-flight requests finish
+    // so the deferred cleanup, such as the final snapshot, runs on exit.
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
 
-    // Run the server
-    if err := router.Run(":3000"); err != nil {
+    stopRESP := func() {}
+    if *respAddr != "" {
+        var err error
+        if stopRESP, err = cache.StartRESP(*respAddr); err != nil {
+            panic(err)
+        }
+    }
+    stopGRPC := func() {}
+    if *grpcAddr != "" {
+        var err error
+        if stopGRPC, err = cache.StartGRPC(*grpcAddr, limits); err != nil {
+            panic(err)
+        }
+    }
+    stopMemcache := func() {}
+    if *memcacheAddr != "" {
+        var err error
+        if stopMemcache, err = cache.StartMemcache(*memcacheAddr); err != nil {
+            panic(err)
+        }
+    }
+
+    server := &http.Server{Addr: ":3000", Handler: router}
+    // Shutdown waits for the /events and /replication/stream streams. The
+    // server does not track upgraded connections, so they are closed
+    // separately.
+    server.RegisterOnShutdown(func() { close(streamsDone) })
+    server.RegisterOnShutdown(stateStreams.close)
+    err = serveUntilDone(ctx, server, server.ListenAndServe, 10*time.Second, func(shutdownCtx context.Context) {
+        stopRESP()
+        stopMemcache()
+        stopGRPC()
+        // Writes can no longer arrive, so drain the queue in what is left
+        // of the shutdown timeout.
+        if err := stopWriteBehind(shutdownCtx); err != nil {
+            slog.Error("write-behind drain failed", "error", err)
+        }
+        // With automatic snapshots on, stopping them writes the final one.
+        if snapshotStore != nil && *snapshotOnShutdown && *snapshotInterval <= 0 {
+            saveSnapshotAtShutdown(cache, snapshotStore, snapshotName)
+        }
+    })
+    if err != nil {
         panic(err)
     }
 }
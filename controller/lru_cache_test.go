@@ -0,0 +1,696 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/stretchr/testify/require"
+)
+
+// fakeClock is a clock for WithClock that only moves when advanced.
+type fakeClock struct {
+    mutex sync.Mutex
+    now   time.Time
+}
+
+func newFakeClock() *fakeClock {
+    return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// Now returns the clock's current time.
+func (f *fakeClock) Now() time.Time {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    return f.now
+}
+
+// Advance moves the clock forward by d.
+func (f *fakeClock) Advance(d time.Duration) {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    f.now = f.now.Add(d)
+}
+
+func TestMustGet(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("config", "loaded", 0)
+    cache.Set("stale", "old", time.Millisecond)
+    time.Sleep(5 * time.Millisecond)
+
+    require.Equal(t, "loaded", cache.MustGet("config"))
+    require.Panics(t, func() { cache.MustGet("stale") })
+    require.PanicsWithValue(t, `lru_cache: key "missing" not found`, func() { cache.MustGet("missing") })
+}
+
+func TestGetOrDefault(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    cache.Set("hit", "cached", 0)
+    cache.Set("nil", nil, 0)
+    cache.Set("stale", "old", time.Second)
+    clock.Advance(time.Second)
+
+    require.Equal(t, "cached", cache.GetOrDefault("hit", "default"))
+    require.Equal(t, "default", cache.GetOrDefault("missing", "default"))
+    require.Equal(t, "default", cache.GetOrDefault("stale", "default"))
+    // A stored nil is a hit.
+    require.Nil(t, cache.GetOrDefault("nil", "default"))
+    require.Equal(t, uint64(2), cache.Stats().Hits)
+    require.Equal(t, uint64(2), cache.Stats().Misses)
+}
+
+func TestResizeShrinksInBatches(t *testing.T) {
+    cache := NewLRUCache(10, WithEvictionBatchSize(3))
+    for i := 0; i < 10; i++ {
+        cache.Set(strconv.Itoa(i), i, 0)
+    }
+
+    if err := cache.Resize(2); err != nil {
+        t.Fatal(err)
+    }
+    if cache.Len() != 2 {
+        t.Fatalf("Len = %d after Resize(2)", cache.Len())
+    }
+    for _, key := range []string{"8", "9"} {
+        if !cache.ContainsKey(key) {
+            t.Fatalf("most recently used key %s was evicted", key)
+        }
+    }
+    if events := cache.RemovalEvents("", 100); len(events) != 8 {
+        t.Fatalf("%d removal events, want 8", len(events))
+    }
+}
+
+func TestResizeRejectsNegativeCapacity(t *testing.T) {
+    cache := NewLRUCache(2)
+    cache.Set("a", 1, 0)
+
+    if err := cache.Resize(-1); err == nil {
+        t.Fatal("Resize(-1) succeeded")
+    }
+    cache.Set("b", 2, 0)
+    if cache.Len() != 2 {
+        t.Fatalf("Len = %d, want the old capacity kept", cache.Len())
+    }
+}
+
+func TestResizeReturnsOnReplica(t *testing.T) {
+    cache := NewLRUCache(10, WithEvictionBatchSize(2))
+    for i := 0; i < 5; i++ {
+        cache.Set(strconv.Itoa(i), i, 0)
+    }
+    // A replica never evicts on its own, so the shrink cannot make progress.
+    cache.replica.Store(&replicaState{})
+
+    done := make(chan error)
+    go func() { done <- cache.Resize(1) }()
+    select {
+    case err := <-done:
+        if err != nil {
+            t.Fatal(err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("Resize did not return on a replica")
+    }
+    if cache.Len() != 5 {
+        t.Fatalf("Len = %d, want the replica's entries kept", cache.Len())
+    }
+}
+
+func TestSnapshotByExpiration(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("never-1", 1, 0)
+    cache.Set("hour", 2, time.Hour)
+    cache.Set("minute", 3, time.Minute)
+    cache.Set("never-2", 4, 0)
+    cache.Set("day", 5, 24*time.Hour)
+
+    var keys []string
+    for _, entry := range cache.SnapshotByExpiration() {
+        keys = append(keys, entry.Key)
+    }
+    want := []string{"minute", "hour", "day", "never-1", "never-2"}
+    if strings.Join(keys, " ") != strings.Join(want, " ") {
+        t.Fatalf("order = %v, want %v", keys, want)
+    }
+}
+
+func TestExpirationTiesBrokenByInsertion(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    for _, key := range []string{"c", "a", "d", "b"} {
+        cache.Set(key, key, time.Minute)
+    }
+    cache.Set("never", 0, 0)
+    cache.Set("sooner", 0, time.Second)
+    // Recency and overwrites do not change the order of ties.
+    cache.Get("b")
+    cache.Get("c")
+    cache.Set("a", "a2", time.Minute)
+
+    want := "sooner c a d b never"
+    for i := 0; i < 10; i++ {
+        if got := strings.Join(viewKeys(cache.SnapshotByExpiration()), " "); got != want {
+            t.Fatalf("SnapshotByExpiration = %s, want %s", got, want)
+        }
+    }
+    if got := strings.Join(viewKeys(cache.ExpiringWithin(time.Hour)), " "); got != "sooner c a d b" {
+        t.Fatalf("ExpiringWithin = %s, want sooner c a d b", got)
+    }
+}
+
+func TestExpiringWithinBoundaries(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    cache.Set("gone", 0, time.Second)
+    cache.Set("now", 0, 2*time.Second)
+    cache.Set("soon", 0, 12*time.Second)
+    cache.Set("edge", 0, 32*time.Second)
+    cache.Set("after", 0, 32*time.Second+time.Nanosecond)
+    cache.Set("never", 0, 0)
+    clock.Advance(2 * time.Second)
+
+    for _, tc := range []struct {
+        within time.Duration
+        want   string
+    }{
+        // An entry expiring exactly now has expired, so it is never
+        // listed, and entries expiring exactly at now+d are.
+        {0, ""},
+        {10*time.Second - time.Nanosecond, ""},
+        {10 * time.Second, "soon"},
+        {30 * time.Second, "soon edge"},
+        {30*time.Second + time.Nanosecond, "soon edge after"},
+        {time.Hour, "soon edge after"},
+    } {
+        if got := strings.Join(viewKeys(cache.ExpiringWithin(tc.within)), " "); got != tc.want {
+            t.Errorf("ExpiringWithin(%v) = %q, want %q", tc.within, got, tc.want)
+        }
+    }
+
+    // The window moves with the clock.
+    clock.Advance(20 * time.Second)
+    if got := strings.Join(viewKeys(cache.ExpiringWithin(10*time.Second)), " "); got != "edge" {
+        t.Fatalf("ExpiringWithin(10s) 20s later = %q, want edge", got)
+    }
+}
+
+func TestNegativeTTLStoresExpiredEntry(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("k", 1, expiredTTL)
+    if value := cache.Get("k"); value != nil {
+        t.Fatalf("Get = %v, want the entry already expired", value)
+    }
+}
+
+func TestExistsHandler(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(3)
+    cache.Set("present", 1, 0)
+    cache.Set("expired", 2, time.Millisecond)
+    cache.Set("other", 3, 0)
+    time.Sleep(5 * time.Millisecond)
+    router := gin.New()
+    router.GET("/cache/:key/exists", existsHandler(cache))
+
+    for key, want := range map[string]string{"present": "true", "absent": "false", "expired": "false"} {
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cache/"+key+"/exists", nil))
+        if rec.Code != http.StatusOK || rec.Body.String() != `{"exists":`+want+`}` {
+            t.Fatalf("GET %s/exists = %d %s, want exists %s", key, rec.Code, rec.Body, want)
+        }
+    }
+    if _, ok := cache.cache["expired"]; !ok {
+        t.Fatal("the expired entry was removed")
+    }
+    // Checking present did not promote it: it is still the least recently
+    // used live entry once the expired one is gone.
+    cache.Delete("expired")
+    cache.Set("new", 4, 0)
+    expectEvicted(t, cache, "newer", "present")
+}
+
+func TestTouchMany(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("live", 1, time.Minute)
+    cache.Set("forever", 2, 0)
+    cache.Set("expired", 3, time.Millisecond)
+    time.Sleep(5 * time.Millisecond)
+
+    touched, err := cache.TouchMany([]string{"live", "missing", "expired", "forever"}, time.Hour)
+    if err != nil || touched != 2 {
+        t.Fatalf("TouchMany = %d, %v; want 2 keys extended", touched, err)
+    }
+    for _, key := range []string{"live", "forever"} {
+        if ttl, ok := cache.TTL(key); !ok || ttl <= time.Minute || ttl > time.Hour {
+            t.Errorf("TTL(%s) = %v, %v; want close to an hour", key, ttl, ok)
+        }
+    }
+    if cache.ContainsKey("expired") || cache.ContainsKey("missing") {
+        t.Error("TouchMany revived a key")
+    }
+
+    if touched, _ := cache.TouchMany([]string{"live"}, 0); touched != 1 {
+        t.Fatalf("TouchMany with no TTL = %d", touched)
+    }
+    if ttl, ok := cache.TTL("live"); !ok || ttl != 0 {
+        t.Fatalf("TTL(live) = %v, %v; want no expiration", ttl, ok)
+    }
+}
+
+// postJSON sends a POST of body to path on router and returns the recorded
+// response.
+func postJSON(router *gin.Engine, path, body string) *httptest.ResponseRecorder {
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+    return rec
+}
+
+func TestBatchHandlers(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(10)
+    router := gin.New()
+    router.POST("/cache-views/batch", batchHandler(cache, noLimits))
+    router.POST("/cache-views/batch/touch", batchTouchHandler(cache, noLimits))
+
+    rec := postJSON(router, "/cache-views/batch", `[{"key":"c","value":1,"expiration":60},{"key":"d","value":2,"expiration":60}]`)
+    if rec.Code != http.StatusOK || rec.Body.String() != `{"count":2}` {
+        t.Fatalf("batch write = %d %s", rec.Code, rec.Body)
+    }
+    rec = postJSON(router, "/cache-views/batch/touch", `{"keys":["c","d"],"persist":true}`)
+    if rec.Code != http.StatusOK || rec.Body.String() != `{"touched":2}` {
+        t.Fatalf("touch with persist = %d %s", rec.Code, rec.Body)
+    }
+    if ttl, ok := cache.TTL("d"); !ok || ttl != 0 {
+        t.Fatalf("TTL(d) = %v, %v after persisting", ttl, ok)
+    }
+    postJSON(router, "/cache-views/batch/touch", `{"keys":["c"],"expiration":0}`)
+    if cache.ContainsKey("c") {
+        t.Fatal("touching with a zero expiration kept c")
+    }
+
+    for body, want := range map[string]string{
+        `{"keys":`:                        `{"field":"body","reason":"must be a JSON object"}`,
+        `{"keys":"a"}`:                    `{"field":"keys","reason":"must be of type []string"}`,
+        `{"expiration":5,"persist":true}`: `{"field":"keys","reason":"is required"},{"field":"persist","reason":"must not be combined with an expiration"}`,
+    } {
+        rec := postJSON(router, "/cache-views/batch/touch", body)
+        if rec.Code != http.StatusBadRequest || strings.TrimSpace(rec.Body.String()) != `{"error":"invalid request","fields":[`+want+`]}` {
+            t.Errorf("touch %s = %d %s", body, rec.Code, rec.Body)
+        }
+    }
+}
+
+func TestRange(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("a", 1, 0)
+    cache.Set("expired", 2, time.Millisecond)
+    cache.Set("b", 3, time.Hour)
+    cache.Set("c", 4, 0)
+    time.Sleep(5 * time.Millisecond)
+
+    var keys []string
+    cache.Range(func(key string, value interface{}, expiration time.Time) bool {
+        keys = append(keys, key)
+        if key == "b" && expiration.IsZero() {
+            t.Error("b was visited without its expiration")
+        }
+        return true
+    })
+    if strings.Join(keys, " ") != "c b a" {
+        t.Fatalf("visited %v, want the live keys most recently used first", keys)
+    }
+
+    keys = nil
+    cache.Range(func(key string, value interface{}, expiration time.Time) bool {
+        keys = append(keys, key)
+        return len(keys) < 2
+    })
+    if strings.Join(keys, " ") != "c b" {
+        t.Fatalf("visited %v, want Range to stop after b", keys)
+    }
+}
+
+func TestSetWithCallbackFiresOnceOnExpiry(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    fired := make(map[string]int)
+    onExpire := func(key string, value interface{}) {
+        if value != key+"-value" {
+            t.Errorf("callback for %s got %v", key, value)
+        }
+        fired[key]++
+    }
+    cache.SetWithCallback("lazy", "lazy-value", time.Minute, onExpire)
+    cache.SetWithCallback("swept", "swept-value", time.Minute, onExpire)
+
+    clock.Advance(59 * time.Second)
+    if cache.Get("lazy") == nil || cache.DeleteExpired() != 0 || len(fired) != 0 {
+        t.Fatalf("callbacks fired before expiry: %v", fired)
+    }
+
+    clock.Advance(time.Second)
+    if cache.Get("lazy") != nil {
+        t.Fatal("lazy was returned after expiring")
+    }
+    if fired["lazy"] != 1 || fired["swept"] != 0 {
+        t.Fatalf("fired = %v after a lazy expiry", fired)
+    }
+    if n := cache.DeleteExpired(); n != 1 {
+        t.Fatalf("DeleteExpired = %d, want 1", n)
+    }
+    cache.Get("lazy")
+    cache.DeleteExpired()
+    if fired["lazy"] != 1 || fired["swept"] != 1 {
+        t.Fatalf("fired = %v, want each callback once", fired)
+    }
+}
+
+func TestSetWithCallbackNotFiredOnOverwrite(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    fired := 0
+    onExpire := func(key string, value interface{}) { fired++ }
+    cache.SetWithCallback("set", 1, time.Minute, onExpire)
+    cache.SetWithCallback("deleted", 1, time.Minute, onExpire)
+
+    cache.Set("set", 2, time.Minute)
+    cache.Delete("deleted")
+    clock.Advance(time.Hour)
+    cache.Get("set")
+    cache.DeleteExpired()
+    if fired != 0 {
+        t.Fatalf("callback fired %d times after the entries were overwritten or deleted", fired)
+    }
+}
+
+func TestSetOverExpiredEntryIsFreshInsert(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    fired := 0
+    onExpire := func(key string, value interface{}) { fired++ }
+    cache.SetWithCallback("live", 1, time.Hour, onExpire)
+    cache.SetWithCallback("expired", 1, time.Second, onExpire)
+    created := clock.Now()
+    cache.Get("live")
+    live, expired := cache.cache["live"].Value.(*cacheEntry), cache.cache["expired"].Value.(*cacheEntry)
+    liveSeq, expiredSeq, expiredVersion := live.seq, expired.seq, expired.version
+
+    clock.Advance(2 * time.Second)
+    cache.Set("live", 2, time.Hour)
+    cache.Set("expired", 2, time.Hour)
+
+    // The live entry is updated in place.
+    live = cache.cache["live"].Value.(*cacheEntry)
+    if !live.createdAt.Equal(created) || live.hits != 1 || live.seq != liveSeq || !live.modifiedAt.Equal(clock.Now()) {
+        t.Fatalf("overwritten live entry: created %v, hits %d, seq %d, modified %v", live.createdAt, live.hits, live.seq, live.modifiedAt)
+    }
+
+    // The expired one is removed as expired and inserted afresh.
+    expired = cache.cache["expired"].Value.(*cacheEntry)
+    if !expired.createdAt.Equal(clock.Now()) || expired.hits != 0 || expired.seq <= expiredSeq || expired.version <= expiredVersion || expired.onExpire != nil {
+        t.Fatalf("overwritten expired entry: created %v, hits %d, seq %d, version %d", expired.createdAt, expired.hits, expired.seq, expired.version)
+    }
+    if fired != 1 || cache.Stats().Expirations != 1 {
+        t.Fatalf("callback fired %d times with %d expirations, want the expired entry's once", fired, cache.Stats().Expirations)
+    }
+    if cache.Get("expired") != 2 {
+        t.Fatalf("expired = %v after the overwrite, want 2", cache.Get("expired"))
+    }
+    checkConsistent(t, cache)
+}
+
+// checkConsistent fails the test unless the map and the list hold the same
+// entries.
+func checkConsistent(t *testing.T, cache *LRUCache) {
+    t.Helper()
+    if len(cache.cache) != cache.list.Len() {
+        t.Fatalf("map holds %d entries, list %d", len(cache.cache), cache.list.Len())
+    }
+    for element := cache.list.Front(); element != nil; element = element.Next() {
+        key := element.Value.(*cacheEntry).key
+        if cache.cache[key] != element {
+            t.Fatalf("list entry %s is not in the map", key)
+        }
+    }
+}
+
+func TestInsertWellPastCapacity(t *testing.T) {
+    cache := NewLRUCache(10, WithEvictionBatchSize(3))
+    entries := make([]BatchEntry, 50)
+    for i := range entries {
+        entries[i] = BatchEntry{Key: strconv.Itoa(i), Value: i}
+    }
+    if err := cache.SetMany(entries[:25]); err != nil {
+        t.Fatal(err)
+    }
+    for _, entry := range entries[25:] {
+        cache.Set(entry.Key, entry.Value, 0)
+    }
+
+    checkConsistent(t, cache)
+    if cache.Len() != 10 {
+        t.Fatalf("Len = %d, want the capacity", cache.Len())
+    }
+    for i := 40; i < 50; i++ {
+        if !cache.ContainsKey(strconv.Itoa(i)) {
+            t.Fatalf("%d, among the last inserted, was evicted", i)
+        }
+    }
+    events := cache.RemovalEvents("", 100)
+    if len(events) != 40 {
+        t.Fatalf("%d removal events, want 40", len(events))
+    }
+    for _, event := range events {
+        if i, _ := strconv.Atoi(event.Key); i >= 40 || event.Reason != removedCapacity.String() {
+            t.Fatalf("unexpected removal %+v", event)
+        }
+    }
+
+    if err := cache.Resize(4); err != nil {
+        t.Fatal(err)
+    }
+    checkConsistent(t, cache)
+    for i := 0; i < 20; i++ {
+        cache.Set("new-"+strconv.Itoa(i), i, 0)
+    }
+    checkConsistent(t, cache)
+    if cache.Len() != 4 || !cache.ContainsKey("new-19") || cache.ContainsKey("49") {
+        t.Fatalf("Len = %d after resizing and inserting", cache.Len())
+    }
+}
+
+// viewKeys returns the keys of views, in order.
+func viewKeys(views []CacheEntryView) []string {
+    keys := []string{}
+    for _, view := range views {
+        keys = append(keys, view.Key)
+    }
+    return keys
+}
+
+func TestSnapshotPrefix(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("user:1", 1, 0)
+    cache.Set("order:1", 2, 0)
+    cache.Set("user:expired", 3, time.Millisecond)
+    cache.Set("user:2", 4, 0)
+    time.Sleep(5 * time.Millisecond)
+
+    for prefix, want := range map[string]string{
+        "user:":  "user:2 user:1",
+        "order:": "order:1",
+        "none:":  "",
+        "":       "user:2 order:1 user:1",
+    } {
+        if got := strings.Join(viewKeys(cache.SnapshotPrefix(prefix)), " "); got != want {
+            t.Errorf("SnapshotPrefix(%q) = %q, want %q", prefix, got, want)
+        }
+    }
+}
+
+func TestGetPrefix(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    cache.Set("user:1", 1, 0)
+    cache.Set("order:1", 2, 0)
+    cache.Set("user:expired", 3, time.Second)
+    cache.Set("user:2", 4, 0)
+    clock.Advance(2 * time.Second)
+
+    for prefix, want := range map[string]string{
+        "user:":  "map[user:1:1 user:2:4]",
+        "order:": "map[order:1:2]",
+        "none:":  "map[]",
+        "":       "map[order:1:2 user:1:1 user:2:4]",
+    } {
+        if got := fmt.Sprint(cache.GetPrefix(prefix, false)); got != want {
+            t.Errorf("GetPrefix(%q) = %s, want %s", prefix, got, want)
+        }
+    }
+    if _, ok := cache.cache["user:expired"]; !ok {
+        t.Fatal("GetPrefix removed the expired entry")
+    }
+    if hits := cache.Stats().Hits; hits != 0 {
+        t.Fatalf("GetPrefix counted %d hits", hits)
+    }
+}
+
+func TestGetPrefixRecency(t *testing.T) {
+    for _, promote := range []bool{false, true} {
+        cache := NewLRUCache(3)
+        cache.Set("user:1", 1, 0)
+        cache.Set("user:2", 2, 0)
+        cache.Set("other", 3, 0)
+
+        cache.GetPrefix("user:", promote)
+        cache.Set("new", 4, 0)
+        want := "new other user:2"
+        if promote {
+            // The matches moved to the front in their existing order.
+            want = "new user:2 user:1"
+        }
+        if got := strings.Join(viewKeys(cache.Snapshot()), " "); got != want {
+            t.Errorf("promote %v: cache holds %s, want %s", promote, got, want)
+        }
+        checkConsistent(t, cache)
+    }
+}
+
+func TestCacheStatePrefixQuery(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(10)
+    cache.Set("user:1", 1, time.Hour)
+    cache.Set("order:1", 2, 0)
+    cache.Set("user:2", 3, time.Minute)
+    router := gin.New()
+    router.GET("/cache-state", cacheStateHandler(cache))
+
+    for query, want := range map[string]string{
+        "?prefix=user:":                 "user:2 user:1",
+        "?prefix=user:&sort=expiration": "user:2 user:1",
+        "?prefix=user:&limit=1":         "user:1",
+        "?prefix=none:":                 "",
+    } {
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cache-state"+query, nil))
+        var views []CacheEntryView
+        json.Unmarshal(rec.Body.Bytes(), &views)
+        if got := strings.Join(viewKeys(views), " "); rec.Code != http.StatusOK || got != want {
+            t.Errorf("GET /cache-state%s = %d %q, want %q", query, rec.Code, got, want)
+        }
+    }
+}
+
+func TestDrain(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    expired := 0
+    cache.SetWithCallback("a", 1, time.Minute, func(string, interface{}) { expired++ })
+    cache.Set("b", 2, 0)
+    cache.Set("gone", 3, time.Second)
+    clock.Advance(2 * time.Second)
+
+    drained, err := cache.Drain()
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []BatchEntry{{Key: "b", Value: 2}, {Key: "a", Value: 1, TTL: 58 * time.Second}}
+    if len(drained) != 2 || drained[0] != want[0] || drained[1] != want[1] {
+        t.Fatalf("Drain = %+v, want %+v", drained, want)
+    }
+    if cache.Len() != 0 {
+        t.Fatalf("Len = %d after Drain", cache.Len())
+    }
+    clock.Advance(time.Hour)
+    cache.DeleteExpired()
+    if expired != 0 {
+        t.Fatal("the expiry callback of a drained entry ran")
+    }
+}
+
+func TestDrainRespectsReadOnly(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("a", 1, 0)
+    cache.SetReadOnly(true)
+
+    if drained, err := cache.Drain(); !errors.Is(err, ErrReadOnly) || drained != nil {
+        t.Fatalf("Drain = %v, %v in read-only mode", drained, err)
+    }
+    if cache.Len() != 1 {
+        t.Fatal("Drain emptied a read-only cache")
+    }
+}
+
+func TestSwap(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    cache.Set("blue", "v1", time.Minute)
+    cache.Set("green", "v2", 0)
+
+    if !cache.Swap("blue", "green") {
+        t.Fatal("Swap of two present keys failed")
+    }
+    if cache.Get("blue") != "v2" || cache.Get("green") != "v1" {
+        t.Fatalf("after Swap blue = %v, green = %v", cache.Get("blue"), cache.Get("green"))
+    }
+    if ttl, ok := cache.TTL("green"); !ok || ttl != time.Minute {
+        t.Fatalf("TTL(green) = %v, %v; want the minute blue had", ttl, ok)
+    }
+    if ttl, ok := cache.TTL("blue"); !ok || ttl != 0 {
+        t.Fatalf("TTL(blue) = %v, %v; want no expiration", ttl, ok)
+    }
+    if cache.Swap("blue", "missing") || cache.Get("blue") != "v2" {
+        t.Fatal("Swap with a missing key changed the cache")
+    }
+    checkConsistent(t, cache)
+}
+
+func TestSwapConcurrentReaders(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("a", "A", 0)
+    cache.Set("b", "B", 0)
+
+    done := make(chan struct{})
+    var wg sync.WaitGroup
+    for r := 0; r < 4; r++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for {
+                select {
+                case <-done:
+                    return
+                default:
+                }
+                values := map[string]interface{}{}
+                for _, view := range cache.Snapshot() {
+                    values[view.Key] = view.Value
+                }
+                if a, b := values["a"], values["b"]; !(a == "A" && b == "B") && !(a == "B" && b == "A") {
+                    t.Errorf("reader saw a = %v, b = %v", values["a"], values["b"])
+                    return
+                }
+            }
+        }()
+    }
+    for i := 0; i < 1000; i++ {
+        if !cache.Swap("a", "b") {
+            t.Fatal("Swap failed")
+        }
+    }
+    close(done)
+    wg.Wait()
+    if cache.Get("a") != "A" || cache.Get("b") != "B" {
+        t.Fatalf("after an even number of swaps a = %v, b = %v", cache.Get("a"), cache.Get("b"))
+    }
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+    "fmt"
+    "time"
+)
+
+// Hasher turns keys of type K into the string keys used by the underlying
+// LRUCache. Implementations should be cheaper than fmt formatting and must
+// map equal keys to equal strings.
+type Hasher[K comparable] interface {
+    Hash(key K) string
+}
+
+// sprintHasher is the fallback Hasher, formatting keys with %v.
+type sprintHasher[K comparable] struct{}
+
+func (sprintHasher[K]) Hash(key K) string {
+    return fmt.Sprintf("%v", key)
+}
+
+// HasherFunc adapts an ordinary function to the Hasher interface.
+type HasherFunc[K comparable] func(key K) string
+
+func (f HasherFunc[K]) Hash(key K) string {
+    return f(key)
+}
+
+// mapCacheItem keeps the original key next to the value so that two keys
+// hashing to the same string are told apart.
+type mapCacheItem[K comparable, V any] struct {
+    key   K
+    value V
+}
+
+// MapCache is an LRU cache with keys of any comparable type. It uses the
+// same eviction logic as LRUCache, which it wraps:
+//
+//   sessions := NewMapCache[int64, UserSession](1000, HasherFunc[int64](func(id int64) string {
+//       return strconv.FormatInt(id, 10)
+//   }))
+//   sessions.Set(42, UserSession{UserID: 42}, 30*time.Minute)
+//
+//   tokens := NewMapCache[uuid.UUID, Token](1000, nil) // formats keys with %v
+//   tokens.Set(id, token, time.Hour)
+//
+// Keys that hash to the same string overwrite each other; a Get for a key
+// whose slot is held by a colliding key reports a miss.
+type MapCache[K comparable, V any] struct {
+    cache  *LRUCache
+    hasher Hasher[K]
+}
+
+// NewMapCache returns an empty MapCache holding at most capacity entries.
+// A nil hasher formats keys with fmt.Sprintf("%v", key).
+func NewMapCache[K comparable, V any](capacity int, hasher Hasher[K]) *MapCache[K, V] {
+    if hasher == nil {
+        hasher = sprintHasher[K]{}
+    }
+    return &MapCache[K, V]{cache: NewLRUCache(capacity), hasher: hasher}
+}
+
+// Get returns the value stored under key and whether it was found.
+func (m *MapCache[K, V]) Get(key K) (V, bool) {
+    item, ok := m.cache.Get(m.hasher.Hash(key)).(mapCacheItem[K, V])
+    if !ok || item.key != key {
+        var zero V
+        return zero, false
+    }
+    return item.value, true
+}
+
+// Set stores value under key for ttl.
+func (m *MapCache[K, V]) Set(key K, value V, ttl time.Duration) {
+    m.cache.Set(m.hasher.Hash(key), mapCacheItem[K, V]{key: key, value: value}, ttl)
+}
+
+// Delete removes key and reports whether it was present.
+func (m *MapCache[K, V]) Delete(key K) bool {
+    hashed := m.hasher.Hash(key)
+    if item, ok := m.cache.Get(hashed).(mapCacheItem[K, V]); !ok || item.key != key {
+        return false
+    }
+    // The underlying cache is private, so it is never read-only.
+    deleted, _ := m.cache.Delete(hashed)
+    return deleted
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    // memcacheMaxKeyLength is the longest key memcached accepts.
+    memcacheMaxKeyLength = 250
+    // memcacheMaxValueLength bounds the data block of a storage command.
+    memcacheMaxValueLength = 1 << 20
+    // memcacheRelativeLimit is the largest exptime memcached treats as a
+    // number of seconds; larger ones are Unix timestamps.
+    memcacheRelativeLimit = 30 * 24 * 60 * 60
+)
+
+// MemcacheValue is how a value written through the memcached listener with
+// nonzero flags is stored, so the flags can be returned to clients. Values
+// written with zero flags are stored as plain strings.
+type MemcacheValue struct {
+    Flags uint32 `json:"flags"`
+    Data  string `json:"data"`
+}
+
+// memcacheServer serves the memcached text protocol over the cache: get,
+// gets, set, add, replace, cas, delete, touch, flush_all, stats, version
+// and quit. Values not written through it are returned encoded as JSON
+// with zero flags.
+type memcacheServer struct {
+    cache *LRUCache
+}
+
+// memcacheClientError is a malformed request. It is reported to the client
+// as CLIENT_ERROR and the connection is kept open.
+type memcacheClientError string
+
+func (e memcacheClientError) Error() string { return string(e) }
+
+// StartMemcache listens for memcached text protocol clients on addr,
+// serving them from the cache. The returned stop function closes the
+// listener, lets every connection finish the command it is running and
+// waits for them to exit.
+func (c *LRUCache) StartMemcache(addr string) (stop func(), err error) {
+    s := &memcacheServer{cache: c}
+    return startTCPServer("memcached", addr, s.serve)
+}
+
+// serve serves one connection. Replies are buffered and flushed once no
+// more pipelined commands are waiting.
+func (s *memcacheServer) serve(r *bufio.Reader, w *bufio.Writer) {
+    for {
+        line, err := readRESPLine(r)
+        if err != nil {
+            return
+        }
+        args := strings.Fields(line)
+        if len(args) == 0 {
+            w.WriteString("ERROR\r\n")
+        } else if args[0] == "quit" {
+            w.Flush()
+            return
+        } else if err := s.execute(r, w, args); err != nil {
+            if isDisconnect(err) {
+                return
+            }
+            var clientErr memcacheClientError
+            if !errors.As(err, &clientErr) {
+                return
+            }
+            w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+        }
+        if r.Buffered() == 0 {
+            if err := w.Flush(); err != nil {
+                return
+            }
+        }
+    }
+}
+
+// execute runs one command and writes its reply. It returns a
+// memcacheClientError for a malformed request and any error reading a
+// data block.
+func (s *memcacheServer) execute(r *bufio.Reader, w *bufio.Writer, args []string) error {
+    c := s.cache
+    noreply := len(args) > 1 && args[len(args)-1] == "noreply"
+    if noreply {
+        args = args[:len(args)-1]
+    }
+    reply := func(msg string) {
+        if !noreply {
+            w.WriteString(msg + "\r\n")
+        }
+    }
+
+    switch args[0] {
+    case "get", "gets":
+        if len(args) < 2 {
+            return memcacheClientError("bad command line format")
+        }
+        for _, key := range args[1:] {
+            if err := checkMemcacheKey(key); err != nil {
+                return err
+            }
+        }
+        for _, key := range args[1:] {
+            found, _, err := c.get(context.Background(), key)
+            if err != nil {
+                continue
+            }
+            flags, data := memcacheEncode(found.value)
+            if args[0] == "gets" {
+                fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, flags, len(data), found.version)
+            } else {
+                fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, flags, len(data))
+            }
+            w.WriteString(data + "\r\n")
+        }
+        w.WriteString("END\r\n")
+
+    case "set", "add", "replace", "cas":
+        want := 5
+        if args[0] == "cas" {
+            want = 6
+        }
+        if len(args) != want {
+            return memcacheClientError("bad command line format")
+        }
+        key := args[1]
+        flags, err1 := strconv.ParseUint(args[2], 10, 32)
+        exptime, err2 := strconv.ParseInt(args[3], 10, 64)
+        size, err3 := strconv.Atoi(args[4])
+        if err1 != nil || err2 != nil || err3 != nil || size < 0 {
+            return memcacheClientError("bad command line format")
+        }
+        if size > memcacheMaxValueLength {
+            // Skip the data block so the next command is read correctly.
+            if _, err := r.Discard(size + 2); err != nil {
+                return err
+            }
+            reply("SERVER_ERROR object too large for cache")
+            return nil
+        }
+        data := make([]byte, size+2)
+        if _, err := io.ReadFull(r, data); err != nil {
+            return err
+        }
+        if string(data[size:]) != "\r\n" {
+            // Skip the rest of the overlong block, as memcached does.
+            if data[size+1] != '\n' {
+                if _, err := readRESPLine(r); err != nil {
+                    return err
+                }
+            }
+            return memcacheClientError("bad data chunk")
+        }
+        if err := checkMemcacheKey(key); err != nil {
+            return err
+        }
+        var value interface{} = string(data[:size])
+        if flags != 0 {
+            value = MemcacheValue{Flags: uint32(flags), Data: string(data[:size])}
+        }
+        ttl, expired := memcacheTTL(exptime)
+
+        if args[0] == "cas" {
+            version, err := strconv.ParseUint(args[5], 10, 64)
+            if err != nil {
+                return memcacheClientError("bad command line format")
+            }
+            err = c.compareAndSwap(key, value, ttl, expired, version)
+            switch {
+            case errors.Is(err, ErrNotFound):
+                reply("NOT_FOUND")
+            case errors.Is(err, ErrVersionMismatch):
+                reply("EXISTS")
+            case err != nil:
+                reply("SERVER_ERROR " + err.Error())
+            default:
+                reply("STORED")
+            }
+            return nil
+        }
+
+        condition := map[string]setCondition{"set": setAlways, "add": setIfMissing, "replace": setIfPresent}[args[0]]
+        stored, err := c.setIfExpired(key, value, ttl, expired, condition)
+        switch {
+        case err != nil:
+            reply("SERVER_ERROR " + err.Error())
+        case stored:
+            reply("STORED")
+        default:
+            reply("NOT_STORED")
+        }
+
+    case "delete":
+        // Older clients send a hold time of 0 after the key.
+        if len(args) < 2 || len(args) > 3 || (len(args) == 3 && args[2] != "0") {
+            return memcacheClientError("bad command line format.  Usage: delete <key> [noreply]")
+        }
+        if err := checkMemcacheKey(args[1]); err != nil {
+            return err
+        }
+        deleted, err := c.Delete(args[1])
+        switch {
+        case err != nil:
+            reply("SERVER_ERROR " + err.Error())
+        case deleted:
+            reply("DELETED")
+        default:
+            reply("NOT_FOUND")
+        }
+
+    case "touch":
+        if len(args) != 3 {
+            return memcacheClientError("bad command line format")
+        }
+        exptime, err := strconv.ParseInt(args[2], 10, 64)
+        if err != nil {
+            return memcacheClientError("invalid exptime argument")
+        }
+        if err := checkMemcacheKey(args[1]); err != nil {
+            return err
+        }
+        ttl, expired := memcacheTTL(exptime)
+        touched := false
+        if expired {
+            touched, err = c.Delete(args[1])
+        } else {
+            var n int
+            n, err = c.TouchMany(args[1:2], ttl)
+            touched = n == 1
+        }
+        if err != nil {
+            reply("SERVER_ERROR " + err.Error())
+            return nil
+        }
+        if touched {
+            reply("TOUCHED")
+        } else {
+            reply("NOT_FOUND")
+        }
+
+    case "flush_all":
+        // A delayed flush is not supported; only an immediate one is.
+        if len(args) > 2 || (len(args) == 2 && args[1] != "0") {
+            return memcacheClientError("delayed flush_all is not supported")
+        }
+        if err := c.ClearCache(); err != nil {
+            reply("SERVER_ERROR " + err.Error())
+            return nil
+        }
+        reply("OK")
+
+    case "stats":
+        if len(args) > 1 {
+            return memcacheClientError("stats groups are not supported")
+        }
+        stats := c.Stats()
+        for _, stat := range []struct {
+            name  string
+            value interface{}
+        }{
+            {"curr_items", stats.Size},
+            {"limit_items", stats.Capacity},
+            {"bytes", stats.BytesUsed},
+            {"limit_maxbytes", stats.MaxBytes},
+            {"get_hits", stats.Hits},
+            {"get_misses", stats.Misses},
+            {"cmd_set", stats.Inserts + stats.Updates},
+            {"total_items", stats.Inserts},
+            {"delete_hits", stats.Deletes},
+            {"evictions", stats.Evictions},
+            {"expired_unfetched", stats.Expirations},
+        } {
+            fmt.Fprintf(w, "STAT %s %v\r\n", stat.name, stat.value)
+        }
+        w.WriteString("END\r\n")
+
+    case "version":
+        w.WriteString("VERSION lrucache\r\n")
+
+    default:
+        w.WriteString("ERROR\r\n")
+    }
+    return nil
+}
+
+// checkMemcacheKey rejects keys memcached would: empty, longer than 250
+// bytes or containing control characters.
+func checkMemcacheKey(key string) error {
+    if key == "" || len(key) > memcacheMaxKeyLength {
+        return memcacheClientError("bad key length")
+    }
+    for i := 0; i < len(key); i++ {
+        if key[i] <= ' ' || key[i] == 0x7f {
+            return memcacheClientError("bad key")
+        }
+    }
+    return nil
+}
+
+// memcacheTTL converts a memcached exptime to a TTL. Zero never expires,
+// values up to 30 days are seconds from now and larger ones are Unix
+// timestamps. expired reports an exptime that is negative or already past,
+// which memcached treats as expiring the item immediately.
+func memcacheTTL(exptime int64) (ttl time.Duration, expired bool) {
+    switch {
+    case exptime == 0:
+        return 0, false
+    case exptime < 0:
+        return 0, true
+    case exptime <= memcacheRelativeLimit:
+        return time.Duration(exptime) * time.Second, false
+    }
+    ttl = time.Until(time.Unix(exptime, 0))
+    return ttl, ttl <= 0
+}
+
+// memcacheEncode returns the flags and data block for value.
+func memcacheEncode(value interface{}) (uint32, string) {
+    if v, ok := value.(MemcacheValue); ok {
+        return v.Flags, v.Data
+    }
+    return 0, respString(value)
+}
+
+// setIfExpired is setIf for a write whose exptime has already passed: the
+// condition is checked as usual but the key is removed instead of stored,
+// so the value is never visible.
+func (c *LRUCache) setIfExpired(key string, value interface{}, ttl time.Duration, expired bool, condition setCondition) (bool, error) {
+    if !expired {
+        return c.setIf(key, value, ttl, condition)
+    }
+    if err := c.checkWritable("set", key); err != nil {
+        return false, err
+    }
+
+    c.mutex.Lock()
+    defer c.unlock()
+
+    element, ok := c.cache[key]
+    present := ok && !element.Value.(*cacheEntry).expired(c.now())
+    if condition != setAlways && present != (condition == setIfPresent) {
+        return false, nil
+    }
+    if ok {
+        c.removeElement(element, removedDeleted, "")
+    } else {
+        c.queueWrite(writeOp{key: key, deleted: true})
+    }
+    return true, nil
+}
+
+// compareAndSwap stores value for key only if the live entry's version is
+// still version, as returned by gets. It fails with ErrNotFound if there is
+// no live entry and with ErrVersionMismatch if the entry has since changed.
+func (c *LRUCache) compareAndSwap(key string, value interface{}, ttl time.Duration, expired bool, version uint64) error {
+    if err := c.checkWritable("cas", key); err != nil {
+        return err
+    }
+
+    c.mutex.Lock()
+    defer c.unlock()
+
+    element, ok := c.cache[key]
+    if !ok || element.Value.(*cacheEntry).expired(c.now()) {
+        return &CacheError{Op: "cas", Key: key, Err: ErrNotFound}
+    }
+    if element.Value.(*cacheEntry).version != version {
+        return &CacheError{Op: "cas", Key: key, Err: ErrVersionMismatch}
+    }
+    if expired {
+        c.removeElement(element, removedDeleted, "")
+    } else {
+        c.set(key, value, c.expirationTime(ttl))
+    }
+    return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+    "io"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+// startMemcacheForTest starts a memcached listener for cache, stopped when
+// the test ends, and returns its address.
+func startMemcacheForTest(t *testing.T, cache *LRUCache) string {
+    t.Helper()
+    addr := freeAddr(t)
+    stop, err := cache.StartMemcache(addr)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(stop)
+    return addr
+}
+
+// expect sends raw and fails the test unless the reply is exactly want.
+func (c *rawConn) expect(raw, want string) {
+    c.t.Helper()
+    c.send(raw)
+    got := make([]byte, len(want))
+    if _, err := io.ReadFull(c.r, got); err != nil {
+        c.t.Fatalf("%q: %v after %q", raw, err, got)
+    }
+    if string(got) != want {
+        c.t.Fatalf("%q replied %q, want %q", raw, got, want)
+    }
+}
+
+// lines sends raw and returns the reply lines up to and including END.
+func (c *rawConn) lines(raw string) []string {
+    c.t.Helper()
+    c.send(raw)
+    var lines []string
+    for {
+        line, err := c.r.ReadString('\n')
+        if err != nil {
+            c.t.Fatal(err)
+        }
+        lines = append(lines, strings.TrimSuffix(line, "\r\n"))
+        if line == "END\r\n" {
+            return lines
+        }
+    }
+}
+
+// casVersion returns the cas value gets reports for key.
+func (c *rawConn) casVersion(key string) string {
+    c.t.Helper()
+    lines := c.lines("gets " + key + "\r\n")
+    fields := strings.Fields(lines[0])
+    if len(lines) != 3 || len(fields) != 5 || fields[0] != "VALUE" {
+        c.t.Fatalf("gets %s = %q", key, lines)
+    }
+    return fields[4]
+}
+
+func TestMemcacheStorageCommands(t *testing.T) {
+    cache := NewLRUCache(10, WithClock(newFakeClock().Now))
+    c := dialRaw(t, startMemcacheForTest(t, cache))
+
+    c.expect("set a 0 0 3\r\none\r\n", "STORED\r\n")
+    c.expect("get a\r\n", "VALUE a 0 3\r\none\r\nEND\r\n")
+    c.expect("add a 0 0 3\r\ntwo\r\n", "NOT_STORED\r\n")
+    c.expect("add b 0 0 3\r\ntwo\r\n", "STORED\r\n")
+    c.expect("replace c 0 0 5\r\nthree\r\n", "NOT_STORED\r\n")
+    c.expect("replace a 0 0 5\r\nthree\r\n", "STORED\r\n")
+    c.expect("get a missing b\r\n", "VALUE a 0 5\r\nthree\r\nVALUE b 0 3\r\ntwo\r\nEND\r\n")
+    c.expect("get missing\r\n", "END\r\n")
+
+    // Values set through the cache API are returned as text.
+    cache.Set("n", 42, 0)
+    c.expect("get n\r\n", "VALUE n 0 2\r\n42\r\nEND\r\n")
+
+    // Flags round trip with the data unchanged.
+    c.expect("set f 17 0 4\r\nf\x00\r\n\r\n", "STORED\r\n")
+    c.expect("get f\r\n", "VALUE f 17 4\r\nf\x00\r\n\r\nEND\r\n")
+    if value, ok := cache.Get("f").(MemcacheValue); !ok || value.Flags != 17 || value.Data != "f\x00\r\n" {
+        t.Fatalf("stored %#v", cache.Get("f"))
+    }
+
+    // cas succeeds only with the version from gets.
+    version := c.casVersion("a")
+    c.expect("cas a 0 0 4 "+version+"1\r\nfour\r\n", "EXISTS\r\n")
+    c.expect("cas a 0 0 4 "+version+"\r\nfour\r\n", "STORED\r\n")
+    c.expect("cas a 0 0 4 "+version+"\r\nfive\r\n", "EXISTS\r\n")
+    c.expect("cas missing 0 0 4 1\r\nfour\r\n", "NOT_FOUND\r\n")
+    if next := c.casVersion("a"); next == version {
+        t.Fatalf("cas left the version at %s", version)
+    }
+    c.expect("get a\r\n", "VALUE a 0 4\r\nfour\r\nEND\r\n")
+
+    c.expect("delete a\r\n", "DELETED\r\n")
+    c.expect("delete a\r\n", "NOT_FOUND\r\n")
+    c.expect("delete b 0\r\n", "DELETED\r\n")
+    c.expect("get a b\r\n", "END\r\n")
+}
+
+func TestMemcacheExpiration(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    c := dialRaw(t, startMemcacheForTest(t, cache))
+
+    c.expect("set a 0 10 1\r\na\r\n", "STORED\r\n")
+    if ttl, ok := cache.TTL("a"); !ok || ttl != 10*time.Second {
+        t.Fatalf("TTL after set = %v, %v; want 10s", ttl, ok)
+    }
+    c.expect("touch a 100\r\n", "TOUCHED\r\n")
+    if ttl, ok := cache.TTL("a"); !ok || ttl != 100*time.Second {
+        t.Fatalf("TTL after touch = %v, %v; want 100s", ttl, ok)
+    }
+    c.expect("touch missing 100\r\n", "NOT_FOUND\r\n")
+    clock.Advance(101 * time.Second)
+    c.expect("get a\r\n", "END\r\n")
+
+    // An exptime beyond 30 days is a Unix timestamp.
+    at := time.Now().Add(time.Hour).Unix()
+    c.expect("set b 0 "+strconv.FormatInt(at, 10)+" 1\r\nb\r\n", "STORED\r\n")
+    if ttl, ok := cache.TTL("b"); !ok || ttl <= 59*time.Minute || ttl > time.Hour {
+        t.Fatalf("TTL of an absolute exptime = %v, %v; want about an hour", ttl, ok)
+    }
+
+    // A negative exptime, or a touch with one, removes the key at once.
+    c.expect("set c 0 -1 1\r\nc\r\n", "STORED\r\n")
+    if cache.ContainsKey("c") {
+        t.Fatal("a negative exptime stored the key")
+    }
+    c.expect("touch b -1\r\n", "TOUCHED\r\n")
+    c.expect("get b\r\n", "END\r\n")
+}
+
+func TestMemcacheNoreply(t *testing.T) {
+    cache := NewLRUCache(10, WithClock(newFakeClock().Now))
+    c := dialRaw(t, startMemcacheForTest(t, cache))
+
+    // Nothing is sent back for a noreply command, so the reply to the
+    // following get is the first thing read.
+    c.expect("set a 0 0 1 noreply\r\na\r\nget a\r\n", "VALUE a 0 1\r\na\r\nEND\r\n")
+    c.expect("add a 0 0 1 noreply\r\nb\r\nget a\r\n", "VALUE a 0 1\r\na\r\nEND\r\n")
+    c.expect("replace a 0 0 1 noreply\r\nc\r\nget a\r\n", "VALUE a 0 1\r\nc\r\nEND\r\n")
+    version := c.casVersion("a")
+    c.expect("cas a 0 0 1 "+version+" noreply\r\nd\r\nget a\r\n", "VALUE a 0 1\r\nd\r\nEND\r\n")
+    c.expect("touch a 10 noreply\r\nget a\r\n", "VALUE a 0 1\r\nd\r\nEND\r\n")
+    if ttl, _ := cache.TTL("a"); ttl != 10*time.Second {
+        t.Fatalf("TTL after a noreply touch = %v, want 10s", ttl)
+    }
+    c.expect("delete a noreply\r\nget a\r\n", "END\r\n")
+    c.expect("delete a noreply\r\nversion\r\n", "VERSION lrucache\r\n")
+
+    cache.Set("b", "b", 0)
+    c.expect("flush_all noreply\r\nget b\r\n", "END\r\n")
+}
+
+func TestMemcacheAdminCommands(t *testing.T) {
+    cache := NewLRUCache(10, WithClock(newFakeClock().Now))
+    c := dialRaw(t, startMemcacheForTest(t, cache))
+
+    c.expect("version\r\n", "VERSION lrucache\r\n")
+    c.expect("set a 0 0 1\r\na\r\n", "STORED\r\n")
+    c.expect("get a missing\r\n", "VALUE a 0 1\r\na\r\nEND\r\n")
+
+    stats := map[string]string{}
+    for _, line := range c.lines("stats\r\n") {
+        if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "STAT" {
+            stats[fields[1]] = fields[2]
+        }
+    }
+    for name, want := range map[string]string{"curr_items": "1", "limit_items": "10", "get_hits": "1", "get_misses": "1", "cmd_set": "1"} {
+        if stats[name] != want {
+            t.Errorf("STAT %s = %q, want %s", name, stats[name], want)
+        }
+    }
+
+    c.expect("flush_all\r\n", "OK\r\n")
+    if cache.Len() != 0 {
+        t.Fatalf("flush_all left %d entries", cache.Len())
+    }
+    c.expect("flush_all 0\r\n", "OK\r\n")
+    c.expect("flush_all 10\r\n", "CLIENT_ERROR delayed flush_all is not supported\r\n")
+}
+
+func TestMemcacheErrorsKeepConnectionOpen(t *testing.T) {
+    cache := NewLRUCache(10, WithClock(newFakeClock().Now))
+    c := dialRaw(t, startMemcacheForTest(t, cache))
+
+    for _, tc := range []struct{ raw, want string }{
+        {"bogus\r\n", "ERROR\r\n"},
+        {"get\r\n", "CLIENT_ERROR bad command line format\r\n"},
+        {"set a 0 0\r\n", "CLIENT_ERROR bad command line format\r\n"},
+        {"set a x 0 1\r\n", "CLIENT_ERROR bad command line format\r\n"},
+        {"set a 0 0 1\r\ntoo long\r\n", "CLIENT_ERROR bad data chunk\r\n"},
+        {"get " + strings.Repeat("k", 251) + "\r\n", "CLIENT_ERROR bad key length\r\n"},
+        {"set a\x01b 0 0 1\r\na\r\n", "CLIENT_ERROR bad key\r\n"},
+        {"delete a 10\r\n", "CLIENT_ERROR bad command line format.  Usage: delete <key> [noreply]\r\n"},
+        {"touch a soon\r\n", "CLIENT_ERROR invalid exptime argument\r\n"},
+        {"stats items\r\n", "CLIENT_ERROR stats groups are not supported\r\n"},
+        {"set big 0 0 1048577\r\n" + strings.Repeat("x", 1048577) + "\r\n", "SERVER_ERROR object too large for cache\r\n"},
+    } {
+        c.expect(tc.raw, tc.want)
+        // The connection is still usable after each error.
+        c.expect("version\r\n", "VERSION lrucache\r\n")
+    }
+    if cache.Len() != 0 {
+        t.Fatalf("a rejected command stored %v", viewKeys(cache.Snapshot()))
+    }
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+    "reflect"
+    "sort"
+)
+
+// Diff compares the live entries of c and other. added holds keys present
+// only in other, removed holds keys missing from other, and changed holds
+// keys present in both whose values differ according to reflect.DeepEqual.
+// Each slice is sorted.
+func (c *LRUCache) Diff(other *LRUCache) (added, removed, changed []string) {
+    mine := make(map[string]interface{})
+    for _, entry := range c.Snapshot() {
+        mine[entry.Key] = entry.Value
+    }
+
+    for _, entry := range other.Snapshot() {
+        value, ok := mine[entry.Key]
+        if !ok {
+            added = append(added, entry.Key)
+            continue
+        }
+        if !reflect.DeepEqual(value, entry.Value) {
+            changed = append(changed, entry.Key)
+        }
+        delete(mine, entry.Key)
+    }
+    for key := range mine {
+        removed = append(removed, key)
+    }
+
+    sort.Strings(added)
+    sort.Strings(removed)
+    sort.Strings(changed)
+    return added, removed, changed
+}
+
+// ConflictPolicy decides which entry survives when Merge finds a key in
+// both caches. It receives the existing entry and the incoming one and
+// returns the entry to keep; returning nil keeps the existing entry.
+type ConflictPolicy func(existing, incoming *cacheEntry) *cacheEntry
+
+var (
+    // KeepExisting always keeps the entry already in the cache.
+    KeepExisting ConflictPolicy = func(existing, incoming *cacheEntry) *cacheEntry {
+        return existing
+    }
+
+    // KeepIncoming always replaces the existing entry.
+    KeepIncoming ConflictPolicy = func(existing, incoming *cacheEntry) *cacheEntry {
+        return incoming
+    }
+
+    // KeepOlder keeps whichever entry was written first.
+    KeepOlder ConflictPolicy = func(existing, incoming *cacheEntry) *cacheEntry {
+        if incoming.modifiedAt.Before(existing.modifiedAt) {
+            return incoming
+        }
+        return existing
+    }
+
+    // KeepNewer keeps whichever entry was written last.
+    KeepNewer ConflictPolicy = func(existing, incoming *cacheEntry) *cacheEntry {
+        if incoming.modifiedAt.After(existing.modifiedAt) {
+            return incoming
+        }
+        return existing
+    }
+
+    // KeepHigherValue keeps the entry with the greater value. Numbers and
+    // strings are compared by value. Values that are reflect.DeepEqual, or
+    // that cannot be ordered, keep the existing entry.
+    KeepHigherValue ConflictPolicy = func(existing, incoming *cacheEntry) *cacheEntry {
+        if greater(incoming.value, existing.value) {
+            return incoming
+        }
+        return existing
+    }
+)
+
+// Custom returns a ConflictPolicy backed by fn.
+func Custom(fn func(a, b *cacheEntry) *cacheEntry) ConflictPolicy {
+    return ConflictPolicy(fn)
+}
+
+// greater reports whether a is strictly greater than b when both are
+// numbers or both are strings.
+func greater(a, b interface{}) bool {
+    if reflect.DeepEqual(a, b) {
+        return false
+    }
+    if x, ok := a.(string); ok {
+        y, ok := b.(string)
+        return ok && x > y
+    }
+    x, ok := toFloat(a)
+    if !ok {
+        return false
+    }
+    y, ok := toFloat(b)
+    return ok && x > y
+}
+
+// toFloat converts any numeric value to float64.
+func toFloat(v interface{}) (float64, bool) {
+    rv := reflect.ValueOf(v)
+    switch rv.Kind() {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return float64(rv.Int()), true
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+        return float64(rv.Uint()), true
+    case reflect.Float32, reflect.Float64:
+        return rv.Float(), true
+    }
+    return 0, false
+}
+
+// Merge copies the live entries of other into c. Keys missing from c are
+// inserted as is; for keys present in both, conflictPolicy picks the
+// surviving entry. Expiration times are preserved, and capacity is enforced
+// as entries are inserted.
+func (c *LRUCache) Merge(other *LRUCache, conflictPolicy ConflictPolicy) {
+    c.mergeEntries(other.entries(), conflictPolicy)
+}
+
+// mergeEntries implements Merge for incoming, ordered most recently used
+// first. Incoming entries that have expired are skipped.
+func (c *LRUCache) mergeEntries(incoming []cacheEntry, conflictPolicy ConflictPolicy) {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    now := c.now()
+    // Insert in reverse so the most recently used entries of other end up
+    // most recently used in c.
+    for i := len(incoming) - 1; i >= 0; i-- {
+        theirs := &incoming[i]
+        if theirs.expired(now) {
+            continue
+        }
+        element, ok := c.cache[theirs.key]
+        if !ok || element.Value.(*cacheEntry).expired(now) {
+            c.set(theirs.key, theirs.value, theirs.expiration)
+            c.restoreModifiedAt(theirs.key, theirs.modifiedAt)
+            continue
+        }
+
+        mine := element.Value.(*cacheEntry)
+        winner := conflictPolicy(mine, theirs)
+        if winner == nil || winner == mine {
+            continue
+        }
+        c.dropDeps(mine)
+        c.invalidateDependants(mine.key)
+        size := c.entrySize(mine.key, winner.value)
+        c.totalBytes += size - mine.sizeBytes
+        mine.sizeBytes = size
+        mine.value = winner.value
+        mine.expiration = winner.expiration
+        mine.modifiedAt = winner.modifiedAt
+        mine.version = c.nextVersion()
+        c.logSet(mine.key, mine.value, mine.expiration)
+        c.notifyWatchers(mine.key, "set", mine.value)
+        c.stats.updates.Add(1)
+    }
+    c.evictOverflow(0, "")
+}
+
+// CopyTo copies the live entries of c into dst, preserving their
+// expiration times, and returns the number of entries copied. If dst cannot
+// hold them all, the least recently used entries of c are dropped. Values
+// are copied shallowly, so reference types such as maps and slices remain
+// shared between the two caches.
+func (c *LRUCache) CopyTo(dst *LRUCache) int {
+    entries := c.entries()
+
+    dst.mutex.Lock()
+    defer dst.unlock()
+
+    if len(entries) > dst.capacity {
+        entries = entries[:dst.capacity]
+    }
+
+    // Insert least recently used first so dst ends up in the same order.
+    for i := len(entries) - 1; i >= 0; i-- {
+        dst.set(entries[i].key, entries[i].value, entries[i].expiration)
+    }
+    return len(entries)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestDiff(t *testing.T) {
+    before := NewLRUCache(10)
+    before.Set("same", []int{1, 2}, 0)
+    before.Set("changed", map[string]int{"v": 1}, 0)
+    before.Set("removed", 1, 0)
+    before.Set("expired-here", 1, time.Millisecond)
+
+    after := NewLRUCache(10)
+    after.Set("same", []int{1, 2}, time.Hour)
+    after.Set("changed", map[string]int{"v": 2}, 0)
+    after.Set("added", 1, 0)
+    after.Set("expired-here", 1, 0)
+    after.Set("expired-there", 1, time.Millisecond)
+    time.Sleep(5 * time.Millisecond)
+
+    added, removed, changed := before.Diff(after)
+    if want := []string{"added", "expired-here"}; !reflect.DeepEqual(added, want) {
+        t.Errorf("added = %v, want %v", added, want)
+    }
+    if want := []string{"removed"}; !reflect.DeepEqual(removed, want) {
+        t.Errorf("removed = %v, want %v", removed, want)
+    }
+    if want := []string{"changed"}; !reflect.DeepEqual(changed, want) {
+        t.Errorf("changed = %v, want %v", changed, want)
+    }
+}
+
+func TestDiffIdentical(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("a", 1, 0)
+    added, removed, changed := cache.Diff(cache)
+    if added != nil || removed != nil || changed != nil {
+        t.Fatalf("Diff with itself = %v, %v, %v", added, removed, changed)
+    }
+}
+
+// conflictingCaches returns two caches that both hold k, written first in
+// older, and each hold one key of their own.
+func conflictingCaches(older, newer interface{}) (*LRUCache, *LRUCache) {
+    first := NewLRUCache(10)
+    first.Set("k", older, 0)
+    first.Set("only-first", 1, 0)
+    time.Sleep(2 * time.Millisecond)
+    second := NewLRUCache(10)
+    second.Set("k", newer, 0)
+    second.Set("only-second", 2, 0)
+    return first, second
+}
+
+func TestMergeConflictPolicies(t *testing.T) {
+    for _, tc := range []struct {
+        name         string
+        policy       ConflictPolicy
+        reverse      bool
+        older, newer interface{}
+        want         interface{}
+    }{
+        {"KeepExisting", KeepExisting, false, "old", "new", "old"},
+        {"KeepIncoming", KeepIncoming, false, "old", "new", "new"},
+        {"KeepOlder into newer", KeepOlder, true, "old", "new", "old"},
+        {"KeepOlder into older", KeepOlder, false, "old", "new", "old"},
+        {"KeepNewer into older", KeepNewer, false, "old", "new", "new"},
+        {"KeepNewer into newer", KeepNewer, true, "old", "new", "new"},
+        {"KeepHigherValue numbers", KeepHigherValue, false, 3, 2.5, 3},
+        {"KeepHigherValue strings", KeepHigherValue, false, "apple", "banana", "banana"},
+        {"KeepHigherValue unordered", KeepHigherValue, false, []int{1}, []int{2}, []int{1}},
+        {"Custom", Custom(func(a, b *cacheEntry) *cacheEntry {
+            return &cacheEntry{value: a.value.(string) + "+" + b.value.(string)}
+        }), false, "old", "new", "old+new"},
+        {"Custom returning nil", Custom(func(a, b *cacheEntry) *cacheEntry { return nil }), false, "old", "new", "old"},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            dst, src := conflictingCaches(tc.older, tc.newer)
+            if tc.reverse {
+                dst, src = src, dst
+            }
+            dst.Merge(src, tc.policy)
+
+            if got := dst.Get("k"); !reflect.DeepEqual(got, tc.want) {
+                t.Fatalf("k = %v, want %v", got, tc.want)
+            }
+            if !dst.ContainsKey("only-first") || !dst.ContainsKey("only-second") {
+                t.Fatal("a key without conflict was not merged")
+            }
+        })
+    }
+}
+
+func TestMergeSkipsExpiredAndKeepsExpiration(t *testing.T) {
+    dst := NewLRUCache(10)
+    src := NewLRUCache(10)
+    src.Set("expired", 1, time.Millisecond)
+    src.Set("ttl", 2, time.Hour)
+    time.Sleep(5 * time.Millisecond)
+
+    dst.Merge(src, KeepIncoming)
+    if dst.ContainsKey("expired") {
+        t.Fatal("an expired entry was merged")
+    }
+    if ttl, ok := dst.TTL("ttl"); !ok || ttl <= 59*time.Minute {
+        t.Fatalf("TTL(ttl) = %v, %v after merging", ttl, ok)
+    }
+}
+
+func TestCopyToIsIndependent(t *testing.T) {
+    src := NewLRUCache(10)
+    src.Set("a", 1, 0)
+    src.Set("b", 2, time.Hour)
+    src.Set("expired", 3, time.Millisecond)
+    time.Sleep(5 * time.Millisecond)
+
+    dst := NewLRUCache(10)
+    if copied := src.CopyTo(dst); copied != 2 {
+        t.Fatalf("CopyTo = %d, want 2", copied)
+    }
+    if ttl, ok := dst.TTL("b"); !ok || ttl <= 59*time.Minute {
+        t.Fatalf("TTL(b) = %v, %v in the copy", ttl, ok)
+    }
+
+    dst.Set("a", 10, 0)
+    dst.Delete("b")
+    dst.Set("c", 30, 0)
+    src.Set("d", 4, 0)
+    if src.Get("a") != 1 || !src.ContainsKey("b") || src.ContainsKey("c") {
+        t.Fatal("writing to the copy changed the source")
+    }
+    if dst.Get("a") != 10 || dst.ContainsKey("d") {
+        t.Fatal("writing to the source changed the copy")
+    }
+}
+
+func TestCopyToDropsLeastRecentlyUsed(t *testing.T) {
+    src := NewLRUCache(10)
+    for _, key := range []string{"a", "b", "c", "d"} {
+        src.Set(key, key, 0)
+    }
+    src.Get("a")
+
+    dst := NewLRUCache(2)
+    if copied := src.CopyTo(dst); copied != 2 {
+        t.Fatalf("CopyTo = %d, want 2", copied)
+    }
+    if !dst.ContainsKey("a") || !dst.ContainsKey("d") {
+        t.Fatalf("copy holds %+v, want the most recently used a and d", dst.Snapshot())
+    }
+}
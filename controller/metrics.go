@@ -0,0 +1,182 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// The /metrics endpoint exposes the following series in the Prometheus text
+// exposition format. Names and labels are part of the public interface and
+// must not change without a deprecation period.
+//
+//   cache_hits_total                        counter
+//   cache_misses_total                      counter
+//   cache_evictions_total{reason}           counter, reason is "capacity" or "expired"
+//   cache_entries                           gauge
+//   cache_capacity                          gauge
+//   cache_average_entry_age_seconds         gauge
+//   cache_operation_duration_seconds{op}    histogram, op is "get", "set", "delete" or "cache_state"
+//   cache_value_size_bytes                  histogram, only when -max-bytes is set
+//   cache_events_dropped_total              counter
+//   cache_webhook_events_total{outcome}     counter, outcome is "sent", "dropped" or "failed", only with a webhook
+//   http_request_duration_seconds{route,status}  histogram
+//
+// The route label is the registered route pattern (e.g. /cache/:key), never
+// the raw path, to keep cardinality bounded.
+
+// durationBuckets are the upper bounds, in seconds, of the request duration
+// histogram buckets.
+var durationBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+// histogram is a cumulative Prometheus-style histogram.
+type histogram struct {
+    buckets []float64
+    counts  []uint64
+    count   uint64
+    sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+    return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// observe records v. The caller must serialize access.
+func (h *histogram) observe(v float64) {
+    for i, upper := range h.buckets {
+        if v <= upper {
+            h.counts[i]++
+        }
+    }
+    h.count++
+    h.sum += v
+}
+
+// write emits the histogram series for name with the given label pairs,
+// which must already be formatted as `k="v",...`.
+func (h *histogram) write(w io.Writer, name, labels string) {
+    sep := ""
+    if labels != "" {
+        sep = ","
+    }
+    for i, upper := range h.buckets {
+        fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, formatFloat(upper), h.counts[i])
+    }
+    fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+    if labels != "" {
+        labels = "{" + labels + "}"
+    }
+    fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+    fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func formatFloat(v float64) string {
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// routeLabels identifies one HTTP request duration series.
+type routeLabels struct {
+    route  string
+    status int
+}
+
+// httpMetrics records request durations per route and status.
+type httpMetrics struct {
+    mutex     sync.Mutex
+    durations map[routeLabels]*histogram
+}
+
+func newHTTPMetrics() *httpMetrics {
+    return &httpMetrics{durations: make(map[routeLabels]*histogram)}
+}
+
+// middleware times every request handled by the router.
+func (m *httpMetrics) middleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        start := time.Now()
+        c.Next()
+
+        route := c.FullPath()
+        if route == "" {
+            route = "unmatched"
+        }
+        labels := routeLabels{route: route, status: c.Writer.Status()}
+
+        m.mutex.Lock()
+        h, ok := m.durations[labels]
+        if !ok {
+            h = newHistogram(durationBuckets)
+            m.durations[labels] = h
+        }
+        h.observe(time.Since(start).Seconds())
+        m.mutex.Unlock()
+    }
+}
+
+// write emits the request duration histograms in a stable order.
+func (m *httpMetrics) write(w io.Writer) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    keys := make([]routeLabels, 0, len(m.durations))
+    for k := range m.durations {
+        keys = append(keys, k)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        if keys[i].route != keys[j].route {
+            return keys[i].route < keys[j].route
+        }
+        return keys[i].status < keys[j].status
+    })
+
+    fmt.Fprintln(w, "# HELP http_request_duration_seconds HTTP request latency by route and status.")
+    fmt.Fprintln(w, "# TYPE http_request_duration_seconds histogram")
+    for _, k := range keys {
+        labels := fmt.Sprintf("route=%q,status=\"%d\"", k.route, k.status)
+        m.durations[k].write(w, "http_request_duration_seconds", labels)
+    }
+}
+
+// writeCacheMetrics emits the cache counters and gauges.
+func writeCacheMetrics(w io.Writer, stats CacheStats, averageAge time.Duration) {
+    fmt.Fprintln(w, "# HELP cache_hits_total Lookups that found a live entry.")
+    fmt.Fprintln(w, "# TYPE cache_hits_total counter")
+    fmt.Fprintf(w, "cache_hits_total %d\n", stats.Hits)
+    fmt.Fprintln(w, "# HELP cache_misses_total Lookups that found no live entry.")
+    fmt.Fprintln(w, "# TYPE cache_misses_total counter")
+    fmt.Fprintf(w, "cache_misses_total %d\n", stats.Misses)
+    fmt.Fprintln(w, "# HELP cache_evictions_total Entries removed by the cache, by reason.")
+    fmt.Fprintln(w, "# TYPE cache_evictions_total counter")
+    fmt.Fprintf(w, "cache_evictions_total{reason=\"capacity\"} %d\n", stats.Evictions)
+    fmt.Fprintf(w, "cache_evictions_total{reason=\"expired\"} %d\n", stats.Expirations)
+    fmt.Fprintln(w, "# HELP cache_entries Number of entries currently stored.")
+    fmt.Fprintln(w, "# TYPE cache_entries gauge")
+    fmt.Fprintf(w, "cache_entries %d\n", stats.Size)
+    fmt.Fprintln(w, "# HELP cache_capacity Maximum number of entries.")
+    fmt.Fprintln(w, "# TYPE cache_capacity gauge")
+    fmt.Fprintf(w, "cache_capacity %d\n", stats.Capacity)
+    fmt.Fprintln(w, "# HELP cache_average_entry_age_seconds Mean time since insertion of the live entries.")
+    fmt.Fprintln(w, "# TYPE cache_average_entry_age_seconds gauge")
+    fmt.Fprintf(w, "cache_average_entry_age_seconds %s\n", formatFloat(averageAge.Seconds()))
+}
+
+// metricsHandler serves GET /metrics.
+func metricsHandler(cache *LRUCache, m *httpMetrics) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var b strings.Builder
+        writeCacheMetrics(&b, cache.Stats(), cache.AverageAge())
+        writeLatencyMetrics(&b, cache)
+        writeValueSizeMetrics(&b, cache)
+        writeSubscriberMetrics(&b, cache)
+        writeWebhookMetrics(&b, cache)
+        m.write(&b)
+        c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+    }
+}
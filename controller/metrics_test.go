@@ -0,0 +1,138 @@
+package main
+
+import (
+    "bufio"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+// parseMetrics parses the Prometheus text exposition format into the value
+// of each series, keyed by its name and labels as written, and the type of
+// each metric family.
+func parseMetrics(t *testing.T, text string) (series map[string]float64, types map[string]string) {
+    t.Helper()
+    series, types = make(map[string]float64), make(map[string]string)
+    scanner := bufio.NewScanner(strings.NewReader(text))
+    for scanner.Scan() {
+        line := scanner.Text()
+        if fields := strings.Fields(line); len(fields) == 4 && fields[1] == "TYPE" {
+            types[fields[2]] = fields[3]
+            continue
+        }
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        i := strings.LastIndexByte(line, ' ')
+        if i < 0 {
+            t.Fatalf("malformed line %q", line)
+        }
+        value, err := strconv.ParseFloat(line[i+1:], 64)
+        if err != nil {
+            t.Fatalf("malformed value in %q: %v", line, err)
+        }
+        series[line[:i]] = value
+    }
+    return series, types
+}
+
+func TestMetricsHandler(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(2)
+    cache.Set("a", 1, 0)
+    cache.Set("b", 2, 0)
+    cache.Set("c", 3, 0)
+    cache.Get("c")
+    cache.Get("a")
+
+    m := newHTTPMetrics()
+    router := gin.New()
+    router.Use(m.middleware())
+    router.GET("/cache/:key", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+    router.GET("/metrics", metricsHandler(cache, m))
+    for _, path := range []string{"/cache/x", "/cache/y", "/nowhere"} {
+        router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+    }
+
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+    if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+        t.Fatalf("GET /metrics = %d, %s", rec.Code, rec.Header().Get("Content-Type"))
+    }
+    series, types := parseMetrics(t, rec.Body.String())
+
+    for name, want := range map[string]float64{
+        "cache_hits_total":                         1,
+        "cache_misses_total":                       1,
+        `cache_evictions_total{reason="capacity"}`: 1,
+        `cache_evictions_total{reason="expired"}`:  0,
+        "cache_entries":                            2,
+        "cache_capacity":                           2,
+        `http_request_duration_seconds_count{route="/cache/:key",status="404"}`:            2,
+        `http_request_duration_seconds_count{route="unmatched",status="404"}`:              1,
+        `http_request_duration_seconds_bucket{route="/cache/:key",status="404",le="+Inf"}`: 2,
+    } {
+        if got, ok := series[name]; !ok || got != want {
+            t.Errorf("%s = %v, %v; want %v", name, got, ok, want)
+        }
+    }
+    for name, want := range map[string]string{
+        "cache_hits_total":                 "counter",
+        "cache_misses_total":               "counter",
+        "cache_evictions_total":            "counter",
+        "cache_entries":                    "gauge",
+        "cache_capacity":                   "gauge",
+        "cache_average_entry_age_seconds":  "gauge",
+        "cache_operation_duration_seconds": "histogram",
+        "http_request_duration_seconds":    "histogram",
+    } {
+        if types[name] != want {
+            t.Errorf("type of %s = %q, want %q", name, types[name], want)
+        }
+    }
+}
+
+func TestValueSizeHistogram(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    scrape := func(cache *LRUCache) map[string]float64 {
+        router := gin.New()
+        router.GET("/metrics", metricsHandler(cache, newHTTPMetrics()))
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+        series, _ := parseMetrics(t, rec.Body.String())
+        return series
+    }
+
+    cache := NewLRUCache(10, WithMaxBytes(1<<20))
+    for i, size := range []int{10, 100, 5000, 100} {
+        cache.Set("k", strings.Repeat("x", size), 0)
+        if got := scrape(cache)["cache_value_size_bytes_count"]; got != float64(i+1) {
+            t.Fatalf("sample count after %d sets = %v", i+1, got)
+        }
+    }
+    series := scrape(cache)
+    for name, want := range map[string]float64{
+        `cache_value_size_bytes_bucket{le="64"}`:    1,
+        `cache_value_size_bytes_bucket{le="256"}`:   3,
+        `cache_value_size_bytes_bucket{le="4096"}`:  3,
+        `cache_value_size_bytes_bucket{le="16384"}`: 4,
+        `cache_value_size_bytes_bucket{le="+Inf"}`:  4,
+        "cache_value_size_bytes_sum":                5210,
+    } {
+        if got := series[name]; got != want {
+            t.Errorf("%s = %v, want %v", name, got, want)
+        }
+    }
+
+    // Without byte accounting no sizes are computed, so there is no
+    // histogram.
+    cache = NewLRUCache(10)
+    cache.Set("k", "v", 0)
+    if _, ok := scrape(cache)["cache_value_size_bytes_count"]; ok {
+        t.Fatal("the value size histogram is exposed without byte accounting")
+    }
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "bytes"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// CachedResponse is the value stored by Middleware for each cached
+// response.
+type CachedResponse struct {
+    Status      int    `json:"status"`
+    ContentType string `json:"content_type"`
+    Body        []byte `json:"body"`
+}
+
+// teeWriter copies everything written to the response into buf.
+type teeWriter struct {
+    gin.ResponseWriter
+    buf bytes.Buffer
+}
+
+func (w *teeWriter) Write(data []byte) (int, error) {
+    w.buf.Write(data)
+    return w.ResponseWriter.Write(data)
+}
+
+func (w *teeWriter) WriteString(s string) (int, error) {
+    w.buf.WriteString(s)
+    return w.ResponseWriter.WriteString(s)
+}
+
+// Middleware returns a Gin middleware that caches handler responses in c for
+// ttl, keyed by request method and URL:
+//
+//   router.GET("/api/products", cache.Middleware(time.Minute), productsHandler)
+//
+// Only 2xx responses are cached, and handlers can opt out by setting
+// Cache-Control: no-store. On a hit the stored status, Content-Type and body
+// are replayed without calling the handler.
+func (c *LRUCache) Middleware(ttl time.Duration) gin.HandlerFunc {
+    return func(ctx *gin.Context) {
+        key := ctx.Request.Method + ctx.Request.URL.String()
+        if cached, ok := c.Get(key).(*CachedResponse); ok {
+            ctx.Data(cached.Status, cached.ContentType, cached.Body)
+            ctx.Abort()
+            return
+        }
+
+        w := &teeWriter{ResponseWriter: ctx.Writer}
+        ctx.Writer = w
+        ctx.Next()
+        ctx.Writer = w.ResponseWriter
+
+        status := w.Status()
+        if status < 200 || status > 299 {
+            return
+        }
+        if strings.Contains(w.Header().Get("Cache-Control"), "no-store") {
+            return
+        }
+        c.Set(key, &CachedResponse{
+            Status:      status,
+            ContentType: w.Header().Get("Content-Type"),
+            Body:        w.buf.Bytes(),
+        }, ttl)
+    }
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/gin-gonic/gin/binding"
+    "github.com/gin-gonic/gin/render"
+)
+
+// respond writes obj as MessagePack when the Accept header asks for it and
+// as JSON otherwise. Handlers that return data should use it instead of
+// calling c.JSON directly so every endpoint negotiates the same way.
+func respond(c *gin.Context, code int, obj interface{}) {
+    switch c.NegotiateFormat(binding.MIMEJSON, binding.MIMEMSGPACK2, binding.MIMEMSGPACK) {
+    case binding.MIMEMSGPACK2, binding.MIMEMSGPACK:
+        data, err := msgpackData(obj)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        c.Render(code, render.MsgPack{Data: data})
+    default:
+        c.JSON(code, obj)
+    }
+}
+
+// msgpackData converts obj to the maps, slices and scalars its JSON
+// encoding decodes to, so MessagePack bodies carry the same fields as JSON
+// ones: json tags and MarshalJSON methods apply, and times are RFC 3339
+// strings rather than the codec's raw binary form. Integers stay integers.
+func msgpackData(obj interface{}) (interface{}, error) {
+    encoded, err := json.Marshal(obj)
+    if err != nil {
+        return nil, err
+    }
+    decoder := json.NewDecoder(bytes.NewReader(encoded))
+    decoder.UseNumber()
+    var data interface{}
+    if err := decoder.Decode(&data); err != nil {
+        return nil, err
+    }
+    return msgpackNumbers(data), nil
+}
+
+// msgpackNumbers replaces the json.Numbers in v with int64, uint64 or
+// float64 values, whichever holds them exactly.
+func msgpackNumbers(v interface{}) interface{} {
+    switch v := v.(type) {
+    case map[string]interface{}:
+        for key, item := range v {
+            v[key] = msgpackNumbers(item)
+        }
+    case []interface{}:
+        for i, item := range v {
+            v[i] = msgpackNumbers(item)
+        }
+    case json.Number:
+        if n, err := v.Int64(); err == nil {
+            return n
+        }
+        if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+            return n
+        }
+        n, _ := v.Float64()
+        return n
+    }
+    return v
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ugorji/go/codec"
+)
+
+func TestRespondMsgPackMatchesJSON(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(1)
+    cache.Set("a", 1, 0)
+    cache.Set("b", 2, 0)
+    router := gin.New()
+    router.GET("/admin/events", eventsHandler(cache))
+    router.GET("/admin/snapshot", func(c *gin.Context) {
+        respond(c, http.StatusOK, cache.Snapshot())
+    })
+
+    for _, path := range []string{"/admin/events", "/admin/snapshot"} {
+        bodies := map[string]interface{}{}
+        for _, accept := range []string{"application/json", "application/msgpack"} {
+            req := httptest.NewRequest(http.MethodGet, path, nil)
+            req.Header.Set("Accept", accept)
+            rec := httptest.NewRecorder()
+            router.ServeHTTP(rec, req)
+            if rec.Code != http.StatusOK {
+                t.Fatalf("GET %s (%s) = %d", path, accept, rec.Code)
+            }
+            if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, accept) {
+                t.Fatalf("GET %s (%s) has Content-Type %q", path, accept, contentType)
+            }
+
+            var body interface{}
+            if accept == "application/json" {
+                if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+                    t.Fatal(err)
+                }
+            } else {
+                var handle codec.MsgpackHandle
+                handle.RawToString = true
+                var decoded interface{}
+                if err := codec.NewDecoderBytes(rec.Body.Bytes(), &handle).Decode(&decoded); err != nil {
+                    t.Fatal(err)
+                }
+                // Bring the msgpack integers to JSON's float64 to compare.
+                encoded, err := json.Marshal(decoded)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if err := json.Unmarshal(encoded, &body); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            bodies[accept] = body
+        }
+        if !reflect.DeepEqual(bodies["application/json"], bodies["application/msgpack"]) {
+            t.Errorf("GET %s: msgpack body %v differs from JSON body %v", path, bodies["application/msgpack"], bodies["application/json"])
+        }
+    }
+}
+
+func TestMsgPackDataFormatsTimes(t *testing.T) {
+    at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+    data, err := msgpackData(RemovalEvent{Key: "a", Reason: "capacity", Time: at})
+    if err != nil {
+        t.Fatal(err)
+    }
+    fields := data.(map[string]interface{})
+    if fields["time"] != "2024-05-01T12:30:00Z" {
+        t.Fatalf("time = %#v, want an RFC 3339 string", fields["time"])
+    }
+    if _, ok := fields["displaced_by"]; ok {
+        t.Fatal("omitempty field was included")
+    }
+    if n, _ := msgpackData(map[string]uint64{"n": 1 << 63}); n.(map[string]interface{})["n"] != uint64(1<<63) {
+        t.Fatalf("n = %#v, want an exact uint64", n)
+    }
+}
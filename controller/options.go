@@ -0,0 +1,127 @@
+package main
+
+import "time"
+
+// Option configures an LRUCache created by NewLRUCache.
+type Option func(*LRUCache)
+
+// WithMaxBytes bounds the total estimated size of the entries, keys and
+// per-entry overhead included, to n bytes, evicting least recently used
+// entries to stay within it. The entry count capacity still applies. Sizes
+// are estimated when a value is set; see WithSizeFunc.
+func WithMaxBytes(n int64) Option {
+    return func(c *LRUCache) {
+        c.maxBytes = n
+    }
+}
+
+// WithSizeFunc sets the function used to estimate the size of values that
+// are not strings, byte slices or fixed-size primitives.
+func WithSizeFunc(fn func(interface{}) int64) Option {
+    return WithSizeEstimator(SizeFunc(fn))
+}
+
+// WithSizeEstimator sets the estimator used for values that are not
+// strings, byte slices or fixed-size primitives. The default is DeepSizeOf;
+// pass SizeFunc(ShallowSizeOf) for a cheaper, less accurate estimate.
+func WithSizeEstimator(e SizeEstimator) Option {
+    return func(c *LRUCache) {
+        c.sizeEstimator = e
+    }
+}
+
+// WithClock sets the function the cache reads the current time from when
+// computing and checking expirations, in place of time.Now. Tests use it to
+// expire entries without sleeping.
+func WithClock(now func() time.Time) Option {
+    return func(c *LRUCache) {
+        c.clock = now
+    }
+}
+
+// WithEvictionBatchSize makes Resize evict at most n entries per lock
+// acquisition when shrinking the cache, trading one long critical section
+// for several short ones. Zero, the default, evicts everything at once.
+func WithEvictionBatchSize(n int) Option {
+    return func(c *LRUCache) {
+        c.evictionBatchSize = n
+    }
+}
+
+// WithAccessLogSize sets how many recent Get, Set and Delete operations are
+// kept for RecentAccesses. The default is 1000; zero disables the log.
+func WithAccessLogSize(n int) Option {
+    return func(c *LRUCache) {
+        c.accessLog = newAtomicRing[AccessRecord](n)
+    }
+}
+
+// WithLoader makes GetCtx, and Get, call l for keys missing from the cache
+// and store what it returns.
+func WithLoader(l Loader) Option {
+    return func(c *LRUCache) {
+        c.loader = l
+    }
+}
+
+// WithLoaderRetry makes failed loader calls be retried as described by r.
+// Without it every load is attempted once.
+func WithLoaderRetry(r LoaderRetry) Option {
+    return func(c *LRUCache) {
+        c.retry = r
+    }
+}
+
+// WithRetryPolicy is WithLoaderRetry for the common case: a load is
+// attempted up to maxAttempts times, waiting initialBackoff before the
+// first retry and doubling the wait after each one, randomized by up to
+// 20% either way. Retries stop once the caller's context would expire
+// before the next attempt, and a load that fails every attempt is not
+// remembered, so the next lookup tries again.
+func WithRetryPolicy(maxAttempts int, initialBackoff time.Duration) Option {
+    return WithLoaderRetry(LoaderRetry{
+        MaxAttempts: maxAttempts,
+        BaseDelay:   initialBackoff,
+        Factor:      2,
+        Jitter:      0.2,
+    })
+}
+
+// WithEventLogSize sets how many removal events are kept for
+// RemovalEvents. The default is 1000; zero disables the log.
+func WithEventLogSize(n int) Option {
+    return func(c *LRUCache) {
+        c.events = newRingBuffer[RemovalEvent](n)
+    }
+}
+
+// WithSlowThreshold logs a warning for operations slower than d; see
+// SetSlowThreshold. When hashKeys is set the warnings carry a hash of the
+// key instead of the key itself.
+func WithSlowThreshold(d time.Duration, hashKeys bool) Option {
+    return func(c *LRUCache) {
+        c.SetSlowThreshold(d)
+        c.hashSlowKeys = hashKeys
+    }
+}
+
+// WithAutoSnapshot makes StartAutoSnapshot save a snapshot to path every
+// interval. An empty path or a non-positive interval disables it.
+func WithAutoSnapshot(path string, interval time.Duration) Option {
+    if path == "" {
+        return WithAutoSnapshotStore(nil, "", interval)
+    }
+    store, name := fileSnapshotStoreFor(path)
+    return WithAutoSnapshotStore(store, name, interval)
+}
+
+// WithAutoSnapshotStore makes StartAutoSnapshot save a snapshot to store
+// under name every interval. A nil store or a non-positive interval
+// disables it.
+func WithAutoSnapshotStore(store SnapshotStore, name string, interval time.Duration) Option {
+    return func(c *LRUCache) {
+        c.autoSnapshotStore = store
+        c.autoSnapshotName = name
+        c.autoSnapshotInterval = interval
+    }
+}
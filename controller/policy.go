@@ -0,0 +1,278 @@
+package main
+
+import (
+    "container/list"
+    "fmt"
+    "net/http"
+    "sort"
+
+    "github.com/gin-gonic/gin"
+)
+
+// EvictionPolicy chooses which entry capacity eviction removes within a
+// priority level. Lower priorities are always evicted first, whatever the
+// policy.
+type EvictionPolicy int
+
+const (
+    // EvictLRU evicts the least recently used entry.
+    EvictLRU EvictionPolicy = iota
+    // EvictLFU evicts the least frequently used entry, counting reads and
+    // writes, and the least recently used one among those used equally
+    // often.
+    EvictLFU
+    // EvictFIFO evicts the entry inserted first. Reads and overwrites do
+    // not change the order.
+    EvictFIFO
+)
+
+// ParseEvictionPolicy parses "lru", "lfu" or "fifo".
+func ParseEvictionPolicy(s string) (EvictionPolicy, error) {
+    switch s {
+    case "lru":
+        return EvictLRU, nil
+    case "lfu":
+        return EvictLFU, nil
+    case "fifo":
+        return EvictFIFO, nil
+    }
+    return 0, fmt.Errorf("unknown eviction policy %q", s)
+}
+
+func (p EvictionPolicy) String() string {
+    switch p {
+    case EvictLFU:
+        return "lfu"
+    case EvictFIFO:
+        return "fifo"
+    }
+    return "lru"
+}
+
+// WithEvictionPolicy sets the eviction policy. The default is EvictLRU.
+func WithEvictionPolicy(p EvictionPolicy) Option {
+    return func(c *LRUCache) {
+        c.SetEvictionPolicy(p)
+    }
+}
+
+// EvictionPolicy returns the current eviction policy.
+func (c *LRUCache) EvictionPolicy() EvictionPolicy {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    return c.policy
+}
+
+// SetEvictionPolicy switches the eviction policy. No entries are dropped:
+// the new policy's bookkeeping is rebuilt from the current entries, with
+// LFU starting from each entry's use count and FIFO from its insertion
+// order. The rebuild holds the write lock and is O(n log n) in the number
+// of entries, so switching blocks every other operation on a large cache.
+func (c *LRUCache) SetEvictionPolicy(p EvictionPolicy) {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    if p == c.policy {
+        return
+    }
+    c.policy = p
+
+    // Collect each level's elements from least to most recently used, the
+    // order they are pushed in, then reorder them for the policy.
+    var levels [numPriorities][]*list.Element
+    for element := c.list.Back(); element != nil; element = element.Prev() {
+        entry := element.Value.(*cacheEntry)
+        levels[entry.priority] = append(levels[entry.priority], element)
+    }
+    for i := range c.priorities {
+        c.priorities[i] = newEvictionQueue(p)
+        elements := levels[i]
+        switch p {
+        case EvictLFU:
+            sort.SliceStable(elements, func(a, b int) bool {
+                return elements[a].Value.(*cacheEntry).uses < elements[b].Value.(*cacheEntry).uses
+            })
+        case EvictFIFO:
+            sort.SliceStable(elements, func(a, b int) bool {
+                return elements[a].Value.(*cacheEntry).seq < elements[b].Value.(*cacheEntry).seq
+            })
+        }
+        for _, element := range elements {
+            c.priorities[i].push(element)
+        }
+    }
+}
+
+// evictionQueue orders the entries of one priority level for eviction.
+// Its values are the entries' elements in the cache's recency list, and
+// it keeps its own position in the entries' priorityElement. The caller
+// must hold the write lock.
+type evictionQueue interface {
+    // push adds an entry as the most recently used.
+    push(element *list.Element)
+    // touch records a read or overwrite of an entry, after its use count
+    // has been incremented.
+    touch(element *list.Element)
+    remove(element *list.Element)
+    // victim returns the entry to evict next, other than keep unless it
+    // is the only one, or nil if there are none.
+    victim(keep *list.Element) *list.Element
+    reset()
+}
+
+func newEvictionQueue(p EvictionPolicy) evictionQueue {
+    switch p {
+    case EvictLFU:
+        return &lfuQueue{buckets: list.New()}
+    case EvictFIFO:
+        return &recencyQueue{entries: list.New(), fifo: true}
+    }
+    return &recencyQueue{entries: list.New()}
+}
+
+// recencyQueue evicts from the back of a list entries are pushed to the
+// front of. Under LRU a touch moves the entry back to the front; under
+// FIFO it does nothing.
+type recencyQueue struct {
+    entries *list.List
+    fifo    bool
+}
+
+func (q *recencyQueue) push(element *list.Element) {
+    element.Value.(*cacheEntry).priorityElement = q.entries.PushFront(element)
+}
+
+func (q *recencyQueue) touch(element *list.Element) {
+    if !q.fifo {
+        q.entries.MoveToFront(element.Value.(*cacheEntry).priorityElement)
+    }
+}
+
+func (q *recencyQueue) remove(element *list.Element) {
+    q.entries.Remove(element.Value.(*cacheEntry).priorityElement)
+}
+
+func (q *recencyQueue) victim(keep *list.Element) *list.Element {
+    back := q.entries.Back()
+    if back == nil {
+        return nil
+    }
+    if back.Value.(*list.Element) == keep && back.Prev() != nil {
+        back = back.Prev()
+    }
+    return back.Value.(*list.Element)
+}
+
+func (q *recencyQueue) reset() {
+    q.entries.Init()
+}
+
+// lfuQueue groups entries into buckets by use count, kept in ascending
+// order of count, each an LRU list. Every operation is O(1) except pushing
+// an entry that already has uses, which walks the buckets from the most
+// used end and only happens when the policy is switched to LFU.
+type lfuQueue struct {
+    buckets *list.List
+}
+
+// lfuBucket holds the entries used count times.
+type lfuBucket struct {
+    count   uint64
+    entries *list.List
+}
+
+func (q *lfuQueue) push(element *list.Element) {
+    count := element.Value.(*cacheEntry).uses
+    var bucket *list.Element
+    if front := q.buckets.Front(); front == nil || count < front.Value.(*lfuBucket).count {
+        bucket = q.buckets.PushFront(&lfuBucket{count: count, entries: list.New()})
+    } else if count == front.Value.(*lfuBucket).count {
+        bucket = front
+    } else {
+        bucket = q.buckets.Back()
+        for bucket.Value.(*lfuBucket).count > count {
+            bucket = bucket.Prev()
+        }
+        if bucket.Value.(*lfuBucket).count != count {
+            bucket = q.buckets.InsertAfter(&lfuBucket{count: count, entries: list.New()}, bucket)
+        }
+    }
+    q.add(bucket, element)
+}
+
+// add puts element at the front of bucket's entries.
+func (q *lfuQueue) add(bucket, element *list.Element) {
+    entry := element.Value.(*cacheEntry)
+    entry.priorityElement = bucket.Value.(*lfuBucket).entries.PushFront(element)
+    entry.lfuBucket = bucket
+}
+
+func (q *lfuQueue) touch(element *list.Element) {
+    entry := element.Value.(*cacheEntry)
+    bucket, count := entry.lfuBucket, entry.uses
+    next := bucket.Next()
+    if next == nil || next.Value.(*lfuBucket).count != count {
+        next = q.buckets.InsertAfter(&lfuBucket{count: count, entries: list.New()}, bucket)
+    }
+    q.remove(element)
+    q.add(next, element)
+}
+
+func (q *lfuQueue) remove(element *list.Element) {
+    entry := element.Value.(*cacheEntry)
+    bucket := entry.lfuBucket.Value.(*lfuBucket)
+    bucket.entries.Remove(entry.priorityElement)
+    if bucket.entries.Len() == 0 {
+        q.buckets.Remove(entry.lfuBucket)
+    }
+    entry.lfuBucket = nil
+}
+
+func (q *lfuQueue) victim(keep *list.Element) *list.Element {
+    front := q.buckets.Front()
+    if front == nil {
+        return nil
+    }
+    victim := front.Value.(*lfuBucket).entries.Back()
+    if victim.Value.(*list.Element) == keep {
+        if prev := victim.Prev(); prev != nil {
+            victim = prev
+        } else if next := front.Next(); next != nil {
+            victim = next.Value.(*lfuBucket).entries.Back()
+        }
+    }
+    return victim.Value.(*list.Element)
+}
+
+func (q *lfuQueue) reset() {
+    q.buckets.Init()
+}
+
+// policyHandler serves GET /admin/policy.
+func policyHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.JSON(http.StatusOK, gin.H{"policy": cache.EvictionPolicy().String()})
+    }
+}
+
+// updatePolicyHandler serves PUT /admin/policy, which takes
+// {"policy": "lru" | "lfu" | "fifo"}.
+func updatePolicyHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var data struct {
+            Policy string `json:"policy" binding:"required"`
+        }
+        if err := c.ShouldBindJSON(&data); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        policy, err := ParseEvictionPolicy(data.Policy)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "policy", Reason: `must be "lru", "lfu" or "fifo"`}}})
+            return
+        }
+        cache.SetEvictionPolicy(policy)
+        policyHandler(cache)(c)
+    }
+}
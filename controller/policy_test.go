@@ -0,0 +1,119 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+// usedCache returns a cache of capacity 3 holding a, b and c, where a is
+// the most used but least recently used entry and c the reverse.
+func usedCache() *LRUCache {
+    cache := NewLRUCache(3)
+    cache.Set("a", 1, 0)
+    cache.Set("b", 2, 0)
+    cache.Set("c", 3, 0)
+    for _, key := range []string{"a", "a", "a", "b", "b", "c"} {
+        cache.Get(key)
+    }
+    return cache
+}
+
+// expectEvicted sets key and fails the test unless doing so evicted want.
+func expectEvicted(t *testing.T, cache *LRUCache, key, want string) {
+    t.Helper()
+    cache.Set(key, key, 0)
+    events := cache.RemovalEvents("", 1)
+    if len(events) != 1 || events[0].Key != want || events[0].DisplacedBy != key {
+        t.Fatalf("setting %s evicted %+v, want %s", key, events, want)
+    }
+}
+
+func TestSwitchToLFUMigratesUseCounts(t *testing.T) {
+    cache := usedCache()
+    cache.SetEvictionPolicy(EvictLFU)
+    if cache.Len() != 3 || cache.EvictionPolicy() != EvictLFU {
+        t.Fatalf("Len = %d, policy = %s after the switch", cache.Len(), cache.EvictionPolicy())
+    }
+
+    // LRU would evict a; LFU evicts c, used least.
+    expectEvicted(t, cache, "d", "c")
+    // d, just inserted, is used less than a and b.
+    expectEvicted(t, cache, "e", "d")
+    for _, key := range []string{"a", "b", "e"} {
+        if !cache.ContainsKey(key) {
+            t.Fatalf("%s was evicted", key)
+        }
+    }
+}
+
+func TestSwitchToLFUCountsWrites(t *testing.T) {
+    // LFU counts overwrites as uses, so an entry written often but never
+    // read must rank the same whether the uses were made before or after
+    // the switch, and resetting the hit counts must not change that.
+    use := func(cache *LRUCache) {
+        cache.Set("a", 1, 0)
+        cache.Set("b", 2, 0)
+        for i := 0; i < 3; i++ {
+            cache.Set("a", i, 0)
+        }
+        cache.Get("b")
+        cache.ResetHitCounts()
+    }
+
+    native := NewLRUCache(2, WithEvictionPolicy(EvictLFU))
+    use(native)
+    expectEvicted(t, native, "c", "b")
+
+    switched := NewLRUCache(2)
+    use(switched)
+    switched.SetEvictionPolicy(EvictLFU)
+    expectEvicted(t, switched, "c", "b")
+}
+
+func TestSwitchBackToLRU(t *testing.T) {
+    cache := usedCache()
+    cache.SetEvictionPolicy(EvictLFU)
+    cache.SetEvictionPolicy(EvictLRU)
+
+    expectEvicted(t, cache, "d", "a")
+}
+
+func TestSwitchToFIFOIgnoresReads(t *testing.T) {
+    cache := usedCache()
+    cache.SetEvictionPolicy(EvictFIFO)
+
+    cache.Get("a")
+    expectEvicted(t, cache, "d", "a")
+    expectEvicted(t, cache, "e", "b")
+}
+
+func TestUpdatePolicyHandler(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := usedCache()
+    router := gin.New()
+    router.PUT("/admin/policy", updatePolicyHandler(cache))
+
+    for _, tc := range []struct {
+        body   string
+        status int
+        policy EvictionPolicy
+    }{
+        {`{"policy":"lfu"}`, http.StatusOK, EvictLFU},
+        {`{"policy":"random"}`, http.StatusBadRequest, EvictLFU},
+        {`{}`, http.StatusBadRequest, EvictLFU},
+        {`{"policy":"fifo"}`, http.StatusOK, EvictFIFO},
+    } {
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/policy", strings.NewReader(tc.body)))
+        if rec.Code != tc.status || cache.EvictionPolicy() != tc.policy {
+            t.Fatalf("PUT %s = %d %s, policy %s; want %d, %s", tc.body, rec.Code, rec.Body, cache.EvictionPolicy(), tc.status, tc.policy)
+        }
+    }
+    if cache.Len() != 3 {
+        t.Fatalf("Len = %d after switching policies", cache.Len())
+    }
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+    "container/list"
+    "time"
+)
+
+// Priority levels for SetWithPriority. Capacity eviction removes an entry
+// of the lowest priority that has any entries, chosen by the eviction
+// policy, so a higher-priority entry is only evicted once no lower-priority
+// entries remain.
+const (
+    PriorityLow    = 0
+    PriorityNormal = 1
+    PriorityHigh   = 2
+
+    numPriorities = PriorityHigh + 1
+)
+
+// SetWithPriority is like Set but stores the entry at priority, one of the
+// Priority* levels; out of range values are clamped. Set stores entries at
+// PriorityNormal, and overwriting a key with Set resets its priority.
+// Priorities are not recorded in snapshots or the append-only log, so
+// restored entries have PriorityNormal. It fails when Set would.
+func (c *LRUCache) SetWithPriority(key string, value interface{}, ttl time.Duration, priority int) error {
+    if err := c.checkWritable("set", key); err != nil {
+        return err
+    }
+
+    c.mutex.Lock()
+    defer c.unlock()
+
+    c.setPriority(key, value, c.expirationTime(ttl), priority)
+    return nil
+}
+
+// promote moves element to the front of the recency list and records the
+// use in its priority's eviction queue. The caller must hold the lock.
+func (c *LRUCache) promote(element *list.Element) {
+    c.list.MoveToFront(element)
+    entry := element.Value.(*cacheEntry)
+    entry.uses++
+    c.priorities[entry.priority].touch(element)
+}
+
+// setEntryPriority records a write of entry at priority: a use if it is
+// already queued at that priority, otherwise it is moved to, or added as
+// the most recent entry of, the queue for priority. The caller must hold
+// the lock.
+func (c *LRUCache) setEntryPriority(element *list.Element, priority int) {
+    entry := element.Value.(*cacheEntry)
+    if entry.priorityElement != nil {
+        entry.uses++
+        if entry.priority == priority {
+            c.priorities[priority].touch(element)
+            return
+        }
+        c.priorities[entry.priority].remove(element)
+    }
+    entry.priority = priority
+    c.priorities[priority].push(element)
+}
+
+// evictionCandidate returns the element capacity eviction removes next:
+// the victim chosen by the eviction policy among the lowest non-empty
+// priority, or nil if the cache is empty. keep, the element just written
+// if any, is passed over unless it is alone in its priority, so that LFU
+// does not evict new entries before they can be used. The caller must
+// hold the lock.
+func (c *LRUCache) evictionCandidate(keep *list.Element) *list.Element {
+    for _, entries := range c.priorities {
+        if victim := entries.victim(keep); victim != nil {
+            return victim
+        }
+    }
+    return nil
+}
+
+// clampPriority limits priority to the supported levels.
+func clampPriority(priority int) int {
+    return min(max(priority, PriorityLow), PriorityHigh)
+}
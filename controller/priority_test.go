@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestPriorityEvictsLowestFirst(t *testing.T) {
+    cache := NewLRUCache(3)
+    cache.SetWithPriority("high", 1, 0, PriorityHigh)
+    cache.SetWithPriority("low", 2, 0, PriorityLow)
+    cache.Set("normal", 3, 0)
+    // The low-priority entry is the most recently used, and the
+    // high-priority one the least.
+    cache.Get("low")
+
+    expectEvicted(t, cache, "a", "low")
+    expectEvicted(t, cache, "b", "normal")
+    expectEvicted(t, cache, "c", "a")
+    if !cache.ContainsKey("high") {
+        t.Fatal("the high-priority entry was evicted while normal ones remained")
+    }
+    checkConsistent(t, cache)
+}
+
+func TestPriorityEvictsLRUWithinLevel(t *testing.T) {
+    cache := NewLRUCache(2)
+    cache.SetWithPriority("h1", 1, 0, PriorityHigh)
+    cache.SetWithPriority("h2", 2, 0, PriorityHigh)
+    cache.Get("h1")
+
+    // Among entries of one priority eviction is least recently used first.
+    cache.SetWithPriority("h3", 3, 0, PriorityHigh)
+    if cache.ContainsKey("h2") || !cache.ContainsKey("h1") || !cache.ContainsKey("h3") {
+        t.Fatalf("entries after eviction = %v, want h2 evicted", viewKeys(cache.Snapshot()))
+    }
+    checkConsistent(t, cache)
+}
+
+func TestSetResetsPriority(t *testing.T) {
+    cache := NewLRUCache(2)
+    cache.SetWithPriority("a", 1, 0, PriorityHigh)
+    cache.Set("b", 2, 0)
+    cache.Set("a", 3, 0)
+    cache.Get("a")
+
+    // a is back at PriorityNormal, so recency decides.
+    expectEvicted(t, cache, "c", "b")
+    expectEvicted(t, cache, "d", "a")
+}
+
+func TestSetWithPriorityClamps(t *testing.T) {
+    cache := NewLRUCache(2)
+    cache.SetWithPriority("above", 1, 0, 99)
+    cache.SetWithPriority("below", 2, 0, -5)
+    cache.Get("below")
+
+    expectEvicted(t, cache, "c", "below")
+    expectEvicted(t, cache, "d", "c")
+    checkConsistent(t, cache)
+}
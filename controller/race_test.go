@@ -0,0 +1,49 @@
+package main
+
+import (
+    "strconv"
+    "sync"
+    "testing"
+)
+
+// TestClearCacheConcurrentAccess hammers ClearCache alongside reads and
+// writes. It checks no invariant beyond consistency at the end; run it with
+// -race to check that no path touches the map or list without the lock.
+func TestClearCacheConcurrentAccess(t *testing.T) {
+    cache := NewLRUCache(64)
+    var wg sync.WaitGroup
+    worker := func(fn func(i int)) {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := 0; i < 2000; i++ {
+                fn(i)
+            }
+        }()
+    }
+    for w := 0; w < 4; w++ {
+        worker(func(i int) { cache.Set(strconv.Itoa(i%100), i, 0) })
+        worker(func(i int) { cache.Get(strconv.Itoa(i % 100)) })
+    }
+    worker(func(i int) { cache.ContainsKey(strconv.Itoa(i % 100)) })
+    worker(func(i int) { cache.Delete(strconv.Itoa(i % 100)) })
+    worker(func(i int) {
+        if i%10 == 0 {
+            cache.GetCacheState()
+        }
+    })
+    worker(func(i int) {
+        if i%50 == 0 {
+            cache.ClearCache()
+        }
+    })
+    wg.Wait()
+
+    if n, listed := len(cache.cache), cache.list.Len(); n != listed || n > 64 {
+        t.Fatalf("map holds %d entries and list %d, capacity 64", n, listed)
+    }
+    cache.ClearCache()
+    if cache.Len() != 0 || cache.totalBytes != 0 {
+        t.Fatalf("Len = %d, totalBytes = %d after ClearCache", cache.Len(), cache.totalBytes)
+    }
+}
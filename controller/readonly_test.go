@@ -0,0 +1,80 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestReadOnlyRejectsEveryWrite(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("a", 1, 0)
+    cache.SetReadOnly(true)
+
+    writes := map[string]func() error{
+        "Set":             func() error { return cache.Set("b", 2, 0) },
+        "SetMany":         func() error { return cache.SetMany([]BatchEntry{{Key: "b", Value: 2}}) },
+        "SetWithPriority": func() error { return cache.SetWithPriority("b", 2, 0, PriorityHigh) },
+        "SetWithDeps":     func() error { return cache.SetWithDeps("b", 2, 0, []string{"a"}) },
+        "SetWithCallback": func() error { return cache.SetWithCallback("b", 2, 0, func(string, interface{}) {}) },
+        "TouchMany": func() error {
+            _, err := cache.TouchMany([]string{"a"}, time.Hour)
+            return err
+        },
+        "Delete": func() error {
+            _, err := cache.Delete("a")
+            return err
+        },
+        "ClearCache": cache.ClearCache,
+    }
+    for name, write := range writes {
+        if err := write(); !errors.Is(err, ErrReadOnly) {
+            t.Errorf("%s = %v, want ErrReadOnly", name, err)
+        }
+    }
+    if cache.ContainsKey("b") {
+        t.Error("a rejected write stored b")
+    }
+    if ttl, ok := cache.TTL("a"); !ok || ttl != 0 {
+        t.Errorf("TTL(a) = %v, %v; want no expiration", ttl, ok)
+    }
+}
+
+func TestWarmFromHTTPReportsReadOnly(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte(`[{"key":"a","value":1}]`))
+    }))
+    defer server.Close()
+
+    cache := NewLRUCache(10)
+    cache.SetReadOnly(true)
+    if err := cache.WarmFromHTTP(context.Background(), server.URL, 0); !errors.Is(err, ErrReadOnly) {
+        t.Fatalf("WarmFromHTTP = %v, want ErrReadOnly", err)
+    }
+    if cache.Len() != 0 {
+        t.Fatalf("Len = %d after a rejected warm", cache.Len())
+    }
+}
+
+func TestCacheGroupReportsUnstoredValues(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.SetReadOnly(true)
+    group := NewCacheGroup(cache, 0)
+
+    loader := func(keys []string) (map[string]interface{}, error) {
+        return map[string]interface{}{"a": 1}, nil
+    }
+    values, err := group.GetMulti(context.Background(), []string{"a"}, loader)
+    if !errors.Is(err, ErrReadOnly) {
+        t.Fatalf("GetMulti = %v, %v; want ErrReadOnly", values, err)
+    }
+
+    cache.SetReadOnly(false)
+    values, err = group.GetMulti(context.Background(), []string{"a"}, loader)
+    if err != nil || values["a"] != 1 || cache.Get("a") != 1 {
+        t.Fatalf("GetMulti = %v, %v; want a stored", values, err)
+    }
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "net/url"
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    // replicationHeartbeat is how often an idle replication stream sends
+    // a heartbeat carrying the primary's sequence number.
+    replicationHeartbeat = 5 * time.Second
+    // replicaMaxBackoff bounds the wait between a replica's reconnection
+    // attempts, which starts at a second and doubles.
+    replicaMaxBackoff = 30 * time.Second
+)
+
+// ReplicationRecord is one line of GET /replication/stream: a write
+// applied by the primary, as recorded in the append-only log, numbered by
+// Seq, which increases by one with every write. Op "heartbeat" records
+// carry the primary's latest Seq and are not writes.
+type ReplicationRecord struct {
+    Seq        uint64          `json:"seq"`
+    Time       time.Time       `json:"time"`
+    Op         string          `json:"op"`
+    Key        string          `json:"key,omitempty"`
+    Value      json.RawMessage `json:"value,omitempty"`
+    Expiration *time.Time      `json:"expiration,omitempty"`
+}
+
+// WithReplicationLog makes the cache a replication primary, keeping its
+// last size writes for replicas to tail; see StartReplica. A replica that
+// falls further behind than that starts over with a full sync. A
+// non-positive size disables it.
+func WithReplicationLog(size int) Option {
+    return func(c *LRUCache) {
+        c.replication = nil
+        if size > 0 {
+            c.replication = &replicationLog{
+                records: make([]ReplicationRecord, size),
+                notify:  make(chan struct{}),
+                streams: make(map[*replicationStream]struct{}),
+            }
+        }
+    }
+}
+
+// replicationLog is a ring of the last writes with their sequence
+// numbers. Records are appended under the cache's write lock, so their
+// order is the order the writes were applied.
+type replicationLog struct {
+    mutex   sync.Mutex
+    records []ReplicationRecord
+    seq     uint64
+    // notify is closed, and replaced, whenever a record is appended.
+    notify  chan struct{}
+    streams map[*replicationStream]struct{}
+}
+
+// replicationStream is a replica tailing the log.
+type replicationStream struct {
+    addr string
+    sent atomic.Uint64
+}
+
+// append records r under the next sequence number. A nil log does
+// nothing.
+func (l *replicationLog) append(r aofRecord) {
+    if l == nil {
+        return
+    }
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    l.seq++
+    l.records[l.seq%uint64(len(l.records))] = ReplicationRecord{
+        Seq:        l.seq,
+        Time:       time.Now(),
+        Op:         r.Op,
+        Key:        r.Key,
+        Value:      r.Value,
+        Expiration: r.Expiration,
+    }
+    close(l.notify)
+    l.notify = make(chan struct{})
+}
+
+// since returns the records after seq, a channel closed once there are
+// more, and the latest sequence number. ok is false if records after seq
+// are no longer kept, or seq is ahead of the log.
+func (l *replicationLog) since(seq uint64) (records []ReplicationRecord, notify <-chan struct{}, latest uint64, ok bool) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    if seq > l.seq || l.seq-seq > uint64(len(l.records)) {
+        return nil, nil, l.seq, false
+    }
+    for s := seq + 1; s <= l.seq; s++ {
+        records = append(records, l.records[s%uint64(len(l.records))])
+    }
+    return records, l.notify, l.seq, true
+}
+
+// status returns the latest and oldest sequence numbers kept.
+func (l *replicationLog) status() (latest, oldest uint64) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    oldest = 1
+    if l.seq > uint64(len(l.records)) {
+        oldest = l.seq - uint64(len(l.records)) + 1
+    }
+    return l.seq, oldest
+}
+
+func (l *replicationLog) addStream(s *replicationStream) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    l.streams[s] = struct{}{}
+}
+
+func (l *replicationLog) removeStream(s *replicationStream) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    delete(l.streams, s)
+}
+
+// ReplicaLag describes a replica tailing this cache: SeqLag is the
+// number of writes not yet sent to it.
+type ReplicaLag struct {
+    Addr    string `json:"addr"`
+    SentSeq uint64 `json:"sent_seq"`
+    SeqLag  uint64 `json:"seq_lag"`
+}
+
+// ReplicationStatus describes the cache's part in replication. A primary
+// reports Seq, the sequence number of its last write, OldestSeq, the
+// oldest one a replica can resume from, and its Replicas. A replica
+// reports its Primary, whether it is Connected, the sequence number of
+// the last write it applied and of the last one the primary announced,
+// and how far it is behind, in writes and in the time between the last
+// write applied and the last one announced.
+type ReplicationStatus struct {
+    Role           string       `json:"role"`
+    Seq            uint64       `json:"seq,omitempty"`
+    OldestSeq      uint64       `json:"oldest_seq,omitempty"`
+    Replicas       []ReplicaLag `json:"replicas,omitempty"`
+    Primary        string       `json:"primary,omitempty"`
+    Connected      bool         `json:"connected,omitempty"`
+    AppliedSeq     uint64       `json:"applied_seq,omitempty"`
+    PrimarySeq     uint64       `json:"primary_seq,omitempty"`
+    SeqLag         uint64       `json:"seq_lag"`
+    TimeLagSeconds float64      `json:"time_lag_seconds"`
+}
+
+// ReplicationStatus returns the replication status, or nil if the cache
+// is neither a primary nor a replica.
+func (c *LRUCache) ReplicationStatus() *ReplicationStatus {
+    var status *ReplicationStatus
+    if l := c.replication; l != nil {
+        status = &ReplicationStatus{Role: "primary", Replicas: []ReplicaLag{}}
+        status.Seq, status.OldestSeq = l.status()
+        l.mutex.Lock()
+        for s := range l.streams {
+            sent := s.sent.Load()
+            status.Replicas = append(status.Replicas, ReplicaLag{Addr: s.addr, SentSeq: sent, SeqLag: status.Seq - min(sent, status.Seq)})
+        }
+        l.mutex.Unlock()
+    }
+    if r := c.replica.Load(); r != nil {
+        if status == nil {
+            status = &ReplicationStatus{}
+        }
+        status.Role = "replica"
+        status.Primary = r.primary
+        status.Connected = r.connected.Load()
+        status.AppliedSeq = r.appliedSeq.Load()
+        status.PrimarySeq = max(r.primarySeq.Load(), status.AppliedSeq)
+        status.SeqLag = status.PrimarySeq - status.AppliedSeq
+        if status.SeqLag > 0 {
+            status.TimeLagSeconds = time.Duration(r.primaryTime.Load() - r.appliedTime.Load()).Seconds()
+        }
+    }
+    return status
+}
+
+// replicationSnapshotHandler serves GET /replication/snapshot, a JSON
+// snapshot of the live entries with the sequence number of the last write
+// it includes in the X-Replication-Seq header.
+func replicationSnapshotHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if cache.replication == nil {
+            c.JSON(http.StatusNotFound, gin.H{"error": "replication is disabled"})
+            return
+        }
+        // Writes are numbered under the write lock, so the entries and
+        // the sequence number read under the read lock agree.
+        cache.mutex.RLock()
+        entries := cache.liveEntries()
+        seq, _ := cache.replication.status()
+        cache.mutex.RUnlock()
+
+        c.Header("Content-Type", "application/json")
+        c.Header("X-Replication-Seq", strconv.FormatUint(seq, 10))
+        c.Status(http.StatusOK)
+        if _, err := encodeJSONSnapshot(c.Writer, entries); err != nil {
+            slog.Warn("replication snapshot failed", "error", err)
+        }
+    }
+}
+
+// replicationStreamHandler serves GET /replication/stream?since=N, a
+// stream of JSON lines holding every write after N as a
+// ReplicationRecord, then each write as it happens, with a heartbeat
+// every replicationHeartbeat while idle. It answers 410 Gone if the writes
+// after N are no longer kept, and ends the stream if the replica falls
+// that far behind, in both cases telling it to sync in full again. The
+// stream ends once done is closed.
+func replicationStreamHandler(cache *LRUCache, done <-chan struct{}) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        log := cache.replication
+        if log == nil {
+            c.JSON(http.StatusNotFound, gin.H{"error": "replication is disabled"})
+            return
+        }
+        since, err := strconv.ParseUint(c.DefaultQuery("since", "0"), 10, 64)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "since", Reason: "must be a sequence number"}}})
+            return
+        }
+        records, notify, latest, ok := log.since(since)
+        if !ok {
+            c.JSON(http.StatusGone, gin.H{"error": "writes since " + strconv.FormatUint(since, 10) + " are no longer available", "seq": latest})
+            return
+        }
+
+        stream := &replicationStream{addr: c.ClientIP()}
+        stream.sent.Store(since)
+        log.addStream(stream)
+        defer log.removeStream(stream)
+
+        c.Header("Content-Type", "application/x-ndjson")
+        c.Status(http.StatusOK)
+        encoder := json.NewEncoder(c.Writer)
+        heartbeat := time.NewTicker(replicationHeartbeat)
+        defer heartbeat.Stop()
+        for {
+            for _, record := range records {
+                if err := encoder.Encode(record); err != nil {
+                    return
+                }
+                since = record.Seq
+            }
+            stream.sent.Store(since)
+            c.Writer.Flush()
+
+            select {
+            case <-notify:
+            case <-heartbeat.C:
+                if err := encoder.Encode(ReplicationRecord{Seq: latest, Time: time.Now(), Op: "heartbeat"}); err != nil {
+                    return
+                }
+                c.Writer.Flush()
+            case <-c.Request.Context().Done():
+                return
+            case <-done:
+                return
+            }
+            if records, notify, latest, ok = log.since(since); !ok {
+                return
+            }
+        }
+    }
+}
+
+// replicaState tracks a replica's progress. The times are in Unix
+// nanoseconds, as stamped by the primary.
+type replicaState struct {
+    primary     string
+    apiKey      string
+    client      *http.Client
+    connected   atomic.Bool
+    appliedSeq  atomic.Uint64
+    appliedTime atomic.Int64
+    primarySeq  atomic.Uint64
+    primaryTime atomic.Int64
+}
+
+// errResync means the replica must sync in full before tailing again.
+var errResync = errors.New("replica must resync")
+
+// StartReplica makes the cache a replica of the primary cache server at
+// primaryURL until the returned stop function is called. It loads a full
+// snapshot from the primary, then tails its writes and applies them in
+// order, reconnecting with backoff whenever the stream breaks and syncing
+// in full again when writes were missed. apiKey is sent in the X-API-Key
+// header and must be the primary's admin key if it has one.
+//
+// While it is a replica the cache rejects writes with ErrReplica, and it
+// never evicts entries on its own: it holds exactly the primary's entries,
+// removing them as the primary's evictions and deletions arrive, so it
+// should be given at least the primary's capacity.
+func (c *LRUCache) StartReplica(primaryURL, apiKey string) (stop func()) {
+    r := &replicaState{primary: primaryURL, apiKey: apiKey, client: &http.Client{}}
+    c.replica.Store(r)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        resync, backoff := true, time.Second
+        for ctx.Err() == nil {
+            var err error
+            if resync {
+                err = c.syncFromPrimary(ctx, r)
+            }
+            if err == nil {
+                resync = false
+                err = c.tailPrimary(ctx, r, func() { backoff = time.Second })
+            }
+            r.connected.Store(false)
+            if ctx.Err() != nil {
+                return
+            }
+            if errors.Is(err, errResync) {
+                resync = true
+                slog.Warn("replica resyncing from primary", "primary", primaryURL, "error", err)
+                continue
+            }
+            slog.Warn("replication from primary interrupted", "primary", primaryURL, "error", err, "retry_in", backoff)
+            select {
+            case <-time.After(backoff):
+            case <-ctx.Done():
+                return
+            }
+            backoff = min(2*backoff, replicaMaxBackoff)
+        }
+    }()
+
+    return func() {
+        cancel()
+        <-done
+        c.replica.Store(nil)
+    }
+}
+
+// replicationGet requests path from the primary.
+func (r *replicaState) replicationGet(ctx context.Context, path string) (*http.Response, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.primary+path, nil)
+    if err != nil {
+        return nil, err
+    }
+    if r.apiKey != "" {
+        req.Header.Set("X-API-Key", r.apiKey)
+    }
+    return r.client.Do(req)
+}
+
+// syncFromPrimary replaces the cache's contents with a snapshot of the
+// primary's.
+func (c *LRUCache) syncFromPrimary(ctx context.Context, r *replicaState) error {
+    resp, err := r.replicationGet(ctx, "/replication/snapshot")
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("snapshot: unexpected status %s", resp.Status)
+    }
+    seq, err := strconv.ParseUint(resp.Header.Get("X-Replication-Seq"), 10, 64)
+    if err != nil {
+        return fmt.Errorf("snapshot: bad X-Replication-Seq: %w", err)
+    }
+    restored, _, err := c.loadSnapshot(resp.Body)
+    if err != nil {
+        return err
+    }
+    now := time.Now().UnixNano()
+    r.appliedSeq.Store(seq)
+    r.appliedTime.Store(now)
+    r.primarySeq.Store(seq)
+    r.primaryTime.Store(now)
+    slog.Info("replica synced from primary", "primary", r.primary, "seq", seq, "entries", restored)
+    return nil
+}
+
+// tailPrimary applies the primary's writes after the last one applied
+// until the stream ends, calling connected once it is established.
+func (c *LRUCache) tailPrimary(ctx context.Context, r *replicaState, connected func()) error {
+    resp, err := r.replicationGet(ctx, "/replication/stream?since="+url.QueryEscape(strconv.FormatUint(r.appliedSeq.Load(), 10)))
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    switch resp.StatusCode {
+    case http.StatusOK:
+    case http.StatusGone:
+        return errResync
+    default:
+        return fmt.Errorf("stream: unexpected status %s", resp.Status)
+    }
+    r.connected.Store(true)
+    connected()
+
+    reader := bufio.NewReader(resp.Body)
+    for {
+        line, err := reader.ReadBytes('\n')
+        if err != nil {
+            if err == io.EOF {
+                err = io.ErrUnexpectedEOF
+            }
+            return err
+        }
+        var record ReplicationRecord
+        if err := json.Unmarshal(line, &record); err != nil {
+            return fmt.Errorf("stream: %w", err)
+        }
+        if record.Seq > r.primarySeq.Load() {
+            r.primarySeq.Store(record.Seq)
+            r.primaryTime.Store(record.Time.UnixNano())
+        }
+        if record.Op == "heartbeat" {
+            continue
+        }
+        if applied := r.appliedSeq.Load(); record.Seq != applied+1 {
+            return fmt.Errorf("%w: got write %d after %d", errResync, record.Seq, applied)
+        }
+        var value interface{}
+        if record.Op == "set" {
+            if err := json.Unmarshal(record.Value, &value); err != nil {
+                return fmt.Errorf("%w: write %d: %w", errResync, record.Seq, err)
+            }
+        }
+        c.mutex.Lock()
+        c.applyRecord(aofRecord{Op: record.Op, Key: record.Key, Expiration: record.Expiration}, value, c.now())
+        c.unlock()
+        r.appliedSeq.Store(record.Seq)
+        r.appliedTime.Store(record.Time.UnixNano())
+    }
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "sort"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// replicationPrimary serves the replication endpoints of a cache. While
+// down is set it answers every request with 503. snapshots counts the full
+// syncs served.
+type replicationPrimary struct {
+    *httptest.Server
+    down      atomic.Bool
+    snapshots atomic.Int32
+}
+
+func startReplicationPrimary(t *testing.T, cache *LRUCache) *replicationPrimary {
+    gin.SetMode(gin.TestMode)
+    p := &replicationPrimary{}
+    done := make(chan struct{})
+    router := gin.New()
+    router.Use(func(c *gin.Context) {
+        if p.down.Load() {
+            c.AbortWithStatus(http.StatusServiceUnavailable)
+        }
+    })
+    snapshot := replicationSnapshotHandler(cache)
+    router.GET("/replication/snapshot", func(c *gin.Context) {
+        p.snapshots.Add(1)
+        snapshot(c)
+    })
+    router.GET("/replication/stream", replicationStreamHandler(cache, done))
+    p.Server = httptest.NewServer(router)
+    t.Cleanup(func() {
+        close(done)
+        p.Close()
+    })
+    return p
+}
+
+// sortedContents is cacheContents in key order, as a replica applies the
+// primary's writes but not its reads, so recency may differ.
+func sortedContents(cache *LRUCache) string {
+    entries := strings.Fields(cacheContents(cache))
+    sort.Strings(entries)
+    return strings.Join(entries, " ")
+}
+
+// waitForReplica waits until replica has applied every write of primary
+// and holds the same entries.
+func waitForReplica(t *testing.T, primary, replica *LRUCache) {
+    t.Helper()
+    waitUntil(t, "the replica to catch up", func() bool {
+        seq, _ := primary.replication.status()
+        status := replica.ReplicationStatus()
+        return status.Connected && status.AppliedSeq == seq
+    })
+    if got, want := sortedContents(replica), sortedContents(primary); got != want {
+        t.Fatalf("replica holds\n%s\nprimary holds\n%s", got, want)
+    }
+}
+
+func TestReplicaConvergesAfterBurst(t *testing.T) {
+    primary := NewLRUCache(50, WithReplicationLog(1000))
+    for i := 0; i < 10; i++ {
+        primary.Set(fmt.Sprintf("before:%d", i), fmt.Sprint(i), time.Hour)
+    }
+    server := startReplicationPrimary(t, primary)
+    replica := NewLRUCache(50)
+    stop := replica.StartReplica(server.URL, "")
+    defer stop()
+    waitForReplica(t, primary, replica)
+
+    // A burst of concurrent writes, deletions and evictions.
+    var wg sync.WaitGroup
+    for w := 0; w < 4; w++ {
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            for i := 0; i < 50; i++ {
+                key := fmt.Sprintf("burst:%d:%d", w, i)
+                primary.Set(key, key, 0)
+                if i%5 == 0 {
+                    primary.Delete(key)
+                }
+            }
+        }(w)
+    }
+    wg.Wait()
+    waitForReplica(t, primary, replica)
+
+    primary.ClearCache()
+    primary.Set("after", "clear", 0)
+    waitForReplica(t, primary, replica)
+    if n := server.snapshots.Load(); n != 1 {
+        t.Fatalf("%d full syncs, want 1", n)
+    }
+
+    // The replica rejects writes of its own.
+    if err := replica.Set("local", 1, 0); !errors.Is(err, ErrReplica) {
+        t.Fatalf("Set on a replica = %v, want ErrReplica", err)
+    }
+
+    status := primary.ReplicationStatus()
+    if status.Role != "primary" || len(status.Replicas) != 1 || status.Replicas[0].SeqLag != 0 {
+        t.Fatalf("primary status = %+v", status)
+    }
+    status = replica.ReplicationStatus()
+    if status.Role != "replica" || status.SeqLag != 0 || status.TimeLagSeconds != 0 || status.Primary != server.URL {
+        t.Fatalf("replica status = %+v", status)
+    }
+}
+
+func TestReplicaReconnects(t *testing.T) {
+    for _, tc := range []struct {
+        name      string
+        logSize   int
+        snapshots int32
+    }{
+        // The writes missed are still in the log, so tailing resumes.
+        {"resume", 1000, 1},
+        // They are not, so the replica syncs in full again.
+        {"resync", 5, 2},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            primary := NewLRUCache(100, WithReplicationLog(tc.logSize))
+            server := startReplicationPrimary(t, primary)
+            replica := NewLRUCache(100)
+            stop := replica.StartReplica(server.URL, "")
+            defer stop()
+            primary.Set("a", "1", 0)
+            waitForReplica(t, primary, replica)
+
+            server.down.Store(true)
+            server.CloseClientConnections()
+            waitUntil(t, "the replica to disconnect", func() bool { return !replica.ReplicationStatus().Connected })
+            for i := 0; i < 20; i++ {
+                primary.Set(fmt.Sprint(i), fmt.Sprint(i), 0)
+            }
+            primary.Delete("a")
+            if value := replica.Get("a"); value != "1" {
+                t.Fatalf("disconnected replica has a = %v, want 1", value)
+            }
+
+            server.down.Store(false)
+            waitForReplica(t, primary, replica)
+            if n := server.snapshots.Load(); n != tc.snapshots {
+                t.Fatalf("%d full syncs, want %d", n, tc.snapshots)
+            }
+        })
+    }
+}
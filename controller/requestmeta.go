@@ -0,0 +1,79 @@
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+
+    "github.com/gin-gonic/gin"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// RequestMeta identifies the request behind a cache operation, for tracing
+// and auditing. It travels in the context given to GetCtx and SetCtx and
+// is passed to the WithOnEvict callback for the entries a write evicts.
+type RequestMeta struct {
+    TraceID string `json:"trace_id,omitempty"`
+    UserID  string `json:"user_id,omitempty"`
+}
+
+type requestMetaKey struct{}
+
+// WithRequestMeta returns a copy of ctx carrying meta.
+func WithRequestMeta(ctx context.Context, meta RequestMeta) context.Context {
+    return context.WithValue(ctx, requestMetaKey{}, meta)
+}
+
+// RequestMetaFrom returns the RequestMeta carried by ctx, or nil if it
+// carries none.
+func RequestMetaFrom(ctx context.Context) *RequestMeta {
+    if meta, ok := ctx.Value(requestMetaKey{}).(RequestMeta); ok {
+        return &meta
+    }
+    return nil
+}
+
+// WithOnEvict calls fn outside the lock with every entry evicted for
+// capacity. When the eviction was caused by a GetCtx or SetCtx whose
+// context carries a RequestMeta, meta is that request's; otherwise it is
+// nil.
+func WithOnEvict(fn func(key string, value interface{}, meta *RequestMeta)) Option {
+    return func(c *LRUCache) {
+        c.evictCallback = fn
+    }
+}
+
+// requestMetaMiddleware attaches a RequestMeta to every request's context.
+// TraceID is taken from the X-Request-ID header, then from the request's
+// span when tracing is enabled, and is generated otherwise; it is echoed
+// in the X-Request-ID response header. UserID is the X-User-ID header, or
+// the role of the key presented when there is none.
+func requestMetaMiddleware(auth authConfig) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        ctx := c.Request.Context()
+        meta := RequestMeta{TraceID: c.GetHeader("X-Request-ID"), UserID: c.GetHeader("X-User-ID")}
+        if meta.TraceID == "" {
+            if span := trace.SpanContextFromContext(ctx); span.HasTraceID() {
+                meta.TraceID = span.TraceID().String()
+            } else {
+                var b [16]byte
+                rand.Read(b[:])
+                meta.TraceID = hex.EncodeToString(b[:])
+            }
+        }
+        if meta.UserID == "" {
+            meta.UserID = auth.role(c)
+        }
+        c.Header("X-Request-ID", meta.TraceID)
+        c.Request = c.Request.WithContext(WithRequestMeta(ctx, meta))
+    }
+}
+
+// slogAttrs returns meta as key-value pairs for slog, or nothing if meta
+// is nil.
+func (meta *RequestMeta) slogAttrs() []any {
+    if meta == nil {
+        return nil
+    }
+    return []any{"trace_id", meta.TraceID, "user_id", meta.UserID}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// respMaxBulkLength and respMaxArrayLength bound the requests the RESP
+// listener accepts, as Redis does.
+const (
+    respMaxBulkLength  = 512 << 20
+    respMaxArrayLength = 1 << 20
+)
+
+// errRESPSyntax is the reply to a malformed command.
+var errRESPSyntax = errors.New("ERR syntax error")
+
+// respServer serves a subset of the Redis protocol (RESP2) over the cache:
+// GET, SET with EX/PX/NX/XX, DEL, EXISTS, TTL, EXPIRE, FLUSHALL, PING and
+// QUIT. Values written through it are stored as strings; other values are
+// returned encoded as JSON.
+type respServer struct {
+    cache *LRUCache
+}
+
+// StartRESP listens for Redis protocol clients on addr, serving them from
+// the cache. The returned stop function closes the listener, lets every
+// connection finish the command it is running and waits for them to exit.
+func (c *LRUCache) StartRESP(addr string) (stop func(), err error) {
+    s := &respServer{cache: c}
+    return startTCPServer("RESP", addr, s.serve)
+}
+
+// serve serves one connection. Replies are buffered and flushed once no
+// more pipelined commands are waiting.
+func (s *respServer) serve(r *bufio.Reader, w *bufio.Writer) {
+    for {
+        args, err := readRESPCommand(r)
+        if err != nil {
+            if !isDisconnect(err) {
+                writeRESPError(w, "ERR Protocol error: "+err.Error())
+                w.Flush()
+            }
+            return
+        }
+        if len(args) == 0 {
+            continue
+        }
+        quit := strings.EqualFold(args[0], "QUIT")
+        if quit {
+            w.WriteString("+OK\r\n")
+        } else {
+            s.execute(w, args)
+        }
+        if r.Buffered() == 0 || quit {
+            if err := w.Flush(); err != nil || quit {
+                return
+            }
+        }
+    }
+}
+
+// readRESPCommand reads a command sent as an array of bulk strings, as
+// clients do, or as an inline command line, as typed into telnet.
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+    line, err := readRESPLine(r)
+    if err != nil {
+        return nil, err
+    }
+    if !strings.HasPrefix(line, "*") {
+        return strings.Fields(line), nil
+    }
+
+    n, err := strconv.Atoi(line[1:])
+    if err != nil || n > respMaxArrayLength {
+        return nil, fmt.Errorf("invalid multibulk length")
+    }
+    args := make([]string, 0, max(n, 0))
+    for i := 0; i < n; i++ {
+        line, err := readRESPLine(r)
+        if err != nil {
+            return nil, err
+        }
+        if !strings.HasPrefix(line, "$") {
+            return nil, fmt.Errorf("expected '$', got '%.1s'", line)
+        }
+        size, err := strconv.Atoi(line[1:])
+        if err != nil || size < 0 || size > respMaxBulkLength {
+            return nil, fmt.Errorf("invalid bulk length")
+        }
+        data := make([]byte, size+2)
+        if _, err := io.ReadFull(r, data); err != nil {
+            return nil, err
+        }
+        args = append(args, string(data[:size]))
+    }
+    return args, nil
+}
+
+// readRESPLine reads a line terminated by CRLF, or by a bare LF as inline
+// commands may be.
+func readRESPLine(r *bufio.Reader) (string, error) {
+    line, err := r.ReadString('\n')
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// execute runs one command and writes its reply.
+func (s *respServer) execute(w *bufio.Writer, args []string) {
+    c := s.cache
+    name := strings.ToUpper(args[0])
+    arity := func(min int) bool {
+        if len(args) < min {
+            writeRESPError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+            return false
+        }
+        return true
+    }
+
+    switch name {
+    case "PING":
+        if len(args) > 1 {
+            writeRESPBulk(w, args[1])
+        } else {
+            w.WriteString("+PONG\r\n")
+        }
+
+    case "GET":
+        if !arity(2) {
+            return
+        }
+        value, err := c.GetCtx(context.Background(), args[1])
+        if err != nil {
+            w.WriteString("$-1\r\n")
+            return
+        }
+        writeRESPBulk(w, respString(value))
+
+    case "SET":
+        if !arity(3) {
+            return
+        }
+        ttl, condition, err := parseRESPSetOptions(args[3:])
+        if err != nil {
+            writeRESPError(w, err.Error())
+            return
+        }
+        stored, err := c.setIf(args[1], args[2], ttl, condition)
+        switch {
+        case err != nil:
+            writeRESPCacheError(w, err)
+        case stored:
+            w.WriteString("+OK\r\n")
+        default:
+            w.WriteString("$-1\r\n")
+        }
+
+    case "DEL":
+        if !arity(2) {
+            return
+        }
+        deleted := 0
+        for _, key := range args[1:] {
+            ok, err := c.Delete(key)
+            if err != nil {
+                writeRESPCacheError(w, err)
+                return
+            }
+            if ok {
+                deleted++
+            }
+        }
+        writeRESPInt(w, int64(deleted))
+
+    case "EXISTS":
+        if !arity(2) {
+            return
+        }
+        found := 0
+        for _, key := range args[1:] {
+            if c.ContainsKey(key) {
+                found++
+            }
+        }
+        writeRESPInt(w, int64(found))
+
+    case "TTL":
+        if !arity(2) {
+            return
+        }
+        ttl, ok := c.TTL(args[1])
+        switch {
+        case !ok:
+            writeRESPInt(w, -2)
+        case ttl == 0:
+            writeRESPInt(w, -1)
+        default:
+            writeRESPInt(w, int64((ttl+time.Second/2)/time.Second))
+        }
+
+    case "EXPIRE":
+        if !arity(3) {
+            return
+        }
+        seconds, err := strconv.ParseInt(args[2], 10, 64)
+        if err != nil {
+            writeRESPError(w, "ERR value is not an integer or out of range")
+            return
+        }
+        // As in Redis, a non-positive timeout deletes the key.
+        if seconds <= 0 {
+            deleted, err := c.Delete(args[1])
+            if err != nil {
+                writeRESPCacheError(w, err)
+                return
+            }
+            writeRESPBool(w, deleted)
+            return
+        }
+        touched, err := c.TouchMany(args[1:2], time.Duration(seconds)*time.Second)
+        if err != nil {
+            writeRESPCacheError(w, err)
+            return
+        }
+        writeRESPBool(w, touched == 1)
+
+    case "FLUSHALL":
+        if err := c.ClearCache(); err != nil {
+            writeRESPCacheError(w, err)
+            return
+        }
+        w.WriteString("+OK\r\n")
+
+    default:
+        writeRESPError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+    }
+}
+
+// setCondition restricts a write to keys that are missing or present.
+type setCondition int
+
+const (
+    setAlways setCondition = iota
+    setIfMissing
+    setIfPresent
+)
+
+// parseRESPSetOptions parses the options following SET key value.
+func parseRESPSetOptions(opts []string) (ttl time.Duration, condition setCondition, err error) {
+    for i := 0; i < len(opts); i++ {
+        switch opt := strings.ToUpper(opts[i]); opt {
+        case "NX", "XX":
+            if condition != setAlways {
+                return 0, 0, errRESPSyntax
+            }
+            condition = setIfMissing
+            if opt == "XX" {
+                condition = setIfPresent
+            }
+        case "EX", "PX":
+            if ttl != 0 || i+1 == len(opts) {
+                return 0, 0, errRESPSyntax
+            }
+            i++
+            n, err := strconv.ParseInt(opts[i], 10, 64)
+            if err != nil || n <= 0 {
+                return 0, 0, errors.New("ERR invalid expire time in 'set' command")
+            }
+            ttl = time.Duration(n) * time.Millisecond
+            if opt == "EX" {
+                ttl = time.Duration(n) * time.Second
+            }
+        default:
+            return 0, 0, errRESPSyntax
+        }
+    }
+    return ttl, condition, nil
+}
+
+// setIf is like Set but, unless condition is setAlways, only stores the
+// value if a live entry for key is missing or present as required. It
+// reports whether the value was stored.
+func (c *LRUCache) setIf(key string, value interface{}, ttl time.Duration, condition setCondition) (bool, error) {
+    if condition == setAlways {
+        return true, c.Set(key, value, ttl)
+    }
+    if err := c.checkWritable("set", key); err != nil {
+        return false, err
+    }
+
+    c.mutex.Lock()
+    defer c.unlock()
+
+    element, ok := c.cache[key]
+    present := ok && !element.Value.(*cacheEntry).expired(c.now())
+    if present != (condition == setIfPresent) {
+        return false, nil
+    }
+    c.set(key, value, c.expirationTime(ttl))
+    return true, nil
+}
+
+// TTL returns the time left before key expires, zero if it never expires,
+// and whether a live entry for key exists.
+func (c *LRUCache) TTL(key string) (time.Duration, bool) {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    element, ok := c.cache[key]
+    if !ok {
+        return 0, false
+    }
+    entry := element.Value.(*cacheEntry)
+    now := c.now()
+    if entry.expired(now) {
+        return 0, false
+    }
+    if entry.expiration.IsZero() {
+        return 0, true
+    }
+    return entry.expiration.Sub(now), true
+}
+
+// respString returns value as a RESP bulk string: strings and byte slices
+// as they are, anything else as JSON.
+func respString(value interface{}) string {
+    switch v := value.(type) {
+    case string:
+        return v
+    case []byte:
+        return string(v)
+    }
+    data, err := json.Marshal(value)
+    if err != nil {
+        return fmt.Sprint(value)
+    }
+    return string(data)
+}
+
+func writeRESPBulk(w *bufio.Writer, s string) {
+    fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func writeRESPInt(w *bufio.Writer, n int64) {
+    fmt.Fprintf(w, ":%d\r\n", n)
+}
+
+func writeRESPBool(w *bufio.Writer, b bool) {
+    if b {
+        writeRESPInt(w, 1)
+    } else {
+        writeRESPInt(w, 0)
+    }
+}
+
+// writeRESPError writes msg, which starts with an error code such as ERR,
+// as an error reply.
+func writeRESPError(w *bufio.Writer, msg string) {
+    w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(msg) + "\r\n")
+}
+
+// writeRESPCacheError writes an error returned by a cache operation.
+func writeRESPCacheError(w *bufio.Writer, err error) {
+    if errors.Is(err, ErrReadOnly) {
+        writeRESPError(w, "READONLY "+err.Error())
+        return
+    }
+    writeRESPError(w, "ERR "+err.Error())
+}
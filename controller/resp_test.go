@@ -0,0 +1,219 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// freeAddr returns a local address that was free a moment ago.
+func freeAddr(t *testing.T) string {
+    t.Helper()
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer ln.Close()
+    return ln.Addr().String()
+}
+
+// startRESPForTest starts a RESP listener for cache, stopped when the test
+// ends, and returns its address.
+func startRESPForTest(t *testing.T, cache *LRUCache) string {
+    t.Helper()
+    addr := freeAddr(t)
+    stop, err := cache.StartRESP(addr)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(stop)
+    return addr
+}
+
+// rawConn is a raw client connection to one of the wire protocol
+// listeners.
+type rawConn struct {
+    t    *testing.T
+    conn net.Conn
+    r    *bufio.Reader
+}
+
+func dialRaw(t *testing.T, addr string) *rawConn {
+    t.Helper()
+    conn, err := net.Dial("tcp", addr)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    conn.SetDeadline(time.Now().Add(5 * time.Second))
+    return &rawConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send writes raw to the connection.
+func (c *rawConn) send(raw string) {
+    c.t.Helper()
+    if _, err := c.conn.Write([]byte(raw)); err != nil {
+        c.t.Fatal(err)
+    }
+}
+
+// reply reads one RESP reply, returning it as sent with the payload of a
+// bulk string joined to its header, e.g. "$3\r\nbar\r\n".
+func (c *rawConn) reply() string {
+    c.t.Helper()
+    line, err := c.r.ReadString('\n')
+    if err != nil {
+        c.t.Fatal(err)
+    }
+    if !strings.HasPrefix(line, "$") || strings.HasPrefix(line, "$-1") {
+        return line
+    }
+    n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+    if err != nil {
+        c.t.Fatalf("bad bulk header %q", line)
+    }
+    data := make([]byte, n+2)
+    if _, err := io.ReadFull(c.r, data); err != nil {
+        c.t.Fatal(err)
+    }
+    return line + string(data)
+}
+
+// command sends args as a RESP array and returns the reply.
+func (c *rawConn) command(args ...string) string {
+    c.t.Helper()
+    var b strings.Builder
+    fmt.Fprintf(&b, "*%d\r\n", len(args))
+    for _, arg := range args {
+        fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+    }
+    c.send(b.String())
+    return c.reply()
+}
+
+func TestRESPCommands(t *testing.T) {
+    cache := NewLRUCache(10, WithClock(newFakeClock().Now))
+    cache.Set("json", map[string]interface{}{"n": 1}, 0)
+    c := dialRaw(t, startRESPForTest(t, cache))
+
+    for _, tc := range []struct {
+        args []string
+        want string
+    }{
+        {[]string{"PING"}, "+PONG\r\n"},
+        {[]string{"ping", "hi"}, "$2\r\nhi\r\n"},
+        {[]string{"GET", "foo"}, "$-1\r\n"},
+        {[]string{"SET", "foo", "bar"}, "+OK\r\n"},
+        {[]string{"GET", "foo"}, "$3\r\nbar\r\n"},
+        {[]string{"GET", "json"}, "$7\r\n{\"n\":1}\r\n"},
+        {[]string{"SET", "foo", "baz", "NX"}, "$-1\r\n"},
+        {[]string{"SET", "new", "v", "XX"}, "$-1\r\n"},
+        {[]string{"SET", "foo", "baz", "XX", "EX", "100"}, "+OK\r\n"},
+        {[]string{"TTL", "foo"}, ":100\r\n"},
+        {[]string{"SET", "px", "v", "PX", "1500"}, "+OK\r\n"},
+        {[]string{"TTL", "px"}, ":2\r\n"},
+        {[]string{"TTL", "json"}, ":-1\r\n"},
+        {[]string{"TTL", "missing"}, ":-2\r\n"},
+        {[]string{"EXPIRE", "json", "50"}, ":1\r\n"},
+        {[]string{"EXPIRE", "missing", "50"}, ":0\r\n"},
+        {[]string{"EXISTS", "foo", "json", "missing", "foo"}, ":3\r\n"},
+        {[]string{"DEL", "foo", "missing"}, ":1\r\n"},
+        {[]string{"SET", "k", "v", "EX", "0"}, "-ERR invalid expire time in 'set' command\r\n"},
+        {[]string{"SET", "k", "v", "NX", "XX"}, "-ERR syntax error\r\n"},
+        {[]string{"GET"}, "-ERR wrong number of arguments for 'get' command\r\n"},
+        {[]string{"HGET", "h", "f"}, "-ERR unknown command 'HGET'\r\n"},
+        {[]string{"FLUSHALL"}, "+OK\r\n"},
+        {[]string{"EXISTS", "json", "px"}, ":0\r\n"},
+    } {
+        if got := c.command(tc.args...); got != tc.want {
+            t.Fatalf("%q = %q, want %q", tc.args, got, tc.want)
+        }
+    }
+}
+
+func TestRESPInlineAndPipelined(t *testing.T) {
+    cache := NewLRUCache(10)
+    c := dialRaw(t, startRESPForTest(t, cache))
+
+    c.send("SET a 1\r\nGET a\nPING\r\n")
+    for _, want := range []string{"+OK\r\n", "$1\r\n1\r\n", "+PONG\r\n"} {
+        if got := c.reply(); got != want {
+            t.Fatalf("reply = %q, want %q", got, want)
+        }
+    }
+    if cache.Get("a") != "1" {
+        t.Fatalf("a = %#v, want the string 1", cache.Get("a"))
+    }
+
+    cache.SetReadOnly(true)
+    if got := c.command("SET", "b", "2"); !strings.HasPrefix(got, "-READONLY ") {
+        t.Fatalf("SET on a read-only cache = %q", got)
+    }
+
+    c.send("QUIT\r\n")
+    if got := c.reply(); got != "+OK\r\n" {
+        t.Fatalf("QUIT = %q", got)
+    }
+    if _, err := c.r.ReadByte(); err == nil {
+        t.Fatal("the connection stayed open after QUIT")
+    }
+}
+
+func TestRESPConcurrentClientsAndStop(t *testing.T) {
+    cache := NewLRUCache(1000)
+    addr := freeAddr(t)
+    stop, err := cache.StartRESP(addr)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    const clients = 20
+    var wg sync.WaitGroup
+    for i := 0; i < clients; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            c := dialRaw(t, addr)
+            key := fmt.Sprint("k", i)
+            for j := 0; j < 50; j++ {
+                if got := c.command("SET", key, fmt.Sprint(j)); got != "+OK\r\n" {
+                    t.Errorf("SET = %q", got)
+                    return
+                }
+                if got, want := c.command("GET", key), fmt.Sprintf("$%d\r\n%d\r\n", len(fmt.Sprint(j)), j); got != want {
+                    t.Errorf("GET = %q, want %q", got, want)
+                    return
+                }
+            }
+        }(i)
+    }
+    wg.Wait()
+    if cache.Len() != clients {
+        t.Fatalf("cache holds %d entries, want %d", cache.Len(), clients)
+    }
+
+    // An idle connection does not keep stop waiting.
+    idle := dialRaw(t, addr)
+    if got := idle.command("PING"); got != "+PONG\r\n" {
+        t.Fatalf("PING = %q", got)
+    }
+    stopped := make(chan struct{})
+    go func() {
+        stop()
+        close(stopped)
+    }()
+    select {
+    case <-stopped:
+    case <-time.After(5 * time.Second):
+        t.Fatal("stop did not return")
+    }
+    if _, err := net.Dial("tcp", addr); err == nil {
+        t.Fatal("the listener accepted a connection after stop")
+    }
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+    "context"
+    "math/rand/v2"
+    "sync"
+    "time"
+)
+
+// LoaderRetry configures how failed loader calls are retried. Delays grow
+// from BaseDelay by Factor after every attempt, capped at MaxDelay, and are
+// randomized by up to Jitter (a fraction of the delay) in either direction.
+// When NegativeTTL is positive, a key whose load failed after every attempt
+// is not loaded again for that long; lookups get the last error instead.
+type LoaderRetry struct {
+    MaxAttempts int
+    BaseDelay   time.Duration
+    MaxDelay    time.Duration
+    Factor      float64
+    Jitter      float64
+    NegativeTTL time.Duration
+}
+
+// delay returns how long to wait before the attempt following attempt,
+// counting from 1.
+func (r LoaderRetry) delay(attempt int) time.Duration {
+    factor := r.Factor
+    if factor <= 0 {
+        factor = 2
+    }
+    d := float64(r.BaseDelay)
+    for i := 1; i < attempt; i++ {
+        d *= factor
+        if r.MaxDelay > 0 && d > float64(r.MaxDelay) {
+            d = float64(r.MaxDelay)
+            break
+        }
+    }
+    if r.Jitter > 0 {
+        d *= 1 - r.Jitter + 2*r.Jitter*rand.Float64()
+    }
+    return time.Duration(d)
+}
+
+// callLoader calls the loader for key, retrying failures as configured by
+// c.retry. It gives up early, returning the last error, if ctx is done or
+// its deadline would pass before the next attempt, and at once if the
+// concurrency limit refuses an attempt.
+func (c *LRUCache) callLoader(ctx context.Context, key string) (interface{}, time.Duration, error) {
+    for attempt := 1; ; attempt++ {
+        if err := c.acquireLoadSlot(ctx); err != nil {
+            return nil, 0, err
+        }
+        c.loadsInFlight.Add(1)
+        value, ttl, err := c.loader.Load(ctx, key)
+        c.loadsInFlight.Add(-1)
+        c.releaseLoadSlot()
+        if err == nil || attempt >= c.retry.MaxAttempts {
+            return value, ttl, err
+        }
+
+        wait := c.retry.delay(attempt)
+        if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+            return nil, 0, err
+        }
+        timer := time.NewTimer(wait)
+        select {
+        case <-timer.C:
+        case <-ctx.Done():
+            timer.Stop()
+            return nil, 0, err
+        }
+    }
+}
+
+// negativeCache remembers keys whose load failed, and why, until a
+// deadline.
+type negativeCache struct {
+    mutex   sync.Mutex
+    entries map[string]negativeEntry
+}
+
+type negativeEntry struct {
+    err   error
+    until time.Time
+}
+
+// get returns the remembered error for key, if it has not expired.
+func (n *negativeCache) get(key string) error {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+
+    entry, ok := n.entries[key]
+    if !ok {
+        return nil
+    }
+    if time.Now().After(entry.until) {
+        delete(n.entries, key)
+        return nil
+    }
+    return entry.err
+}
+
+// put remembers err for key for ttl.
+func (n *negativeCache) put(key string, err error, ttl time.Duration) {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+
+    if n.entries == nil {
+        n.entries = make(map[string]negativeEntry)
+    }
+    n.entries[key] = negativeEntry{err: err, until: time.Now().Add(ttl)}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// flakyLoader fails its first failures calls and then returns the key.
+func flakyLoader(failures int32, calls *atomic.Int32) Loader {
+    return LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        if calls.Add(1) <= failures {
+            return nil, 0, errors.New("backend unavailable")
+        }
+        return key, 0, nil
+    })
+}
+
+func TestLoaderRetrySucceedsAfterFailures(t *testing.T) {
+    var calls atomic.Int32
+    cache := NewLRUCache(10, WithLoader(flakyLoader(2, &calls)), WithLoaderRetry(LoaderRetry{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+
+    if value, err := cache.GetCtx(context.Background(), "k"); value != "k" || err != nil {
+        t.Fatalf("GetCtx = %v, %v; want k, nil", value, err)
+    }
+    if n := calls.Load(); n != 3 {
+        t.Fatalf("loader called %d times, want 3", n)
+    }
+    if !cache.ContainsKey("k") {
+        t.Fatal("the value loaded after retries was not cached")
+    }
+}
+
+func TestLoaderRetryHonoursMaxAttempts(t *testing.T) {
+    var calls atomic.Int32
+    cache := NewLRUCache(10, WithLoader(flakyLoader(5, &calls)), WithLoaderRetry(LoaderRetry{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+
+    if _, err := cache.GetCtx(context.Background(), "k"); !errors.Is(err, ErrBackend) {
+        t.Fatalf("GetCtx error = %v, want ErrBackend", err)
+    }
+    if n := calls.Load(); n != 3 {
+        t.Fatalf("loader called %d times, want 3", n)
+    }
+    if cache.ContainsKey("k") {
+        t.Fatal("a failed load was cached")
+    }
+}
+
+func TestLoaderRetryStopsBeforeDeadline(t *testing.T) {
+    var calls atomic.Int32
+    cache := NewLRUCache(10, WithLoader(flakyLoader(5, &calls)), WithLoaderRetry(LoaderRetry{MaxAttempts: 5, BaseDelay: time.Hour}))
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+
+    start := time.Now()
+    if _, err := cache.GetCtx(ctx, "k"); !errors.Is(err, ErrBackend) {
+        t.Fatalf("GetCtx error = %v, want ErrBackend", err)
+    }
+    if n := calls.Load(); n != 1 || time.Since(start) > 500*time.Millisecond {
+        t.Fatalf("loader called %d times in %v, want one attempt and no wait", n, time.Since(start))
+    }
+}
+
+func TestLoaderRetryNegativeCache(t *testing.T) {
+    var calls atomic.Int32
+    cache := NewLRUCache(10, WithLoader(flakyLoader(2, &calls)), WithLoaderRetry(LoaderRetry{MaxAttempts: 2, BaseDelay: time.Millisecond, NegativeTTL: time.Hour}))
+
+    for i := 0; i < 3; i++ {
+        if _, err := cache.GetCtx(context.Background(), "k"); !errors.Is(err, ErrBackend) {
+            t.Fatalf("GetCtx %d error = %v, want ErrBackend", i, err)
+        }
+    }
+    if n := calls.Load(); n != 2 {
+        t.Fatalf("loader called %d times, want the failure remembered after 2", n)
+    }
+}
+
+func TestRetryPolicy(t *testing.T) {
+    var calls atomic.Int32
+    cache := NewLRUCache(10, WithLoader(flakyLoader(3, &calls)), WithRetryPolicy(4, time.Millisecond))
+    if value, err := cache.GetCtx(context.Background(), "k"); value != "k" || err != nil || calls.Load() != 4 {
+        t.Fatalf("GetCtx = %v, %v after %d calls; want k on the fourth", value, err, calls.Load())
+    }
+
+    // A load failing every attempt is not cached, so the next lookup
+    // retries from the start.
+    calls.Store(0)
+    cache = NewLRUCache(10, WithLoader(flakyLoader(6, &calls)), WithRetryPolicy(3, time.Millisecond))
+    for i, want := range []int32{3, 6} {
+        if _, err := cache.GetCtx(context.Background(), "k"); !errors.Is(err, ErrBackend) || calls.Load() != want {
+            t.Fatalf("GetCtx %d = %v after %d calls, want ErrBackend after %d", i, err, calls.Load(), want)
+        }
+    }
+    if value, err := cache.GetCtx(context.Background(), "k"); value != "k" || err != nil {
+        t.Fatalf("GetCtx once the loader recovers = %v, %v", value, err)
+    }
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+    "sync"
+
+    "github.com/gin-gonic/gin"
+)
+
+// RingCache keeps the last capacity values pushed into it, like a circular
+// buffer. It is backed by an LRUCache keyed by a sequence number; since
+// values are never read back by key, the least recently used entry is
+// always the oldest one.
+type RingCache struct {
+    mutex sync.Mutex
+    cache *LRUCache
+    next  uint64
+}
+
+// NewRingCache returns an empty ring holding at most capacity values.
+func NewRingCache(capacity int) *RingCache {
+    return &RingCache{cache: NewLRUCache(capacity, WithEventLogSize(0), WithAccessLogSize(0))}
+}
+
+// Push appends value, dropping the oldest value if the ring is full.
+func (r *RingCache) Push(value interface{}) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+
+    r.cache.Set(strconv.FormatUint(r.next, 10), value, 0)
+    r.next++
+}
+
+// Range calls f for each value, oldest first, until f returns false. The
+// same restrictions as LRUCache.Range apply: f must not push into the ring.
+func (r *RingCache) Range(f func(value interface{}) bool) {
+    c := r.cache
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    for element := c.list.Back(); element != nil; element = element.Prev() {
+        if !f(element.Value.(*cacheEntry).value) {
+            return
+        }
+    }
+}
+
+// ringHandler serves GET /ringcache, listing the values oldest first.
+func ringHandler(ring *RingCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        values := []interface{}{}
+        ring.Range(func(value interface{}) bool {
+            values = append(values, value)
+            return true
+        })
+        respond(c, http.StatusOK, gin.H{"values": values})
+    }
+}
+
+// ringPushHandler serves POST /ringcache, pushing the "value" field of the
+// request body.
+func ringPushHandler(ring *RingCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var data struct {
+            Value interface{} `json:"value" binding:"required"`
+        }
+        if err := c.ShouldBindJSON(&data); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        ring.Push(data.Value)
+        c.Status(http.StatusOK)
+    }
+}
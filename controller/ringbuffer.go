@@ -0,0 +1,113 @@
+package main
+
+import (
+    "sync"
+    "sync/atomic"
+)
+
+// ringBuffer is a fixed-size buffer keeping the most recently added items.
+// It has its own lock so items can be added without holding the cache
+// lock. A nil ringBuffer records nothing.
+type ringBuffer[T any] struct {
+    mutex sync.Mutex
+    items []T
+    next  int
+    full  bool
+}
+
+// newRingBuffer returns a buffer holding the last size items, or nil when
+// size is not positive.
+func newRingBuffer[T any](size int) *ringBuffer[T] {
+    if size <= 0 {
+        return nil
+    }
+    return &ringBuffer[T]{items: make([]T, size)}
+}
+
+// add appends items, overwriting the oldest ones once the buffer is full.
+func (b *ringBuffer[T]) add(items ...T) {
+    if b == nil || len(items) == 0 {
+        return
+    }
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    for _, item := range items {
+        b.items[b.next] = item
+        b.next++
+        if b.next == len(b.items) {
+            b.next = 0
+            b.full = true
+        }
+    }
+}
+
+// recent returns up to limit items for which match returns true, newest
+// first. A nil match accepts every item.
+func (b *ringBuffer[T]) recent(limit int, match func(T) bool) []T {
+    result := []T{}
+    if b == nil {
+        return result
+    }
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    n := b.next
+    if b.full {
+        n = len(b.items)
+    }
+    for i := 0; i < n && len(result) < limit; i++ {
+        item := b.items[(b.next-1-i+len(b.items))%len(b.items)]
+        if match == nil || match(item) {
+            result = append(result, item)
+        }
+    }
+    return result
+}
+
+// atomicRing is a fixed-size buffer keeping the most recently added items,
+// like ringBuffer, but written without a lock: each add claims a slot by
+// advancing an atomic index and stores a pointer to the item in it. Reads
+// may miss an item whose slot is claimed but not yet stored, or see a slot
+// overwritten by a newer item, which is acceptable for the debugging logs
+// it backs. A nil atomicRing records nothing.
+type atomicRing[T any] struct {
+    slots []atomic.Pointer[T]
+    next  atomic.Uint64
+}
+
+// newAtomicRing returns a buffer holding the last size items, or nil when
+// size is not positive.
+func newAtomicRing[T any](size int) *atomicRing[T] {
+    if size <= 0 {
+        return nil
+    }
+    return &atomicRing[T]{slots: make([]atomic.Pointer[T], size)}
+}
+
+// add appends item, overwriting the oldest one once the buffer is full.
+func (b *atomicRing[T]) add(item T) {
+    if b == nil {
+        return
+    }
+    i := b.next.Add(1) - 1
+    b.slots[i%uint64(len(b.slots))].Store(&item)
+}
+
+// recent returns up to limit items for which match returns true, newest
+// first. A nil match accepts every item.
+func (b *atomicRing[T]) recent(limit int, match func(T) bool) []T {
+    result := []T{}
+    if b == nil {
+        return result
+    }
+    next := b.next.Load()
+    size := uint64(len(b.slots))
+    for i := uint64(0); i < min(next, size) && len(result) < limit; i++ {
+        item := b.slots[(next-1-i)%size].Load()
+        if item != nil && (match == nil || match(*item)) {
+            result = append(result, *item)
+        }
+    }
+    return result
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// noLimits bounds the writes served by ServeHTTP: only the key charset
+// rules apply.
+var noLimits writeLimits
+
+// routeParams holds the values of a route's :name segments.
+type routeParams map[string]string
+
+// cacheRoute is an entry of cacheRoutes: requests with method whose path
+// matches pattern are served by handle. A pattern segment starting with a
+// colon matches any one non-empty path segment, passed to handle under the
+// rest of its name.
+type cacheRoute struct {
+    method  string
+    pattern string
+    handle  func(c *LRUCache, w http.ResponseWriter, r *http.Request, params routeParams)
+}
+
+// cacheRoutes mirrors the /cache routes of the Gin server, relative to
+// /cache. Fixed paths live outside /cache, so no route shadows a key.
+var cacheRoutes = []cacheRoute{
+    {http.MethodGet, "/:key", (*LRUCache).serveGet},
+    {http.MethodGet, "/:key/exists", (*LRUCache).serveExists},
+    {http.MethodGet, "/:key/stats", (*LRUCache).serveKeyStats},
+    {http.MethodPost, "/:key", (*LRUCache).serveSet},
+    {http.MethodDelete, "/", (*LRUCache).serveClear},
+    {http.MethodDelete, "/:key", (*LRUCache).serveDelete},
+}
+
+// ServeHTTP serves the cache's HTTP API, the /cache routes of the Gin
+// server, with paths relative to /cache, so it can be mounted on a
+// standard library mux. Mount it at both /cache and /cache/, or the mux
+// answers DELETE /cache, which clears the cache, with a redirect:
+//
+//   handler := http.StripPrefix("/cache", cache)
+//   mux.Handle("/cache", handler)
+//   mux.Handle("/cache/", handler)
+//
+// Responses are JSON, without the MessagePack negotiation of the Gin
+// routes. The server's middleware and flags do not apply: there is no
+// authentication, key length or expiration limit, lock timeout or audit
+// log, misses are soft only when the request's X-Soft-Miss header says so,
+// and the routes under /cache-views, such as the batch writes, are left
+// out.
+func (c *LRUCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    path := r.URL.Path
+    for _, route := range cacheRoutes {
+        if route.method != r.Method {
+            continue
+        }
+        if params, ok := matchRoute(route.pattern, path); ok {
+            route.handle(c, w, r, params)
+            return
+        }
+    }
+    http.NotFound(w, r)
+}
+
+// matchRoute reports whether path matches pattern, ignoring leading and
+// trailing slashes, so the empty path left by stripping /cache from
+// /cache matches "/", and returns the values of its :name segments.
+func matchRoute(pattern, path string) (routeParams, bool) {
+    want := strings.Split(strings.Trim(pattern, "/"), "/")
+    got := strings.Split(strings.Trim(path, "/"), "/")
+    if len(want) != len(got) {
+        return nil, false
+    }
+    params := routeParams{}
+    for i, segment := range want {
+        if name, ok := strings.CutPrefix(segment, ":"); ok {
+            if got[i] == "" {
+                return nil, false
+            }
+            params[name] = got[i]
+        } else if segment != got[i] {
+            return nil, false
+        }
+    }
+    return params, true
+}
+
+// writeJSON writes obj as a JSON response with status code.
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(obj)
+}
+
+// writeInvalid responds 400 with the fields that failed validation.
+func writeInvalid(w http.ResponseWriter, errs []FieldError) {
+    writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid request", "fields": errs})
+}
+
+// writeError responds with err and the status errorStatus maps it to.
+func writeError(w http.ResponseWriter, err error) {
+    writeJSON(w, errorStatus(err), map[string]interface{}{"error": err.Error()})
+}
+
+// serveGet serves GET /cache/:key.
+func (c *LRUCache) serveGet(w http.ResponseWriter, r *http.Request, params routeParams) {
+    value, modifiedAt, err := c.GetWithModTime(r.Context(), params["key"])
+    if err != nil {
+        status, message := errorStatus(err), err.Error()
+        if status == http.StatusNotFound {
+            if soft, _ := strconv.ParseBool(r.Header.Get(softMissHeader)); soft {
+                writeJSON(w, http.StatusOK, map[string]interface{}{"found": false})
+                return
+            }
+            message = "key not found"
+        }
+        writeJSON(w, status, map[string]interface{}{"error": message})
+        return
+    }
+    if !modifiedAt.IsZero() {
+        // As notModified, for a plain http.ResponseWriter.
+        modifiedAt = modifiedAt.Truncate(time.Second)
+        w.Header().Set("Last-Modified", modifiedAt.UTC().Format(http.TimeFormat))
+        if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modifiedAt.After(since) {
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"value": value})
+}
+
+// serveExists serves GET /cache/:key/exists.
+func (c *LRUCache) serveExists(w http.ResponseWriter, r *http.Request, params routeParams) {
+    writeJSON(w, http.StatusOK, map[string]interface{}{"exists": c.ContainsKey(params["key"])})
+}
+
+// serveKeyStats serves GET /cache/:key/stats.
+func (c *LRUCache) serveKeyStats(w http.ResponseWriter, r *http.Request, params routeParams) {
+    writeJSON(w, http.StatusOK, c.StatsFor(params["key"]))
+}
+
+// serveSet serves POST /cache/:key.
+func (c *LRUCache) serveSet(w http.ResponseWriter, r *http.Request, params routeParams) {
+    key := params["key"]
+    var body map[string]json.RawMessage
+    if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+        writeInvalid(w, []FieldError{{Field: "body", Reason: "must be a JSON object"}})
+        return
+    }
+    data, errs := noLimits.validateSet(key, body)
+    if len(errs) > 0 {
+        writeInvalid(w, errs)
+        return
+    }
+    if err := c.SetCtx(r.Context(), key, data.Value, data.Expiration); err != nil {
+        writeError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+}
+
+// serveDelete serves DELETE /cache/:key.
+func (c *LRUCache) serveDelete(w http.ResponseWriter, r *http.Request, params routeParams) {
+    deleted, err := c.Delete(params["key"])
+    switch {
+    case err != nil:
+        writeError(w, err)
+    case deleted:
+        w.WriteHeader(http.StatusOK)
+    default:
+        writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": "key not found"})
+    }
+}
+
+// serveClear serves DELETE /cache.
+func (c *LRUCache) serveClear(w http.ResponseWriter, r *http.Request, params routeParams) {
+    if err := c.ClearCache(); err != nil {
+        writeError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+}
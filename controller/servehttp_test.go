@@ -0,0 +1,98 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// serveCache sends a request for path, relative to /cache, with body, if
+// not empty, to cache's ServeHTTP and returns the recorded response.
+func serveCache(cache *LRUCache, method, path, body string) *httptest.ResponseRecorder {
+    rec := httptest.NewRecorder()
+    cache.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+    return rec
+}
+
+func TestServeHTTPServesKeysNamedLikeViews(t *testing.T) {
+    cache := NewLRUCache(10)
+    for _, key := range []string{"expiring", "content-addressed", "batch", "warm", "audit"} {
+        if rec := serveCache(cache, http.MethodPost, "/"+key, `{"value":"`+key+` value","persist":true}`); rec.Code != http.StatusOK {
+            t.Fatalf("POST /%s = %d %s", key, rec.Code, rec.Body)
+        }
+
+        rec := serveCache(cache, http.MethodGet, "/"+key, "")
+        var body struct{ Value interface{} }
+        if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+            t.Fatalf("GET /%s = %d %s", key, rec.Code, rec.Body)
+        }
+        if body.Value != key+" value" {
+            t.Fatalf("GET /%s = %v", key, body.Value)
+        }
+    }
+}
+
+func TestServeHTTPZeroExpirationNeedsPersist(t *testing.T) {
+    cache := NewLRUCache(10)
+    writes := []struct {
+        path, body string
+        stored     bool
+        ttl        time.Duration
+    }{
+        {"/a", `{"value":1}`, false, 0},
+        {"/b", `{"value":1,"expiration":0}`, false, 0},
+        {"/c", `{"value":1,"persist":true}`, true, 0},
+        {"/d", `{"value":1,"expiration":60}`, true, time.Minute},
+    }
+    for _, w := range writes {
+        if rec := serveCache(cache, http.MethodPost, w.path, w.body); rec.Code != http.StatusOK {
+            t.Fatalf("POST %s %s = %d %s", w.path, w.body, rec.Code, rec.Body)
+        }
+        ttl, ok := cache.TTL(strings.TrimPrefix(w.path, "/"))
+        if ok != w.stored || ttl > w.ttl || (w.ttl > 0 && ttl <= 0) {
+            t.Errorf("after POST %s %s: TTL = %v, %v; want %v, %v", w.path, w.body, ttl, ok, w.ttl, w.stored)
+        }
+    }
+
+    rec := serveCache(cache, http.MethodPost, "/e", `{"value":1,"expiration":60,"persist":true}`)
+    if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"field":"persist"`) {
+        t.Fatalf("persist with an expiration = %d %s, want a persist field error", rec.Code, rec.Body)
+    }
+}
+
+func TestServeHTTPMountedOnMux(t *testing.T) {
+    cache := NewLRUCache(10)
+    handler := http.StripPrefix("/cache", cache)
+    mux := http.NewServeMux()
+    mux.Handle("/cache", handler)
+    mux.Handle("/cache/", handler)
+    serve := func(method, path, body string) *httptest.ResponseRecorder {
+        rec := httptest.NewRecorder()
+        mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+        return rec
+    }
+
+    if rec := serve(http.MethodPost, "/cache/a", `{"value":1,"persist":true}`); rec.Code != http.StatusOK {
+        t.Fatalf("POST /cache/a = %d %s", rec.Code, rec.Body)
+    }
+    if rec := serve(http.MethodGet, "/cache/a", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"value":1`) {
+        t.Fatalf("GET /cache/a = %d %s", rec.Code, rec.Body)
+    }
+    for _, path := range []string{"/cache", "/cache/"} {
+        cache.Set("a", 1, 0)
+        if rec := serve(http.MethodDelete, path, ""); rec.Code != http.StatusOK || cache.Len() != 0 {
+            t.Fatalf("DELETE %s = %d %s, leaving %d entries", path, rec.Code, rec.Body, cache.Len())
+        }
+    }
+
+    // Mounted at /cache/ only, the mux redirects DELETE /cache instead.
+    mux = http.NewServeMux()
+    mux.Handle("/cache/", handler)
+    cache.Set("a", 1, 0)
+    if rec := serve(http.MethodDelete, "/cache", ""); rec.Header().Get("Location") != "/cache/" || cache.Len() != 1 {
+        t.Fatalf("DELETE /cache with only /cache/ mounted = %d %v, leaving %d entries", rec.Code, rec.Header(), cache.Len())
+    }
+}
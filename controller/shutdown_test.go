@@ -0,0 +1,103 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net"
+    "net/http"
+    "os"
+    "os/signal"
+    "path/filepath"
+    "strings"
+    "syscall"
+    "testing"
+    "time"
+)
+
+func TestSignalSavesSnapshotAndRestartConsumesIt(t *testing.T) {
+    logs := captureLogs(t)
+    clock := newFakeClock()
+    dir := t.TempDir()
+    store := NewFileSnapshotStore(dir)
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    cache.Set("a", 1, 0)
+    cache.Set("short", 2, time.Second)
+
+    // A request that is still being handled when the signal arrives.
+    entered, release := make(chan struct{}), make(chan struct{})
+    mux := http.NewServeMux()
+    mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+        close(entered)
+        <-release
+        cache.Set("inflight", 3, 0)
+    })
+    server := &http.Server{Handler: mux}
+    shuttingDown := make(chan struct{})
+    server.RegisterOnShutdown(func() { close(shuttingDown) })
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+    defer stop()
+    served := make(chan error, 1)
+    go func() {
+        served <- serveUntilDone(ctx, server, func() error { return server.Serve(ln) }, 5*time.Second, func(context.Context) {
+            saveSnapshotAtShutdown(cache, store, "cache.json")
+        })
+    }()
+
+    responded := make(chan error, 1)
+    go func() {
+        resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+        if err == nil {
+            resp.Body.Close()
+            if resp.StatusCode != http.StatusOK {
+                err = errors.New(resp.Status)
+            }
+        }
+        responded <- err
+    }()
+    <-entered
+    if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+        t.Fatal(err)
+    }
+    <-shuttingDown
+    close(release)
+
+    if err := <-responded; err != nil {
+        t.Fatalf("the in-flight request failed: %v", err)
+    }
+    if err := <-served; err != nil {
+        t.Fatalf("serveUntilDone = %v", err)
+    }
+    if !strings.Contains(logs.String(), `"msg":"shutdown snapshot saved","name":"cache.json","saved":3`) {
+        t.Fatalf("the saved count was not logged:\n%s", logs)
+    }
+
+    // The next start, once short has expired, restores the snapshot
+    // and moves it aside.
+    clock.Advance(2 * time.Second)
+    restarted := NewLRUCache(10, WithClock(clock.Now))
+    loadSnapshotAtStartup(restarted, store, "cache.json", true)
+    if got := viewKeys(restarted.Snapshot()); strings.Join(got, " ") != "inflight a" {
+        t.Fatalf("restored %v, want inflight and a", got)
+    }
+    if !strings.Contains(logs.String(), `"msg":"snapshot loaded","name":"cache.json","restored":2,"skipped_expired":1`) {
+        t.Fatalf("the restored and skipped counts were not logged:\n%s", logs)
+    }
+    if _, err := os.Stat(filepath.Join(dir, "cache.json")); !errors.Is(err, os.ErrNotExist) {
+        t.Fatalf("the snapshot was left in place: %v", err)
+    }
+    if _, err := os.Stat(filepath.Join(dir, "cache.json.restored")); err != nil {
+        t.Fatalf("the snapshot was not moved aside: %v", err)
+    }
+
+    // A crash-restart finds no snapshot and starts cold.
+    cold := NewLRUCache(10, WithClock(clock.Now))
+    loadSnapshotAtStartup(cold, store, "cache.json", true)
+    if cold.Len() != 0 {
+        t.Fatalf("a second start restored %d entries", cold.Len())
+    }
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+    "container/list"
+    "fmt"
+    "io"
+    "reflect"
+    "sync/atomic"
+    "unsafe"
+)
+
+// entryOverhead approximates the fixed memory cost of an entry besides its
+// key and value: the cacheEntry struct, its elements in the recency and
+// priority lists and the map slot (key header plus element pointer).
+const entryOverhead = int64(unsafe.Sizeof(cacheEntry{}) + 2*unsafe.Sizeof(list.Element{}) + unsafe.Sizeof("") + unsafe.Sizeof(&list.Element{}))
+
+// entrySize returns the estimated memory used by an entry for key holding
+// value.
+func (c *LRUCache) entrySize(key string, value interface{}) int64 {
+    return entryOverhead + int64(len(key)) + c.estimateSize(value)
+}
+
+// valueSizeBuckets are the upper bounds, in bytes, of the value size
+// histogram buckets, from 64 bytes to 16 MiB in powers of four.
+var valueSizeBuckets = [...]float64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+
+// valueSizeHistogram records the estimated size of every value written
+// while byte accounting is enabled. Like latencyHistogram it is updated
+// with atomics only and made cumulative when read.
+type valueSizeHistogram struct {
+    counts [len(valueSizeBuckets) + 1]atomic.Uint64 // the last one is +Inf
+    sum    atomic.Uint64
+}
+
+// observe records a value of size bytes.
+func (h *valueSizeHistogram) observe(size int64) {
+    i := 0
+    for i < len(valueSizeBuckets) && float64(size) > valueSizeBuckets[i] {
+        i++
+    }
+    h.counts[i].Add(1)
+    h.sum.Add(uint64(size))
+}
+
+// reset zeroes the histogram. Observations racing with it may be lost.
+func (h *valueSizeHistogram) reset() {
+    for i := range h.counts {
+        h.counts[i].Store(0)
+    }
+    h.sum.Store(0)
+}
+
+// histogram returns a cumulative copy suitable for the /metrics output.
+func (h *valueSizeHistogram) histogram() *histogram {
+    out := newHistogram(valueSizeBuckets[:])
+    var cumulative uint64
+    for i := range valueSizeBuckets {
+        cumulative += h.counts[i].Load()
+        out.counts[i] = cumulative
+    }
+    out.count = cumulative + h.counts[len(valueSizeBuckets)].Load()
+    out.sum = float64(h.sum.Load())
+    return out
+}
+
+// writeValueSizeMetrics emits the value size histogram. It is left out
+// when byte accounting is disabled, since no sizes are recorded then.
+func writeValueSizeMetrics(w io.Writer, c *LRUCache) {
+    if c.maxBytes <= 0 {
+        return
+    }
+    fmt.Fprintln(w, "# HELP cache_value_size_bytes Estimated size of the values written to the cache.")
+    fmt.Fprintln(w, "# TYPE cache_value_size_bytes histogram")
+    c.valueSizes.histogram().write(w, "cache_value_size_bytes", "")
+}
+
+// estimateSize returns the estimated size of value in bytes. Strings and
+// byte slices count their length, fixed-size primitives their in-memory
+// size, and everything else is delegated to the configured SizeEstimator,
+// DeepSizeOf by default.
+func (c *LRUCache) estimateSize(value interface{}) int64 {
+    switch v := value.(type) {
+    case nil:
+        return 0
+    case string:
+        return int64(len(v))
+    case []byte:
+        return int64(len(v))
+    case bool:
+        return int64(unsafe.Sizeof(v))
+    case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, float32, float64, complex64, complex128:
+        return int64(reflect.TypeOf(v).Size())
+    }
+    if c.sizeEstimator != nil {
+        return c.sizeEstimator.EstimateSize(value)
+    }
+    return DeepSizeOf(value)
+}
+
+// SizeEstimator estimates the memory used by a cached value.
+type SizeEstimator interface {
+    EstimateSize(v interface{}) int64
+}
+
+// SizeFunc adapts an ordinary function to the SizeEstimator interface.
+type SizeFunc func(v interface{}) int64
+
+func (f SizeFunc) EstimateSize(v interface{}) int64 {
+    return f(v)
+}
+
+// ShallowSizeOf returns the in-memory size of v's type plus the backing
+// storage of v itself when it is a string, slice or map. Nothing is
+// traversed, so it is cheap but undercounts nested data.
+func ShallowSizeOf(v interface{}) int64 {
+    if v == nil {
+        return 0
+    }
+    rv := reflect.ValueOf(v)
+    size := int64(rv.Type().Size())
+    switch rv.Kind() {
+    case reflect.String:
+        size += int64(rv.Len())
+    case reflect.Slice:
+        size += int64(rv.Cap()) * int64(rv.Type().Elem().Size())
+    case reflect.Map:
+        size += int64(rv.Len()) * int64(rv.Type().Key().Size()+rv.Type().Elem().Size())
+    }
+    return size
+}
+
+// DeepSizeOf estimates the memory reachable from v by following pointers,
+// slices, maps, strings and interfaces with reflection. Memory shared
+// through pointers is counted once, which also makes cyclic structures
+// safe. Map sizes ignore bucket overhead, so results are approximate.
+func DeepSizeOf(v interface{}) int64 {
+    if v == nil {
+        return 0
+    }
+    rv := reflect.ValueOf(v)
+    return int64(rv.Type().Size()) + indirectSize(rv, make(map[uintptr]bool))
+}
+
+// indirectSize returns the memory referenced by v beyond its own inline
+// size. seen records visited pointers and backing arrays.
+func indirectSize(v reflect.Value, seen map[uintptr]bool) int64 {
+    switch v.Kind() {
+    case reflect.Pointer:
+        if v.IsNil() || seen[v.Pointer()] {
+            return 0
+        }
+        seen[v.Pointer()] = true
+        elem := v.Elem()
+        return int64(elem.Type().Size()) + indirectSize(elem, seen)
+    case reflect.Interface:
+        if v.IsNil() {
+            return 0
+        }
+        elem := v.Elem()
+        return int64(elem.Type().Size()) + indirectSize(elem, seen)
+    case reflect.String:
+        return int64(v.Len())
+    case reflect.Slice:
+        if v.IsNil() || seen[v.Pointer()] {
+            return 0
+        }
+        seen[v.Pointer()] = true
+        size := int64(v.Cap()) * int64(v.Type().Elem().Size())
+        for i := 0; i < v.Len(); i++ {
+            size += indirectSize(v.Index(i), seen)
+        }
+        return size
+    case reflect.Array:
+        var size int64
+        for i := 0; i < v.Len(); i++ {
+            size += indirectSize(v.Index(i), seen)
+        }
+        return size
+    case reflect.Map:
+        if v.IsNil() || seen[v.Pointer()] {
+            return 0
+        }
+        seen[v.Pointer()] = true
+        size := int64(v.Len()) * int64(v.Type().Key().Size()+v.Type().Elem().Size())
+        iter := v.MapRange()
+        for iter.Next() {
+            size += indirectSize(iter.Key(), seen) + indirectSize(iter.Value(), seen)
+        }
+        return size
+    case reflect.Struct:
+        var size int64
+        for i := 0; i < v.NumField(); i++ {
+            size += indirectSize(v.Field(i), seen)
+        }
+        return size
+    }
+    return 0
+}
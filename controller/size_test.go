@@ -0,0 +1,143 @@
+package main
+
+import (
+    "math/rand"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+// checkBytes fails the test unless the running byte total equals the sum
+// of the entry sizes, each matching a fresh estimate of its entry.
+func checkBytes(t *testing.T, cache *LRUCache) {
+    t.Helper()
+    cache.mutex.RLock()
+    defer cache.mutex.RUnlock()
+
+    var sum int64
+    for element := cache.list.Front(); element != nil; element = element.Next() {
+        entry := element.Value.(*cacheEntry)
+        if want := cache.entrySize(entry.key, entry.value); entry.sizeBytes != want {
+            t.Fatalf("entry %s records %d bytes, estimated %d", entry.key, entry.sizeBytes, want)
+        }
+        sum += entry.sizeBytes
+    }
+    if cache.totalBytes != sum {
+        t.Fatalf("totalBytes = %d, entries sum to %d", cache.totalBytes, sum)
+    }
+    if cache.maxBytes > 0 && cache.totalBytes > cache.maxBytes {
+        t.Fatalf("totalBytes = %d over the %d byte limit", cache.totalBytes, cache.maxBytes)
+    }
+}
+
+func TestSizeAccountingRandomWorkload(t *testing.T) {
+    for _, maxBytes := range []int64{0, 4 << 10} {
+        clock := newFakeClock()
+        cache := NewLRUCache(50, WithMaxBytes(maxBytes), WithClock(clock.Now))
+        rng := rand.New(rand.NewSource(1))
+        key := func() string { return "k" + strconv.Itoa(rng.Intn(80)) }
+        value := func() interface{} {
+            if rng.Intn(4) == 0 {
+                return map[string]int{"n": rng.Intn(100)}
+            }
+            return strings.Repeat("x", rng.Intn(300))
+        }
+        ttl := func() time.Duration { return time.Duration(rng.Intn(3)) * time.Second }
+
+        for i := 0; i < 5000; i++ {
+            switch rng.Intn(10) {
+            case 0, 1, 2:
+                cache.Set(key(), value(), ttl())
+            case 3:
+                cache.SetMany([]BatchEntry{{Key: key(), Value: value()}, {Key: key(), Value: value(), TTL: ttl()}})
+            case 4:
+                cache.Get(key())
+            case 5:
+                cache.Delete(key())
+            case 6:
+                cache.Swap(key(), key())
+            case 7:
+                cache.DeleteExpired()
+            case 8:
+                clock.Advance(time.Second)
+            case 9:
+                other := NewLRUCache(5)
+                other.Set(key(), value(), 0)
+                cache.Merge(other, KeepIncoming)
+            }
+            if i%50 == 0 {
+                checkBytes(t, cache)
+            }
+        }
+        checkBytes(t, cache)
+
+        if err := cache.ClearCache(); err != nil {
+            t.Fatal(err)
+        }
+        if cache.totalBytes != 0 || cache.Stats().BytesUsed != 0 {
+            t.Fatalf("totalBytes = %d after ClearCache", cache.totalBytes)
+        }
+    }
+}
+
+func TestSizeAccountingOverwrite(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("k", strings.Repeat("x", 100), 0)
+    cache.Set("other", "y", 0)
+    before := cache.totalBytes
+
+    cache.Set("k", strings.Repeat("x", 40), 0)
+    if delta := cache.totalBytes - before; delta != -60 {
+        t.Fatalf("overwriting with a value 60 bytes shorter changed the total by %d", delta)
+    }
+    cache.Delete("k")
+    if cache.totalBytes != cache.entrySize("other", "y") {
+        t.Fatalf("totalBytes = %d with only other left", cache.totalBytes)
+    }
+}
+
+type sizedProfile struct {
+    Name    string
+    Tags    []string
+    Scores  map[string]int
+    Manager *sizedProfile
+}
+
+// sizedValues are the values the size estimator benchmarks measure.
+var sizedValues = []struct {
+    name  string
+    value interface{}
+}{
+    {"string", strings.Repeat("x", 1024)},
+    {"slice", make([]int64, 256)},
+    {"map", map[string]int{"a": 1, "b": 2, "c": 3, "d": 4}},
+    {"struct", &sizedProfile{
+        Name:    "alice",
+        Tags:    []string{"admin", "ops", "oncall"},
+        Scores:  map[string]int{"q1": 10, "q2": 12},
+        Manager: &sizedProfile{Name: "bob", Tags: []string{"lead"}},
+    }},
+}
+
+// benchmarkSizeOf measures sizeOf over each of sizedValues, reporting the
+// size it estimates.
+func benchmarkSizeOf(b *testing.B, sizeOf func(interface{}) int64) {
+    for _, v := range sizedValues {
+        b.Run(v.name, func(b *testing.B) {
+            var size int64
+            for i := 0; i < b.N; i++ {
+                size = sizeOf(v.value)
+            }
+            b.ReportMetric(float64(size), "est-bytes")
+        })
+    }
+}
+
+func BenchmarkDeepSizeOf(b *testing.B) {
+    benchmarkSizeOf(b, DeepSizeOf)
+}
+
+func BenchmarkShallowSizeOf(b *testing.B) {
+    benchmarkSizeOf(b, ShallowSizeOf)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+    "log/slog"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// SetSlowThreshold makes the cache log a warning for every operation, and
+// every HTTP request served by slowRequestMiddleware, taking longer than d.
+// Zero disables slow-operation logging. It is safe to call at any time.
+func (c *LRUCache) SetSlowThreshold(d time.Duration) {
+    c.slowThreshold.Store(int64(d))
+}
+
+// SlowThreshold returns the current slow-operation threshold, or zero if
+// slow-operation logging is disabled.
+func (c *LRUCache) SlowThreshold() time.Duration {
+    return time.Duration(c.slowThreshold.Load())
+}
+
+// isSlow reports whether d exceeds the slow-operation threshold.
+func (c *LRUCache) isSlow(d time.Duration) bool {
+    threshold := c.SlowThreshold()
+    return threshold > 0 && d > threshold
+}
+
+// finishOp records the latency of an operation started at start and logs
+// it, with meta if not nil, if it was slow. It must be called without the
+// lock held.
+func (c *LRUCache) finishOp(h *latencyHistogram, op, key string, start time.Time, evicted int, meta *RequestMeta) {
+    d := h.observeSince(start)
+    if !c.isSlow(d) {
+        return
+    }
+    if c.hashSlowKeys && key != "" {
+        key = keyHash(key)
+    }
+    args := []any{
+        "op", op,
+        "key", key,
+        "duration", d,
+        "size", c.Len(),
+        "evicted", evicted > 0,
+    }
+    slog.Warn("slow cache operation", append(args, meta.slogAttrs()...)...)
+}
+
+// slowRequestMiddleware logs a warning for every request taking longer than
+// the cache's slow-operation threshold.
+func slowRequestMiddleware(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        start := time.Now()
+        c.Next()
+
+        // Upgraded connections and event streams last as long as the
+        // client stays.
+        streaming := c.Writer.Status() == http.StatusSwitchingProtocols || c.Writer.Header().Get("Content-Type") == "text/event-stream"
+        if d := time.Since(start); cache.isSlow(d) && !streaming {
+            slog.Warn("slow request",
+                "method", c.Request.Method,
+                "route", c.FullPath(),
+                "status", c.Writer.Status(),
+                "duration", d,
+                "size", cache.Len(),
+            )
+        }
+    }
+}
+
+// configHandler serves GET /admin/config.
+func configHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.JSON(http.StatusOK, gin.H{"slow_threshold_ms": cache.SlowThreshold().Milliseconds()})
+    }
+}
+
+// updateConfigHandler serves PUT /admin/config. Only the fields present in
+// the body are changed.
+func updateConfigHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var data struct {
+            SlowThresholdMs *int64 `json:"slow_threshold_ms"`
+        }
+        if err := c.ShouldBindJSON(&data); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if data.SlowThresholdMs != nil {
+            if *data.SlowThresholdMs < 0 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "slow_threshold_ms", Reason: "must not be negative"}}})
+                return
+            }
+            cache.SetSlowThreshold(time.Duration(*data.SlowThresholdMs) * time.Millisecond)
+        }
+        configHandler(cache)(c)
+    }
+}
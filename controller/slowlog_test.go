@@ -0,0 +1,120 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "log/slog"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// captureLogs routes the default slog logger to a buffer of JSON lines
+// until the test ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+    t.Helper()
+    var buf bytes.Buffer
+    previous := slog.Default()
+    slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+    t.Cleanup(func() { slog.SetDefault(previous) })
+    return &buf
+}
+
+// logRecords decodes the JSON lines written to buf.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+    t.Helper()
+    var records []map[string]interface{}
+    for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+        if line == "" {
+            continue
+        }
+        var record map[string]interface{}
+        decodeBody(t, line, &record)
+        records = append(records, record)
+    }
+    return records
+}
+
+func TestSlowLogSilentUnderThreshold(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    buf := captureLogs(t)
+    cache := NewLRUCache(1, WithSlowThreshold(time.Hour, false))
+    router := gin.New()
+    router.Use(slowRequestMiddleware(cache))
+    router.GET("/cache/:key", func(c *gin.Context) {
+        c.JSON(http.StatusOK, cache.Get(c.Param("key")))
+    })
+
+    cache.Set("a", 1, 0)
+    cache.Set("b", 2, 0)
+    cache.Get("b")
+    cache.Delete("b")
+    cache.GetCacheState()
+    router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/cache/a", nil))
+
+    if buf.Len() != 0 {
+        t.Fatalf("operations under the threshold logged:\n%s", buf)
+    }
+
+    cache.SetSlowThreshold(0)
+    cache.Set("c", 3, 0)
+    if buf.Len() != 0 {
+        t.Fatalf("a zero threshold logged:\n%s", buf)
+    }
+}
+
+func TestSlowLogAboveThreshold(t *testing.T) {
+    buf := captureLogs(t)
+    cache := NewLRUCache(1, WithSlowThreshold(time.Hour, true))
+    cache.Set("a", 1, 0)
+
+    // Every operation takes longer than a nanosecond.
+    cache.SetSlowThreshold(time.Nanosecond)
+    cache.Set("b", 2, 0)
+
+    records := logRecords(t, buf)
+    if len(records) != 1 {
+        t.Fatalf("got %d log records, want 1:\n%s", len(records), buf)
+    }
+    record := records[0]
+    if record["msg"] != "slow cache operation" || record["op"] != "set" || record["evicted"] != true || record["size"] != float64(1) {
+        t.Fatalf("record = %v", record)
+    }
+    if record["key"] != keyHash("b") {
+        t.Fatalf("key = %v, want the hash of b", record["key"])
+    }
+}
+
+func TestUpdateConfigHandlerChangesThreshold(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(1)
+    router := gin.New()
+    router.PUT("/admin/config", updateConfigHandler(cache))
+
+    for _, tc := range []struct {
+        body string
+        code int
+        want time.Duration
+    }{
+        {`{"slow_threshold_ms":250}`, http.StatusOK, 250 * time.Millisecond},
+        {`{}`, http.StatusOK, 250 * time.Millisecond},
+        {`{"slow_threshold_ms":-1}`, http.StatusBadRequest, 250 * time.Millisecond},
+        {`{"slow_threshold_ms":0}`, http.StatusOK, 0},
+    } {
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/config", strings.NewReader(tc.body)))
+        if rec.Code != tc.code || cache.SlowThreshold() != tc.want {
+            t.Fatalf("PUT %s = %d, threshold %v; want %d, %v", tc.body, rec.Code, cache.SlowThreshold(), tc.code, tc.want)
+        }
+        if tc.code == http.StatusOK {
+            var resp map[string]int64
+            if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp["slow_threshold_ms"] != tc.want.Milliseconds() {
+                t.Fatalf("PUT %s body = %s", tc.body, rec.Body)
+            }
+        }
+    }
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// snapshotVersion is written to every JSON snapshot so the format can
+// evolve. A JSON snapshot is an object holding the version, the time it was
+// saved as "saved_at" and its entries, most recently used first.
+const snapshotVersion = 1
+
+// snapshotEntry is one entry of a JSON snapshot. Expiration is absolute and
+// omitted for entries that never expire. ModifiedAt is when the value was
+// last written; snapshots written before it was added lack it.
+type snapshotEntry struct {
+    Key        string          `json:"key"`
+    Value      json.RawMessage `json:"value"`
+    Expiration *time.Time      `json:"expiration,omitempty"`
+    ModifiedAt *time.Time      `json:"modified_at,omitempty"`
+}
+
+// SaveSnapshot writes the live entries to w as JSON, in LRU order. Values
+// must be encodable as JSON; they are restored by LoadSnapshot as the
+// types encoding/json decodes into an interface{}. See SaveSnapshotBinary
+// for a faster format.
+func (c *LRUCache) SaveSnapshot(w io.Writer) error {
+    _, err := c.writeSnapshot(w)
+    return err
+}
+
+// writeSnapshot implements SaveSnapshot, returning the number of entries
+// written.
+func (c *LRUCache) writeSnapshot(w io.Writer) (int, error) {
+    return encodeJSONSnapshot(w, c.entries())
+}
+
+// encodeJSONSnapshot writes entries to w as a JSON snapshot. Entries are
+// encoded one at a time into a buffered writer rather than building the
+// whole document in memory.
+func encodeJSONSnapshot(w io.Writer, entries []cacheEntry) (int, error) {
+    bw := bufio.NewWriter(w)
+    savedAt, err := json.Marshal(time.Now())
+    if err != nil {
+        return 0, err
+    }
+    fmt.Fprintf(bw, `{"version":%d,"saved_at":%s,"entries":[`, snapshotVersion, savedAt)
+    for i, entry := range entries {
+        value, err := json.Marshal(entry.value)
+        if err != nil {
+            return 0, fmt.Errorf("snapshot: encode %q: %w", entry.key, err)
+        }
+        data, err := json.Marshal(snapshotEntry{Key: entry.key, Value: value, Expiration: expirationPtr(entry.expiration), ModifiedAt: expirationPtr(entry.modifiedAt)})
+        if err != nil {
+            return 0, err
+        }
+        if i > 0 {
+            bw.WriteByte(',')
+        }
+        if _, err := bw.Write(data); err != nil {
+            return 0, err
+        }
+    }
+    bw.WriteString("]}\n")
+    return len(entries), bw.Flush()
+}
+
+// LoadSnapshot replaces the contents of the cache with the entries read
+// from r, preserving their LRU order and skipping entries that have expired
+// since the snapshot was taken. Both the JSON and the binary format are
+// accepted; the format is detected from the first bytes. The snapshot is
+// decoded completely before the cache is touched, so a corrupted snapshot
+// leaves the cache unchanged.
+func (c *LRUCache) LoadSnapshot(r io.Reader) error {
+    _, _, err := c.loadSnapshot(r)
+    return err
+}
+
+// loadSnapshot implements LoadSnapshot, returning the number of entries
+// restored and of expired entries skipped.
+func (c *LRUCache) loadSnapshot(r io.Reader) (restored, skipped int, err error) {
+    items, err := decodeSnapshot(r, c.codec)
+    if err != nil {
+        return 0, 0, err
+    }
+    restored, skipped = c.replaceEntries(items)
+    return restored, skipped, nil
+}
+
+// replaceEntries replaces the contents of the cache with items, most
+// recently used first, under a single lock acquisition, skipping those
+// that have expired. It returns the number of entries restored and
+// skipped.
+func (c *LRUCache) replaceEntries(items []cacheEntry) (restored, skipped int) {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    c.clear()
+    now := c.now()
+    // Insert least recently used first so the most recently used entry
+    // ends up at the front.
+    for i := len(items) - 1; i >= 0; i-- {
+        item := items[i]
+        if item.expired(now) {
+            skipped++
+            continue
+        }
+        c.set(item.key, item.value, item.expiration)
+        c.restoreModifiedAt(item.key, item.modifiedAt)
+        restored++
+    }
+    return restored, skipped
+}
+
+// decodeSnapshot reads a snapshot in either format, detected from its
+// first bytes, decoding binary snapshot values with codec. Only the key,
+// value, expiration and modification time of the returned entries are
+// set.
+func decodeSnapshot(r io.Reader, codec Codec) ([]cacheEntry, error) {
+    br := bufio.NewReader(r)
+    var items []cacheEntry
+    var err error
+    if magic, _ := br.Peek(len(binarySnapshotMagic)); string(magic) == binarySnapshotMagic {
+        items, err = decodeBinarySnapshot(br, codec)
+    } else {
+        items, err = decodeJSONSnapshot(br)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("snapshot: %w", err)
+    }
+    return items, nil
+}
+
+// restoreModifiedAt sets the modification time of the entry for key to
+// modifiedAt, unless modifiedAt is zero. The caller must hold the lock.
+func (c *LRUCache) restoreModifiedAt(key string, modifiedAt time.Time) {
+    if modifiedAt.IsZero() {
+        return
+    }
+    if element, ok := c.cache[key]; ok {
+        element.Value.(*cacheEntry).modifiedAt = modifiedAt
+    }
+}
+
+// decodeJSONSnapshot reads a JSON snapshot from r one entry at a time, so
+// only the decoded values are held in memory.
+func decodeJSONSnapshot(r io.Reader) ([]cacheEntry, error) {
+    decoder := json.NewDecoder(r)
+    if err := expectDelim(decoder, '{'); err != nil {
+        return nil, err
+    }
+    var items []cacheEntry
+    version := 0
+    for decoder.More() {
+        token, err := decoder.Token()
+        if err != nil {
+            return nil, err
+        }
+        switch token {
+        case "version":
+            if err := decoder.Decode(&version); err != nil {
+                return nil, err
+            }
+            if version != snapshotVersion {
+                return nil, fmt.Errorf("unsupported version %d", version)
+            }
+        case "entries":
+            if err := expectDelim(decoder, '['); err != nil {
+                return nil, err
+            }
+            for decoder.More() {
+                var entry snapshotEntry
+                if err := decoder.Decode(&entry); err != nil {
+                    return nil, err
+                }
+                item := cacheEntry{key: entry.Key}
+                if err := json.Unmarshal(entry.Value, &item.value); err != nil {
+                    return nil, fmt.Errorf("decode %q: %w", entry.Key, err)
+                }
+                if entry.Expiration != nil {
+                    item.expiration = *entry.Expiration
+                }
+                if entry.ModifiedAt != nil {
+                    item.modifiedAt = *entry.ModifiedAt
+                }
+                items = append(items, item)
+            }
+            if err := expectDelim(decoder, ']'); err != nil {
+                return nil, err
+            }
+        default:
+            var skip json.RawMessage
+            if err := decoder.Decode(&skip); err != nil {
+                return nil, err
+            }
+        }
+    }
+    if err := expectDelim(decoder, '}'); err != nil {
+        return nil, err
+    }
+    if version != snapshotVersion {
+        return nil, fmt.Errorf("unsupported version %d", version)
+    }
+    return items, nil
+}
+
+// expectDelim reads the next token from decoder and checks that it is
+// delim.
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+    token, err := decoder.Token()
+    if err != nil {
+        return err
+    }
+    if token != delim {
+        return fmt.Errorf("expected %v, found %v", delim, token)
+    }
+    return nil
+}
+
+// SaveSnapshotFile writes a snapshot to path, in the format chosen by
+// SnapshotFormatFor. It writes to a temporary file in the same directory
+// first and renames it, so an existing snapshot is never left half-written.
+// Successful saves are reported by LastSnapshot.
+func (c *LRUCache) SaveSnapshotFile(path string) error {
+    store, name := fileSnapshotStoreFor(path)
+    return c.SaveSnapshotTo(store, name)
+}
+
+// SaveSnapshotTo writes a snapshot to store under name, in the format
+// chosen by SnapshotFormatFor. The snapshot is streamed to the store as it
+// is encoded. Successful saves are reported by LastSnapshot.
+func (c *LRUCache) SaveSnapshotTo(store SnapshotStore, name string) error {
+    start := time.Now()
+    write := c.writeSnapshot
+    if SnapshotFormatFor(name) == SnapshotBinary {
+        write = c.writeBinarySnapshot
+    }
+
+    pr, pw := io.Pipe()
+    entries := make(chan int, 1)
+    go func() {
+        n, err := write(pw)
+        entries <- n
+        pw.CloseWithError(err)
+    }()
+    err := store.Put(name, pr)
+    // Unblock the writer if the store gave up before reading everything.
+    pr.CloseWithError(errors.New("snapshot store stopped reading"))
+    n := <-entries
+    if err != nil {
+        return err
+    }
+    c.lastSnapshot.Store(&SnapshotStatus{At: start, DurationSeconds: time.Since(start).Seconds(), Entries: n})
+    return nil
+}
+
+// LoadSnapshotFile loads the snapshot stored at path, in either format;
+// see LoadSnapshot.
+func (c *LRUCache) LoadSnapshotFile(path string) error {
+    store, name := fileSnapshotStoreFor(path)
+    return c.LoadSnapshotFrom(store, name)
+}
+
+// LoadSnapshotFrom loads the snapshot stored in store under name, in
+// either format; see LoadSnapshot.
+func (c *LRUCache) LoadSnapshotFrom(store SnapshotStore, name string) error {
+    _, _, err := c.loadSnapshotFrom(store, name)
+    return err
+}
+
+// loadSnapshotFrom implements LoadSnapshotFrom, returning the counts
+// reported by loadSnapshot.
+func (c *LRUCache) loadSnapshotFrom(store SnapshotStore, name string) (restored, skipped int, err error) {
+    r, err := store.Get(name)
+    if err != nil {
+        return 0, 0, err
+    }
+    defer r.Close()
+
+    return c.loadSnapshot(r)
+}
+
+// loadSnapshotAtStartup loads name from store if it exists. Failures are
+// logged rather than fatal so a bad snapshot only costs a cold start. With
+// consume set, a loaded snapshot is moved aside to name.restored, so a
+// restart after a crash, which writes no new snapshot, starts cold instead
+// of loading the same stale data again.
+func loadSnapshotAtStartup(cache *LRUCache, store SnapshotStore, name string, consume bool) {
+    restored, skipped, err := cache.loadSnapshotFrom(store, name)
+    switch {
+    case err == nil:
+        slog.Info("snapshot loaded", "name", name, "restored", restored, "skipped_expired", skipped)
+        if consume {
+            if err := moveSnapshot(store, name, name+".restored"); err != nil {
+                slog.Error("snapshot rename failed", "name", name, "error", err)
+            }
+        }
+    case errors.Is(err, ErrSnapshotNotFound):
+    default:
+        slog.Error("snapshot load failed", "name", name, "error", err)
+    }
+}
+
+// moveSnapshot renames from to to within store, copying it as the
+// interface has no rename.
+func moveSnapshot(store SnapshotStore, from, to string) error {
+    r, err := store.Get(from)
+    if err != nil {
+        return err
+    }
+    err = store.Put(to, r)
+    r.Close()
+    if err != nil {
+        return err
+    }
+    return store.Delete(from)
+}
+
+// saveSnapshotAtShutdown writes the snapshot loaded by the next start,
+// logging the outcome.
+func saveSnapshotAtShutdown(cache *LRUCache, store SnapshotStore, name string) {
+    if err := cache.SaveSnapshotTo(store, name); err != nil {
+        slog.Error("shutdown snapshot failed", "name", name, "error", err)
+        return
+    }
+    slog.Info("shutdown snapshot saved", "name", name, "saved", cache.LastSnapshot().Entries)
+}
+
+// snapshotHandler serves POST /admin/snapshot/save and
+// POST /admin/snapshot/load, calling op with the configured snapshot store
+// and name. A nil store means no snapshot is configured.
+func snapshotHandler(store SnapshotStore, name string, op func(store SnapshotStore, name string) error) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if store == nil {
+            c.JSON(http.StatusConflict, gin.H{"error": "no snapshot file configured"})
+            return
+        }
+        if err := op(store, name); err != nil {
+            status := http.StatusInternalServerError
+            if errors.Is(err, ErrSnapshotNotFound) {
+                status = http.StatusNotFound
+            }
+            c.JSON(status, gin.H{"error": err.Error()})
+            return
+        }
+        c.Status(http.StatusOK)
+    }
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+    "bufio"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "io"
+    "math"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// SnapshotFormat selects how a snapshot is encoded.
+type SnapshotFormat int
+
+const (
+    // SnapshotJSON is the JSON document written by SaveSnapshot.
+    SnapshotJSON SnapshotFormat = iota
+    // SnapshotBinary is a length-prefixed binary encoding that is much
+    // faster to write and read than JSON for large caches.
+    SnapshotBinary
+)
+
+// SnapshotFormatFor returns the format used for a snapshot file at path:
+// binary for the ".bin" extension and JSON otherwise.
+func SnapshotFormatFor(path string) SnapshotFormat {
+    if strings.EqualFold(filepath.Ext(path), ".bin") {
+        return SnapshotBinary
+    }
+    return SnapshotJSON
+}
+
+// A binary snapshot starts with binarySnapshotMagic followed by the format
+// version, the save time in Unix nanoseconds and the entry count, all as
+// varints. Each entry, most recently used first, is then encoded as
+//
+//    key length, key bytes
+//    expiration in Unix nanoseconds, 0 if the entry never expires
+//    last write time in Unix nanoseconds (from version 2), 0 if unknown
+//    value
+//
+// Values are a tag byte followed by the tag's payload. The JSON types are
+// encoded directly; anything else is encoded with the cache's codec. With
+// the default JSONCodec it comes back as the types encoding/json decodes
+// into an interface{}, as with a JSON snapshot.
+const (
+    binarySnapshotMagic   = "LRUSNAP"
+    binarySnapshotVersion = 2
+
+    // maxBinaryLength bounds the lengths read from a binary snapshot so a
+    // corrupted one cannot make the loader allocate without limit.
+    maxBinaryLength = 1 << 30
+)
+
+const (
+    tagNull byte = iota
+    tagFalse
+    tagTrue
+    tagNumber
+    tagString
+    tagArray
+    tagObject
+    tagJSON
+    // tagCodec holds a value encoded with a codec other than JSONCodec.
+    tagCodec
+)
+
+// SaveSnapshotBinary writes the live entries to w in the binary snapshot
+// format. LoadSnapshot detects and reads it.
+func (c *LRUCache) SaveSnapshotBinary(w io.Writer) error {
+    _, err := c.writeBinarySnapshot(w)
+    return err
+}
+
+// writeBinarySnapshot implements SaveSnapshotBinary, returning the number
+// of entries written. Entries are encoded one at a time into a buffered
+// writer.
+func (c *LRUCache) writeBinarySnapshot(w io.Writer) (int, error) {
+    entries := c.entries()
+    e := &binaryEncoder{w: bufio.NewWriter(w), codec: c.codec}
+    e.w.WriteString(binarySnapshotMagic)
+    e.uvarint(binarySnapshotVersion)
+    e.varint(time.Now().UnixNano())
+    e.uvarint(uint64(len(entries)))
+    for _, entry := range entries {
+        e.string(entry.key)
+        e.varint(unixNano(entry.expiration))
+        e.varint(unixNano(entry.modifiedAt))
+        if err := e.value(entry.value); err != nil {
+            return 0, fmt.Errorf("snapshot: encode %q: %w", entry.key, err)
+        }
+        if e.err != nil {
+            return 0, e.err
+        }
+    }
+    if err := e.w.Flush(); err != nil {
+        return 0, err
+    }
+    return len(entries), e.err
+}
+
+// unixNano returns t in Unix nanoseconds, or 0 for the zero time.
+func unixNano(t time.Time) int64 {
+    if t.IsZero() {
+        return 0
+    }
+    return t.UnixNano()
+}
+
+// fromUnixNano is the inverse of unixNano.
+func fromUnixNano(ns int64) time.Time {
+    if ns == 0 {
+        return time.Time{}
+    }
+    return time.Unix(0, ns)
+}
+
+// binaryEncoder writes the primitives of the binary snapshot format,
+// keeping the first write error. Values that are not of the JSON types
+// are encoded with codec.
+type binaryEncoder struct {
+    w     *bufio.Writer
+    buf   [binary.MaxVarintLen64]byte
+    err   error
+    codec Codec
+}
+
+func (e *binaryEncoder) write(p []byte) {
+    if e.err == nil {
+        _, e.err = e.w.Write(p)
+    }
+}
+
+func (e *binaryEncoder) uvarint(x uint64) {
+    e.write(e.buf[:binary.PutUvarint(e.buf[:], x)])
+}
+
+func (e *binaryEncoder) varint(x int64) {
+    e.write(e.buf[:binary.PutVarint(e.buf[:], x)])
+}
+
+func (e *binaryEncoder) string(s string) {
+    e.uvarint(uint64(len(s)))
+    if e.err == nil {
+        _, e.err = e.w.WriteString(s)
+    }
+}
+
+func (e *binaryEncoder) tag(t byte) {
+    if e.err == nil {
+        e.err = e.w.WriteByte(t)
+    }
+}
+
+// value encodes v. It only returns errors from encoding a value that is
+// not one of the JSON types with the codec; write errors are kept in
+// e.err.
+func (e *binaryEncoder) value(v interface{}) error {
+    switch v := v.(type) {
+    case nil:
+        e.tag(tagNull)
+    case bool:
+        if v {
+            e.tag(tagTrue)
+        } else {
+            e.tag(tagFalse)
+        }
+    case float64:
+        e.tag(tagNumber)
+        binary.LittleEndian.PutUint64(e.buf[:8], math.Float64bits(v))
+        e.write(e.buf[:8])
+    case string:
+        e.tag(tagString)
+        e.string(v)
+    case []interface{}:
+        e.tag(tagArray)
+        e.uvarint(uint64(len(v)))
+        for _, item := range v {
+            if err := e.value(item); err != nil {
+                return err
+            }
+        }
+    case map[string]interface{}:
+        e.tag(tagObject)
+        e.uvarint(uint64(len(v)))
+        for key, item := range v {
+            e.string(key)
+            if err := e.value(item); err != nil {
+                return err
+            }
+        }
+    default:
+        data, err := e.codec.Marshal(v)
+        if err != nil {
+            return err
+        }
+        if _, ok := e.codec.(JSONCodec); ok {
+            e.tag(tagJSON)
+        } else {
+            e.tag(tagCodec)
+        }
+        e.uvarint(uint64(len(data)))
+        e.write(data)
+    }
+    return nil
+}
+
+// decodeBinarySnapshot reads a binary snapshot from r, which must start
+// at the magic bytes. Version 1 snapshots, which lack write times, are
+// still accepted.
+func decodeBinarySnapshot(r *bufio.Reader, codec Codec) ([]cacheEntry, error) {
+    if _, err := r.Discard(len(binarySnapshotMagic)); err != nil {
+        return nil, err
+    }
+    d := &binaryDecoder{r: r, codec: codec}
+    version := d.uvarint()
+    if d.err == nil && (version < 1 || version > binarySnapshotVersion) {
+        return nil, fmt.Errorf("unsupported binary format version %d", version)
+    }
+    d.varint() // saved at
+    count := d.uvarint()
+    if d.err != nil {
+        return nil, d.err
+    }
+
+    items := make([]cacheEntry, 0, min(count, 1<<16))
+    for i := uint64(0); i < count; i++ {
+        var item cacheEntry
+        item.key = d.string()
+        item.expiration = fromUnixNano(d.varint())
+        if version >= 2 {
+            item.modifiedAt = fromUnixNano(d.varint())
+        }
+        item.value = d.value()
+        if d.err != nil {
+            return nil, fmt.Errorf("entry %d: %w", i, d.err)
+        }
+        items = append(items, item)
+    }
+    return items, nil
+}
+
+// binaryDecoder reads the primitives of the binary snapshot format,
+// keeping the first error. A snapshot that ends early is reported as
+// io.ErrUnexpectedEOF.
+type binaryDecoder struct {
+    r     *bufio.Reader
+    err   error
+    codec Codec
+}
+
+func (d *binaryDecoder) fail(err error) {
+    if err == io.EOF {
+        err = io.ErrUnexpectedEOF
+    }
+    if d.err == nil {
+        d.err = err
+    }
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+    if d.err != nil {
+        return 0
+    }
+    x, err := binary.ReadUvarint(d.r)
+    if err != nil {
+        d.fail(err)
+    }
+    return x
+}
+
+func (d *binaryDecoder) varint() int64 {
+    if d.err != nil {
+        return 0
+    }
+    x, err := binary.ReadVarint(d.r)
+    if err != nil {
+        d.fail(err)
+    }
+    return x
+}
+
+// length reads a length prefix, rejecting implausible ones.
+func (d *binaryDecoder) length() int {
+    n := d.uvarint()
+    if n > maxBinaryLength {
+        d.fail(fmt.Errorf("length %d out of range", n))
+        return 0
+    }
+    return int(n)
+}
+
+func (d *binaryDecoder) bytes() []byte {
+    n := d.length()
+    if d.err != nil {
+        return nil
+    }
+    data := make([]byte, n)
+    if _, err := io.ReadFull(d.r, data); err != nil {
+        d.fail(err)
+    }
+    return data
+}
+
+func (d *binaryDecoder) string() string {
+    return string(d.bytes())
+}
+
+func (d *binaryDecoder) value() interface{} {
+    if d.err != nil {
+        return nil
+    }
+    tag, err := d.r.ReadByte()
+    if err != nil {
+        d.fail(err)
+        return nil
+    }
+    switch tag {
+    case tagNull:
+        return nil
+    case tagFalse:
+        return false
+    case tagTrue:
+        return true
+    case tagNumber:
+        var buf [8]byte
+        if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+            d.fail(err)
+            return nil
+        }
+        return math.Float64frombits(binary.LittleEndian.Uint64(buf[:]))
+    case tagString:
+        return d.string()
+    case tagArray:
+        n := d.length()
+        items := make([]interface{}, 0, min(n, 1<<10))
+        for i := 0; i < n && d.err == nil; i++ {
+            items = append(items, d.value())
+        }
+        return items
+    case tagObject:
+        n := d.length()
+        object := make(map[string]interface{}, min(n, 1<<10))
+        for i := 0; i < n && d.err == nil; i++ {
+            key := d.string()
+            object[key] = d.value()
+        }
+        return object
+    case tagJSON:
+        data := d.bytes()
+        if d.err != nil {
+            return nil
+        }
+        var value interface{}
+        if err := json.Unmarshal(data, &value); err != nil {
+            d.fail(err)
+        }
+        return value
+    case tagCodec:
+        data := d.bytes()
+        if d.err != nil {
+            return nil
+        }
+        value, err := d.codec.Unmarshal(data)
+        if err != nil {
+            d.fail(err)
+        }
+        return value
+    }
+    d.fail(fmt.Errorf("unknown value tag %d", tag))
+    return nil
+}
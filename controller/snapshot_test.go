@@ -0,0 +1,98 @@
+package main
+
+import (
+    "bytes"
+    "reflect"
+    "strconv"
+    "testing"
+    "time"
+)
+
+// snapshotFormats are the ways of saving a snapshot; LoadSnapshot reads
+// both.
+var snapshotFormats = []struct {
+    name string
+    save func(c *LRUCache, buf *bytes.Buffer) error
+}{
+    {"json", func(c *LRUCache, buf *bytes.Buffer) error { return c.SaveSnapshot(buf) }},
+    {"binary", func(c *LRUCache, buf *bytes.Buffer) error { return c.SaveSnapshotBinary(buf) }},
+}
+
+// syntheticCache returns a cache of n entries with values of the shapes
+// the API stores: strings, numbers and JSON objects, some expiring.
+func syntheticCache(n int) *LRUCache {
+    cache := NewLRUCache(n)
+    for i := 0; i < n; i++ {
+        key := "key:" + strconv.Itoa(i)
+        switch i % 3 {
+        case 0:
+            cache.Set(key, "value "+strconv.Itoa(i), 0)
+        case 1:
+            cache.Set(key, float64(i), time.Hour)
+        default:
+            cache.Set(key, map[string]interface{}{"id": float64(i), "name": key, "tags": []interface{}{"a", "b"}}, 0)
+        }
+    }
+    return cache
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+    source := syntheticCache(50)
+    for _, format := range snapshotFormats {
+        var buf bytes.Buffer
+        if err := format.save(source, &buf); err != nil {
+            t.Fatal(err)
+        }
+        restored := NewLRUCache(50)
+        if err := restored.LoadSnapshot(&buf); err != nil {
+            t.Fatalf("%s: %v", format.name, err)
+        }
+        if restored.Len() != source.Len() {
+            t.Fatalf("%s: restored %d of %d entries", format.name, restored.Len(), source.Len())
+        }
+        for _, key := range []string{"key:0", "key:1", "key:2", "key:49"} {
+            if got, want := restored.Get(key), source.Get(key); !reflect.DeepEqual(got, want) {
+                t.Errorf("%s: %s = %#v, want %#v", format.name, key, got, want)
+            }
+        }
+        if ttl, ok := restored.TTL("key:1"); !ok || ttl <= 0 {
+            t.Errorf("%s: TTL(key:1) = %v, %v; want the expiration kept", format.name, ttl, ok)
+        }
+    }
+}
+
+func BenchmarkSnapshotSave(b *testing.B) {
+    cache := syntheticCache(100_000)
+    for _, format := range snapshotFormats {
+        b.Run(format.name, func(b *testing.B) {
+            var buf bytes.Buffer
+            for i := 0; i < b.N; i++ {
+                buf.Reset()
+                if err := format.save(cache, &buf); err != nil {
+                    b.Fatal(err)
+                }
+            }
+            b.ReportMetric(float64(buf.Len()), "file-bytes")
+        })
+    }
+}
+
+func BenchmarkSnapshotLoad(b *testing.B) {
+    source := syntheticCache(100_000)
+    for _, format := range snapshotFormats {
+        b.Run(format.name, func(b *testing.B) {
+            var buf bytes.Buffer
+            if err := format.save(source, &buf); err != nil {
+                b.Fatal(err)
+            }
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                cache := NewLRUCache(100_000)
+                if err := cache.LoadSnapshot(bytes.NewReader(buf.Bytes())); err != nil {
+                    b.Fatal(err)
+                }
+            }
+            b.ReportMetric(float64(buf.Len()), "file-bytes")
+        })
+    }
+}
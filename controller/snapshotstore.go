@@ -0,0 +1,263 @@
+package main
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "net/url"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// ErrSnapshotNotFound is returned by SnapshotStore.Get and Delete for
+// names the store does not hold.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// SnapshotStore holds named snapshots and backups. Names are plain file
+// names, without directories. Put replaces any snapshot of the same name
+// only once r has been read completely, so a failed Put leaves the
+// previous one in place. Implementations must be safe for concurrent use.
+type SnapshotStore interface {
+    Put(name string, r io.Reader) error
+    Get(name string) (io.ReadCloser, error)
+    List() ([]SnapshotInfo, error)
+    Delete(name string) error
+}
+
+// SnapshotInfo describes a snapshot held by a SnapshotStore.
+type SnapshotInfo struct {
+    Name    string    `json:"name"`
+    Size    int64     `json:"size"`
+    ModTime time.Time `json:"mod_time"`
+}
+
+// OpenSnapshotStore returns the store at location: "memory://" for a new
+// MemorySnapshotStore, or "file:///dir", or a plain directory path, for a
+// FileSnapshotStore.
+func OpenSnapshotStore(location string) (SnapshotStore, error) {
+    if !strings.Contains(location, "://") {
+        return NewFileSnapshotStore(location), nil
+    }
+    u, err := url.Parse(location)
+    if err != nil {
+        return nil, err
+    }
+    switch u.Scheme {
+    case "memory":
+        return NewMemorySnapshotStore(), nil
+    case "file":
+        if u.Path == "" {
+            return nil, fmt.Errorf("snapshot store %q has no path", location)
+        }
+        return NewFileSnapshotStore(u.Path), nil
+    }
+    return nil, fmt.Errorf("unsupported snapshot store %q", location)
+}
+
+// validSnapshotName reports whether name can be stored: it must be a plain
+// file name that is not hidden, since stores keep their temporary files
+// hidden.
+func validSnapshotName(name string) bool {
+    return name != "" && filepath.Base(name) == name && !strings.HasPrefix(name, ".")
+}
+
+// FileSnapshotStore keeps each snapshot in a file of its name in Dir.
+type FileSnapshotStore struct {
+    Dir string
+}
+
+// NewFileSnapshotStore returns a store keeping snapshots in dir.
+func NewFileSnapshotStore(dir string) *FileSnapshotStore {
+    return &FileSnapshotStore{Dir: dir}
+}
+
+// fileSnapshotStoreFor returns a store for the directory of path and the
+// name of the file within it.
+func fileSnapshotStoreFor(path string) (*FileSnapshotStore, string) {
+    return NewFileSnapshotStore(filepath.Dir(path)), filepath.Base(path)
+}
+
+// Put writes r to a hidden temporary file in Dir, syncs it and renames it,
+// so an existing snapshot is never left half-written, even by a crash.
+func (s *FileSnapshotStore) Put(name string, r io.Reader) error {
+    if !validSnapshotName(name) {
+        return fmt.Errorf("invalid snapshot name %q", name)
+    }
+    tmp, err := os.CreateTemp(s.Dir, "."+name+".tmp*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    _, err = io.Copy(tmp, r)
+    if err == nil {
+        err = tmp.Sync()
+    }
+    if closeErr := tmp.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return err
+    }
+    if err := os.Rename(tmp.Name(), filepath.Join(s.Dir, name)); err != nil {
+        return err
+    }
+    return syncDir(s.Dir)
+}
+
+// syncDir flushes the entries of dir to disk, making a rename within it
+// durable.
+func syncDir(dir string) error {
+    d, err := os.Open(dir)
+    if err != nil {
+        return err
+    }
+    defer d.Close()
+    return d.Sync()
+}
+
+func (s *FileSnapshotStore) Get(name string) (io.ReadCloser, error) {
+    if !validSnapshotName(name) {
+        return nil, ErrSnapshotNotFound
+    }
+    f, err := os.Open(filepath.Join(s.Dir, name))
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, ErrSnapshotNotFound
+    }
+    return f, err
+}
+
+// List returns the regular files in Dir, leaving out hidden ones.
+func (s *FileSnapshotStore) List() ([]SnapshotInfo, error) {
+    files, err := os.ReadDir(s.Dir)
+    if err != nil {
+        return nil, err
+    }
+    infos := []SnapshotInfo{}
+    for _, file := range files {
+        if !file.Type().IsRegular() || !validSnapshotName(file.Name()) {
+            continue
+        }
+        info, err := file.Info()
+        if err != nil {
+            continue
+        }
+        infos = append(infos, SnapshotInfo{Name: file.Name(), Size: info.Size(), ModTime: info.ModTime()})
+    }
+    return infos, nil
+}
+
+func (s *FileSnapshotStore) Delete(name string) error {
+    if !validSnapshotName(name) {
+        return ErrSnapshotNotFound
+    }
+    err := os.Remove(filepath.Join(s.Dir, name))
+    if errors.Is(err, os.ErrNotExist) {
+        return ErrSnapshotNotFound
+    }
+    return err
+}
+
+// MemorySnapshotStore keeps snapshots in memory, for tests and for
+// caches that only need snapshots while the process runs.
+type MemorySnapshotStore struct {
+    mutex     sync.Mutex
+    snapshots map[string]memorySnapshot
+}
+
+type memorySnapshot struct {
+    data    []byte
+    modTime time.Time
+}
+
+// NewMemorySnapshotStore returns an empty in-memory store.
+func NewMemorySnapshotStore() *MemorySnapshotStore {
+    return &MemorySnapshotStore{snapshots: make(map[string]memorySnapshot)}
+}
+
+func (s *MemorySnapshotStore) Put(name string, r io.Reader) error {
+    if !validSnapshotName(name) {
+        return fmt.Errorf("invalid snapshot name %q", name)
+    }
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return err
+    }
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    s.snapshots[name] = memorySnapshot{data: data, modTime: time.Now()}
+    return nil
+}
+
+func (s *MemorySnapshotStore) Get(name string) (io.ReadCloser, error) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    snapshot, ok := s.snapshots[name]
+    if !ok {
+        return nil, ErrSnapshotNotFound
+    }
+    // Stored data is never modified, so readers can share it.
+    return io.NopCloser(bytes.NewReader(snapshot.data)), nil
+}
+
+func (s *MemorySnapshotStore) List() ([]SnapshotInfo, error) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    infos := make([]SnapshotInfo, 0, len(s.snapshots))
+    for name, snapshot := range s.snapshots {
+        infos = append(infos, SnapshotInfo{Name: name, Size: int64(len(snapshot.data)), ModTime: snapshot.modTime})
+    }
+    return infos, nil
+}
+
+func (s *MemorySnapshotStore) Delete(name string) error {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    if _, ok := s.snapshots[name]; !ok {
+        return ErrSnapshotNotFound
+    }
+    delete(s.snapshots, name)
+    return nil
+}
+
+// PruneSnapshots deletes all but the keep newest snapshots in store whose
+// names start with prefix, ordered by modification time and then name, and
+// returns the names deleted. A non-positive keep deletes nothing. It stops
+// at the first failed deletion.
+func PruneSnapshots(store SnapshotStore, prefix string, keep int) ([]string, error) {
+    if keep <= 0 {
+        return nil, nil
+    }
+    infos, err := store.List()
+    if err != nil {
+        return nil, err
+    }
+    var matching []SnapshotInfo
+    for _, info := range infos {
+        if strings.HasPrefix(info.Name, prefix) {
+            matching = append(matching, info)
+        }
+    }
+    sort.Slice(matching, func(i, j int) bool {
+        if !matching[i].ModTime.Equal(matching[j].ModTime) {
+            return matching[i].ModTime.After(matching[j].ModTime)
+        }
+        return matching[i].Name > matching[j].Name
+    })
+    var deleted []string
+    for i := keep; i < len(matching); i++ {
+        if err := store.Delete(matching[i].Name); err != nil && !errors.Is(err, ErrSnapshotNotFound) {
+            return deleted, err
+        }
+        deleted = append(deleted, matching[i].Name)
+    }
+    return deleted, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// storedNames returns the sorted names held by store.
+func storedNames(t *testing.T, store SnapshotStore) []string {
+    t.Helper()
+    infos, err := store.List()
+    if err != nil {
+        t.Fatal(err)
+    }
+    names := make([]string, len(infos))
+    for i, info := range infos {
+        names[i] = info.Name
+    }
+    sort.Strings(names)
+    return names
+}
+
+func TestPruneSnapshots(t *testing.T) {
+    for name, store := range map[string]SnapshotStore{
+        "memory": NewMemorySnapshotStore(),
+        "file":   NewFileSnapshotStore(t.TempDir()),
+    } {
+        t.Run(name, func(t *testing.T) {
+            for i := 0; i < 5; i++ {
+                if err := store.Put(fmt.Sprintf("auto-%d", i), strings.NewReader("{}")); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            store.Put("manual", strings.NewReader("{}"))
+
+            if deleted, err := PruneSnapshots(store, "auto-", 0); err != nil || len(deleted) != 0 {
+                t.Fatalf("PruneSnapshots keeping 0 = %v, %v; want nothing deleted", deleted, err)
+            }
+            // The newest two are kept; names break ties between equal
+            // modification times, which coarse file timestamps produce.
+            deleted, err := PruneSnapshots(store, "auto-", 2)
+            if err != nil || fmt.Sprint(deleted) != "[auto-2 auto-1 auto-0]" {
+                t.Fatalf("PruneSnapshots = %v, %v; want [auto-2 auto-1 auto-0]", deleted, err)
+            }
+            if names := storedNames(t, store); fmt.Sprint(names) != "[auto-3 auto-4 manual]" {
+                t.Fatalf("store holds %v after pruning", names)
+            }
+            if deleted, err := PruneSnapshots(store, "auto-", 2); err != nil || len(deleted) != 0 {
+                t.Fatalf("pruning again = %v, %v; want nothing deleted", deleted, err)
+            }
+        })
+    }
+}
+
+func TestPruneSnapshotsOrdersByModTime(t *testing.T) {
+    store := NewMemorySnapshotStore()
+    now := time.Now()
+    // Names sorting against their age.
+    for i, name := range []string{"auto-c", "auto-b", "auto-a"} {
+        store.Put(name, strings.NewReader("{}"))
+        store.snapshots[name] = memorySnapshot{modTime: now.Add(time.Duration(i) * time.Minute)}
+    }
+    if deleted, err := PruneSnapshots(store, "auto-", 1); err != nil || fmt.Sprint(deleted) != "[auto-b auto-c]" {
+        t.Fatalf("PruneSnapshots = %v, %v; want the older [auto-b auto-c]", deleted, err)
+    }
+}
+
+func TestPruneSnapshotsSkipsPutsInProgress(t *testing.T) {
+    dir := t.TempDir()
+    store := NewFileSnapshotStore(dir)
+    for i := 0; i < 3; i++ {
+        store.Put(fmt.Sprintf("auto-%d", i), strings.NewReader("{}"))
+    }
+    // The temporary file of a Put not yet synced and renamed.
+    tmp := filepath.Join(dir, ".auto-3.tmp123")
+    if err := os.WriteFile(tmp, []byte("{"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+
+    if deleted, err := PruneSnapshots(store, "auto-", 1); err != nil || fmt.Sprint(deleted) != "[auto-1 auto-0]" {
+        t.Fatalf("PruneSnapshots = %v, %v", deleted, err)
+    }
+    if _, err := os.Stat(tmp); err != nil {
+        t.Fatalf("pruning touched a Put in progress: %v", err)
+    }
+}
+
+func TestBackupHandlerKeepsNewest(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(10)
+    store := NewMemorySnapshotStore()
+    store.Put("auto-snapshot", strings.NewReader("{}"))
+    router := gin.New()
+    router.POST("/admin/backup", backupHandler(cache, store, 2))
+
+    var names []string
+    for i := 0; i < 4; i++ {
+        cache.Set("k", i, 0)
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/backup", nil))
+        if rec.Code != http.StatusOK {
+            t.Fatalf("POST /admin/backup = %d %s", rec.Code, rec.Body)
+        }
+        backups, err := ListBackups(store)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if want := min(i+1, 2); len(backups) != want {
+            t.Fatalf("%d backups after %d POSTs, want %d", len(backups), i+1, want)
+        }
+        names = append(names, backups[0].Name)
+    }
+
+    backups, _ := ListBackups(store)
+    if backups[0].Name != names[3] || backups[1].Name != names[2] {
+        t.Fatalf("kept %+v, want the newest %s and %s", backups, names[3], names[2])
+    }
+    if _, err := store.Get("auto-snapshot"); err != nil {
+        t.Fatalf("pruning backups removed another snapshot: %v", err)
+    }
+    n, _, err := cache.RestoreBackup(store, names[2])
+    if err != nil || n != 1 || cache.Get("k") != 2.0 {
+        t.Fatalf("RestoreBackup of a kept backup = %d, %v; k = %v", n, err, cache.Get("k"))
+    }
+}
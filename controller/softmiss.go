@@ -0,0 +1,21 @@
+package main
+
+import (
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+)
+
+// softMissHeader lets a request choose how GET /cache/:key reports a
+// missing key, overriding the server's -soft-miss setting.
+const softMissHeader = "X-Soft-Miss"
+
+// softMiss reports whether GET /cache/:key should answer a miss with 200
+// and {"found": false} instead of 404: as the request's X-Soft-Miss header
+// says if it holds a boolean, and otherwise as configured.
+func softMiss(c *gin.Context, configured bool) bool {
+    if soft, err := strconv.ParseBool(c.GetHeader(softMissHeader)); err == nil {
+        return soft
+    }
+    return configured
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestGetHandlerSoftMiss(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    const (
+        hard = `{"error":"key not found"}`
+        soft = `{"found":false}`
+        hit  = `{"value":"v"}`
+    )
+    for _, tc := range []struct {
+        configured bool
+        header     string
+        miss       string
+    }{
+        {false, "", hard},
+        {true, "", soft},
+        {false, "true", soft},
+        {true, "false", hard},
+        {true, "1", soft},
+        // A header that is not a boolean leaves the configured mode.
+        {false, "yes", hard},
+        {true, "yes", soft},
+    } {
+        clock := newFakeClock()
+        cache := NewLRUCache(10, WithClock(clock.Now))
+        cache.Set("k", "v", 0)
+        cache.Set("expired", "v", time.Second)
+        clock.Advance(time.Second)
+        router := gin.New()
+        router.GET("/cache/:key", getHandler(cache, 0, tc.configured))
+
+        for key, want := range map[string]string{"missing": tc.miss, "expired": tc.miss, "k": hit} {
+            req := httptest.NewRequest(http.MethodGet, "/cache/"+key, nil)
+            if tc.header != "" {
+                req.Header.Set(softMissHeader, tc.header)
+            }
+            rec := httptest.NewRecorder()
+            router.ServeHTTP(rec, req)
+
+            status := http.StatusOK
+            if want == hard {
+                status = http.StatusNotFound
+            }
+            if rec.Code != status || strings.TrimSpace(rec.Body.String()) != want {
+                t.Errorf("configured %v, %s %q: GET %s = %d %s, want %d %s", tc.configured, softMissHeader, tc.header, key, rec.Code, rec.Body, status, want)
+            }
+        }
+    }
+}
+
+func TestServeHTTPSoftMiss(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("k", "v", 0)
+    for _, tc := range []struct {
+        header, key string
+        status      int
+        body        string
+    }{
+        {"", "missing", http.StatusNotFound, `{"error":"key not found"}`},
+        {"true", "missing", http.StatusOK, `{"found":false}`},
+        {"true", "k", http.StatusOK, `{"value":"v"}`},
+    } {
+        req := httptest.NewRequest(http.MethodGet, "/"+tc.key, nil)
+        if tc.header != "" {
+            req.Header.Set(softMissHeader, tc.header)
+        }
+        rec := httptest.NewRecorder()
+        cache.ServeHTTP(rec, req)
+        if rec.Code != tc.status || strings.TrimSpace(rec.Body.String()) != tc.body {
+            t.Errorf("%s %q: GET /%s = %d %s, want %d %s", softMissHeader, tc.header, tc.key, rec.Code, rec.Body, tc.status, tc.body)
+        }
+    }
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    // sseBufferSize is the number of events an /events client may fall
+    // behind by before its stream is ended.
+    sseBufferSize = 1024
+    // sseHeartbeatInterval is how often a comment is sent on an idle
+    // stream so proxies do not time it out.
+    sseHeartbeatInterval = 15 * time.Second
+)
+
+// GapMessage is the data of the "gap" event sent first to a client that
+// reconnects with a Last-Event-ID other than the ID of the last event
+// applied, telling it that events were missed and it should resynchronise,
+// for example from /cache-state. Events are not replayed.
+type GapMessage struct {
+    LastEventID uint64 `json:"last_event_id"`
+    CurrentID   uint64 `json:"current_id"`
+}
+
+// eventStreamHandler serves GET /events, a Server-Sent Events stream of the
+// changes to keys starting with the prefix query parameter. Each event is
+// named after the StateMessage type it carries as data, "set", "delete",
+// "evict" or "expire", and has the change's KeyEvent Seq as its ID.
+//
+// The IDs count the changes to every key, so with a prefix a gap may be
+// reported even though none of the missed changes matched it. A client
+// that falls sseBufferSize events behind has its stream ended, and is told
+// of the gap when it reconnects. The stream ends with a "shutdown" event
+// once done is closed.
+func eventStreamHandler(cache *LRUCache, done <-chan struct{}) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var lastID uint64
+        resuming := false
+        if header := c.GetHeader("Last-Event-ID"); header != "" {
+            id, err := strconv.ParseUint(header, 10, 64)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "Last-Event-ID", Reason: "must be an event ID"}}})
+                return
+            }
+            lastID, resuming = id, true
+        }
+
+        sub, seq := cache.subscribe(c.Query("prefix"), sseBufferSize, true)
+        defer cache.unsubscribe(sub)
+
+        c.Header("Content-Type", "text/event-stream")
+        c.Header("Cache-Control", "no-cache")
+        c.Header("X-Accel-Buffering", "no")
+        c.Status(http.StatusOK)
+        if resuming && lastID != seq {
+            writeSSE(c, "gap", "", GapMessage{LastEventID: lastID, CurrentID: seq})
+        }
+        c.Writer.Flush()
+
+        heartbeat := time.NewTicker(sseHeartbeatInterval)
+        defer heartbeat.Stop()
+        for {
+            select {
+            case event, ok := <-sub.events:
+                // A closed channel means the client fell too far behind.
+                if !ok {
+                    return
+                }
+                message := stateMessage(event)
+                writeSSE(c, message.Type, strconv.FormatUint(event.Seq, 10), message)
+            case <-c.Request.Context().Done():
+                return
+            case <-heartbeat.C:
+                fmt.Fprint(c.Writer, ": heartbeat\n\n")
+            case <-done:
+                writeSSE(c, "shutdown", "", struct{}{})
+                c.Writer.Flush()
+                return
+            }
+            c.Writer.Flush()
+        }
+    }
+}
+
+// writeSSE writes one event named name with data encoded as JSON, and an
+// id line unless id is empty.
+func writeSSE(c *gin.Context, name, id string, data interface{}) {
+    encoded, err := json.Marshal(data)
+    if err != nil {
+        encoded = []byte(`{}`)
+    }
+    if id != "" {
+        fmt.Fprintf(c.Writer, "id: %s\n", id)
+    }
+    fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", name, encoded)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// sseEvent is one event read from a Server-Sent Events stream.
+type sseEvent struct {
+    id, name, data string
+}
+
+// sseStream reads events from an /events response as they arrive.
+type sseStream struct {
+    t    *testing.T
+    resp *http.Response
+    r    *bufio.Reader
+}
+
+// startEventStream serves /events for cache and returns the server's URL
+// and the channel ending its streams.
+func startEventStream(t *testing.T, cache *LRUCache) (string, chan struct{}) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    done := make(chan struct{})
+    router := gin.New()
+    router.GET("/events", eventStreamHandler(cache, done))
+    server := httptest.NewServer(router)
+    t.Cleanup(server.Close)
+    return server.URL, done
+}
+
+// openEventStream requests url with Last-Event-ID set to lastID unless it
+// is empty. The cache is subscribed to once it returns.
+func openEventStream(t *testing.T, url, lastID string) *sseStream {
+    t.Helper()
+    req, _ := http.NewRequest(http.MethodGet, url, nil)
+    if lastID != "" {
+        req.Header.Set("Last-Event-ID", lastID)
+    }
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { resp.Body.Close() })
+    if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+        t.Fatalf("GET /events = %s, %s", resp.Status, resp.Header.Get("Content-Type"))
+    }
+    return &sseStream{t: t, resp: resp, r: bufio.NewReader(resp.Body)}
+}
+
+// next reads the next event, failing the test if none arrives in time.
+func (s *sseStream) next() sseEvent {
+    s.t.Helper()
+    events := make(chan sseEvent, 1)
+    errs := make(chan error, 1)
+    go func() {
+        var event sseEvent
+        for {
+            line, err := s.r.ReadString('\n')
+            if err != nil {
+                errs <- err
+                return
+            }
+            line = strings.TrimSuffix(line, "\n")
+            switch {
+            case line == "":
+                events <- event
+                return
+            case strings.HasPrefix(line, "id: "):
+                event.id = strings.TrimPrefix(line, "id: ")
+            case strings.HasPrefix(line, "event: "):
+                event.name = strings.TrimPrefix(line, "event: ")
+            case strings.HasPrefix(line, "data: "):
+                event.data = strings.TrimPrefix(line, "data: ")
+            }
+        }
+    }()
+    select {
+    case event := <-events:
+        return event
+    case err := <-errs:
+        s.t.Fatalf("stream ended: %v", err)
+    case <-time.After(5 * time.Second):
+        s.t.Fatal("no event received")
+    }
+    return sseEvent{}
+}
+
+func TestEventStreamOrdering(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(2, WithClock(clock.Now))
+    url, _ := startEventStream(t, cache)
+    stream := openEventStream(t, url+"/events?prefix=user:", "")
+
+    cache.Set("user:1", "a", 0)
+    cache.Set("other", "x", 0)
+    cache.Set("user:1", "b", time.Second)
+    cache.Set("user:2", "c", 0) // evicts other
+    cache.Set("user:3", "d", 0) // evicts user:1
+    cache.Delete("user:2")
+    cache.Set("user:4", "e", time.Second)
+    clock.Advance(2 * time.Second)
+    cache.Get("user:4")
+
+    var got []string
+    var lastID uint64
+    for i := 0; i < 8; i++ {
+        event := stream.next()
+        id, err := strconv.ParseUint(event.id, 10, 64)
+        if err != nil || id <= lastID {
+            t.Fatalf("event %d has id %q after %d", i, event.id, lastID)
+        }
+        lastID = id
+        var message StateMessage
+        if err := json.Unmarshal([]byte(event.data), &message); err != nil || message.Type != event.name {
+            t.Fatalf("event %s carries %q", event.name, event.data)
+        }
+        got = append(got, describeMessage(message))
+    }
+    want := "set user:1 a, set user:1 b, set user:2 c, set user:3 d, evict user:1 capacity, delete user:2 deleted, set user:4 e, expire user:4 expired"
+    if strings.Join(got, ", ") != want {
+        t.Fatalf("events:\n%s\nwant:\n%s", strings.Join(got, ", "), want)
+    }
+}
+
+// describeMessage describes a message as type, key and value or reason.
+func describeMessage(message StateMessage) string {
+    if message.Type == "set" {
+        return message.Type + " " + message.Key + " " + message.Value.(string)
+    }
+    return message.Type + " " + message.Key + " " + message.Reason
+}
+
+func TestEventStreamSignalsGap(t *testing.T) {
+    cache := NewLRUCache(10)
+    url, _ := startEventStream(t, cache)
+    stream := openEventStream(t, url+"/events", "")
+    cache.Set("a", 1, 0)
+    seen := stream.next().id
+    stream.resp.Body.Close()
+
+    // Reconnecting with the ID of the last change finds nothing missed.
+    stream = openEventStream(t, url+"/events", seen)
+    cache.Set("b", 2, 0)
+    if event := stream.next(); event.name != "set" {
+        t.Fatalf("first event after an up-to-date reconnect = %+v", event)
+    }
+    stream.resp.Body.Close()
+
+    // Changes made while disconnected are reported as a gap.
+    cache.Set("c", 3, 0)
+    stream = openEventStream(t, url+"/events", seen)
+    event := stream.next()
+    var gap GapMessage
+    if event.name != "gap" || json.Unmarshal([]byte(event.data), &gap) != nil {
+        t.Fatalf("first event after missing changes = %+v, want a gap", event)
+    }
+    if strconv.FormatUint(gap.LastEventID, 10) != seen || gap.CurrentID != gap.LastEventID+2 {
+        t.Fatalf("gap = %+v after event %s and two more changes", gap, seen)
+    }
+
+    req, _ := http.NewRequest(http.MethodGet, url+"/events", nil)
+    req.Header.Set("Last-Event-ID", "yesterday")
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadRequest {
+        t.Fatalf("bad Last-Event-ID = %d, want 400", resp.StatusCode)
+    }
+}
+
+func TestEventStreamShutdown(t *testing.T) {
+    cache := NewLRUCache(10)
+    url, done := startEventStream(t, cache)
+    stream := openEventStream(t, url+"/events", "")
+
+    close(done)
+    if event := stream.next(); event.name != "shutdown" {
+        t.Fatalf("event on shutdown = %+v", event)
+    }
+    if _, err := io.ReadAll(stream.r); err != nil {
+        t.Fatalf("stream did not end cleanly: %v", err)
+    }
+    waitUntil(t, "the subscriber to be removed", func() bool { return subscribers(cache) == 0 })
+}
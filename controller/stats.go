@@ -0,0 +1,238 @@
+package main
+
+import (
+    "container/list"
+    "net/http"
+    "runtime"
+    "strconv"
+    "sync/atomic"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// processStart is used to report the process uptime.
+var processStart = time.Now()
+
+// cacheCounters holds the operation counters of an LRUCache. They are
+// updated atomically so they can be read without taking the cache lock.
+type cacheCounters struct {
+    hits        atomic.Uint64
+    misses      atomic.Uint64
+    inserts     atomic.Uint64
+    updates     atomic.Uint64
+    deletes     atomic.Uint64
+    evictions   atomic.Uint64
+    expirations atomic.Uint64
+    clears      atomic.Uint64
+}
+
+// reset zeroes every counter.
+func (s *cacheCounters) reset() {
+    s.hits.Store(0)
+    s.misses.Store(0)
+    s.inserts.Store(0)
+    s.updates.Store(0)
+    s.deletes.Store(0)
+    s.evictions.Store(0)
+    s.expirations.Store(0)
+    s.clears.Store(0)
+}
+
+// CacheStats is a point-in-time view of the cache counters. Evictions count
+// entries removed to make room, while Expirations count entries removed
+// because their TTL elapsed.
+type CacheStats struct {
+    Hits        uint64  `json:"hits"`
+    Misses      uint64  `json:"misses"`
+    HitRatio    float64 `json:"hit_ratio"`
+    Inserts     uint64  `json:"inserts"`
+    Updates     uint64  `json:"updates"`
+    Deletes     uint64  `json:"deletes"`
+    Evictions   uint64  `json:"evictions"`
+    Expirations uint64  `json:"expirations"`
+    Clears      uint64  `json:"clears"`
+    Size        int     `json:"size"`
+    Capacity    int     `json:"capacity"`
+    BytesUsed   int64   `json:"bytes_used"`
+    MaxBytes    int64   `json:"max_bytes"`
+}
+
+// Stats returns the current counters along with the cache size and
+// capacity. Counters survive ClearCache; use ResetStats to zero them.
+func (c *LRUCache) Stats() CacheStats {
+    c.mutex.RLock()
+    size, capacity, bytesUsed := len(c.cache), c.capacity, c.totalBytes
+    c.mutex.RUnlock()
+
+    stats := CacheStats{
+        Hits:        c.stats.hits.Load(),
+        Misses:      c.stats.misses.Load(),
+        Inserts:     c.stats.inserts.Load(),
+        Updates:     c.stats.updates.Load(),
+        Deletes:     c.stats.deletes.Load(),
+        Evictions:   c.stats.evictions.Load(),
+        Expirations: c.stats.expirations.Load(),
+        Clears:      c.stats.clears.Load(),
+        Size:        size,
+        Capacity:    capacity,
+        BytesUsed:   bytesUsed,
+        MaxBytes:    c.maxBytes,
+    }
+    if total := stats.Hits + stats.Misses; total > 0 {
+        stats.HitRatio = float64(stats.Hits) / float64(total)
+    }
+    return stats
+}
+
+// Sets returns the number of Set calls since the cache was created. It is
+// not affected by ClearCache or ResetStats.
+func (c *LRUCache) Sets() int {
+    return int(c.totalSets.Load())
+}
+
+// Gets returns the number of Get calls since the cache was created. It is
+// not affected by ClearCache or ResetStats.
+func (c *LRUCache) Gets() int {
+    return int(c.totalGets.Load())
+}
+
+// EvictionCount returns the number of entries evicted to make room since the
+// cache was created or the counters were last reset.
+func (c *LRUCache) EvictionCount() uint64 {
+    return c.stats.evictions.Load()
+}
+
+// OldestEntry returns the key of the least recently used entry and the time
+// since it was inserted, or ("", 0) if the cache is empty.
+func (c *LRUCache) OldestEntry() (key string, age time.Duration) {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    return entryAge(c.list.Back())
+}
+
+// NewestEntry returns the key of the most recently used entry and the time
+// since it was inserted, or ("", 0) if the cache is empty.
+func (c *LRUCache) NewestEntry() (key string, age time.Duration) {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    return entryAge(c.list.Front())
+}
+
+// AverageAge returns the mean time since insertion of the live entries, or
+// zero if there are none. It scans every entry under the read lock rather
+// than maintaining a running sum, which keeps writes cheap and excludes
+// expired entries that have not been removed yet; the scan is only paid
+// when stats are read.
+func (c *LRUCache) AverageAge() time.Duration {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+
+    now := c.now()
+    var total time.Duration
+    var n int
+    for element := c.list.Front(); element != nil; element = element.Next() {
+        entry := element.Value.(*cacheEntry)
+        if entry.expired(now) {
+            continue
+        }
+        total += now.Sub(entry.createdAt)
+        n++
+    }
+    if n == 0 {
+        return 0
+    }
+    return total / time.Duration(n)
+}
+
+// entryAge returns the key and age of the entry held by element, which may
+// be nil.
+func entryAge(element *list.Element) (string, time.Duration) {
+    if element == nil {
+        return "", 0
+    }
+    entry := element.Value.(*cacheEntry)
+    return entry.key, time.Since(entry.createdAt)
+}
+
+// ResetStats zeroes the operation counters, the latency and value size
+// histograms and the rolling window without touching the entries. Counters
+// are only updated under the write lock, so taking it makes the reset
+// atomic with respect to cache operations.
+func (c *LRUCache) ResetStats() {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    c.stats.reset()
+    c.recent.reset()
+    c.latency.reset()
+    c.valueSizes.reset()
+    c.resetAt.Store(c.now().UnixNano())
+}
+
+// StatsResetAt returns when ResetStats was last called, or the zero time if
+// the counters have never been reset.
+func (c *LRUCache) StatsResetAt() time.Time {
+    if at := c.resetAt.Load(); at != 0 {
+        return time.Unix(0, at)
+    }
+    return time.Time{}
+}
+
+// statsHandler serves GET /stats. With ?window=N it also reports, as
+// "window", the statistics of the last N seconds, up to 300.
+func statsHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var window time.Duration
+        if raw := c.Query("window"); raw != "" {
+            seconds, err := strconv.Atoi(raw)
+            if err != nil || seconds < 1 || time.Duration(seconds)*time.Second > maxStatsWindow {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "window", Reason: "must be a number of seconds between 1 and 300"}}})
+                return
+            }
+            window = time.Duration(seconds) * time.Second
+        }
+        var mem runtime.MemStats
+        runtime.ReadMemStats(&mem)
+        oldestKey, oldestAge := cache.OldestEntry()
+        newestKey, newestAge := cache.NewestEntry()
+
+        body := gin.H{
+            "cache":               cache.Stats(),
+            "recent":              cache.RecentStats(),
+            "eviction_count":      cache.EvictionCount(),
+            "sets":                cache.Sets(),
+            "gets":                cache.Gets(),
+            "latency":             cache.OperationLatencies(),
+            "loader":              gin.H{"in_flight": cache.LoadsInFlight(), "concurrency_limit": cache.LoaderConcurrency()},
+            "oldest_entry":        gin.H{"key": oldestKey, "age_seconds": oldestAge.Seconds()},
+            "newest_entry":        gin.H{"key": newestKey, "age_seconds": newestAge.Seconds()},
+            "average_age_seconds": cache.AverageAge().Seconds(),
+            "uptime_seconds":      int64(time.Since(processStart).Seconds()),
+            "process": gin.H{
+                "heap_alloc_bytes": mem.HeapAlloc,
+                "heap_inuse_bytes": mem.HeapInuse,
+                "sys_bytes":        mem.Sys,
+                "num_gc":           mem.NumGC,
+            },
+        }
+        if window > 0 {
+            body["window"] = cache.StatsWindow(window)
+        }
+        if resetAt := cache.StatsResetAt(); !resetAt.IsZero() {
+            body["reset_at"] = resetAt
+        }
+        if snapshot := cache.LastSnapshot(); snapshot != nil {
+            body["last_snapshot"] = snapshot
+        }
+        if writeBehind := cache.WriteBehindStats(); writeBehind != nil {
+            body["write_behind"] = writeBehind
+        }
+        if replication := cache.ReplicationStatus(); replication != nil {
+            body["replication"] = replication
+        }
+        respond(c, http.StatusOK, body)
+    }
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestAverageAge(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    if age := cache.AverageAge(); age != 0 {
+        t.Fatalf("AverageAge of an empty cache = %v, want 0", age)
+    }
+
+    cache.Set("a", 1, 0)
+    clock.Advance(10 * time.Second)
+    cache.Set("b", 2, 0)
+    clock.Advance(10 * time.Second)
+    cache.Set("c", 3, 5*time.Second)
+    if age := cache.AverageAge(); age != 10*time.Second {
+        t.Fatalf("AverageAge = %v, want 10s", age)
+    }
+
+    // c has expired, and overwriting a keeps its creation time.
+    clock.Advance(10 * time.Second)
+    cache.Set("a", 4, 0)
+    if age := cache.AverageAge(); age != 25*time.Second {
+        t.Fatalf("AverageAge = %v, want 25s", age)
+    }
+
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.GET("/metrics", metricsHandler(cache, newHTTPMetrics()))
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+    series, _ := parseMetrics(t, rec.Body.String())
+    if got := series["cache_average_entry_age_seconds"]; got != 25 {
+        t.Fatalf("cache_average_entry_age_seconds = %v, want 25", got)
+    }
+}
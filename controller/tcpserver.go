@@ -0,0 +1,95 @@
+package main
+
+import (
+    "bufio"
+    "errors"
+    "io"
+    "log/slog"
+    "net"
+    "sync"
+    "time"
+)
+
+// tcpServer accepts connections for one of the wire protocol listeners and
+// serves each in its own goroutine, tracking them so stop can wait for
+// them to finish.
+type tcpServer struct {
+    name     string
+    listener net.Listener
+    serve    func(r *bufio.Reader, w *bufio.Writer)
+
+    mutex  sync.Mutex
+    conns  map[net.Conn]struct{}
+    closed bool
+    wg     sync.WaitGroup
+}
+
+// startTCPServer listens on addr and calls serve for every connection
+// until it returns, then closes the connection. serve should return when a
+// read fails. The returned stop function closes the listener, makes
+// pending reads fail so each connection finishes the request it is
+// handling, and waits for them to exit.
+func startTCPServer(name, addr string, serve func(r *bufio.Reader, w *bufio.Writer)) (stop func(), err error) {
+    listener, err := net.Listen("tcp", addr)
+    if err != nil {
+        return nil, err
+    }
+    s := &tcpServer{name: name, listener: listener, serve: serve, conns: make(map[net.Conn]struct{})}
+    s.wg.Add(1)
+    go s.accept()
+    slog.Info(name+" listener started", "addr", listener.Addr().String())
+    return s.stop, nil
+}
+
+func (s *tcpServer) accept() {
+    defer s.wg.Done()
+    for {
+        conn, err := s.listener.Accept()
+        if err != nil {
+            if !errors.Is(err, net.ErrClosed) {
+                slog.Error(s.name+" accept failed", "error", err)
+            }
+            return
+        }
+        s.mutex.Lock()
+        if s.closed {
+            s.mutex.Unlock()
+            conn.Close()
+            return
+        }
+        s.conns[conn] = struct{}{}
+        s.wg.Add(1)
+        s.mutex.Unlock()
+        go s.handle(conn)
+    }
+}
+
+func (s *tcpServer) handle(conn net.Conn) {
+    defer s.wg.Done()
+    defer func() {
+        s.mutex.Lock()
+        delete(s.conns, conn)
+        s.mutex.Unlock()
+        conn.Close()
+    }()
+
+    s.serve(bufio.NewReader(conn), bufio.NewWriter(conn))
+}
+
+func (s *tcpServer) stop() {
+    s.mutex.Lock()
+    s.closed = true
+    s.listener.Close()
+    for conn := range s.conns {
+        conn.SetReadDeadline(time.Now())
+    }
+    s.mutex.Unlock()
+    s.wg.Wait()
+}
+
+// isDisconnect reports whether a read error means the client went away or
+// the server is stopping, rather than a protocol error worth reporting.
+func isDisconnect(err error) bool {
+    var netErr net.Error
+    return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || (errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/propagation"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans enables tracing into a span recorder for the rest of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+    recorder := tracetest.NewSpanRecorder()
+    provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+    propagator := otel.GetTextMapPropagator()
+    otel.SetTextMapPropagator(propagation.TraceContext{})
+    tracer = provider.Tracer("test")
+    t.Cleanup(func() {
+        tracer = nil
+        otel.SetTextMapPropagator(propagator)
+    })
+    return recorder
+}
+
+// spansByName indexes spans by name, failing the test if a name repeats.
+func spansByName(t *testing.T, spans []sdktrace.ReadOnlySpan) map[string]sdktrace.ReadOnlySpan {
+    t.Helper()
+    byName := make(map[string]sdktrace.ReadOnlySpan)
+    for _, span := range spans {
+        if _, ok := byName[span.Name()]; ok {
+            t.Fatalf("more than one %s span", span.Name())
+        }
+        byName[span.Name()] = span
+    }
+    return byName
+}
+
+func TestTracingSpans(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(1)
+    cache.Set("old", 1, 0)
+    recorder := recordSpans(t)
+
+    router := gin.New()
+    router.Use(tracingMiddleware())
+    router.POST("/cache/:key", func(c *gin.Context) {
+        ctx := c.Request.Context()
+        cache.GetCtx(ctx, c.Param("key"))
+        cache.SetCtx(ctx, c.Param("key"), "value", 0)
+        c.Status(http.StatusOK)
+    })
+    req := httptest.NewRequest(http.MethodPost, "/cache/user@example.com", nil)
+    req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+    router.ServeHTTP(httptest.NewRecorder(), req)
+
+    spans := spansByName(t, recorder.Ended())
+    server, get, set, evict := spans["POST /cache/:key"], spans["cache.get"], spans["cache.set"], spans["cache.evict"]
+    if server == nil || get == nil || set == nil || evict == nil {
+        t.Fatalf("spans = %v", spans)
+    }
+    if server.SpanKind() != trace.SpanKindServer || server.Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !server.Parent().IsRemote() {
+        t.Fatalf("server span %v does not continue the incoming trace", server.Parent())
+    }
+    for child, parent := range map[sdktrace.ReadOnlySpan]sdktrace.ReadOnlySpan{get: server, set: server, evict: set} {
+        if child.Parent().SpanID() != parent.SpanContext().SpanID() {
+            t.Errorf("%s is not a child of %s", child.Name(), parent.Name())
+        }
+    }
+
+    attrs := make(map[string]string)
+    for _, span := range []sdktrace.ReadOnlySpan{server, get, set, evict} {
+        for _, kv := range span.Attributes() {
+            attrs[span.Name()+" "+string(kv.Key)] = kv.Value.Emit()
+            if kv.Value.Emit() == "user@example.com" {
+                t.Errorf("%s exports the key as %s", span.Name(), kv.Key)
+            }
+        }
+    }
+    for name, want := range map[string]string{
+        "POST /cache/:key http.route":                "/cache/:key",
+        "POST /cache/:key http.response.status_code": "200",
+        "cache.get cache.key_hash":                   keyHash("user@example.com"),
+        "cache.get cache.hit":                        "false",
+        "cache.set cache.value_size":                 "5",
+        "cache.evict cache.evicted":                  "1",
+    } {
+        if attrs[name] != want {
+            t.Errorf("%s = %q, want %q", name, attrs[name], want)
+        }
+    }
+}
+
+func TestTracingDisabled(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(10)
+    router := gin.New()
+    router.Use(tracingMiddleware())
+    router.GET("/", func(c *gin.Context) {
+        if trace.SpanFromContext(c.Request.Context()).SpanContext().IsValid() {
+            t.Error("a span was started with tracing disabled")
+        }
+        cache.GetCtx(c.Request.Context(), "k")
+    })
+    router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "time"
+)
+
+// ErrTxDone is returned by Commit and Rollback on a transaction that has
+// already been committed or rolled back.
+var ErrTxDone = errors.New("transaction already committed or rolled back")
+
+// TransactionalCache wraps an LRUCache to stage groups of writes that are
+// applied all together or not at all.
+type TransactionalCache struct {
+    cache *LRUCache
+}
+
+// NewTransactionalCache returns a TransactionalCache over cache. The cache
+// can still be used directly.
+func NewTransactionalCache(cache *LRUCache) *TransactionalCache {
+    return &TransactionalCache{cache: cache}
+}
+
+// Begin starts a transaction.
+func (t *TransactionalCache) Begin() *Transaction {
+    return &Transaction{cache: t.cache, pending: make(map[string]txWrite)}
+}
+
+// Transaction buffers Set and Delete calls until Commit applies them to the
+// cache under a single acquisition of its write lock, so other goroutines
+// see either none or all of them. Reads through the transaction see its own
+// buffered writes. Transactions do not detect conflicts: when two commit
+// writes to the same key, the later commit wins. A Transaction is safe for
+// concurrent use, though its writes are applied in the order they were
+// made.
+type Transaction struct {
+    mutex   sync.Mutex
+    cache   *LRUCache
+    writes  []txWrite
+    pending map[string]txWrite
+    done    bool
+}
+
+// txWrite is a buffered write. A nil set means a delete.
+type txWrite struct {
+    key string
+    set *BatchEntry
+}
+
+// Set buffers storing value under key for ttl. The TTL starts counting at
+// Commit.
+func (tx *Transaction) Set(key string, value interface{}, ttl time.Duration) {
+    tx.buffer(txWrite{key: key, set: &BatchEntry{Key: key, Value: value, TTL: ttl}})
+}
+
+// Delete buffers removing key.
+func (tx *Transaction) Delete(key string) {
+    tx.buffer(txWrite{key: key})
+}
+
+// buffer records w, unless the transaction is done, in which case writes
+// are ignored.
+func (tx *Transaction) buffer(w txWrite) {
+    tx.mutex.Lock()
+    defer tx.mutex.Unlock()
+
+    if tx.done {
+        return
+    }
+    tx.writes = append(tx.writes, w)
+    tx.pending[w.key] = w
+}
+
+// Get returns the value of key as the transaction sees it: the last
+// buffered write to key if there is one, and the cache's value otherwise.
+// Once the transaction is done it reads the cache directly.
+func (tx *Transaction) Get(key string) (interface{}, bool) {
+    tx.mutex.Lock()
+    w, ok := tx.pending[key]
+    tx.mutex.Unlock()
+
+    if ok {
+        if w.set == nil {
+            return nil, false
+        }
+        return w.set.Value, true
+    }
+    value, err := tx.cache.GetCtx(context.Background(), key)
+    return value, err == nil
+}
+
+// Commit applies the buffered writes in order. It fails without applying
+// anything if the cache is read-only or the transaction is already done.
+func (tx *Transaction) Commit() error {
+    tx.mutex.Lock()
+    defer tx.mutex.Unlock()
+
+    if tx.done {
+        return ErrTxDone
+    }
+    if err := tx.cache.checkWritable("commit", ""); err != nil {
+        return err
+    }
+    writes := tx.writes
+    tx.done = true
+    tx.writes = nil
+    clear(tx.pending)
+
+    c := tx.cache
+    c.mutex.Lock()
+    defer c.unlock()
+
+    for _, w := range writes {
+        if w.set != nil {
+            c.set(w.key, w.set.Value, c.expirationTime(w.set.TTL))
+        } else if element, ok := c.cache[w.key]; ok {
+            c.removeElement(element, removedDeleted, "")
+        } else {
+            c.queueWrite(writeOp{key: w.key, deleted: true})
+        }
+    }
+    return nil
+}
+
+// Rollback discards the buffered writes.
+func (tx *Transaction) Rollback() error {
+    tx.mutex.Lock()
+    defer tx.mutex.Unlock()
+
+    if tx.done {
+        return ErrTxDone
+    }
+    tx.done = true
+    tx.writes = nil
+    clear(tx.pending)
+    return nil
+}
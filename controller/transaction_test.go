@@ -0,0 +1,127 @@
+package main
+
+import (
+    "errors"
+    "sync"
+    "testing"
+)
+
+func TestTransactionCommit(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("a", 1, 0)
+    cache.Set("b", 2, 0)
+    tx := NewTransactionalCache(cache).Begin()
+    tx.Set("a", 10, 0)
+    tx.Delete("b")
+    tx.Set("c", 3, 0)
+    tx.Set("c", 30, 0)
+
+    // The transaction reads its own writes; the cache does not see them.
+    for key, want := range map[string]interface{}{"a": 10, "b": nil, "c": 30} {
+        if got, _ := tx.Get(key); got != want {
+            t.Errorf("tx.Get(%s) = %v, want %v", key, got, want)
+        }
+    }
+    if cache.Get("a") != 1 || cache.Get("b") != 2 || cache.ContainsKey("c") {
+        t.Fatal("buffered writes reached the cache before Commit")
+    }
+
+    if err := tx.Commit(); err != nil {
+        t.Fatal(err)
+    }
+    if cache.Get("a") != 10 || cache.ContainsKey("b") || cache.Get("c") != 30 {
+        t.Fatalf("cache after Commit = %v", cache.Snapshot())
+    }
+    if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+        t.Fatalf("second Commit = %v, want ErrTxDone", err)
+    }
+    checkConsistent(t, cache)
+}
+
+func TestTransactionRollback(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("a", 1, 0)
+    tx := NewTransactionalCache(cache).Begin()
+    tx.Set("a", 10, 0)
+    tx.Delete("a")
+    tx.Set("b", 2, 0)
+
+    if err := tx.Rollback(); err != nil {
+        t.Fatal(err)
+    }
+    if cache.Get("a") != 1 || cache.ContainsKey("b") || cache.Len() != 1 {
+        t.Fatalf("cache after Rollback = %v", cache.Snapshot())
+    }
+    if got, ok := tx.Get("a"); got != 1 || !ok {
+        t.Fatalf("tx.Get after Rollback = %v, %v; want the cache's value", got, ok)
+    }
+    if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+        t.Fatalf("Commit after Rollback = %v, want ErrTxDone", err)
+    }
+}
+
+func TestTransactionCommitReadOnly(t *testing.T) {
+    cache := NewLRUCache(10)
+    tx := NewTransactionalCache(cache).Begin()
+    tx.Set("a", 1, 0)
+    cache.SetReadOnly(true)
+    if err := tx.Commit(); !errors.Is(err, ErrReadOnly) {
+        t.Fatalf("Commit = %v, want ErrReadOnly", err)
+    }
+    cache.SetReadOnly(false)
+    if err := tx.Commit(); err != nil || cache.Get("a") != 1 {
+        t.Fatalf("Commit once writable = %v, a = %v", err, cache.Get("a"))
+    }
+}
+
+func TestConcurrentTransactionsAreAtomic(t *testing.T) {
+    cache := NewLRUCache(10)
+    txCache := NewTransactionalCache(cache)
+    cache.Set("x", 0, 0)
+    cache.Set("y", 0, 0)
+
+    const writers, commits = 8, 200
+    done := make(chan struct{})
+    var readers sync.WaitGroup
+    readers.Add(1)
+    go func() {
+        defer readers.Done()
+        for {
+            select {
+            case <-done:
+                return
+            default:
+            }
+            // Snapshot reads under one lock, so it sees whole commits.
+            values := map[string]interface{}{}
+            for _, view := range cache.Snapshot() {
+                values[view.Key] = view.Value
+            }
+            if values["x"] != values["y"] {
+                t.Errorf("saw x = %v and y = %v, half of a commit", values["x"], values["y"])
+                return
+            }
+        }
+    }()
+
+    var wg sync.WaitGroup
+    for w := 0; w < writers; w++ {
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            for i := 0; i < commits; i++ {
+                tx := txCache.Begin()
+                tx.Set("x", w*commits+i, 0)
+                tx.Set("y", w*commits+i, 0)
+                if err := tx.Commit(); err != nil {
+                    t.Error(err)
+                    return
+                }
+            }
+        }(w)
+    }
+    wg.Wait()
+    close(done)
+    readers.Wait()
+    checkConsistent(t, cache)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+    "context"
+    "time"
+)
+
+const (
+    // lockPollMin and lockPollMax bound the interval at which a bounded
+    // wait retries the lock, doubling from the first to the second.
+    lockPollMin = 10 * time.Microsecond
+    lockPollMax = time.Millisecond
+)
+
+// lockWaitKey is the context key marking operations that wait for the
+// cache lock for a bounded time; see withLockWait.
+type lockWaitKey struct{}
+
+// withLockWait returns a copy of ctx under which Get and Set variants give
+// up waiting for the cache lock, failing with ErrBusy, once ctx is done or
+// after timeout, if positive. Only the wait for the lock is bounded by
+// timeout: a loader called under the returned context is not.
+func withLockWait(ctx context.Context, timeout time.Duration) context.Context {
+    return context.WithValue(ctx, lockWaitKey{}, timeout)
+}
+
+// TryGet is like GetCtx but stops waiting for the cache lock once ctx is
+// done, failing with a *CacheError wrapping ErrBusy, so callers can shed
+// load instead of queueing behind an operation holding the lock. A miss is
+// still loaded, under ctx, if a loader is configured.
+func (c *LRUCache) TryGet(ctx context.Context, key string) (interface{}, error) {
+    return c.GetCtx(withLockWait(ctx, 0), key)
+}
+
+// TrySet is like SetCtx but stops waiting for the cache lock once ctx is
+// done, failing with a *CacheError wrapping ErrBusy and leaving the cache
+// unchanged.
+func (c *LRUCache) TrySet(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+    return c.SetCtx(withLockWait(ctx, 0), key, value, expiration)
+}
+
+// lockCtx acquires the write lock. Under a context from withLockWait it
+// gives up, returning ErrBusy, once the context is done or its timeout
+// has passed, retrying the lock meanwhile with a growing interval.
+// Otherwise it waits as long as it takes.
+func (c *LRUCache) lockCtx(ctx context.Context) error {
+    timeout, bounded := ctx.Value(lockWaitKey{}).(time.Duration)
+    if !bounded {
+        c.mutex.Lock()
+        return nil
+    }
+    if c.mutex.TryLock() {
+        return nil
+    }
+
+    var expired <-chan time.Time
+    if timeout > 0 {
+        deadline := time.NewTimer(timeout)
+        defer deadline.Stop()
+        expired = deadline.C
+    }
+    interval := lockPollMin
+    poll := time.NewTimer(interval)
+    defer poll.Stop()
+    for {
+        select {
+        case <-poll.C:
+        case <-expired:
+            return ErrBusy
+        case <-ctx.Done():
+            return ErrBusy
+        }
+        if c.mutex.TryLock() {
+            return nil
+        }
+        interval = min(2*interval, lockPollMax)
+        poll.Reset(interval)
+    }
+}
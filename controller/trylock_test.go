@@ -0,0 +1,100 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestTryGetAndTrySetGiveUpOnHeldLock(t *testing.T) {
+    var loads atomic.Int32
+    cache := NewLRUCache(10, WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        loads.Add(1)
+        return "loaded", 0, nil
+    })))
+    cache.Set("k", "v", 0)
+
+    // A slow operation holds the lock throughout.
+    cache.mutex.Lock()
+    for name, try := range map[string]func(context.Context) error{
+        "TryGet": func(ctx context.Context) error {
+            _, err := cache.TryGet(ctx, "missing")
+            return err
+        },
+        "TrySet": func(ctx context.Context) error {
+            return cache.TrySet(ctx, "k", "changed", 0)
+        },
+    } {
+        ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+        start := time.Now()
+        err := try(ctx)
+        cancel()
+        var cacheErr *CacheError
+        if !errors.Is(err, ErrBusy) || !errors.As(err, &cacheErr) {
+            t.Fatalf("%s with the lock held = %v, want a *CacheError wrapping ErrBusy", name, err)
+        }
+        if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+            t.Fatalf("%s took %v to give up on a 20ms deadline", name, elapsed)
+        }
+    }
+    cache.mutex.Unlock()
+
+    // Giving up neither loaded the missing key nor wrote k.
+    if n := loads.Load(); n != 0 {
+        t.Fatalf("a busy TryGet called the loader %d times", n)
+    }
+    if value := cache.Get("k"); value != "v" {
+        t.Fatalf("k = %v after a busy TrySet, want v", value)
+    }
+}
+
+func TestTryGetWaitsForLockReleasedInTime(t *testing.T) {
+    cache := NewLRUCache(10)
+    cache.Set("k", "v", 0)
+    cache.mutex.Lock()
+    time.AfterFunc(10*time.Millisecond, cache.mutex.Unlock)
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if value, err := cache.TryGet(ctx, "k"); err != nil || value != "v" {
+        t.Fatalf("TryGet = %v, %v once the lock is released", value, err)
+    }
+    if err := cache.TrySet(ctx, "k", "w", 0); err != nil || cache.Get("k") != "w" {
+        t.Fatalf("TrySet = %v, k = %v", err, cache.Get("k"))
+    }
+}
+
+func TestHandlersAnswer503WhenLockIsHeld(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cache := NewLRUCache(10)
+    cache.Set("k", "v", 0)
+    router := gin.New()
+    router.GET("/cache/:key", getHandler(cache, 20*time.Millisecond, false))
+
+    cache.mutex.Lock()
+    start := time.Now()
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cache/k", nil))
+    elapsed := time.Since(start)
+    cache.mutex.Unlock()
+
+    if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), ErrBusy.Error()) {
+        t.Fatalf("GET with the lock held = %d %s, want 503", rec.Code, rec.Body)
+    }
+    if elapsed > 500*time.Millisecond {
+        t.Fatalf("GET took %v with a 20ms lock timeout", elapsed)
+    }
+
+    rec = httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cache/k", nil))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("GET once the lock is free = %d %s", rec.Code, rec.Body)
+    }
+}
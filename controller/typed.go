@@ -0,0 +1,35 @@
+package main
+
+import "time"
+
+// TypedLRUCache is a type-safe view over an LRUCache whose values all have
+// type V. Values are still stored as interface{} in the underlying cache,
+// but callers no longer need type assertions:
+//
+//   users := NewTypedLRUCache[User](cache)
+//   users.Set("alice", User{Name: "Alice"}, time.Hour)
+//   if u, ok := users.Get("alice"); ok {
+//       fmt.Println(u.Name)
+//   }
+//
+// Several typed views may share one LRUCache as long as their keys do not
+// collide; a value of another type is reported as a miss.
+type TypedLRUCache[V any] struct {
+    cache *LRUCache
+}
+
+// NewTypedLRUCache returns a typed view over cache.
+func NewTypedLRUCache[V any](cache *LRUCache) *TypedLRUCache[V] {
+    return &TypedLRUCache[V]{cache: cache}
+}
+
+// Get returns the value stored under key and whether it was found.
+func (t *TypedLRUCache[V]) Get(key string) (V, bool) {
+    value, ok := t.cache.Get(key).(V)
+    return value, ok
+}
+
+// Set stores value under key for ttl. It fails like LRUCache.Set.
+func (t *TypedLRUCache[V]) Set(key string, value V, ttl time.Duration) error {
+    return t.cache.Set(key, value, ttl)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "time"
+    "unicode"
+)
+
+// FieldError describes one invalid field of a write request. Index is set
+// for batch requests and identifies the offending entry.
+type FieldError struct {
+    Index  *int   `json:"index,omitempty"`
+    Field  string `json:"field"`
+    Reason string `json:"reason"`
+}
+
+// writeLimits bounds the keys and expirations accepted by the write
+// endpoints. A zero maxExpiration allows any non-negative expiration.
+//
+// An expiration of 0 stores the entry already expired, as the API always
+// has, unless the request also sets "persist": true, which stores it
+// without expiration. A capped maxExpiration rejects both.
+type writeLimits struct {
+    maxKeyLength  int
+    maxExpiration time.Duration
+}
+
+// setRequest is a write request that passed validation. Expiration is the
+// TTL to store the entry with; see requestTTL.
+type setRequest struct {
+    Key        string
+    Value      interface{}
+    Expiration time.Duration
+}
+
+// validateKey checks the length and charset rules for a cache key.
+func (l writeLimits) validateKey(key string) []FieldError {
+    if key == "" {
+        return []FieldError{{Field: "key", Reason: "is required"}}
+    }
+    var errs []FieldError
+    if l.maxKeyLength > 0 && len(key) > l.maxKeyLength {
+        errs = append(errs, FieldError{Field: "key", Reason: fmt.Sprintf("must be at most %d bytes", l.maxKeyLength)})
+    }
+    for _, r := range key {
+        if unicode.IsSpace(r) || unicode.IsControl(r) || r == unicode.ReplacementChar {
+            errs = append(errs, FieldError{Field: "key", Reason: "must not contain whitespace, control or invalid UTF-8 characters"})
+            break
+        }
+    }
+    return errs
+}
+
+// validateSet checks a decoded write request body for key.
+func (l writeLimits) validateSet(key string, body map[string]json.RawMessage) (setRequest, []FieldError) {
+    req := setRequest{Key: key}
+    errs := append(l.validateKey(key), l.validateFields(&req, body)...)
+    return req, errs
+}
+
+// validateFields checks the value and expiration fields of a write request
+// body and stores the decoded values in req. Fields are inspected as raw JSON
+// so type mismatches are reported per field instead of failing the decode.
+func (l writeLimits) validateFields(req *setRequest, body map[string]json.RawMessage) []FieldError {
+    var errs []FieldError
+    if raw, ok := body["value"]; !ok || string(raw) == "null" {
+        errs = append(errs, FieldError{Field: "value", Reason: "is required"})
+    } else if err := json.Unmarshal(raw, &req.Value); err != nil {
+        errs = append(errs, FieldError{Field: "value", Reason: "must be valid JSON"})
+    }
+
+    var seconds int64
+    if raw, ok := body["expiration"]; ok && json.Unmarshal(raw, &seconds) != nil {
+        errs = append(errs, FieldError{Field: "expiration", Reason: "must be an integer number of seconds"})
+    } else {
+        errs = append(errs, l.validateExpiration(seconds)...)
+    }
+    var persist bool
+    if raw, ok := body["persist"]; ok && json.Unmarshal(raw, &persist) != nil {
+        errs = append(errs, FieldError{Field: "persist", Reason: "must be a boolean"})
+    } else {
+        errs = append(errs, validatePersist(seconds, persist)...)
+    }
+    req.Expiration = requestTTL(seconds, persist)
+
+    return errs
+}
+
+// validatePersist checks that persist is only set without an expiration.
+func validatePersist(seconds int64, persist bool) []FieldError {
+    if persist && seconds != 0 {
+        return []FieldError{{Field: "persist", Reason: "must not be combined with an expiration"}}
+    }
+    return nil
+}
+
+// requestTTL converts the expiration, in seconds, and persist fields of a
+// valid write request to the TTL passed to the cache.
+func requestTTL(seconds int64, persist bool) time.Duration {
+    if seconds == 0 && !persist {
+        return expiredTTL
+    }
+    return time.Duration(seconds) * time.Second
+}
+
+// validateExpiration checks an expiration given in seconds against the
+// configured bounds.
+func (l writeLimits) validateExpiration(seconds int64) []FieldError {
+    var reason string
+    switch {
+    case seconds < 0:
+        reason = "must be >= 0"
+    case l.maxExpiration > 0 && seconds == 0:
+        reason = "must be > 0"
+    case l.maxExpiration > 0 && time.Duration(seconds) > l.maxExpiration/time.Second:
+        reason = fmt.Sprintf("must be <= %d", int64(l.maxExpiration/time.Second))
+    default:
+        return nil
+    }
+    return []FieldError{{Field: "expiration", Reason: reason}}
+}
+
+// validateBatch checks every entry of a batch write request. Each entry
+// carries its own "key" field, and errors are tagged with the entry index.
+func (l writeLimits) validateBatch(body []map[string]json.RawMessage) ([]setRequest, []FieldError) {
+    reqs := make([]setRequest, 0, len(body))
+    var errs []FieldError
+    for i, item := range body {
+        var req setRequest
+        var itemErrs []FieldError
+        if raw, ok := item["key"]; ok && json.Unmarshal(raw, &req.Key) != nil {
+            itemErrs = append(itemErrs, FieldError{Field: "key", Reason: "must be a string"})
+        } else {
+            itemErrs = append(itemErrs, l.validateKey(req.Key)...)
+        }
+        itemErrs = append(itemErrs, l.validateFields(&req, item)...)
+        for j := range itemErrs {
+            index := i
+            itemErrs[j].Index = &index
+        }
+        errs = append(errs, itemErrs...)
+        reqs = append(reqs, req)
+    }
+    return reqs, errs
+}
+
+// validateTouch checks a decoded batch touch request.
+func (l writeLimits) validateTouch(keys []string, seconds int64, persist bool) []FieldError {
+    var errs []FieldError
+    if keys == nil {
+        errs = append(errs, FieldError{Field: "keys", Reason: "is required"})
+    }
+    errs = append(errs, l.validateExpiration(seconds)...)
+    return append(errs, validatePersist(seconds, persist)...)
+}
+
+// decodeErrors describes an error decoding a JSON request body into a
+// struct, naming the offending field when the decoder reports one.
+func decodeErrors(err error) []FieldError {
+    var typeErr *json.UnmarshalTypeError
+    if errors.As(err, &typeErr) && typeErr.Field != "" {
+        return []FieldError{{Field: typeErr.Field, Reason: "must be of type " + typeErr.Type.String()}}
+    }
+    return []FieldError{{Field: "body", Reason: "must be a JSON object"}}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+// decodeBody decodes a JSON test body, failing the test if it is invalid.
+func decodeBody(t *testing.T, body string, v interface{}) {
+    t.Helper()
+    if err := json.Unmarshal([]byte(body), v); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// fieldErrors formats errs as index:field:reason strings, for comparison.
+func fieldErrors(errs []FieldError) []string {
+    var out []string
+    for _, err := range errs {
+        index := "-"
+        if err.Index != nil {
+            index = fmt.Sprint(*err.Index)
+        }
+        out = append(out, index+":"+err.Field+":"+err.Reason)
+    }
+    return out
+}
+
+func TestValidateSetReportsEveryViolation(t *testing.T) {
+    limits := writeLimits{maxKeyLength: 4, maxExpiration: time.Minute}
+    var body map[string]json.RawMessage
+    decodeBody(t, `{"expiration":120,"persist":"yes"}`, &body)
+
+    _, errs := limits.validateSet("long key", body)
+    want := []string{
+        "-:key:must be at most 4 bytes",
+        "-:key:must not contain whitespace, control or invalid UTF-8 characters",
+        "-:value:is required",
+        "-:expiration:must be <= 60",
+        "-:persist:must be a boolean",
+    }
+    if got := fieldErrors(errs); !reflect.DeepEqual(got, want) {
+        t.Fatalf("errors = %q, want %q", got, want)
+    }
+}
+
+func TestValidateBatchReportsEntryIndex(t *testing.T) {
+    limits := writeLimits{maxExpiration: time.Minute}
+    var body []map[string]json.RawMessage
+    decodeBody(t, `[
+        {"key":"ok","value":1,"expiration":10},
+        {"key":7,"value":null,"expiration":"soon"},
+        {"key":"fine","value":2,"expiration":30},
+        {"value":3,"expiration":-1}
+    ]`, &body)
+
+    reqs, errs := limits.validateBatch(body)
+    want := []string{
+        "1:key:must be a string",
+        "1:value:is required",
+        "1:expiration:must be an integer number of seconds",
+        "3:key:is required",
+        "3:expiration:must be >= 0",
+    }
+    if got := fieldErrors(errs); !reflect.DeepEqual(got, want) {
+        t.Fatalf("errors = %q, want %q", got, want)
+    }
+    if len(reqs) != 4 || reqs[2].Key != "fine" || reqs[2].Expiration != 30*time.Second {
+        t.Fatalf("requests = %+v", reqs)
+    }
+}
+
+func TestServeHTTPInvalidWriteBody(t *testing.T) {
+    cache := NewLRUCache(10)
+    rec := serveCache(cache, http.MethodPost, "/a", `{"expiration":-5}`)
+    if rec.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400", rec.Code)
+    }
+    var resp struct {
+        Error  string       `json:"error"`
+        Fields []FieldError `json:"fields"`
+    }
+    decodeBody(t, rec.Body.String(), &resp)
+    got := fieldErrors(resp.Fields)
+    want := []string{"-:value:is required", "-:expiration:must be >= 0"}
+    if resp.Error != "invalid request" || !reflect.DeepEqual(got, want) {
+        t.Fatalf("body = %s", strings.TrimSpace(rec.Body.String()))
+    }
+    if cache.Len() != 0 {
+        t.Fatal("an invalid write was stored")
+    }
+}
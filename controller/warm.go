@@ -0,0 +1,141 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// WarmFromHTTP fetches a JSON array of {"key": ..., "value": ...} objects
+// from url and stores every element with the given ttl. The request is bound
+// to ctx, so cancelling ctx aborts the fetch.
+func (c *LRUCache) WarmFromHTTP(ctx context.Context, url string, ttl time.Duration) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return &CacheError{Op: "warm", Err: fmt.Errorf("%w: %w", ErrBackend, err)}
+    }
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return &CacheError{Op: "warm", Err: fmt.Errorf("%w: %w", ErrBackend, err)}
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return &CacheError{Op: "warm", Err: fmt.Errorf("%w: %s: unexpected status %s", ErrBackend, url, resp.Status)}
+    }
+
+    var items []struct {
+        Key   string      `json:"key"`
+        Value interface{} `json:"value"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+        return &CacheError{Op: "warm", Err: fmt.Errorf("%w: %s: %w", ErrBackend, url, err)}
+    }
+
+    entries := make([]BatchEntry, len(items))
+    for i, item := range items {
+        entries[i] = BatchEntry{Key: item.Key, Value: item.Value, TTL: ttl}
+    }
+    if err := c.SetMany(entries); err != nil {
+        return err
+    }
+
+    slog.Info("cache warmed", "url", url, "entries", len(entries))
+    return nil
+}
+
+// warmWorkers is the number of keys Warm loads concurrently.
+const warmWorkers = 8
+
+// Warm calls the loader for every key in keys that is not already in the
+// cache and stores the results, loading up to warmWorkers keys at a time.
+// It returns the number of keys loaded. Warming stops early when ctx is
+// cancelled; a failed load does not stop it, but the first failure is
+// returned.
+func (c *LRUCache) Warm(ctx context.Context, keys []string) (int, error) {
+    if c.loader == nil {
+        return 0, &CacheError{Op: "warm", Err: ErrNoLoader}
+    }
+
+    jobs := make(chan string)
+    var (
+        wg       sync.WaitGroup
+        loaded   atomic.Int64
+        firstErr error
+        errOnce  sync.Once
+    )
+    for i := 0; i < warmWorkers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for key := range jobs {
+                if _, err := c.load(ctx, key); err != nil {
+                    errOnce.Do(func() { firstErr = err })
+                    continue
+                }
+                loaded.Add(1)
+            }
+        }()
+    }
+
+feed:
+    for _, key := range keys {
+        if c.ContainsKey(key) {
+            continue
+        }
+        select {
+        case jobs <- key:
+        case <-ctx.Done():
+            break feed
+        }
+    }
+    close(jobs)
+    wg.Wait()
+
+    if err := ctx.Err(); err != nil {
+        return int(loaded.Load()), err
+    }
+    return int(loaded.Load()), firstErr
+}
+
+// warmHandler serves POST /cache-views/warm. The body either names keys to
+// load through the configured loader, {"keys": [...]}, or a URL to fetch
+// entries from, {"url": ..., "ttl_seconds": ...}.
+func warmHandler(cache *LRUCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var data struct {
+            Keys       []string `json:"keys"`
+            URL        string   `json:"url"`
+            TTLSeconds int      `json:"ttl_seconds"`
+        }
+        if err := c.ShouldBindJSON(&data); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if data.Keys != nil {
+            loaded, err := cache.Warm(c.Request.Context(), data.Keys)
+            if err != nil {
+                c.JSON(errorStatus(err), gin.H{"error": err.Error(), "loaded": loaded})
+                return
+            }
+            c.JSON(http.StatusOK, gin.H{"loaded": loaded})
+            return
+        }
+        if data.URL == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "fields": []FieldError{{Field: "url", Reason: "required unless keys is given"}}})
+            return
+        }
+        if err := cache.WarmFromHTTP(c.Request.Context(), data.URL, time.Duration(data.TTLSeconds)*time.Second); err != nil {
+            c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.Status(http.StatusOK)
+    }
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestWarmLoadsOnlyMissingKeys(t *testing.T) {
+    var (
+        mu     sync.Mutex
+        loaded []string
+    )
+    cache := NewLRUCache(10, WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        mu.Lock()
+        loaded = append(loaded, key)
+        mu.Unlock()
+        return "loaded " + key, 0, nil
+    })))
+    cache.Set("a", "cached a", 0)
+    cache.Set("c", "cached c", 0)
+
+    n, err := cache.Warm(context.Background(), []string{"a", "b", "c", "d"})
+    if n != 2 || err != nil {
+        t.Fatalf("Warm = %d, %v; want 2, nil", n, err)
+    }
+    sort.Strings(loaded)
+    if fmt.Sprint(loaded) != "[b d]" {
+        t.Fatalf("loader called for %v, want [b d]", loaded)
+    }
+    for key, want := range map[string]string{"a": "cached a", "b": "loaded b", "c": "cached c", "d": "loaded d"} {
+        if got := cache.Get(key); got != want {
+            t.Errorf("%s = %v, want %q", key, got, want)
+        }
+    }
+}
+
+func TestWarmStopsWhenCancelled(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    var calls atomic.Int32
+    cache := NewLRUCache(1000, WithLoader(LoaderFunc(func(ctx context.Context, key string) (interface{}, time.Duration, error) {
+        if calls.Add(1) == 3 {
+            cancel()
+        }
+        return key, 0, nil
+    })))
+
+    keys := make([]string, 500)
+    for i := range keys {
+        keys[i] = fmt.Sprint("k", i)
+    }
+    n, err := cache.Warm(ctx, keys)
+    if !errors.Is(err, context.Canceled) {
+        t.Fatalf("Warm error = %v, want context.Canceled", err)
+    }
+    if n >= len(keys) || int(calls.Load()) >= len(keys) {
+        t.Fatalf("Warm loaded %d keys with %d loader calls, want it to stop partway", n, calls.Load())
+    }
+    // Loads already running when ctx was cancelled may still store their
+    // values, but no more are started.
+    if cache.Len() < n || cache.Len() >= len(keys) {
+        t.Fatalf("cache holds %d entries after Warm reported %d", cache.Len(), n)
+    }
+}
+
+func TestWarmWithoutLoader(t *testing.T) {
+    cache := NewLRUCache(10)
+    if n, err := cache.Warm(context.Background(), []string{"a"}); n != 0 || !errors.Is(err, ErrNoLoader) {
+        t.Fatalf("Warm = %d, %v; want 0, ErrNoLoader", n, err)
+    }
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "strings"
+    "time"
+)
+
+const (
+    // subscriberBufferSize is the number of events a Subscribe channel
+    // may fall behind by before further events for it are dropped.
+    subscriberBufferSize = 256
+    // watchBufferSize is the same for Watch.
+    watchBufferSize = 256
+)
+
+// Event reports a change to a key: Type is "set", with the value written
+// in Value, or "delete", "evict" or "expire", with the removal reason
+// reported in RemovalEvent in Reason. Seq numbers the events of every key
+// in the order they were applied, starting at 1 when the cache is created.
+type Event struct {
+    Seq    uint64      `json:"seq"`
+    Type   string      `json:"type"`
+    Key    string      `json:"key"`
+    Value  interface{} `json:"value,omitempty"`
+    Reason string      `json:"reason,omitempty"`
+    Time   time.Time   `json:"time"`
+}
+
+// KeyEvent reports a change to a key to Watch. Type is "set" for writes,
+// with the value written in Value, and otherwise the removal reason
+// reported in RemovalEvent.
+type KeyEvent struct {
+    Key   string      `json:"key"`
+    Type  string      `json:"type"`
+    Value interface{} `json:"value,omitempty"`
+    Time  time.Time   `json:"time"`
+}
+
+// subscriber receives the events for keys starting with prefix. A strict
+// subscriber is dropped, and its channel closed, instead of missing
+// events.
+type subscriber struct {
+    prefix string
+    events chan Event
+    strict bool
+}
+
+// Subscribe returns a channel receiving an Event for every write and
+// removal of a key starting with prefix, in the order they were applied,
+// and a function that unsubscribes and closes the channel. Events are
+// sent without blocking writers: a subscriber more than
+// subscriberBufferSize events behind misses events until it catches up,
+// and the events missed are counted by DroppedEvents. Cancelling twice is
+// harmless.
+func (c *LRUCache) Subscribe(prefix string) (<-chan Event, func()) {
+    s, _ := c.subscribe(prefix, subscriberBufferSize, false)
+    return s.events, func() { c.unsubscribe(s) }
+}
+
+// subscribe implements Subscribe with a buffer of size events. With
+// strict set, a subscriber that falls that far behind has its channel
+// closed rather than missing events. seq is the Seq of the last event
+// applied before the subscriber was registered.
+func (c *LRUCache) subscribe(prefix string, size int, strict bool) (s *subscriber, seq uint64) {
+    s = &subscriber{prefix: prefix, events: make(chan Event, size), strict: strict}
+
+    c.mutex.Lock()
+    defer c.unlock()
+
+    if c.subscribers == nil {
+        c.subscribers = make(map[*subscriber]struct{})
+    }
+    c.subscribers[s] = struct{}{}
+    return s, c.eventSeq
+}
+
+// unsubscribe unregisters s and closes its channel, unless that has
+// already been done.
+func (c *LRUCache) unsubscribe(s *subscriber) {
+    c.mutex.Lock()
+    defer c.unlock()
+
+    c.dropSubscriber(s)
+}
+
+// Watch is Subscribe for callers that stop with a context: the channel
+// receives a KeyEvent for every Event until ctx is done, when it is
+// closed.
+func (c *LRUCache) Watch(ctx context.Context, prefix string) <-chan KeyEvent {
+    s, _ := c.subscribe(prefix, watchBufferSize, false)
+    out := make(chan KeyEvent)
+    go func() {
+        defer close(out)
+        defer c.unsubscribe(s)
+        for {
+            select {
+            case event := <-s.events:
+                keyEvent := KeyEvent{Key: event.Key, Type: event.Reason, Value: event.Value, Time: event.Time}
+                if event.Type == "set" {
+                    keyEvent.Type = "set"
+                }
+                select {
+                case out <- keyEvent:
+                case <-ctx.Done():
+                    return
+                }
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+    return out
+}
+
+// DroppedEvents returns the number of events Subscribe and Watch channels
+// have missed by falling behind.
+func (c *LRUCache) DroppedEvents() uint64 {
+    return c.droppedEvents.Load()
+}
+
+// notifyWatchers sends an event for key to the subscribers interested in
+// it; eventType is "set" or the removal reason. The caller must hold the
+// write lock, which keeps events in order and stops a subscriber's channel
+// from being closed meanwhile. Sends never block, so no subscriber can
+// hold up the cache.
+func (c *LRUCache) notifyWatchers(key, eventType string, value interface{}) {
+    c.eventSeq++
+    if len(c.subscribers) == 0 {
+        return
+    }
+    event := Event{Seq: c.eventSeq, Type: "delete", Key: key, Reason: eventType, Time: time.Now()}
+    switch eventType {
+    case "set":
+        event.Type, event.Value, event.Reason = "set", value, ""
+    case removedCapacity.String():
+        event.Type = "evict"
+    case removedExpired.String():
+        event.Type = "expire"
+    }
+    for s := range c.subscribers {
+        if !strings.HasPrefix(key, s.prefix) {
+            continue
+        }
+        select {
+        case s.events <- event:
+        default:
+            if s.strict {
+                c.dropSubscriber(s)
+            } else {
+                c.droppedEvents.Add(1)
+            }
+        }
+    }
+}
+
+// dropSubscriber unregisters s and closes its channel, unless that has
+// already been done. The caller must hold the write lock.
+func (c *LRUCache) dropSubscriber(s *subscriber) {
+    if _, ok := c.subscribers[s]; ok {
+        delete(c.subscribers, s)
+        close(s.events)
+    }
+}
+
+// writeSubscriberMetrics emits the number of events dropped by slow
+// subscribers.
+func writeSubscriberMetrics(w io.Writer, c *LRUCache) {
+    fmt.Fprintln(w, "# HELP cache_events_dropped_total Change events missed by subscribers that fell behind.")
+    fmt.Fprintln(w, "# TYPE cache_events_dropped_total counter")
+    fmt.Fprintf(w, "cache_events_dropped_total %d\n", c.DroppedEvents())
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// nextKeyEvent returns the next event from events, failing the test if
+// none arrives.
+func nextKeyEvent(t *testing.T, events <-chan KeyEvent) KeyEvent {
+    t.Helper()
+    select {
+    case event := <-events:
+        return event
+    case <-time.After(time.Second):
+        t.Fatal("no event received")
+        return KeyEvent{}
+    }
+}
+
+func TestWatchOrdersOverwriteOfExpiredKey(t *testing.T) {
+    cache := NewLRUCache(10)
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    events := cache.Watch(ctx, "k")
+
+    cache.Set("k", 1, 10*time.Millisecond)
+    time.Sleep(20 * time.Millisecond)
+    // The expired entry is still in the cache, so this write removes it.
+    cache.Set("k", 2, 0)
+
+    want := []KeyEvent{
+        {Key: "k", Type: "set", Value: 1},
+        {Key: "k", Type: removedExpired.String()},
+        {Key: "k", Type: "set", Value: 2},
+    }
+    for i, w := range want {
+        got := nextKeyEvent(t, events)
+        if got.Key != w.Key || got.Type != w.Type || got.Value != w.Value {
+            t.Fatalf("event %d = %+v, want %+v", i, got, w)
+        }
+    }
+    if value := cache.Get("k"); value != 2 {
+        t.Fatalf("Get = %v, want 2", value)
+    }
+}
+
+func TestSubscribeSeqFollowsEvictions(t *testing.T) {
+    cache := NewLRUCache(1)
+    events, cancel := cache.Subscribe("")
+    defer cancel()
+
+    cache.Set("a", 1, 0)
+    cache.Set("b", 2, 0)
+
+    want := []struct{ typ, key string }{{"set", "a"}, {"set", "b"}, {"evict", "a"}}
+    var seq uint64
+    for i, w := range want {
+        var event Event
+        select {
+        case event = <-events:
+        case <-time.After(time.Second):
+            t.Fatalf("event %d not received", i)
+        }
+        if event.Type != w.typ || event.Key != w.key {
+            t.Fatalf("event %d = %s %s, want %s %s", i, event.Type, event.Key, w.typ, w.key)
+        }
+        if event.Seq <= seq {
+            t.Fatalf("event %d has seq %d after %d", i, event.Seq, seq)
+        }
+        seq = event.Seq
+    }
+}
+
+func TestSubscribeManyConcurrentSubscribers(t *testing.T) {
+    const subscribers, writes = 50, 200
+    cache := NewLRUCache(writes)
+    prefixes := []string{"", "a", "b"}
+
+    var wg sync.WaitGroup
+    received := make([][]Event, subscribers)
+    for i := 0; i < subscribers; i++ {
+        events, cancel := cache.Subscribe(prefixes[i%len(prefixes)])
+        defer cancel()
+        wg.Add(1)
+        go func(i int, events <-chan Event) {
+            defer wg.Done()
+            want := writes
+            if prefixes[i%len(prefixes)] != "" {
+                want /= 2
+            }
+            for len(received[i]) < want {
+                select {
+                case event := <-events:
+                    received[i] = append(received[i], event)
+                case <-time.After(5 * time.Second):
+                    return
+                }
+            }
+        }(i, events)
+    }
+
+    var writers sync.WaitGroup
+    for _, prefix := range []string{"a", "b"} {
+        writers.Add(1)
+        go func(prefix string) {
+            defer writers.Done()
+            for i := 0; i < writes/2; i++ {
+                cache.Set(fmt.Sprintf("%s%d", prefix, i), i, 0)
+            }
+        }(prefix)
+    }
+    writers.Wait()
+    wg.Wait()
+
+    for i, events := range received {
+        prefix := prefixes[i%len(prefixes)]
+        want := writes
+        if prefix != "" {
+            want /= 2
+        }
+        if len(events) != want {
+            t.Fatalf("subscriber %d (prefix %q) got %d events, want %d", i, prefix, len(events), want)
+        }
+        var seq uint64
+        for _, event := range events {
+            if !strings.HasPrefix(event.Key, prefix) || event.Type != "set" {
+                t.Fatalf("subscriber %d (prefix %q) got %s %s", i, prefix, event.Type, event.Key)
+            }
+            if event.Seq <= seq {
+                t.Fatalf("subscriber %d got seq %d after %d", i, event.Seq, seq)
+            }
+            seq = event.Seq
+        }
+    }
+    if dropped := cache.DroppedEvents(); dropped != 0 {
+        t.Fatalf("DroppedEvents = %d, want 0", dropped)
+    }
+}
+
+func TestSubscribeSlowSubscriberDropsEvents(t *testing.T) {
+    const extra = 10
+    cache := NewLRUCache(subscriberBufferSize + extra)
+    slow, cancelSlow := cache.Subscribe("")
+    defer cancelSlow()
+    other, cancelOther := cache.Subscribe("other")
+    defer cancelOther()
+
+    // Nobody reads slow, so these writes would block if sends did.
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        for i := 0; i < subscriberBufferSize+extra; i++ {
+            cache.Set(fmt.Sprint(i), i, 0)
+        }
+    }()
+    select {
+    case <-done:
+    case <-time.After(5 * time.Second):
+        t.Fatal("writes blocked on a slow subscriber")
+    }
+
+    if dropped := cache.DroppedEvents(); dropped != extra {
+        t.Fatalf("DroppedEvents = %d, want %d", dropped, extra)
+    }
+    // The subscriber keeps the oldest events and, once it catches up,
+    // receives new ones again.
+    for i := 0; i < subscriberBufferSize; i++ {
+        if event := <-slow; event.Key != fmt.Sprint(i) {
+            t.Fatalf("event %d is for %q", i, event.Key)
+        }
+    }
+    cache.Set("late", 1, 0)
+    if event := <-slow; event.Key != "late" {
+        t.Fatalf("event after catching up is for %q, want late", event.Key)
+    }
+    if len(other) != 0 {
+        t.Fatalf("subscriber to another prefix got %d events", len(other))
+    }
+}
+
+func TestSubscribeCancel(t *testing.T) {
+    cache := NewLRUCache(10)
+    events, cancel := cache.Subscribe("")
+    cache.Set("a", 1, 0)
+
+    cancel()
+    cancel()
+    if subscribers := len(cache.subscribers); subscribers != 0 {
+        t.Fatalf("%d subscribers registered after cancel", subscribers)
+    }
+    // Events sent before cancelling are still delivered, then the channel
+    // is closed.
+    if event, ok := <-events; !ok || event.Key != "a" {
+        t.Fatalf("first event = %+v, %v", event, ok)
+    }
+    if _, ok := <-events; ok {
+        t.Fatal("channel not closed by cancel")
+    }
+    cache.Set("b", 2, 0)
+
+    // Cancelling concurrently with writes is safe.
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        events, cancel := cache.Subscribe("")
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            for range events {
+            }
+        }()
+        go func(i int) {
+            defer wg.Done()
+            cache.Set(fmt.Sprint(i), i, 0)
+            cancel()
+        }(i)
+    }
+    wg.Wait()
+    if subscribers := len(cache.subscribers); subscribers != 0 {
+        t.Fatalf("%d subscribers registered after cancel", subscribers)
+    }
+}
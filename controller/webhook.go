@@ -0,0 +1,259 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Webhook defaults, used for the zero values of WebhookConfig.
+const (
+    defaultWebhookQueueSize     = 10000
+    defaultWebhookBatchSize     = 100
+    defaultWebhookFlushInterval = time.Second
+    defaultWebhookMaxAttempts   = 5
+    defaultWebhookRetryDelay    = 500 * time.Millisecond
+    webhookTimeout              = 10 * time.Second
+)
+
+// WebhookConfig configures StartWebhook. Only URL is required.
+type WebhookConfig struct {
+    // URL receives the batches.
+    URL string
+    // Prefix, if set, limits the events sent to keys starting with it.
+    Prefix string
+    // Secret, if set, signs every batch: the X-Cache-Signature header is
+    // "sha256=" followed by the hex HMAC-SHA256 of the body keyed with it.
+    Secret string
+    // QueueSize bounds the events waiting to be sent. When it is full the
+    // oldest are dropped. Default 10000.
+    QueueSize int
+    // BatchSize bounds the events per request. Default 100.
+    BatchSize int
+    // FlushInterval is how often queued events are sent. Default 1s.
+    FlushInterval time.Duration
+    // MaxAttempts bounds the attempts to deliver a batch, waiting
+    // RetryDelay before the first retry and doubling the wait after each
+    // one. A batch that fails every attempt is dropped. Defaults 5 and
+    // 500ms.
+    MaxAttempts int
+    RetryDelay  time.Duration
+}
+
+// WebhookEvent is one entry of a webhook batch. Type is "evict" or
+// "expire" and Reason the removal reason reported in RemovalEvent.
+type WebhookEvent struct {
+    Type   string    `json:"type"`
+    Key    string    `json:"key"`
+    Reason string    `json:"reason"`
+    Time   time.Time `json:"time"`
+}
+
+// webhookBatch is the body of a webhook request.
+type webhookBatch struct {
+    Events []WebhookEvent `json:"events"`
+}
+
+// webhookPublisher queues the evictions and expirations of a cache and
+// POSTs them to a URL in batches. Events reach it through a subscription,
+// which never blocks the cache, and are moved to its own queue, so a slow
+// or failing endpoint only ever costs queued events.
+type webhookPublisher struct {
+    config WebhookConfig
+    client *http.Client
+
+    mutex sync.Mutex
+    queue []WebhookEvent
+
+    sent    atomic.Uint64
+    dropped atomic.Uint64
+    failed  atomic.Uint64
+}
+
+// StartWebhook POSTs the evictions and expirations of the cache's keys to
+// config.URL as JSON batches, {"events": [...]}, from a background
+// goroutine until the returned stop function is called. Failed requests,
+// including any non-2xx response, are retried with exponential backoff.
+// Events dropped because the queue was full, and those of batches that
+// could not be delivered, are counted in the cache's metrics. Stopping
+// makes one last attempt to send what is queued.
+func (c *LRUCache) StartWebhook(config WebhookConfig) (stop func()) {
+    if config.QueueSize <= 0 {
+        config.QueueSize = defaultWebhookQueueSize
+    }
+    if config.BatchSize <= 0 {
+        config.BatchSize = defaultWebhookBatchSize
+    }
+    if config.FlushInterval <= 0 {
+        config.FlushInterval = defaultWebhookFlushInterval
+    }
+    if config.MaxAttempts <= 0 {
+        config.MaxAttempts = defaultWebhookMaxAttempts
+    }
+    if config.RetryDelay <= 0 {
+        config.RetryDelay = defaultWebhookRetryDelay
+    }
+    p := &webhookPublisher{config: config, client: &http.Client{Timeout: webhookTimeout}}
+
+    c.mutex.Lock()
+    c.webhook = p
+    c.unlock()
+
+    events, unsubscribe := c.Subscribe(config.Prefix)
+    ctx, cancel := context.WithCancel(context.Background())
+    var wg sync.WaitGroup
+    wg.Add(2)
+    go func() {
+        defer wg.Done()
+        for event := range events {
+            if event.Type == "evict" || event.Type == "expire" {
+                p.enqueue(WebhookEvent{Type: event.Type, Key: event.Key, Reason: event.Reason, Time: event.Time})
+            }
+        }
+    }()
+    go func() {
+        defer wg.Done()
+        p.run(ctx)
+    }()
+
+    return func() {
+        unsubscribe()
+        cancel()
+        wg.Wait()
+    }
+}
+
+// enqueue adds event to the queue, dropping the oldest event if it is
+// full.
+func (p *webhookPublisher) enqueue(event WebhookEvent) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    if len(p.queue) >= p.config.QueueSize {
+        p.queue = p.queue[1:]
+        p.dropped.Add(1)
+    }
+    p.queue = append(p.queue, event)
+}
+
+// take removes and returns up to BatchSize of the oldest queued events.
+func (p *webhookPublisher) take() []WebhookEvent {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    n := min(len(p.queue), p.config.BatchSize)
+    batch := make([]WebhookEvent, n)
+    copy(batch, p.queue)
+    p.queue = p.queue[n:]
+    return batch
+}
+
+// run sends the queued events every FlushInterval until ctx is done, then
+// makes a last attempt at what is left.
+func (p *webhookPublisher) run(ctx context.Context) {
+    ticker := time.NewTicker(p.config.FlushInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+            p.flush(ctx, p.config.MaxAttempts)
+        case <-ctx.Done():
+            p.flush(context.Background(), 1)
+            return
+        }
+    }
+}
+
+// flush sends the queue in batches, giving each batch up to attempts
+// attempts.
+func (p *webhookPublisher) flush(ctx context.Context, attempts int) {
+    for {
+        batch := p.take()
+        if len(batch) == 0 {
+            return
+        }
+        if err := p.deliver(ctx, batch, attempts); err != nil {
+            p.failed.Add(uint64(len(batch)))
+            slog.Warn("webhook delivery failed", "url", p.config.URL, "events", len(batch), "error", err)
+            continue
+        }
+        p.sent.Add(uint64(len(batch)))
+    }
+}
+
+// deliver POSTs batch, retrying up to attempts times in all.
+func (p *webhookPublisher) deliver(ctx context.Context, batch []WebhookEvent, attempts int) error {
+    body, err := json.Marshal(webhookBatch{Events: batch})
+    if err != nil {
+        return err
+    }
+    delay := p.config.RetryDelay
+    for attempt := 1; ; attempt++ {
+        err = p.post(ctx, body)
+        if err == nil || attempt >= attempts {
+            return err
+        }
+        select {
+        case <-time.After(delay):
+        case <-ctx.Done():
+            return err
+        }
+        delay *= 2
+    }
+}
+
+// post makes one delivery attempt.
+func (p *webhookPublisher) post(ctx context.Context, body []byte) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.URL, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    if p.config.Secret != "" {
+        req.Header.Set("X-Cache-Signature", "sha256="+webhookSignature(p.config.Secret, body))
+    }
+    resp, err := p.client.Do(req)
+    if err != nil {
+        return err
+    }
+    io.Copy(io.Discard, resp.Body)
+    resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return fmt.Errorf("unexpected status %s", resp.Status)
+    }
+    return nil
+}
+
+// webhookSignature returns the hex HMAC-SHA256 of body keyed with secret.
+func webhookSignature(secret string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeWebhookMetrics emits the webhook delivery counters, if a webhook
+// was started.
+func writeWebhookMetrics(w io.Writer, c *LRUCache) {
+    c.mutex.RLock()
+    p := c.webhook
+    c.mutex.RUnlock()
+    if p == nil {
+        return
+    }
+    fmt.Fprintln(w, "# HELP cache_webhook_events_total Removal events handled by the webhook publisher, by outcome.")
+    fmt.Fprintln(w, "# TYPE cache_webhook_events_total counter")
+    fmt.Fprintf(w, "cache_webhook_events_total{outcome=\"sent\"} %d\n", p.sent.Load())
+    fmt.Fprintf(w, "cache_webhook_events_total{outcome=\"dropped\"} %d\n", p.dropped.Load())
+    fmt.Fprintf(w, "cache_webhook_events_total{outcome=\"failed\"} %d\n", p.failed.Load())
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+    "crypto/hmac"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// webhookRequest is a request received by a webhookEndpoint.
+type webhookRequest struct {
+    body        []byte
+    signature   string
+    contentType string
+}
+
+// webhookEndpoint is an httptest server recording the webhook requests it
+// receives and answering the first failures of them with 500.
+type webhookEndpoint struct {
+    *httptest.Server
+
+    mutex    sync.Mutex
+    requests []webhookRequest
+    failures int
+}
+
+func startWebhookEndpoint(t *testing.T, failures int) *webhookEndpoint {
+    e := &webhookEndpoint{failures: failures}
+    e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        e.mutex.Lock()
+        defer e.mutex.Unlock()
+        e.requests = append(e.requests, webhookRequest{body: body, signature: r.Header.Get("X-Cache-Signature"), contentType: r.Header.Get("Content-Type")})
+        if len(e.requests) <= e.failures {
+            w.WriteHeader(http.StatusInternalServerError)
+        }
+    }))
+    t.Cleanup(e.Close)
+    return e
+}
+
+// received returns the requests received so far.
+func (e *webhookEndpoint) received() []webhookRequest {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    return append([]webhookRequest(nil), e.requests...)
+}
+
+// batchKeys decodes the body of a webhook request and returns the keys of
+// its events.
+func batchKeys(t *testing.T, body []byte) []string {
+    t.Helper()
+    var batch webhookBatch
+    if err := json.Unmarshal(body, &batch); err != nil {
+        t.Fatalf("invalid batch %s: %v", body, err)
+    }
+    keys := make([]string, len(batch.Events))
+    for i, event := range batch.Events {
+        keys[i] = event.Key
+    }
+    return keys
+}
+
+// queued returns the number of events waiting in the webhook queue.
+func queued(p *webhookPublisher) int {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    return len(p.queue)
+}
+
+func TestWebhookBatchesAndSigns(t *testing.T) {
+    endpoint := startWebhookEndpoint(t, 0)
+    clock := newFakeClock()
+    cache := NewLRUCache(1, WithClock(clock.Now))
+    // Nothing is sent before stopping, which sends the queue in batches.
+    stop := cache.StartWebhook(WebhookConfig{URL: endpoint.URL, Prefix: "user:", Secret: "s3cret", BatchSize: 3, FlushInterval: time.Hour})
+
+    for i := 0; i < 7; i++ {
+        cache.Set(fmt.Sprintf("user:%d", i), i, 0)
+    }
+    // Writing other evicts user:6. The removals of other keys, and
+    // deletions, are not sent.
+    cache.Set("other", 0, 0)
+    cache.Set("user:x", 0, 0)
+    cache.Delete("user:x")
+    cache.Set("user:e", 0, time.Second)
+    clock.Advance(2 * time.Second)
+    cache.Get("user:e")
+
+    waitUntil(t, "events queued", func() bool { return queued(cache.webhook) == 8 })
+    stop()
+
+    requests := endpoint.received()
+    want := [][]string{
+        {"user:0", "user:1", "user:2"},
+        {"user:3", "user:4", "user:5"},
+        {"user:6", "user:e"},
+    }
+    if len(requests) != len(want) {
+        t.Fatalf("received %d batches, want %d", len(requests), len(want))
+    }
+    for i, req := range requests {
+        if keys := batchKeys(t, req.body); fmt.Sprint(keys) != fmt.Sprint(want[i]) {
+            t.Fatalf("batch %d = %v, want %v", i, keys, want[i])
+        }
+        if req.contentType != "application/json" {
+            t.Fatalf("Content-Type = %q", req.contentType)
+        }
+        if want := "sha256=" + webhookSignature("s3cret", req.body); !hmac.Equal([]byte(req.signature), []byte(want)) {
+            t.Fatalf("batch %d signature = %q, want %q", i, req.signature, want)
+        }
+    }
+    var batch webhookBatch
+    json.Unmarshal(requests[2].body, &batch)
+    if e := batch.Events[0]; e.Type != "evict" || e.Reason != removedCapacity.String() {
+        t.Fatalf("eviction sent as %+v", e)
+    }
+    if e := batch.Events[1]; e.Type != "expire" || e.Reason != removedExpired.String() {
+        t.Fatalf("expiration sent as %+v", e)
+    }
+    if sent := cache.webhook.sent.Load(); sent != 8 {
+        t.Fatalf("sent = %d, want 8", sent)
+    }
+}
+
+func TestWebhookRetriesFlakyEndpoint(t *testing.T) {
+    endpoint := startWebhookEndpoint(t, 2)
+    cache := NewLRUCache(1)
+    stop := cache.StartWebhook(WebhookConfig{URL: endpoint.URL, FlushInterval: 5 * time.Millisecond, MaxAttempts: 3, RetryDelay: time.Millisecond})
+    defer stop()
+
+    cache.Set("a", 1, 0)
+    cache.Set("b", 2, 0)
+    waitUntil(t, "delivery", func() bool { return cache.webhook.sent.Load() == 1 })
+
+    // The batch was sent unchanged until the endpoint accepted it.
+    requests := endpoint.received()
+    if len(requests) != 3 {
+        t.Fatalf("%d attempts, want 3", len(requests))
+    }
+    for _, req := range requests {
+        if string(req.body) != string(requests[0].body) {
+            t.Fatalf("retry sent %s, first attempt %s", req.body, requests[0].body)
+        }
+    }
+    if keys := batchKeys(t, requests[0].body); len(keys) != 1 || keys[0] != "a" {
+        t.Fatalf("batch = %v, want [a]", keys)
+    }
+    if failed := cache.webhook.failed.Load(); failed != 0 {
+        t.Fatalf("failed = %d, want 0", failed)
+    }
+}
+
+func TestWebhookGivesUpAfterMaxAttempts(t *testing.T) {
+    endpoint := startWebhookEndpoint(t, 1000)
+    cache := NewLRUCache(1)
+    stop := cache.StartWebhook(WebhookConfig{URL: endpoint.URL, FlushInterval: 5 * time.Millisecond, MaxAttempts: 2, RetryDelay: time.Millisecond})
+    defer stop()
+
+    cache.Set("a", 1, 0)
+    cache.Set("b", 2, 0)
+    waitUntil(t, "the batch to fail", func() bool { return cache.webhook.failed.Load() == 1 })
+    if n := len(endpoint.received()); n != 2 {
+        t.Fatalf("%d attempts, want 2", n)
+    }
+    if sent := cache.webhook.sent.Load(); sent != 0 {
+        t.Fatalf("sent = %d, want 0", sent)
+    }
+}
+
+func TestWebhookDropsOldestWhenQueueFull(t *testing.T) {
+    endpoint := startWebhookEndpoint(t, 0)
+    cache := NewLRUCache(1)
+    stop := cache.StartWebhook(WebhookConfig{URL: endpoint.URL, QueueSize: 2, FlushInterval: time.Hour})
+
+    for i := 0; i < 6; i++ {
+        cache.Set(fmt.Sprint(i), i, 0)
+    }
+    waitUntil(t, "events dropped", func() bool { return cache.webhook.dropped.Load() == 3 })
+    stop()
+
+    requests := endpoint.received()
+    if len(requests) != 1 {
+        t.Fatalf("received %d batches, want 1", len(requests))
+    }
+    if keys := batchKeys(t, requests[0].body); fmt.Sprint(keys) != "[3 4]" {
+        t.Fatalf("batch = %v, want the newest events [3 4]", keys)
+    }
+
+    var text strings.Builder
+    writeWebhookMetrics(&text, cache)
+    metrics, _ := parseMetrics(t, text.String())
+    for outcome, want := range map[string]float64{"sent": 2, "dropped": 3, "failed": 0} {
+        name := fmt.Sprintf("cache_webhook_events_total{outcome=%q}", outcome)
+        if got := metrics[name]; got != want {
+            t.Fatalf("%s = %v, want %v", name, got, want)
+        }
+    }
+}
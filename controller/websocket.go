@@ -0,0 +1,403 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "crypto/sha1"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    // wsBufferSize is the number of events a WebSocket client may fall
+    // behind by before it is disconnected.
+    wsBufferSize = 1024
+    // wsPingInterval is how often the server pings an idle client, and
+    // wsPongWait how long it waits for any frame before giving up on it.
+    wsPingInterval = 30 * time.Second
+    wsPongWait     = 2 * wsPingInterval
+    // wsWriteTimeout bounds writing one frame.
+    wsWriteTimeout = 10 * time.Second
+    // wsCloseWait bounds waiting for the client to answer a close frame.
+    wsCloseWait = time.Second
+    // wsMaxFrameSize bounds the frames accepted from clients, which have
+    // nothing to send but control frames.
+    wsMaxFrameSize = 64 << 10
+    // wsGUID is appended to the client's key to compute the handshake
+    // answer, as RFC 6455 requires.
+    wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// WebSocket opcodes and close codes from RFC 6455.
+const (
+    wsText  = 0x1
+    wsClose = 0x8
+    wsPing  = 0x9
+    wsPong  = 0xa
+
+    wsCloseNormal        = 1000
+    wsCloseGoingAway     = 1001
+    wsCloseProtocolError = 1002
+    wsClosePolicy        = 1008
+    wsCloseTooBig        = 1009
+)
+
+// StateMessage is a message sent to /cache-state/ws clients. The first is
+// a "snapshot" listing the live entries in Entries. Every later one
+// reports a change to Key: "set", with the new Value, or "delete",
+// "evict" or "expire", with the removal reason in Reason.
+type StateMessage struct {
+    Type    string           `json:"type"`
+    Key     string           `json:"key,omitempty"`
+    Value   interface{}      `json:"value,omitempty"`
+    Reason  string           `json:"reason,omitempty"`
+    Entries []CacheEntryView `json:"entries,omitempty"`
+    Time    time.Time        `json:"time"`
+}
+
+// stateMessage converts an event to the message sent for it.
+func stateMessage(event Event) StateMessage {
+    return StateMessage{Type: event.Type, Key: event.Key, Value: event.Value, Reason: event.Reason, Time: event.Time}
+}
+
+// wsHub tracks the open WebSocket connections, which the HTTP server stops
+// tracking once they are upgraded, so they can be closed on shutdown.
+type wsHub struct {
+    mutex  sync.Mutex
+    conns  map[*wsConn]struct{}
+    closed bool
+}
+
+func newWSHub() *wsHub {
+    return &wsHub{conns: make(map[*wsConn]struct{})}
+}
+
+// add registers conn, reporting false once the hub is closed.
+func (h *wsHub) add(conn *wsConn) bool {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    if h.closed {
+        return false
+    }
+    h.conns[conn] = struct{}{}
+    return true
+}
+
+func (h *wsHub) remove(conn *wsConn) {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    delete(h.conns, conn)
+}
+
+// close tells every connection the server is going away and refuses new
+// ones. It does not wait for the connections to finish closing.
+func (h *wsHub) close() {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    h.closed = true
+    for conn := range h.conns {
+        conn.shutdown()
+    }
+}
+
+// stateStreamHandler serves GET /cache-state/ws, upgrading to a WebSocket
+// that receives a snapshot of the live entries, then a message for every
+// change, optionally only for keys starting with the prefix query
+// parameter. A client that falls wsBufferSize messages behind is
+// disconnected rather than slowing down writers.
+func stateStreamHandler(cache *LRUCache, hub *wsHub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        // A failed upgrade has already been answered.
+        conn, err := upgradeWebSocket(c)
+        if err != nil {
+            return
+        }
+        defer conn.conn.Close()
+        if !hub.add(conn) {
+            conn.close(wsCloseGoingAway, "server shutting down")
+            return
+        }
+        defer hub.remove(conn)
+
+        // Events are watched before the snapshot is taken so no change is
+        // missed; one made in between is in both.
+        prefix := c.Query("prefix")
+        sub, _ := cache.subscribe(prefix, wsBufferSize, true)
+        defer cache.unsubscribe(sub)
+        snapshot := StateMessage{Type: "snapshot", Entries: cache.SnapshotPrefix(prefix), Time: time.Now()}
+        if err := conn.writeJSON(snapshot); err != nil {
+            return
+        }
+        go conn.readLoop()
+        conn.stream(sub.events)
+    }
+}
+
+// wsConn is a server-side WebSocket connection. Frames are written under
+// mutex, so the reading goroutine can answer pings.
+type wsConn struct {
+    conn net.Conn
+    r    *bufio.Reader
+
+    mutex sync.Mutex
+    w     *bufio.Writer
+
+    // ctx is cancelled once the connection is closing, for any reason,
+    // and readDone closed when the read loop has exited.
+    ctx      context.Context
+    cancel   context.CancelFunc
+    readDone chan struct{}
+    // closeCode is the code to close with when ctx was cancelled by
+    // shutdown rather than by the client or an error.
+    closeCode int
+}
+
+// upgradeWebSocket checks the handshake request, takes over the connection
+// and answers with 101 Switching Protocols. Bad requests are answered
+// with an error status.
+func upgradeWebSocket(c *gin.Context) (*wsConn, error) {
+    header := c.Request.Header
+    key := header.Get("Sec-WebSocket-Key")
+    if !headerContains(header, "Connection", "upgrade") || !headerContains(header, "Upgrade", "websocket") || key == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "WebSocket handshake required"})
+        return nil, errors.New("not a WebSocket handshake")
+    }
+    if header.Get("Sec-WebSocket-Version") != "13" {
+        c.Header("Sec-WebSocket-Version", "13")
+        c.JSON(http.StatusUpgradeRequired, gin.H{"error": "unsupported WebSocket version"})
+        return nil, errors.New("unsupported WebSocket version")
+    }
+
+    // Record the status for the middleware; the response itself is
+    // written directly to the connection.
+    c.Writer.WriteHeader(http.StatusSwitchingProtocols)
+    conn, rw, err := c.Writer.Hijack()
+    if err != nil {
+        return nil, err
+    }
+    sum := sha1.Sum([]byte(key + wsGUID))
+    fmt.Fprintf(rw.Writer, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+    conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+    if err := rw.Writer.Flush(); err != nil {
+        conn.Close()
+        return nil, err
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    return &wsConn{conn: conn, r: rw.Reader, w: rw.Writer, ctx: ctx, cancel: cancel, readDone: make(chan struct{})}, nil
+}
+
+// headerContains reports whether the comma-separated header name contains
+// token, ignoring case.
+func headerContains(header http.Header, name, token string) bool {
+    for _, value := range header.Values(name) {
+        for _, field := range strings.Split(value, ",") {
+            if strings.EqualFold(strings.TrimSpace(field), token) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// stream sends events until the connection closes, pinging the client
+// while idle, and then completes the close handshake.
+func (ws *wsConn) stream(events <-chan Event) {
+    ticker := time.NewTicker(wsPingInterval)
+    defer ticker.Stop()
+
+    code, reason := wsCloseNormal, ""
+loop:
+    for {
+        select {
+        case event, ok := <-events:
+            if !ok {
+                if ws.ctx.Err() == nil {
+                    code, reason = wsClosePolicy, "client fell too far behind"
+                }
+                break loop
+            }
+            if err := ws.writeJSON(stateMessage(event)); err != nil {
+                break loop
+            }
+        case <-ticker.C:
+            if err := ws.writeFrame(wsPing, nil); err != nil {
+                break loop
+            }
+        case <-ws.ctx.Done():
+            break loop
+        }
+    }
+
+    ws.mutex.Lock()
+    if ws.closeCode != 0 {
+        code, reason = ws.closeCode, "server shutting down"
+    }
+    ws.mutex.Unlock()
+    ws.close(code, reason)
+}
+
+// close sends a close frame, unless one was already sent, and waits
+// briefly for the client to answer before the connection is dropped.
+func (ws *wsConn) close(code int, reason string) {
+    payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+    ws.writeFrame(wsClose, append(payload, reason...))
+    ws.cancel()
+    select {
+    case <-ws.readDone:
+    case <-time.After(wsCloseWait):
+    }
+}
+
+// shutdown makes the connection close with 1001 Going Away.
+func (ws *wsConn) shutdown() {
+    ws.mutex.Lock()
+    ws.closeCode = wsCloseGoingAway
+    ws.mutex.Unlock()
+    ws.cancel()
+}
+
+// readLoop handles frames from the client until it closes the connection
+// or sends something invalid. Pings are answered; data frames are
+// ignored.
+func (ws *wsConn) readLoop() {
+    defer close(ws.readDone)
+    defer ws.cancel()
+
+    for {
+        ws.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+        opcode, payload, err := ws.readFrame()
+        var protocolErr wsProtocolError
+        switch {
+        case errors.As(err, &protocolErr):
+            ws.writeFrame(wsClose, binary.BigEndian.AppendUint16(nil, uint16(protocolErr.code)))
+            return
+        case err != nil:
+            return
+        }
+        switch opcode {
+        case wsPing:
+            ws.writeFrame(wsPong, payload)
+        case wsClose:
+            // Echo the client's code, as RFC 6455 asks, unless this
+            // answers the server's own close frame.
+            if len(payload) > 2 {
+                payload = payload[:2]
+            }
+            ws.writeFrame(wsClose, payload)
+            return
+        }
+    }
+}
+
+// wsProtocolError is a frame the client should not have sent, to be
+// answered with a close frame carrying code.
+type wsProtocolError struct {
+    code int
+}
+
+func (e wsProtocolError) Error() string {
+    return fmt.Sprintf("WebSocket protocol error %d", e.code)
+}
+
+// readFrame reads one frame from the client and returns its opcode and
+// unmasked payload. Fragmented messages are returned a fragment at a
+// time, which is enough to skip them.
+func (ws *wsConn) readFrame() (opcode byte, payload []byte, err error) {
+    var header [2]byte
+    if _, err := io.ReadFull(ws.r, header[:]); err != nil {
+        return 0, nil, err
+    }
+    opcode = header[0] & 0x0f
+    masked := header[1]&0x80 != 0
+    size := uint64(header[1] & 0x7f)
+    switch size {
+    case 126:
+        var ext [2]byte
+        if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+            return 0, nil, err
+        }
+        size = uint64(binary.BigEndian.Uint16(ext[:]))
+    case 127:
+        var ext [8]byte
+        if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+            return 0, nil, err
+        }
+        size = binary.BigEndian.Uint64(ext[:])
+    }
+
+    control := opcode&0x8 != 0
+    switch {
+    case !masked, header[0]&0x70 != 0:
+        // Clients must mask their frames and no extension was agreed.
+        return 0, nil, wsProtocolError{wsCloseProtocolError}
+    case control && (size > 125 || header[0]&0x80 == 0):
+        return 0, nil, wsProtocolError{wsCloseProtocolError}
+    case size > wsMaxFrameSize:
+        return 0, nil, wsProtocolError{wsCloseTooBig}
+    }
+
+    var mask [4]byte
+    if _, err := io.ReadFull(ws.r, mask[:]); err != nil {
+        return 0, nil, err
+    }
+    payload = make([]byte, size)
+    if _, err := io.ReadFull(ws.r, payload); err != nil {
+        return 0, nil, err
+    }
+    for i := range payload {
+        payload[i] ^= mask[i%4]
+    }
+    return opcode, payload, nil
+}
+
+// writeJSON sends v as a text message.
+func (ws *wsConn) writeJSON(v interface{}) error {
+    data, err := json.Marshal(v)
+    if err != nil {
+        return err
+    }
+    return ws.writeFrame(wsText, data)
+}
+
+// writeFrame sends an unfragmented, unmasked frame. It fails once a close
+// frame has been sent, since nothing may follow it.
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+    ws.mutex.Lock()
+    defer ws.mutex.Unlock()
+
+    if ws.w == nil {
+        return net.ErrClosed
+    }
+    header := []byte{0x80 | opcode}
+    switch size := len(payload); {
+    case size < 126:
+        header = append(header, byte(size))
+    case size <= 0xffff:
+        header = binary.BigEndian.AppendUint16(append(header, 126), uint16(size))
+    default:
+        header = binary.BigEndian.AppendUint64(append(header, 127), uint64(size))
+    }
+    ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+    ws.w.Write(header)
+    ws.w.Write(payload)
+    err := ws.w.Flush()
+    if opcode == wsClose {
+        ws.w = nil
+    }
+    return err
+}
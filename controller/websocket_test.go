@@ -0,0 +1,297 @@
+package main
+
+import (
+    "bufio"
+    "crypto/sha1"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/json"
+    "io"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// wsClient is a minimal WebSocket client for the tests, speaking just
+// enough of RFC 6455 to read unfragmented server frames.
+type wsClient struct {
+    t    *testing.T
+    conn net.Conn
+    r    *bufio.Reader
+}
+
+// startStateStream serves /cache-state/ws for cache and returns the
+// server's URL and the hub tracking its connections.
+func startStateStream(t *testing.T, cache *LRUCache) (string, *wsHub) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    hub := newWSHub()
+    router := gin.New()
+    router.GET("/cache-state/ws", stateStreamHandler(cache, hub))
+    server := httptest.NewServer(router)
+    t.Cleanup(func() {
+        hub.close()
+        server.Close()
+    })
+    return server.URL, hub
+}
+
+// dialWebSocket opens a WebSocket to path on the server at serverURL and
+// checks the handshake answer.
+func dialWebSocket(t *testing.T, serverURL, path string) *wsClient {
+    t.Helper()
+    conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+    const key = "dGhlIHNhbXBsZSBub25jZQ=="
+    req, _ := http.NewRequest(http.MethodGet, serverURL+path, nil)
+    req.Header.Set("Connection", "Upgrade")
+    req.Header.Set("Upgrade", "websocket")
+    req.Header.Set("Sec-WebSocket-Key", key)
+    req.Header.Set("Sec-WebSocket-Version", "13")
+    if err := req.Write(conn); err != nil {
+        t.Fatal(err)
+    }
+    r := bufio.NewReader(conn)
+    resp, err := http.ReadResponse(r, req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    sum := sha1.Sum([]byte(key + wsGUID))
+    if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+        t.Fatalf("handshake answered %s with accept %q", resp.Status, resp.Header.Get("Sec-WebSocket-Accept"))
+    }
+    return &wsClient{t: t, conn: conn, r: r}
+}
+
+// readFrame reads one frame, which the server never masks or fragments.
+func (c *wsClient) readFrame() (opcode byte, payload []byte) {
+    c.t.Helper()
+    var header [2]byte
+    if _, err := io.ReadFull(c.r, header[:]); err != nil {
+        c.t.Fatal(err)
+    }
+    if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+        c.t.Fatalf("server sent a fragmented or masked frame: % x", header)
+    }
+    size := uint64(header[1])
+    switch size {
+    case 126:
+        var ext [2]byte
+        io.ReadFull(c.r, ext[:])
+        size = uint64(binary.BigEndian.Uint16(ext[:]))
+    case 127:
+        var ext [8]byte
+        io.ReadFull(c.r, ext[:])
+        size = binary.BigEndian.Uint64(ext[:])
+    }
+    payload = make([]byte, size)
+    if _, err := io.ReadFull(c.r, payload); err != nil {
+        c.t.Fatal(err)
+    }
+    return header[0] & 0x0f, payload
+}
+
+// message reads the next frame, which must be a text message, and decodes
+// it.
+func (c *wsClient) message() StateMessage {
+    c.t.Helper()
+    opcode, payload := c.readFrame()
+    if opcode != wsText {
+        c.t.Fatalf("got opcode %#x (% x), want a text message", opcode, payload)
+    }
+    var message StateMessage
+    if err := json.Unmarshal(payload, &message); err != nil {
+        c.t.Fatal(err)
+    }
+    return message
+}
+
+// closeCode reads frames until a close frame, skipping messages, and
+// returns its status code.
+func (c *wsClient) closeCode() int {
+    c.t.Helper()
+    for {
+        opcode, payload := c.readFrame()
+        if opcode == wsClose {
+            if len(payload) < 2 {
+                c.t.Fatalf("close frame without a code: % x", payload)
+            }
+            return int(binary.BigEndian.Uint16(payload))
+        }
+    }
+}
+
+// writeFrame sends a frame, masked unless unmasked is set.
+func (c *wsClient) writeFrame(opcode byte, payload []byte, unmasked bool) {
+    c.t.Helper()
+    frame := []byte{0x80 | opcode, byte(len(payload))}
+    if !unmasked {
+        mask := []byte{1, 2, 3, 4}
+        frame[1] |= 0x80
+        frame = append(frame, mask...)
+        for i, b := range payload {
+            frame = append(frame, b^mask[i%4])
+        }
+    } else {
+        frame = append(frame, payload...)
+    }
+    if _, err := c.conn.Write(frame); err != nil {
+        c.t.Fatal(err)
+    }
+}
+
+// subscribers returns the number of subscribers registered with cache.
+func subscribers(cache *LRUCache) int {
+    cache.mutex.RLock()
+    defer cache.mutex.RUnlock()
+    return len(cache.subscribers)
+}
+
+func TestStateStreamSnapshotThenEvents(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(3, WithClock(clock.Now))
+    cache.Set("user:1", "a", 0)
+    cache.Set("other", "x", 0)
+    url, _ := startStateStream(t, cache)
+    c := dialWebSocket(t, url, "/cache-state/ws?prefix=user:")
+
+    snapshot := c.message()
+    if snapshot.Type != "snapshot" || strings.Join(viewKeys(snapshot.Entries), " ") != "user:1" {
+        t.Fatalf("first message = %+v, want a snapshot of user:1", snapshot)
+    }
+
+    cache.Set("user:2", "b", 0)
+    cache.Delete("user:1")
+    cache.Set("user:3", "c", 0)
+    cache.Set("user:4", "d", 0) // evicts other, which is filtered out
+    cache.Set("user:5", "e", 0) // evicts user:2
+    cache.Set("user:6", "f", time.Second)
+    clock.Advance(2 * time.Second)
+    cache.Get("user:6")
+
+    var got []string
+    for i := 0; i < 9; i++ {
+        message := c.message()
+        got = append(got, strings.TrimSpace(message.Type+" "+message.Key+" "+message.Reason))
+        if message.Type == "set" && message.Value == nil {
+            t.Errorf("set message without a value: %+v", message)
+        }
+    }
+    want := "set user:2, delete user:1 deleted, set user:3, set user:4, set user:5, evict user:2 capacity, set user:6, evict user:3 capacity, expire user:6 expired"
+    if strings.Join(got, ", ") != want {
+        t.Fatalf("messages:\n%s\nwant:\n%s", strings.Join(got, ", "), want)
+    }
+}
+
+func TestStateStreamPingAndClientClose(t *testing.T) {
+    cache := NewLRUCache(10)
+    url, _ := startStateStream(t, cache)
+    c := dialWebSocket(t, url, "/cache-state/ws")
+    c.message()
+
+    c.writeFrame(wsPing, []byte("hello"), false)
+    if opcode, payload := c.readFrame(); opcode != wsPong || string(payload) != "hello" {
+        t.Fatalf("answer to a ping = %#x %q, want a pong echoing it", opcode, payload)
+    }
+
+    c.writeFrame(wsClose, binary.BigEndian.AppendUint16(nil, wsCloseNormal), false)
+    if code := c.closeCode(); code != wsCloseNormal {
+        t.Fatalf("close answered with %d, want %d", code, wsCloseNormal)
+    }
+    waitUntil(t, "the subscriber to be removed", func() bool { return subscribers(cache) == 0 })
+}
+
+func TestStateStreamShutdown(t *testing.T) {
+    cache := NewLRUCache(10)
+    url, hub := startStateStream(t, cache)
+    c := dialWebSocket(t, url, "/cache-state/ws")
+    c.message()
+    waitUntil(t, "the connection to be tracked", func() bool {
+        hub.mutex.Lock()
+        defer hub.mutex.Unlock()
+        return len(hub.conns) == 1
+    })
+
+    hub.close()
+    if code := c.closeCode(); code != wsCloseGoingAway {
+        t.Fatalf("closed with %d on shutdown, want %d", code, wsCloseGoingAway)
+    }
+    waitUntil(t, "the subscriber to be removed", func() bool { return subscribers(cache) == 0 })
+
+    // Connections after shutdown are closed at once.
+    c = dialWebSocket(t, url, "/cache-state/ws")
+    if code := c.closeCode(); code != wsCloseGoingAway {
+        t.Fatalf("closed with %d after shutdown, want %d", code, wsCloseGoingAway)
+    }
+}
+
+func TestStateStreamDisconnectsSlowClient(t *testing.T) {
+    cache := NewLRUCache(10)
+    url, _ := startStateStream(t, cache)
+    c := dialWebSocket(t, url, "/cache-state/ws")
+    c.message()
+
+    // Without reading, the socket buffers fill, the server's writes block
+    // and its event buffer overflows. The writes go on regardless.
+    value := strings.Repeat("x", 16<<10)
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        for i := 0; i < 4*wsBufferSize; i++ {
+            cache.Set("k", value, 0)
+        }
+    }()
+    select {
+    case <-done:
+    case <-time.After(5 * time.Second):
+        t.Fatal("a slow client held up writes")
+    }
+    if code := c.closeCode(); code != wsClosePolicy {
+        t.Fatalf("slow client closed with %d, want %d", code, wsClosePolicy)
+    }
+}
+
+func TestStateStreamProtocolErrors(t *testing.T) {
+    cache := NewLRUCache(10)
+    url, _ := startStateStream(t, cache)
+
+    c := dialWebSocket(t, url, "/cache-state/ws")
+    c.message()
+    c.writeFrame(wsPing, nil, true)
+    if code := c.closeCode(); code != wsCloseProtocolError {
+        t.Fatalf("unmasked frame closed with %d, want %d", code, wsCloseProtocolError)
+    }
+
+    resp, err := http.Get(url + "/cache-state/ws")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadRequest {
+        t.Fatalf("plain GET = %d, want 400", resp.StatusCode)
+    }
+
+    req, _ := http.NewRequest(http.MethodGet, url+"/cache-state/ws", nil)
+    req.Header.Set("Connection", "Upgrade")
+    req.Header.Set("Upgrade", "websocket")
+    req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+    req.Header.Set("Sec-WebSocket-Version", "8")
+    resp, err = http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Sec-WebSocket-Version") != "13" {
+        t.Fatalf("old version = %d, %q; want 426 asking for 13", resp.StatusCode, resp.Header.Get("Sec-WebSocket-Version"))
+    }
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+    "sync/atomic"
+    "time"
+)
+
+const (
+    // windowBuckets is the number of one-second buckets kept, bounding
+    // StatsWindow to five minutes.
+    windowBuckets = 300
+    // maxStatsWindow is the longest window StatsWindow covers.
+    maxStatsWindow = windowBuckets * time.Second
+)
+
+// windowBucket counts lookups and evictions during the second, in Unix
+// time, it holds.
+type windowBucket struct {
+    second    atomic.Int64
+    hits      atomic.Uint64
+    misses    atomic.Uint64
+    evictions atomic.Uint64
+}
+
+// rollingWindow counts hits, misses and evictions over the last
+// windowBuckets seconds in a circular buffer of one-second buckets. A
+// bucket is claimed for the current second by the first operation in it,
+// which zeroes the counts left from windowBuckets seconds earlier;
+// operations racing with that claim may be lost, which is acceptable for
+// statistics. Recording is otherwise a few atomic operations.
+type rollingWindow struct {
+    buckets [windowBuckets]windowBucket
+
+    // now returns the current time, the owning cache's clock.
+    now func() time.Time
+}
+
+// bucket returns the bucket for the current second.
+func (w *rollingWindow) bucket() *windowBucket {
+    now := w.now().Unix()
+    b := &w.buckets[now%windowBuckets]
+    if old := b.second.Load(); old != now && b.second.CompareAndSwap(old, now) {
+        b.hits.Store(0)
+        b.misses.Store(0)
+        b.evictions.Store(0)
+    }
+    return b
+}
+
+func (w *rollingWindow) hit() {
+    w.bucket().hits.Add(1)
+}
+
+func (w *rollingWindow) miss() {
+    w.bucket().misses.Add(1)
+}
+
+func (w *rollingWindow) evict() {
+    w.bucket().evictions.Add(1)
+}
+
+// totals sums the buckets of the last d, rounded up to whole seconds and
+// at most maxStatsWindow.
+func (w *rollingWindow) totals(d time.Duration) (hits, misses, evictions uint64) {
+    seconds := int64(min(d, maxStatsWindow)+time.Second-1) / int64(time.Second)
+    oldest := w.now().Unix() - seconds
+    for i := range w.buckets {
+        b := &w.buckets[i]
+        if b.second.Load() > oldest {
+            hits += b.hits.Load()
+            misses += b.misses.Load()
+            evictions += b.evictions.Load()
+        }
+    }
+    return hits, misses, evictions
+}
+
+// reset zeroes every bucket.
+func (w *rollingWindow) reset() {
+    for i := range w.buckets {
+        w.buckets[i].second.Store(0)
+        w.buckets[i].hits.Store(0)
+        w.buckets[i].misses.Store(0)
+        w.buckets[i].evictions.Store(0)
+    }
+}
+
+// WindowStats summarizes lookups and capacity evictions over a recent time
+// window. HitRatio is the hit rate, zero when there were no lookups.
+type WindowStats struct {
+    WindowSeconds int     `json:"window_seconds"`
+    Hits          uint64  `json:"hits"`
+    Misses        uint64  `json:"misses"`
+    HitRatio      float64 `json:"hit_ratio"`
+    Evictions     uint64  `json:"evictions"`
+}
+
+// StatsWindow returns the hits, misses and capacity evictions of the last
+// d, counted per second. Windows longer than five minutes are cut to five
+// minutes.
+func (c *LRUCache) StatsWindow(d time.Duration) WindowStats {
+    d = min(d, maxStatsWindow)
+    hits, misses, evictions := c.recent.totals(d)
+    stats := WindowStats{
+        WindowSeconds: int((d + time.Second - 1) / time.Second),
+        Hits:          hits,
+        Misses:        misses,
+        Evictions:     evictions,
+    }
+    if total := hits + misses; total > 0 {
+        stats.HitRatio = float64(hits) / float64(total)
+    }
+    return stats
+}
+
+// RecentStats returns the statistics of the last five minutes.
+func (c *LRUCache) RecentStats() WindowStats {
+    return c.StatsWindow(maxStatsWindow)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// newWindow returns an empty rollingWindow reading time from clock.
+func newWindow(clock *fakeClock) *rollingWindow {
+    return &rollingWindow{now: clock.Now}
+}
+
+// record counts hits hits and misses misses in w.
+func record(w *rollingWindow, hits, misses int) {
+    for i := 0; i < hits; i++ {
+        w.hit()
+    }
+    for i := 0; i < misses; i++ {
+        w.miss()
+    }
+}
+
+func TestRollingWindowRotation(t *testing.T) {
+    clock := newFakeClock()
+    w := newWindow(clock)
+
+    record(w, 3, 1)
+    clock.Advance(10 * time.Second)
+    record(w, 2, 2)
+    w.evict()
+
+    for _, tc := range []struct {
+        window                  time.Duration
+        hits, misses, evictions uint64
+    }{
+        {time.Second, 2, 2, 1},
+        {10 * time.Second, 2, 2, 1},
+        {11 * time.Second, 5, 3, 1},
+        {time.Hour, 5, 3, 1},
+    } {
+        hits, misses, evictions := w.totals(tc.window)
+        if hits != tc.hits || misses != tc.misses || evictions != tc.evictions {
+            t.Errorf("totals(%v) = %d, %d, %d; want %d, %d, %d", tc.window, hits, misses, evictions, tc.hits, tc.misses, tc.evictions)
+        }
+    }
+
+    // Once the first second falls out of the window its counts are gone,
+    // even before its bucket is reused.
+    clock.Advance(maxStatsWindow - 10*time.Second)
+    if hits, misses, _ := w.totals(maxStatsWindow); hits != 2 || misses != 2 {
+        t.Fatalf("totals = %d hits, %d misses after the first second left the window", hits, misses)
+    }
+
+    // Reusing a bucket for a new second drops the counts it held.
+    clock.Advance(10 * time.Second)
+    w.hit()
+    b := &w.buckets[clock.Now().Unix()%windowBuckets]
+    if b.hits.Load() != 1 || b.misses.Load() != 0 || b.evictions.Load() != 0 {
+        t.Fatalf("reused bucket holds %d hits, %d misses, %d evictions", b.hits.Load(), b.misses.Load(), b.evictions.Load())
+    }
+    if hits, misses, evictions := w.totals(maxStatsWindow); hits != 1 || misses != 0 || evictions != 0 {
+        t.Fatalf("totals = %d, %d, %d after a full rotation", hits, misses, evictions)
+    }
+}
+
+func TestStatsWindowRatio(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    cache.Set("k", 1, 0)
+
+    if stats := cache.StatsWindow(time.Minute); stats.HitRatio != 0 || stats.Hits+stats.Misses != 0 {
+        t.Fatalf("StatsWindow = %+v with no lookups", stats)
+    }
+    for i := 0; i < 3; i++ {
+        cache.Get("k")
+    }
+    cache.Get("missing")
+    clock.Advance(30 * time.Second)
+    cache.Get("missing")
+    cache.Get("missing")
+    cache.Get("missing")
+    cache.Get("k")
+
+    for _, tc := range []struct {
+        window time.Duration
+        want   WindowStats
+    }{
+        {10 * time.Second, WindowStats{WindowSeconds: 10, Hits: 1, Misses: 3, HitRatio: 0.25}},
+        {time.Minute, WindowStats{WindowSeconds: 60, Hits: 4, Misses: 4, HitRatio: 0.5}},
+        {time.Hour, WindowStats{WindowSeconds: 300, Hits: 4, Misses: 4, HitRatio: 0.5}},
+    } {
+        if stats := cache.StatsWindow(tc.window); stats != tc.want {
+            t.Errorf("StatsWindow(%v) = %+v, want %+v", tc.window, stats, tc.want)
+        }
+    }
+}
+
+func TestResetStatsClearsWindow(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    cache.Get("missing")
+    clock.Advance(time.Minute)
+
+    cache.ResetStats()
+    if stats := cache.RecentStats(); stats.Misses != 0 || cache.Stats().Misses != 0 {
+        t.Fatalf("RecentStats = %+v, Stats = %+v after a reset", stats, cache.Stats())
+    }
+    if at := cache.StatsResetAt(); !at.Equal(clock.Now()) {
+        t.Fatalf("StatsResetAt = %v, want %v", at, clock.Now())
+    }
+}
+
+func TestStatsWindowEvictions(t *testing.T) {
+    clock := newFakeClock()
+    cache := NewLRUCache(1, WithClock(clock.Now))
+    cache.Set("a", 1, 0)
+    cache.Set("b", 2, 0)
+    clock.Advance(20 * time.Second)
+    cache.Set("c", 3, 0)
+    // Deleting and expiring are not evictions.
+    cache.Delete("c")
+    cache.Set("d", 4, time.Second)
+    clock.Advance(2 * time.Second)
+    cache.Get("d")
+
+    if stats := cache.StatsWindow(10 * time.Second); stats.Evictions != 1 {
+        t.Fatalf("StatsWindow(10s).Evictions = %d, want 1", stats.Evictions)
+    }
+    if stats := cache.StatsWindow(time.Minute); stats.Evictions != 2 {
+        t.Fatalf("StatsWindow(1m).Evictions = %d, want 2", stats.Evictions)
+    }
+}
+
+func TestStatsHandlerWindow(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    clock := newFakeClock()
+    cache := NewLRUCache(10, WithClock(clock.Now))
+    cache.Set("k", 1, 0)
+    cache.Get("missing")
+    clock.Advance(time.Minute)
+    cache.Get("k")
+    router := gin.New()
+    router.GET("/stats", statsHandler(cache))
+
+    for _, tc := range []struct {
+        query  string
+        status int
+        want   *WindowStats
+    }{
+        {"", http.StatusOK, nil},
+        {"?window=30", http.StatusOK, &WindowStats{WindowSeconds: 30, Hits: 1, HitRatio: 1}},
+        {"?window=300", http.StatusOK, &WindowStats{WindowSeconds: 300, Hits: 1, Misses: 1, HitRatio: 0.5}},
+        {"?window=0", http.StatusBadRequest, nil},
+        {"?window=301", http.StatusBadRequest, nil},
+        {"?window=5m", http.StatusBadRequest, nil},
+    } {
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats"+tc.query, nil))
+        if rec.Code != tc.status {
+            t.Fatalf("GET /stats%s = %d, want %d", tc.query, rec.Code, tc.status)
+        }
+        if tc.status != http.StatusOK {
+            continue
+        }
+        var body struct {
+            Window *WindowStats `json:"window"`
+        }
+        if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+            t.Fatal(err)
+        }
+        if (body.Window == nil) != (tc.want == nil) || (tc.want != nil && *body.Window != *tc.want) {
+            t.Fatalf("GET /stats%s window = %+v, want %+v", tc.query, body.Window, tc.want)
+        }
+    }
+}
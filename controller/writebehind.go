@@ -0,0 +1,393 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "hash/fnv"
+    "io"
+    "log/slog"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Write-behind defaults, used for the zero values of WriteBehindConfig.
+const (
+    defaultWriteBehindWorkers     = 4
+    defaultWriteBehindQueueSize   = 10000
+    defaultWriteBehindMaxAttempts = 5
+    defaultWriteBehindRetryDelay  = 100 * time.Millisecond
+    defaultWriteBehindMaxDelay    = 10 * time.Second
+    httpBackendTimeout            = 10 * time.Second
+)
+
+// Backend is a store the cache persists its writes to; see
+// StartWriteBehind. Store writes key's value, which expires at expiration
+// unless it is zero, and Delete removes key, succeeding if it is absent.
+type Backend interface {
+    Store(ctx context.Context, key string, value interface{}, expiration time.Time) error
+    Delete(ctx context.Context, key string) error
+}
+
+// WriteBehindOverflow is what a write does when the write-behind queue is
+// full.
+type WriteBehindOverflow int
+
+const (
+    // OverflowBlock makes the write wait for room. It waits before taking
+    // the cache's lock, so only writers are held up.
+    OverflowBlock WriteBehindOverflow = iota
+    // OverflowReject fails the write with ErrWriteBehindFull, leaving the
+    // cache unchanged.
+    OverflowReject
+)
+
+// ParseWriteBehindOverflow parses the name of an overflow policy: "block"
+// or "reject".
+func ParseWriteBehindOverflow(s string) (WriteBehindOverflow, error) {
+    switch strings.ToLower(s) {
+    case "block":
+        return OverflowBlock, nil
+    case "reject":
+        return OverflowReject, nil
+    }
+    return 0, fmt.Errorf("unknown write-behind overflow policy %q", s)
+}
+
+func (o WriteBehindOverflow) String() string {
+    if o == OverflowReject {
+        return "reject"
+    }
+    return "block"
+}
+
+// WriteBehindConfig configures StartWriteBehind.
+type WriteBehindConfig struct {
+    // Workers is the number of goroutines calling the backend. Default 4.
+    Workers int
+    // QueueSize bounds the keys waiting to be written. Default 10000.
+    // Writes are admitted one at a time but may write several keys, as
+    // SetMany and transactions do, so the queue can briefly exceed it.
+    QueueSize int
+    // Overflow is what writes do when the queue is full.
+    Overflow WriteBehindOverflow
+    // MaxAttempts bounds the attempts at each backend call, waiting
+    // RetryDelay before the first retry and doubling the wait after each
+    // one, up to MaxDelay. A call that fails every attempt is dropped.
+    // Defaults 5, 100ms and 10s.
+    MaxAttempts int
+    RetryDelay  time.Duration
+    MaxDelay    time.Duration
+}
+
+// WriteBehindStats are the counters of the write-behind queue. Depth is
+// the number of keys waiting to be written, Coalesced the writes replaced
+// by a later write of the same key before reaching the backend, Written
+// the backend calls that succeeded, Failed those that failed every attempt
+// and Rejected the cache writes refused because the queue was full.
+type WriteBehindStats struct {
+    Depth     int    `json:"queue_depth"`
+    Capacity  int    `json:"queue_capacity"`
+    Coalesced uint64 `json:"coalesced"`
+    Written   uint64 `json:"written"`
+    Failed    uint64 `json:"failed"`
+    Rejected  uint64 `json:"rejected"`
+}
+
+// writeOp is a write waiting for the backend: a store, or a delete if
+// deleted is set.
+type writeOp struct {
+    key        string
+    value      interface{}
+    expiration time.Time
+    deleted    bool
+}
+
+// writeBehind queues the cache's writes for a backend. Only the latest
+// write of each key is kept: pending maps the keys waiting to their write,
+// and each key sits once in the queue of the worker it hashes to, so the
+// writes of a key reach the backend in order.
+type writeBehind struct {
+    backend Backend
+    config  WriteBehindConfig
+
+    mutex   sync.Mutex
+    cond    *sync.Cond
+    pending map[string]writeOp
+    queues  [][]string
+    closed  bool
+
+    coalesced atomic.Uint64
+    written   atomic.Uint64
+    failed    atomic.Uint64
+    rejected  atomic.Uint64
+}
+
+// StartWriteBehind makes every write to the cache also write to backend,
+// asynchronously: the cache is updated and the write queued for a pool of
+// workers, which call the backend with retries. Every value stored is
+// persisted, whether by Set, SetMany, Swap, a transaction, a merge, an
+// import or a restore, and so are TTL changes and deletes, including
+// deletes of keys the cache no longer holds. Other removals, such as
+// evictions, expirations, invalidations and clears, are not. Writes to a
+// key still queued replace the queued one, so the backend only sees the
+// latest. When the queue is full, writes wait or are rejected as
+// config.Overflow says; see checkWritable.
+//
+// The returned stop function stops queueing writes, then waits for the
+// queue to drain until ctx is done, when the writes still queued are
+// abandoned and ctx's error returned.
+func (c *LRUCache) StartWriteBehind(backend Backend, config WriteBehindConfig) (stop func(ctx context.Context) error) {
+    if config.Workers <= 0 {
+        config.Workers = defaultWriteBehindWorkers
+    }
+    if config.QueueSize <= 0 {
+        config.QueueSize = defaultWriteBehindQueueSize
+    }
+    if config.MaxAttempts <= 0 {
+        config.MaxAttempts = defaultWriteBehindMaxAttempts
+    }
+    if config.RetryDelay <= 0 {
+        config.RetryDelay = defaultWriteBehindRetryDelay
+    }
+    if config.MaxDelay <= 0 {
+        config.MaxDelay = defaultWriteBehindMaxDelay
+    }
+    w := &writeBehind{
+        backend: backend,
+        config:  config,
+        pending: make(map[string]writeOp),
+        queues:  make([][]string, config.Workers),
+    }
+    w.cond = sync.NewCond(&w.mutex)
+
+    c.writeBehind.Store(w)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    var wg sync.WaitGroup
+    for i := 0; i < config.Workers; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            w.work(ctx, i)
+        }(i)
+    }
+
+    return func(drainCtx context.Context) error {
+        // Taking the lock waits out the writes queueing meanwhile.
+        c.mutex.Lock()
+        c.writeBehind.Store(nil)
+        c.unlock()
+
+        w.mutex.Lock()
+        w.closed = true
+        w.cond.Broadcast()
+        w.mutex.Unlock()
+
+        done := make(chan struct{})
+        go func() {
+            wg.Wait()
+            close(done)
+        }()
+        select {
+        case <-done:
+            cancel()
+            return nil
+        case <-drainCtx.Done():
+            slog.Warn("write-behind queue abandoned at shutdown", "writes", w.stats().Depth)
+            cancel()
+            <-done
+            return drainCtx.Err()
+        }
+    }
+}
+
+// admit waits until the queue has room for another key or, if it is
+// configured to reject, fails with ErrWriteBehindFull when it has none. A
+// write of key, if not empty, is admitted at once while key is queued, as
+// it only replaces the queued write. Writers call it, through
+// checkWritable, before taking the cache lock, which the workers never
+// need, so a slow backend cannot stall readers. A nil writeBehind admits
+// everything.
+func (w *writeBehind) admit(key string) error {
+    if w == nil {
+        return nil
+    }
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+
+    for len(w.pending) >= w.config.QueueSize && !w.closed {
+        if _, ok := w.pending[key]; ok && key != "" {
+            return nil
+        }
+        if w.config.Overflow == OverflowReject {
+            w.rejected.Add(1)
+            return ErrWriteBehindFull
+        }
+        w.cond.Wait()
+    }
+    return nil
+}
+
+// queueWrite queues op for write-behind, if it is running, replacing the
+// write already queued for its key. It never waits: room was made by
+// admit. A replica leaves persisting the writes it mirrors to its primary.
+// The caller must hold the write lock, which orders the writes of each
+// key.
+func (c *LRUCache) queueWrite(op writeOp) {
+    w := c.writeBehind.Load()
+    if w == nil || c.replica.Load() != nil {
+        return
+    }
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+
+    if _, ok := w.pending[op.key]; ok {
+        w.coalesced.Add(1)
+    } else {
+        worker := w.worker(op.key)
+        w.queues[worker] = append(w.queues[worker], op.key)
+    }
+    w.pending[op.key] = op
+    w.cond.Broadcast()
+}
+
+// worker returns the index of the worker writing key.
+func (w *writeBehind) worker(key string) int {
+    h := fnv.New32a()
+    h.Write([]byte(key))
+    return int(h.Sum32() % uint32(len(w.queues)))
+}
+
+// work writes the keys of queue i until it is empty after closing. Once
+// ctx is done the writes left are dropped, counted as failures.
+func (w *writeBehind) work(ctx context.Context, i int) {
+    for {
+        w.mutex.Lock()
+        for len(w.queues[i]) == 0 && !w.closed {
+            w.cond.Wait()
+        }
+        if len(w.queues[i]) == 0 {
+            w.mutex.Unlock()
+            return
+        }
+        key := w.queues[i][0]
+        w.queues[i] = w.queues[i][1:]
+        op := w.pending[key]
+        delete(w.pending, key)
+        w.cond.Broadcast()
+        w.mutex.Unlock()
+
+        if ctx.Err() != nil {
+            w.failed.Add(1)
+            continue
+        }
+        if err := w.write(ctx, op); err != nil {
+            w.failed.Add(1)
+            slog.Warn("write-behind write failed", "key", key, "delete", op.deleted, "error", err)
+            continue
+        }
+        w.written.Add(1)
+    }
+}
+
+// write applies op to the backend, retrying with backoff.
+func (w *writeBehind) write(ctx context.Context, op writeOp) error {
+    delay := w.config.RetryDelay
+    for attempt := 1; ; attempt++ {
+        var err error
+        if op.deleted {
+            err = w.backend.Delete(ctx, op.key)
+        } else {
+            err = w.backend.Store(ctx, op.key, op.value, op.expiration)
+        }
+        if err == nil || attempt >= w.config.MaxAttempts || ctx.Err() != nil {
+            return err
+        }
+        select {
+        case <-time.After(delay):
+        case <-ctx.Done():
+            return err
+        }
+        delay = min(2*delay, w.config.MaxDelay)
+    }
+}
+
+func (w *writeBehind) stats() WriteBehindStats {
+    w.mutex.Lock()
+    depth := len(w.pending)
+    w.mutex.Unlock()
+    return WriteBehindStats{
+        Depth:     depth,
+        Capacity:  w.config.QueueSize,
+        Coalesced: w.coalesced.Load(),
+        Written:   w.written.Load(),
+        Failed:    w.failed.Load(),
+        Rejected:  w.rejected.Load(),
+    }
+}
+
+// WriteBehindStats returns the write-behind counters, or nil if
+// StartWriteBehind is not running.
+func (c *LRUCache) WriteBehindStats() *WriteBehindStats {
+    w := c.writeBehind.Load()
+    if w == nil {
+        return nil
+    }
+    stats := w.stats()
+    return &stats
+}
+
+// HTTPBackend is a Backend storing entries on an HTTP server: Store PUTs
+// {"value": ..., "expiration": ...} to URL/key, with the expiration
+// omitted for entries that never expire, and Delete sends DELETE to the
+// same URL. Any 2xx response, and 404 for a delete, is a success.
+type HTTPBackend struct {
+    URL    string
+    Client *http.Client
+}
+
+// NewHTTPBackend returns an HTTPBackend for baseURL.
+func NewHTTPBackend(baseURL string) *HTTPBackend {
+    return &HTTPBackend{URL: strings.TrimRight(baseURL, "/"), Client: &http.Client{Timeout: httpBackendTimeout}}
+}
+
+func (b *HTTPBackend) Store(ctx context.Context, key string, value interface{}, expiration time.Time) error {
+    body, err := json.Marshal(struct {
+        Value      interface{} `json:"value"`
+        Expiration *time.Time  `json:"expiration,omitempty"`
+    }{value, expirationPtr(expiration)})
+    if err != nil {
+        return err
+    }
+    return b.do(ctx, http.MethodPut, key, body)
+}
+
+func (b *HTTPBackend) Delete(ctx context.Context, key string) error {
+    return b.do(ctx, http.MethodDelete, key, nil)
+}
+
+func (b *HTTPBackend) do(ctx context.Context, method, key string, body []byte) error {
+    req, err := http.NewRequestWithContext(ctx, method, b.URL+"/"+url.PathEscape(key), bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    resp, err := b.Client.Do(req)
+    if err != nil {
+        return err
+    }
+    io.Copy(io.Discard, resp.Body)
+    resp.Body.Close()
+    if resp.StatusCode/100 != 2 && !(method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+        return fmt.Errorf("%s %s: unexpected status %s", method, req.URL, resp.Status)
+    }
+    return nil
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// recordingBackend is a Backend keeping what it is sent in memory. If
+// release is set, Store signals started and then waits for release.
+type recordingBackend struct {
+    mutex       sync.Mutex
+    values      map[string]interface{}
+    expirations map[string]time.Time
+
+    started chan string
+    release chan struct{}
+}
+
+func newRecordingBackend() *recordingBackend {
+    return &recordingBackend{values: make(map[string]interface{}), expirations: make(map[string]time.Time)}
+}
+
+func (b *recordingBackend) Store(ctx context.Context, key string, value interface{}, expiration time.Time) error {
+    if b.release != nil {
+        b.started <- key
+        <-b.release
+    }
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    b.values[key] = value
+    b.expirations[key] = expiration
+    return nil
+}
+
+func (b *recordingBackend) Delete(ctx context.Context, key string) error {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    delete(b.values, key)
+    delete(b.expirations, key)
+    return nil
+}
+
+func (b *recordingBackend) value(key string) (interface{}, bool) {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    value, ok := b.values[key]
+    return value, ok
+}
+
+func TestWriteBehindPersistsEveryWritePath(t *testing.T) {
+    backend := newRecordingBackend()
+    backend.values["gone"] = "stale"
+    backend.values["tx-gone"] = "stale"
+    cache := NewLRUCache(100)
+
+    var snapshot bytes.Buffer
+    source := NewLRUCache(10)
+    source.Set("restored", "r", 0)
+    if err := source.SaveSnapshot(&snapshot); err != nil {
+        t.Fatal(err)
+    }
+
+    stop := cache.StartWriteBehind(backend, WriteBehindConfig{RetryDelay: time.Millisecond})
+    if err := cache.LoadSnapshot(&snapshot); err != nil {
+        t.Fatal(err)
+    }
+    cache.Set("a", 1, 0)
+    if err := cache.SetMany([]BatchEntry{{Key: "b", Value: 2}, {Key: "c", Value: 3}}); err != nil {
+        t.Fatal(err)
+    }
+    if !cache.Swap("a", "b") {
+        t.Fatal("Swap failed")
+    }
+    if touched, err := cache.TouchMany([]string{"c"}, time.Hour); err != nil || touched != 1 {
+        t.Fatalf("TouchMany = %d, %v", touched, err)
+    }
+    if err := cache.SetWithPriority("priority", "p", 0, PriorityHigh); err != nil {
+        t.Fatal(err)
+    }
+    if err := cache.SetWithDeps("deps", "d", 0, []string{"a"}); err != nil {
+        t.Fatal(err)
+    }
+    if err := cache.SetWithCallback("callback", "cb", 0, func(string, interface{}) {}); err != nil {
+        t.Fatal(err)
+    }
+
+    tx := NewTransactionalCache(cache).Begin()
+    tx.Set("tx", "t", 0)
+    tx.Delete("tx-gone")
+    if err := tx.Commit(); err != nil {
+        t.Fatal(err)
+    }
+
+    if stored, err := cache.setIf("nx", "n", 0, setIfMissing); err != nil || !stored {
+        t.Fatalf("setIf = %v, %v", stored, err)
+    }
+    cache.mutex.RLock()
+    version := cache.cache["nx"].Value.(*cacheEntry).version
+    cache.mutex.RUnlock()
+    if err := cache.compareAndSwap("nx", "cas", 0, false, version); err != nil {
+        t.Fatalf("compareAndSwap = %v", err)
+    }
+
+    other := NewLRUCache(10)
+    other.Set("merged", "m", 0)
+    cache.Merge(other, KeepNewer)
+
+    if _, err := cache.Delete("gone"); err != nil {
+        t.Fatal(err)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := stop(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    want := map[string]interface{}{
+        "restored": "r",
+        "a":        2,
+        "b":        1,
+        "c":        3,
+        "priority": "p",
+        "deps":     "d",
+        "callback": "cb",
+        "tx":       "t",
+        "nx":       "cas",
+        "merged":   "m",
+    }
+    for key, value := range want {
+        if got, ok := backend.value(key); !ok || got != value {
+            t.Errorf("backend[%q] = %v, %v; want %v", key, got, ok, value)
+        }
+    }
+    for _, key := range []string{"gone", "tx-gone"} {
+        if _, ok := backend.value(key); ok {
+            t.Errorf("backend still holds deleted key %q", key)
+        }
+    }
+    if backend.expirations["c"].IsZero() {
+        t.Error("TouchMany's TTL was not persisted")
+    }
+}
+
+// startBlockedWriteBehind starts write-behind with a one-key queue whose
+// only worker is stuck writing "first", and fills the queue with "second".
+func startBlockedWriteBehind(t *testing.T, overflow WriteBehindOverflow) (*LRUCache, *recordingBackend, func(context.Context) error) {
+    t.Helper()
+    backend := newRecordingBackend()
+    backend.started = make(chan string, 1)
+    backend.release = make(chan struct{})
+    cache := NewLRUCache(100)
+    stop := cache.StartWriteBehind(backend, WriteBehindConfig{Workers: 1, QueueSize: 1, Overflow: overflow})
+
+    if err := cache.Set("first", 1, 0); err != nil {
+        t.Fatal(err)
+    }
+    <-backend.started
+    if err := cache.Set("second", 2, 0); err != nil {
+        t.Fatal(err)
+    }
+    return cache, backend, stop
+}
+
+func TestWriteBehindBlockDoesNotStallReaders(t *testing.T) {
+    cache, backend, stop := startBlockedWriteBehind(t, OverflowBlock)
+
+    written := make(chan error)
+    go func() { written <- cache.Set("third", 3, 0) }()
+    select {
+    case err := <-written:
+        t.Fatalf("Set returned %v with the queue full", err)
+    case <-time.After(50 * time.Millisecond):
+    }
+
+    // The blocked writer must not hold the cache lock.
+    read := make(chan interface{})
+    go func() { read <- cache.Get("first") }()
+    select {
+    case value := <-read:
+        if value != 1 {
+            t.Fatalf("Get = %v, want 1", value)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("Get stalled behind a writer waiting for the write-behind queue")
+    }
+
+    go func() {
+        for range backend.started {
+        }
+    }()
+    close(backend.release)
+    select {
+    case err := <-written:
+        if err != nil {
+            t.Fatal(err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("Set still blocked after the queue drained")
+    }
+    if err := stop(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if value, ok := backend.value("third"); !ok || value != 3 {
+        t.Fatalf("backend[third] = %v, %v; want 3", value, ok)
+    }
+}
+
+func TestWriteBehindRejectsWhenFull(t *testing.T) {
+    cache, backend, stop := startBlockedWriteBehind(t, OverflowReject)
+
+    err := cache.Set("third", 3, 0)
+    if !errors.Is(err, ErrWriteBehindFull) {
+        t.Fatalf("Set = %v, want ErrWriteBehindFull", err)
+    }
+    if cache.ContainsKey("third") {
+        t.Fatal("rejected write was applied to the cache")
+    }
+    if _, err := cache.Delete("first"); !errors.Is(err, ErrWriteBehindFull) {
+        t.Fatalf("Delete = %v, want ErrWriteBehindFull", err)
+    }
+    if stats := cache.WriteBehindStats(); stats.Rejected != 2 || stats.Depth != 1 {
+        t.Fatalf("stats = %+v, want 2 rejected and 1 queued", stats)
+    }
+
+    go func() {
+        for range backend.started {
+        }
+    }()
+    close(backend.release)
+    if err := stop(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestWriteBehindCoalescesQueuedWrites(t *testing.T) {
+    cache, backend, stop := startBlockedWriteBehind(t, OverflowBlock)
+
+    // "second" is still queued, so these replace it rather than queueing.
+    for i := 3; i <= 5; i++ {
+        if err := cache.Set("second", i, 0); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if stats := cache.WriteBehindStats(); stats.Coalesced != 3 || stats.Depth != 1 {
+        t.Fatalf("stats = %+v, want 3 coalesced and 1 queued", stats)
+    }
+
+    go func() {
+        for range backend.started {
+        }
+    }()
+    close(backend.release)
+    if err := stop(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if value, _ := backend.value("second"); value != 5 {
+        t.Fatalf("backend[second] = %v, want 5", value)
+    }
+    if stats := cache.WriteBehindStats(); stats != nil {
+        t.Fatalf("WriteBehindStats after stop = %+v, want nil", stats)
+    }
+}
+
+// slowBackend is a recordingBackend that takes delay for every call and
+// fails the first failures of them.
+type slowBackend struct {
+    *recordingBackend
+    delay    time.Duration
+    failures atomic.Int32
+    calls    atomic.Int32
+}
+
+func (b *slowBackend) Store(ctx context.Context, key string, value interface{}, expiration time.Time) error {
+    select {
+    case <-time.After(b.delay):
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+    if b.calls.Add(1) <= b.failures.Load() {
+        return errors.New("backend unavailable")
+    }
+    return b.recordingBackend.Store(ctx, key, value, expiration)
+}
+
+func TestWriteBehindSlowBackendDoesNotSlowSets(t *testing.T) {
+    backend := &slowBackend{recordingBackend: newRecordingBackend(), delay: 20 * time.Millisecond}
+    cache := NewLRUCache(100)
+    stop := cache.StartWriteBehind(backend, WriteBehindConfig{Workers: 2})
+
+    start := time.Now()
+    for i := 0; i < 20; i++ {
+        if err := cache.Set(fmt.Sprint(i), i, 0); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // Writing them through would take 20 × 20ms / 2 workers.
+    if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+        t.Fatalf("20 Sets took %v with a slow backend", elapsed)
+    }
+    if stats := cache.WriteBehindStats(); stats.Depth == 0 {
+        t.Fatal("nothing queued behind the slow backend")
+    }
+
+    // /stats reports the queue.
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.GET("/stats", statsHandler(cache))
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+    var body struct {
+        WriteBehind *WriteBehindStats `json:"write_behind"`
+    }
+    if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    if body.WriteBehind == nil || body.WriteBehind.Capacity != defaultWriteBehindQueueSize {
+        t.Fatalf("/stats write_behind = %+v", body.WriteBehind)
+    }
+
+    // Stopping drains the queue.
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := stop(ctx); err != nil {
+        t.Fatal(err)
+    }
+    for i := 0; i < 20; i++ {
+        if value, ok := backend.value(fmt.Sprint(i)); !ok || value != i {
+            t.Fatalf("backend[%d] = %v, %v after draining", i, value, ok)
+        }
+    }
+}
+
+func TestWriteBehindRetriesFailures(t *testing.T) {
+    backend := &slowBackend{recordingBackend: newRecordingBackend()}
+    backend.failures.Store(2)
+    cache := NewLRUCache(100)
+    stop := cache.StartWriteBehind(backend, WriteBehindConfig{Workers: 1, MaxAttempts: 3, RetryDelay: 10 * time.Millisecond})
+
+    start := time.Now()
+    cache.Set("k", 1, 0)
+    waitUntil(t, "the write", func() bool { return cache.WriteBehindStats().Written == 1 })
+    // The retries waited 10ms, then 20ms.
+    if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+        t.Fatalf("three attempts took %v, want at least 30ms of backoff", elapsed)
+    }
+    if n := backend.calls.Load(); n != 3 {
+        t.Fatalf("backend called %d times, want 3", n)
+    }
+
+    // A write failing every attempt is dropped and counted.
+    backend.failures.Store(100)
+    cache.Set("k", 2, 0)
+    waitUntil(t, "the failure", func() bool { return cache.WriteBehindStats().Failed == 1 })
+    if n := backend.calls.Load(); n != 6 {
+        t.Fatalf("backend called %d times, want 6", n)
+    }
+    if value, _ := backend.value("k"); value != 1 {
+        t.Fatalf("backend[k] = %v, want 1", value)
+    }
+    if err := stop(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestWriteBehindStopGivesUpAtDeadline(t *testing.T) {
+    backend := &slowBackend{recordingBackend: newRecordingBackend(), delay: time.Hour}
+    cache := NewLRUCache(100)
+    stop := cache.StartWriteBehind(backend, WriteBehindConfig{Workers: 1})
+    for i := 0; i < 5; i++ {
+        cache.Set(fmt.Sprint(i), i, 0)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    if err := stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("stop = %v, want DeadlineExceeded", err)
+    }
+    if elapsed := time.Since(start); elapsed > time.Second {
+        t.Fatalf("stop took %v past its deadline", elapsed)
+    }
+    // Writes after stopping are not queued.
+    if err := cache.Set("late", 1, 0); err != nil || cache.WriteBehindStats() != nil {
+        t.Fatalf("Set after stop = %v, stats %+v", err, cache.WriteBehindStats())
+    }
+}